@@ -4,16 +4,18 @@ import (
 	"fmt"
 	"net/http"
 	"time"
+
+	"github.com/ellezio/zcm/internal/testserver"
 )
 
 func main() {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("start")
-		fmt.Println("wait 300ms")
-		time.Sleep(300 * time.Millisecond)
-		fmt.Println("end")
+	handler := testserver.NewHandler(testserver.Options{
+		Logf: func(format string, args ...interface{}) {
+			fmt.Printf(format+"\n", args...)
+		},
+		Delay: 300 * time.Millisecond,
 	})
 
 	fmt.Println("Listening at :3000")
-	http.ListenAndServe(":3000", nil)
+	http.ListenAndServe(":3000", handler)
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ellezio/zcm/internal/admin"
+	"github.com/ellezio/zcm/internal/monitoring"
+)
+
+// newAdminServer returns server of admin API, it serves TLS when TLSConfig is set
+func newAdminServer(opts adminOptions, targets *monitoring.Targets) (*http.Server, error) {
+	handlerOpts := admin.Options{
+		ClientCerts:           opts.clientCAFile != "",
+		CertScopes:            opts.clientCertScopes,
+		RequireIdempotencyKey: opts.requireIdempotencyKey,
+	}
+
+	if opts.tokenFile != "" {
+		tokens, err := admin.LoadTokens(opts.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		handlerOpts.Tokens = tokens
+	}
+
+	if opts.auditLog != "" {
+		f, err := os.OpenFile(opts.auditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("error while opening admin audit log, error: %s", err))
+		}
+		handlerOpts.Audit = f
+	}
+
+	server := &http.Server{
+		Addr:              opts.address,
+		Handler:           admin.Handler(targets, handlerOpts),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if opts.certFile != "" {
+		config, err := admin.ServerTLSConfig(opts.certFile, opts.keyFile, opts.clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = config
+	}
+
+	return server, nil
+}
+
+// listenAdmin listens at host:port or at unix socket given as unix:///path,
+// socket is accessible only to agent's user
+func listenAdmin(address string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(address, "unix://")
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+
+	// socket left by previous run would make listen fail
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	// socket is created in private directory and moved into place once its
+	// permissions are restricted, so other users can't connect in between
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".zcm-admin-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "admin.sock")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// socket is moved away from path it's bound to, so it's removed by unixListener
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmp, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &unixListener{Listener: l, path: path}, nil
+}
+
+// unixListener removes its socket on close
+type unixListener struct {
+	net.Listener
+	path string
+}
+
+func (l *unixListener) Close() error {
+	os.Remove(l.path)
+	return l.Listener.Close()
+}
+
+// isCleartextAdmin reports whether admin API at address without TLS would
+// receive bearer tokens unencrypted over network, unix socket and
+// loopback don't leave the host
+func isCleartextAdmin(address string, tls bool) bool {
+	if tls || strings.HasPrefix(address, "unix://") {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return true
+	}
+	if host == "localhost" {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip == nil || !ip.IsLoopback()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenAdminUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "admin.sock")
+
+	l, err := listenAdmin("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Errorf("got mode %s, want socket with 0600", info.Mode())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("got %d entries in directory of socket, want only socket", len(entries))
+	}
+
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	l.Close()
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket wasn't removed on close: %v", err)
+	}
+}
+
+func TestIsCleartextAdmin(t *testing.T) {
+	tests := []struct {
+		address string
+		tls     bool
+		want    bool
+	}{
+		{"127.0.0.1:9101", false, false},
+		{"[::1]:9101", false, false},
+		{"localhost:9101", false, false},
+		{"unix:///run/zcm/admin.sock", false, false},
+		{"0.0.0.0:9101", true, false},
+		{"0.0.0.0:9101", false, true},
+		{":9101", false, true},
+		{"10.0.0.5:9101", false, true},
+		{"zcm.example.com:9101", false, true},
+	}
+
+	for _, tt := range tests {
+		if got := isCleartextAdmin(tt.address, tt.tls); got != tt.want {
+			t.Errorf("%s (tls %t): got %t, want %t", tt.address, tt.tls, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ellezio/zcm/internal/exporter"
+)
+
+const (
+	metricUp           = "zcm_target_up"
+	metricAvailability = "zcm_target_availability_percent"
+)
+
+// vantage is view of single agent on target
+type vantage struct {
+	location        string
+	up              bool
+	availability    float64
+	hasAvailability bool
+}
+
+// aggregateRow is availability of target combined from all locations
+type aggregateRow struct {
+	Target    string `json:"target"`
+	Locations int    `json:"locations"`
+	// Up is number of locations target is up from
+	Up int `json:"up"`
+	// Availability is average of locations measuring it, nil when none does
+	Availability *float64       `json:"availability"`
+	Worst        *worstLocation `json:"worst"`
+}
+
+type worstLocation struct {
+	Location     string  `json:"location"`
+	Availability float64 `json:"availability"`
+}
+
+// runAggregate queries metrics of several agents and prints availability
+// of every target combined from all locations it's monitored from
+func runAggregate(args []string) error {
+	var agents []string
+	timeout := 10 * time.Second
+	output := outputTable
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--timeout":
+			i++
+			var err error
+			if i < len(args) {
+				timeout, err = time.ParseDuration(args[i])
+			}
+			if i >= len(args) || err != nil || timeout <= 0 {
+				return configError(errors.New("invalid argument for \"--timeout\""))
+			}
+
+		case "--output", "-o":
+			i++
+			var err error
+			if output, err = parseOutput(args, i); err != nil {
+				return err
+			}
+
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				return configError(errors.New(fmt.Sprintf("unknown argument \"%s\"", args[i])))
+			}
+			agents = append(agents, args[i])
+		}
+	}
+
+	if len(agents) == 0 {
+		return configError(errors.New("missing agents, expected metrics addresses e.g. zcm aggregate eu.example.com:9100 us.example.com:9100"))
+	}
+
+	client := &http.Client{Timeout: timeout}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		vantages = map[string][]vantage{}
+		failed   int
+	)
+	for _, agent := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			samples, err := fetchSamples(client, agent)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", agent, err)
+				failed++
+				return
+			}
+			for target, v := range agentVantages(agent, samples) {
+				vantages[target] = append(vantages[target], v)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failed == len(agents) {
+		return errors.New("none of agents responded")
+	}
+
+	rows := aggregateRows(vantages)
+
+	if output == outputJSON {
+		if err := writeJSON(rows); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TARGET\tLOCATIONS\tUP\tAVAILABILITY\tWORST")
+
+		for _, row := range rows {
+			availability, worst := "-", "-"
+			if row.Availability != nil {
+				availability = fmt.Sprintf("%.2f", *row.Availability)
+				worst = fmt.Sprintf("%s (%.2f)", row.Worst.Location, row.Worst.Availability)
+			}
+
+			fmt.Fprintf(w, "%s\t%d\t%d/%d\t%s\t%s\n", row.Target, row.Locations, row.Up, row.Locations, availability, worst)
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	down := 0
+	for _, row := range rows {
+		if row.Up < row.Locations {
+			down++
+		}
+	}
+	if down > 0 {
+		return checksFailed(errors.New(fmt.Sprintf("%d of %d targets are down from some location", down, len(rows))))
+	}
+
+	return nil
+}
+
+// aggregateRows combines vantages of every target, ordered by target
+func aggregateRows(vantages map[string][]vantage) []aggregateRow {
+	targets := make([]string, 0, len(vantages))
+	for target := range vantages {
+		targets = append(targets, target)
+	}
+	slices.Sort(targets)
+
+	rows := make([]aggregateRow, 0, len(targets))
+	for _, target := range targets {
+		vs := vantages[target]
+		slices.SortFunc(vs, func(a, b vantage) int { return strings.Compare(a.location, b.location) })
+
+		row := aggregateRow{Target: target, Locations: len(vs)}
+
+		var (
+			measured int
+			total    float64
+		)
+		for _, v := range vs {
+			if v.up {
+				row.Up++
+			}
+			if !v.hasAvailability {
+				continue
+			}
+
+			measured++
+			total += v.availability
+			if row.Worst == nil || v.availability < row.Worst.Availability {
+				row.Worst = &worstLocation{Location: v.location, Availability: v.availability}
+			}
+		}
+
+		if measured > 0 {
+			availability := total / float64(measured)
+			row.Availability = &availability
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// fetchSamples reads metrics of agent given as address of its metrics
+// listener (host:port) or full url. Metrics are read instead of admin API
+// as metrics listener is unauthenticated and read-only, so aggregating
+// needs no tokens, and agents often run without admin API at all.
+func fetchSamples(client *http.Client, agent string) ([]exporter.Sample, error) {
+	u := agent
+	if !strings.Contains(u, "://") {
+		u = "http://" + u + "/metrics"
+	}
+
+	res, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("unexpected status %s", res.Status))
+	}
+
+	return exporter.ParseSamples(res.Body, exporter.AgentInfoMetric, metricUp, metricAvailability)
+}
+
+// agentVantages groups samples of agent by target. Location is read only
+// from agent's info metric, as target's own labels may contain location too,
+// agent without location (or older one without info metric) is identified
+// by its address.
+func agentVantages(agent string, samples []exporter.Sample) map[string]vantage {
+	location := agent
+	for _, s := range samples {
+		if s.Name == exporter.AgentInfoMetric && s.Labels[exporter.LocationLabel] != "" {
+			location = s.Labels[exporter.LocationLabel]
+		}
+	}
+
+	vantages := map[string]vantage{}
+	for _, s := range samples {
+		if s.Name == exporter.AgentInfoMetric {
+			continue
+		}
+
+		target := s.Labels["target"]
+		v := vantages[target]
+		v.location = location
+
+		switch s.Name {
+		case metricUp:
+			v.up = s.Value == 1
+		case metricAvailability:
+			v.availability, v.hasAvailability = s.Value, true
+		}
+		vantages[target] = v
+	}
+	return vantages
+}
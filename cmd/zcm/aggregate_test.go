@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ellezio/zcm/internal/exporter"
+)
+
+func TestAgentVantagesLocation(t *testing.T) {
+	// location comes from agent's info metric, never from target's labels
+	tests := []struct {
+		name     string
+		metrics  string
+		expected string
+	}{
+		{
+			name: "agent with location",
+			metrics: `zcm_agent_info{location="eu-west"} 1
+zcm_target_up{target="web",location="eu-west"} 1`,
+			expected: "eu-west",
+		},
+		{
+			name: "agent without location, target with location label",
+			metrics: `zcm_agent_info 1
+zcm_target_up{target="web",location="datacenter-2"} 1`,
+			expected: "eu.example.com:9100",
+		},
+		{
+			name:     "agent without info metric",
+			metrics:  `zcm_target_up{target="web",location="datacenter-2"} 1`,
+			expected: "eu.example.com:9100",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			samples, err := exporter.ParseSamples(strings.NewReader(test.metrics), exporter.AgentInfoMetric, metricUp, metricAvailability)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			vantages := agentVantages("eu.example.com:9100", samples)
+			if len(vantages) != 1 {
+				t.Fatalf("expected vantage of 1 target, got %v", vantages)
+			}
+			if v := vantages["web"]; v.location != test.expected || !v.up {
+				t.Errorf("expected up from \"%s\", got %+v", test.expected, v)
+			}
+		})
+	}
+}
@@ -1,18 +1,53 @@
 package main
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ellezio/zcm/internal/admin"
+	"github.com/ellezio/zcm/internal/monitoring"
+	"github.com/ellezio/zcm/internal/syslog"
+	"github.com/ellezio/zcm/pkg/zbx"
+)
 
 func parseCLIArgs(args []string) (*cli, error) {
 	cli := newCLI()
 
+	path, err := configPath(args)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.apply(cli); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid agent configuration, %s", err))
+	}
+
+	// the first --listen replaces addresses from configuration, following ones add to it
+	isListenSet := false
+
 	argsLen := len(args)
 	for i := 0; i < argsLen; i++ {
 
 		switch args[i] {
+		case "--config", "-c":
+			// already loaded by configPath
+			i++
+
 		case "--targets-file", "-t":
 			i++
 			var path string
-			if i < argsLen && args[i][:1] != "-" {
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
 				path = args[i]
 			}
 
@@ -21,9 +56,334 @@ func parseCLIArgs(args []string) (*cli, error) {
 			}
 
 			cli.targetsFile = path
+
+		case "--env", "-e":
+			i++
+			var env string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				env = args[i]
+			}
+
+			if env == "" {
+				return nil, errors.New("invalid argument for \"--env\"")
+			}
+
+			cli.env = env
+
+		case "--host-concurrency":
+			i++
+			var limit int
+			if i < argsLen {
+				limit, _ = strconv.Atoi(args[i])
+			}
+
+			if limit <= 0 {
+				return nil, errors.New("invalid argument for \"--host-concurrency\"")
+			}
+
+			cli.hostConcurrency = limit
+
+		case "--server-active":
+			i++
+			var address string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				address = args[i]
+			}
+
+			if address == "" {
+				return nil, errors.New("invalid argument for \"--server-active\"")
+			}
+
+			cli.serverActive = address
+
+		case "--hostname":
+			i++
+			var hostname string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				hostname = args[i]
+			}
+
+			if hostname == "" {
+				return nil, errors.New("invalid argument for \"--hostname\"")
+			}
+
+			cli.hostname = hostname
+
+		case "--dns-min-ttl", "--dns-max-ttl":
+			flag := args[i]
+			i++
+			seconds := -1
+			if i < argsLen {
+				if n, err := strconv.Atoi(args[i]); err == nil {
+					seconds = n
+				}
+			}
+
+			if seconds < 0 {
+				return nil, errors.New(fmt.Sprintf("invalid argument for \"%s\"", flag))
+			}
+
+			if flag == "--dns-min-ttl" {
+				cli.dnsMinTTL = time.Duration(seconds) * time.Second
+			} else {
+				cli.dnsMaxTTL = time.Duration(seconds) * time.Second
+			}
+
+		case "--no-dns-cache":
+			cli.noDNSCache = true
+
+		case "--tls-accept":
+			i++
+			var accept string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				accept = args[i]
+			}
+
+			if err := cli.setTLSAccept(strings.Split(accept, ",")); err != nil {
+				return nil, errors.New("invalid argument for \"--tls-accept\"")
+			}
+
+		case "--tls-psk-identity":
+			i++
+			var identity string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				identity = args[i]
+			}
+
+			if identity == "" {
+				return nil, errors.New("invalid argument for \"--tls-psk-identity\"")
+			}
+
+			cli.tlsPSKIdentity = identity
+
+		case "--tls-psk-file":
+			i++
+			var path string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				path = args[i]
+			}
+
+			if path == "" {
+				return nil, errors.New("invalid argument for \"--tls-psk-file\"")
+			}
+
+			cli.tlsPSKFile = path
+
+		case "--tls-ca-file", "--tls-cert-file", "--tls-key-file", "--tls-server-cert-issuer", "--tls-server-cert-subject":
+			flag := args[i]
+			i++
+			var value string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				value = args[i]
+			}
+
+			if value == "" {
+				return nil, errors.New(fmt.Sprintf("invalid argument for \"%s\"", flag))
+			}
+
+			switch flag {
+			case "--tls-ca-file":
+				cli.tlsCert.CAFile = value
+			case "--tls-cert-file":
+				cli.tlsCert.CertFile = value
+			case "--tls-key-file":
+				cli.tlsCert.KeyFile = value
+			case "--tls-server-cert-issuer":
+				cli.tlsCert.ServerCertIssuer = value
+			case "--tls-server-cert-subject":
+				cli.tlsCert.ServerCertSubject = value
+			}
+
+		case "--listen", "-l":
+			i++
+			var addresses string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				addresses = args[i]
+			}
+
+			if addresses == "" {
+				return nil, errors.New("invalid argument for \"--listen\"")
+			}
+
+			if !isListenSet {
+				cli.listenAddresses = nil
+				isListenSet = true
+			}
+			cli.listenAddresses = append(cli.listenAddresses, strings.Split(addresses, ",")...)
+
+		case "--allowed-peers":
+			i++
+			var peers string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				peers = args[i]
+			}
+
+			if peers == "" {
+				return nil, errors.New("invalid argument for \"--allowed-peers\"")
+			}
+
+			cli.allowedPeers = strings.Split(peers, ",")
+
+		case "--metrics-address":
+			i++
+			var address string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				address = args[i]
+			}
+
+			if address == "" {
+				return nil, errors.New("invalid argument for \"--metrics-address\"")
+			}
+
+			cli.metricsAddress = address
+
+		case "--dashboard-address":
+			i++
+			var address string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				address = args[i]
+			}
+
+			if address == "" {
+				return nil, errors.New("invalid argument for \"--dashboard-address\"")
+			}
+
+			cli.dashboardAddress = address
+
+		case "--admin-address":
+			i++
+			var address string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				address = args[i]
+			}
+
+			if address == "" {
+				return nil, errors.New("invalid argument for \"--admin-address\"")
+			}
+
+			cli.admin.address = address
+
+		case "--siem-address", "--siem-format":
+			flag := args[i]
+			i++
+			var value string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				value = args[i]
+			}
+
+			if value == "" {
+				return nil, errors.New(fmt.Sprintf("invalid argument for \"%s\"", flag))
+			}
+
+			if flag == "--siem-address" {
+				cli.siemAddress = value
+			} else {
+				cli.siemFormat = value
+			}
+
+		case "--location":
+			i++
+			var location string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				location = args[i]
+			}
+
+			if location == "" {
+				return nil, errors.New("invalid argument for \"--location\"")
+			}
+
+			cli.location = location
+
+		case "--no-watch":
+			cli.noWatch = true
+
+		case "--wait-for-config":
+			cli.waitForConfig = true
+
+		case "--log-level":
+			i++
+			var level string
+			if i < argsLen {
+				level = args[i]
+			}
+
+			if err := cli.logLevel.UnmarshalText([]byte(level)); err != nil {
+				return nil, errors.New("invalid argument for \"--log-level\"")
+			}
+
+		case "--log-format":
+			i++
+			var format string
+			if i < argsLen {
+				format = args[i]
+			}
+
+			if !isLogFormatSupported(format) {
+				return nil, errors.New("invalid argument for \"--log-format\"")
+			}
+
+			cli.logFormat = format
+
+		case "--log-syslog":
+			i++
+			var address string
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				address = args[i]
+			}
+
+			if address == "" {
+				return nil, errors.New("invalid argument for \"--log-syslog\"")
+			}
+
+			cli.logSyslog = address
+
+		case "--log-facility":
+			i++
+			var facility string
+			if i < argsLen {
+				facility = args[i]
+			}
+
+			if _, err := syslog.ParseFacility(facility); err != nil {
+				return nil, errors.New("invalid argument for \"--log-facility\"")
+			}
+
+			cli.logFacility = facility
 		}
 	}
 
+	if cli.tlsAcceptPSK && (cli.tlsPSKIdentity == "" || cli.tlsPSKFile == "") {
+		return nil, errors.New("\"--tls-accept psk\" requires \"--tls-psk-identity\" and \"--tls-psk-file\"")
+	}
+
+	if cli.tlsAcceptCert && (cli.tlsCert.CAFile == "" || cli.tlsCert.CertFile == "" || cli.tlsCert.KeyFile == "") {
+		return nil, errors.New("\"--tls-accept cert\" requires \"--tls-ca-file\", \"--tls-cert-file\" and \"--tls-key-file\"")
+	}
+
+	if cli.admin.address != "" && cli.admin.tokenFile == "" && cli.admin.clientCAFile == "" {
+		return nil, errors.New("\"--admin-address\" requires admin token-file or client-ca-file")
+	}
+
+	if cli.admin.clientCAFile != "" && (cli.admin.certFile == "" || cli.admin.keyFile == "") {
+		return nil, errors.New("admin client-ca-file requires admin cert-file and key-file")
+	}
+
+	if (cli.admin.certFile == "") != (cli.admin.keyFile == "") {
+		return nil, errors.New("admin cert-file and key-file must be set together")
+	}
+
+	if cli.dnsMinTTL > cli.dnsMaxTTL {
+		return nil, errors.New("\"--dns-min-ttl\" is greater than \"--dns-max-ttl\"")
+	}
+
+	for i, address := range cli.listenAddresses {
+		normalized, err := listenAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		cli.listenAddresses[i] = normalized
+	}
+
 	return cli, nil
 }
 
@@ -31,10 +391,147 @@ func newCLI() *cli {
 	cli := &cli{}
 
 	cli.targetsFile = "monitoring-targets.yml"
+	cli.tlsAcceptUnencrypted = true
+	cli.logLevel = slog.LevelInfo
+	cli.logFormat = logFormatText
+	cli.logFacility = "daemon"
+	cli.dnsMinTTL = monitoring.DefaultDNSMinTTL
+	cli.dnsMaxTTL = monitoring.DefaultDNSMaxTTL
+	cli.storageFlushInterval = 60 * time.Second
+	cli.listenAddresses = []string{net.JoinHostPort(defaultListenHost, defaultListenPort)}
 
 	return cli
 }
 
+const (
+	defaultListenHost = "0.0.0.0"
+	defaultListenPort = "10050"
+)
+
+// listenAddress completes address of passive listener given as host:port,
+// host alone (port defaults to 10050) or port alone (all interfaces),
+// IPv6 hosts may be written without brackets when port is omitted
+func listenAddress(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if _, err := strconv.Atoi(address); err == nil {
+		address = ":" + address
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"), defaultListenPort
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return "", errors.New(fmt.Sprintf("invalid listen address \"%s\", invalid port", address))
+	}
+
+	if strings.Contains(host, ":") {
+		if _, err := netip.ParseAddr(host); err != nil {
+			return "", errors.New(fmt.Sprintf("invalid listen address \"%s\", invalid IPv6 address", address))
+		}
+	} else if host == "" && address == "" {
+		return "", errors.New("invalid listen address, address is empty")
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// setTLSAccept sets accepted incoming connections from list of modes,
+// same as Zabbix agent's TLSAccept
+func (cli *cli) setTLSAccept(modes []string) error {
+	cli.tlsAcceptUnencrypted, cli.tlsAcceptPSK, cli.tlsAcceptCert = false, false, false
+	for _, mode := range modes {
+		switch strings.TrimSpace(mode) {
+		case "unencrypted":
+			cli.tlsAcceptUnencrypted = true
+		case "psk":
+			cli.tlsAcceptPSK = true
+		case "cert":
+			cli.tlsAcceptCert = true
+		default:
+			return errors.New(fmt.Sprintf("unknown mode \"%s\"", mode))
+		}
+	}
+	return nil
+}
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+func isLogFormatSupported(format string) bool {
+	return format == logFormatText || format == logFormatJSON
+}
+
 type cli struct {
+	// location of agent, e.g. region it monitors targets from
+	location string
+
+	logLevel  slog.Level
+	logFormat string
+	// logSyslog is address of syslog logs are sent to instead of stderr
+	logSyslog   string
+	logFacility string
+
 	targetsFile string
+	env         string
+
+	hostConcurrency int
+
+	noWatch bool
+	// waitForConfig starts agent without targets when targets file
+	// doesn't exist and loads them once it appears
+	waitForConfig bool
+
+	noDNSCache bool
+	dnsMinTTL  time.Duration
+	dnsMaxTTL  time.Duration
+
+	serverActive string
+	hostname     string
+
+	tlsAcceptUnencrypted bool
+	tlsAcceptPSK         bool
+	tlsPSKIdentity       string
+	tlsPSKFile           string
+	tlsAcceptCert        bool
+	tlsCert              zbx.CertOptions
+
+	listenAddresses []string
+	allowedPeers    []string
+	// limits of passive connections, zero means zbx default
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	maxRequestSize int
+
+	metricsAddress string
+	// dashboardAddress is address of status dashboard, see internal/dashboard
+	dashboardAddress string
+
+	// storage keeps state and history of targets over restarts, see pkg/store
+	storageType          string
+	storagePath          string
+	storageFlushInterval time.Duration
+
+	admin adminOptions
+
+	// siemAddress is udp:// or tcp:// address events are sent to
+	siemAddress   string
+	siemFormat    string
+	siemEvents    []string
+	siemDownAfter int
+}
+
+// adminOptions configure admin API listener, see internal/admin
+type adminOptions struct {
+	address               string
+	tokenFile             string
+	certFile              string
+	keyFile               string
+	clientCAFile          string
+	clientCertScopes      []admin.Scope
+	auditLog              string
+	requireIdempotencyKey bool
 }
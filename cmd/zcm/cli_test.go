@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestParseCLIArgsEmptyValue(t *testing.T) {
+	t.Setenv("ZCM_CONFIG", "")
+
+	flags := []string{
+		"--targets-file", "--env", "--host-concurrency", "--server-active", "--hostname",
+		"--dns-min-ttl", "--tls-accept", "--tls-psk-identity", "--tls-psk-file", "--tls-ca-file",
+		"--listen", "--allowed-peers", "--metrics-address", "--dashboard-address", "--admin-address",
+		"--siem-address", "--siem-format", "--location", "--log-level", "--log-format",
+		"--log-syslog", "--log-facility",
+	}
+
+	for _, flag := range flags {
+		t.Run(flag, func(t *testing.T) {
+			if _, err := parseCLIArgs([]string{"zcm", flag, ""}); err == nil {
+				t.Errorf("expected error for empty value of %s", flag)
+			}
+		})
+	}
+}
+
+func TestConfigPathEmptyValue(t *testing.T) {
+	t.Setenv("ZCM_CONFIG", "")
+
+	for _, args := range [][]string{{"zcm", "--config", ""}, {"zcm", "-c"}, {"zcm", "-c", "--no-watch"}} {
+		if _, err := configPath(args); err == nil {
+			t.Errorf("expected error for %q", args)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ellezio/zcm/internal/admin"
+	"github.com/ellezio/zcm/internal/syslog"
+	"gopkg.in/yaml.v3"
+)
+
+// agentConfig is content of agent configuration file (zcm.yml),
+// every field can be overridden with ZCM_<SECTION>_<FIELD> environment
+// variable, e.g. ZCM_LISTEN_ADDRESS or ZCM_TLS_PSK_FILE
+type agentConfig struct {
+	Agent     identityConfig  `yaml:"agent"`
+	Log       logConfig       `yaml:"log"`
+	Targets   targetsConfig   `yaml:"targets"`
+	Listen    listenConfig    `yaml:"listen"`
+	TLS       tlsConfig       `yaml:"tls"`
+	Active    activeConfig    `yaml:"active"`
+	DNS       dnsConfig       `yaml:"dns"`
+	Metrics   metricsConfig   `yaml:"metrics"`
+	SIEM      siemConfig      `yaml:"siem"`
+	Admin     adminConfig     `yaml:"admin"`
+	Dashboard dashboardConfig `yaml:"dashboard"`
+	Storage   storageConfig   `yaml:"storage"`
+}
+
+type identityConfig struct {
+	Location string `yaml:"location"`
+}
+
+type logConfig struct {
+	Level    string `yaml:"level"`
+	Format   string `yaml:"format"`
+	Syslog   string `yaml:"syslog"`
+	Facility string `yaml:"facility"`
+}
+
+type targetsConfig struct {
+	File            string `yaml:"file"`
+	Env             string `yaml:"env"`
+	Watch           *bool  `yaml:"watch"`
+	WaitForConfig   bool   `yaml:"wait-for-config"`
+	HostConcurrency int    `yaml:"host-concurrency"`
+}
+
+type listenConfig struct {
+	Address      addressList `yaml:"address"`
+	AllowedPeers []string    `yaml:"allowed-peers"`
+	// ReadTimeout and WriteTimeout are in seconds
+	ReadTimeout    int `yaml:"read-timeout"`
+	WriteTimeout   int `yaml:"write-timeout"`
+	MaxRequestSize int `yaml:"max-request-size"`
+}
+
+// addressList is given as yaml list or as comma separated string
+type addressList []string
+
+func (a *addressList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*a = strings.Split(node.Value, ",")
+		return nil
+	}
+
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+type tlsConfig struct {
+	Accept            []string `yaml:"accept"`
+	PSKIdentity       string   `yaml:"psk-identity"`
+	PSKFile           string   `yaml:"psk-file"`
+	CAFile            string   `yaml:"ca-file"`
+	CertFile          string   `yaml:"cert-file"`
+	KeyFile           string   `yaml:"key-file"`
+	ServerCertIssuer  string   `yaml:"server-cert-issuer"`
+	ServerCertSubject string   `yaml:"server-cert-subject"`
+}
+
+type activeConfig struct {
+	Server   string `yaml:"server"`
+	Hostname string `yaml:"hostname"`
+}
+
+type dnsConfig struct {
+	Cache *bool `yaml:"cache"`
+	// MinTTL and MaxTTL are in seconds
+	MinTTL *int `yaml:"min-ttl"`
+	MaxTTL *int `yaml:"max-ttl"`
+}
+
+type metricsConfig struct {
+	Address string `yaml:"address"`
+}
+
+type dashboardConfig struct {
+	Address string `yaml:"address"`
+}
+
+type storageConfig struct {
+	Type          string `yaml:"type"`
+	Path          string `yaml:"path"`
+	FlushInterval int    `yaml:"flush-interval"`
+}
+
+type siemConfig struct {
+	Address string   `yaml:"address"`
+	Format  string   `yaml:"format"`
+	Events  []string `yaml:"events"`
+	// DownAfter is number of consecutive failed checks before down event
+	DownAfter int `yaml:"down-after"`
+}
+
+type adminConfig struct {
+	Address               string   `yaml:"address"`
+	TokenFile             string   `yaml:"token-file"`
+	CertFile              string   `yaml:"cert-file"`
+	KeyFile               string   `yaml:"key-file"`
+	ClientCAFile          string   `yaml:"client-ca-file"`
+	ClientCertScopes      []string `yaml:"client-cert-scopes"`
+	AuditLog              string   `yaml:"audit-log"`
+	RequireIdempotencyKey bool     `yaml:"require-idempotency-key"`
+}
+
+// configPath returns path of agent configuration file given with --config
+// or ZCM_CONFIG, empty when agent runs without configuration file
+func configPath(args []string) (string, error) {
+	path := os.Getenv("ZCM_CONFIG")
+	for i := 0; i < len(args); i++ {
+		if args[i] != "--config" && args[i] != "-c" {
+			continue
+		}
+
+		i++
+		if i >= len(args) || args[i] == "" || strings.HasPrefix(args[i], "-") {
+			return "", errors.New("invalid argument for \"--config\"")
+		}
+		path = args[i]
+	}
+
+	return path, nil
+}
+
+func loadConfig(path string) (*agentConfig, error) {
+	config := &agentConfig{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Error while reading config file, error: %s", err))
+		}
+
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, errors.New(fmt.Sprintf("%s: %s", path, err))
+		}
+	}
+
+	if err := config.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// applyEnv overrides fields with ZCM_<SECTION>_<FIELD> environment variables,
+// lists are comma separated
+func (c *agentConfig) applyEnv() error {
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionName := sections.Type().Field(i).Tag.Get("yaml")
+
+		for j := 0; j < section.NumField(); j++ {
+			name := envName(sectionName, section.Type().Field(j).Tag.Get("yaml"))
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+
+			if err := setField(section.Field(j), value); err != nil {
+				return errors.New(fmt.Sprintf("invalid value of %s, error: %s", name, err))
+			}
+		}
+	}
+
+	// ZCM_PORT predates config file and changes only port of listen addresses
+	if port, ok := os.LookupEnv("ZCM_PORT"); ok && port != "" {
+		addresses := c.Listen.Address
+		if len(addresses) == 0 {
+			addresses = addressList{defaultListenHost}
+		}
+
+		c.Listen.Address = make(addressList, len(addresses))
+		for i, address := range addresses {
+			host := strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+			if h, _, err := net.SplitHostPort(address); err == nil {
+				host = h
+			}
+			c.Listen.Address[i] = net.JoinHostPort(host, port)
+		}
+	}
+
+	return nil
+}
+
+func envName(section, field string) string {
+	return "ZCM_" + strings.ToUpper(strings.ReplaceAll(section+"_"+field, "-", "_"))
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+
+	case reflect.Slice:
+		field.Set(reflect.ValueOf(strings.Split(value, ",")))
+
+	case reflect.Pointer:
+		v := reflect.New(field.Type().Elem())
+		if err := setField(v.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(v)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	}
+
+	return nil
+}
+
+// apply copies settings present in configuration to cli,
+// arguments given on command line are parsed afterwards and take precedence
+func (c *agentConfig) apply(cli *cli) error {
+	setIfPresent(&cli.location, c.Agent.Location)
+
+	if c.Log.Level != "" {
+		if err := cli.logLevel.UnmarshalText([]byte(c.Log.Level)); err != nil {
+			return errors.New("invalid \"level\" in log section")
+		}
+	}
+	if c.Log.Format != "" {
+		if !isLogFormatSupported(c.Log.Format) {
+			return errors.New("invalid \"format\" in log section")
+		}
+		cli.logFormat = c.Log.Format
+	}
+	setIfPresent(&cli.logSyslog, c.Log.Syslog)
+	if c.Log.Facility != "" {
+		if _, err := syslog.ParseFacility(c.Log.Facility); err != nil {
+			return errors.New("invalid \"facility\" in log section")
+		}
+		cli.logFacility = c.Log.Facility
+	}
+
+	setIfPresent(&cli.targetsFile, c.Targets.File)
+	setIfPresent(&cli.env, c.Targets.Env)
+	if c.Targets.Watch != nil {
+		cli.noWatch = !*c.Targets.Watch
+	}
+	if c.Targets.WaitForConfig {
+		cli.waitForConfig = true
+	}
+	if c.Targets.HostConcurrency < 0 {
+		return errors.New("invalid \"host-concurrency\" in targets section")
+	}
+	if c.Targets.HostConcurrency > 0 {
+		cli.hostConcurrency = c.Targets.HostConcurrency
+	}
+
+	if len(c.Listen.Address) > 0 {
+		cli.listenAddresses = c.Listen.Address
+	}
+	if len(c.Listen.AllowedPeers) > 0 {
+		cli.allowedPeers = c.Listen.AllowedPeers
+	}
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{
+		{"read-timeout", c.Listen.ReadTimeout},
+		{"write-timeout", c.Listen.WriteTimeout},
+		{"max-request-size", c.Listen.MaxRequestSize},
+	} {
+		if limit.value < 0 {
+			return errors.New(fmt.Sprintf("invalid \"%s\" in listen section", limit.name))
+		}
+	}
+	cli.readTimeout = time.Duration(c.Listen.ReadTimeout) * time.Second
+	cli.writeTimeout = time.Duration(c.Listen.WriteTimeout) * time.Second
+	cli.maxRequestSize = c.Listen.MaxRequestSize
+
+	if len(c.TLS.Accept) > 0 {
+		if err := cli.setTLSAccept(c.TLS.Accept); err != nil {
+			return errors.New("invalid \"accept\" in tls section")
+		}
+	}
+	setIfPresent(&cli.tlsPSKIdentity, c.TLS.PSKIdentity)
+	setIfPresent(&cli.tlsPSKFile, c.TLS.PSKFile)
+	setIfPresent(&cli.tlsCert.CAFile, c.TLS.CAFile)
+	setIfPresent(&cli.tlsCert.CertFile, c.TLS.CertFile)
+	setIfPresent(&cli.tlsCert.KeyFile, c.TLS.KeyFile)
+	setIfPresent(&cli.tlsCert.ServerCertIssuer, c.TLS.ServerCertIssuer)
+	setIfPresent(&cli.tlsCert.ServerCertSubject, c.TLS.ServerCertSubject)
+
+	setIfPresent(&cli.serverActive, c.Active.Server)
+	setIfPresent(&cli.hostname, c.Active.Hostname)
+
+	if c.DNS.Cache != nil {
+		cli.noDNSCache = !*c.DNS.Cache
+	}
+	for _, ttl := range []struct {
+		name  string
+		value *int
+		dst   *time.Duration
+	}{
+		{"min-ttl", c.DNS.MinTTL, &cli.dnsMinTTL},
+		{"max-ttl", c.DNS.MaxTTL, &cli.dnsMaxTTL},
+	} {
+		if ttl.value == nil {
+			continue
+		}
+		if *ttl.value < 0 {
+			return errors.New(fmt.Sprintf("invalid \"%s\" in dns section", ttl.name))
+		}
+		*ttl.dst = time.Duration(*ttl.value) * time.Second
+	}
+
+	setIfPresent(&cli.metricsAddress, c.Metrics.Address)
+	setIfPresent(&cli.dashboardAddress, c.Dashboard.Address)
+
+	setIfPresent(&cli.storageType, c.Storage.Type)
+	setIfPresent(&cli.storagePath, c.Storage.Path)
+	if c.Storage.FlushInterval < 0 {
+		return errors.New("invalid \"flush-interval\" in storage section")
+	}
+	if c.Storage.FlushInterval > 0 {
+		cli.storageFlushInterval = time.Duration(c.Storage.FlushInterval) * time.Second
+	}
+
+	setIfPresent(&cli.siemAddress, c.SIEM.Address)
+	setIfPresent(&cli.siemFormat, c.SIEM.Format)
+	cli.siemEvents = c.SIEM.Events
+	if c.SIEM.DownAfter < 0 {
+		return errors.New("invalid \"down-after\" in siem section")
+	}
+	cli.siemDownAfter = c.SIEM.DownAfter
+
+	setIfPresent(&cli.admin.address, c.Admin.Address)
+	setIfPresent(&cli.admin.tokenFile, c.Admin.TokenFile)
+	setIfPresent(&cli.admin.certFile, c.Admin.CertFile)
+	setIfPresent(&cli.admin.keyFile, c.Admin.KeyFile)
+	setIfPresent(&cli.admin.clientCAFile, c.Admin.ClientCAFile)
+	if len(c.Admin.ClientCertScopes) > 0 {
+		scopes, err := admin.ParseScopes(strings.Join(c.Admin.ClientCertScopes, ","))
+		if err != nil {
+			return errors.New("invalid \"client-cert-scopes\" in admin section")
+		}
+		cli.admin.clientCertScopes = scopes
+	}
+	setIfPresent(&cli.admin.auditLog, c.Admin.AuditLog)
+	cli.admin.requireIdempotencyKey = c.Admin.RequireIdempotencyKey
+
+	return nil
+}
+
+func setIfPresent(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
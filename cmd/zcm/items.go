@@ -0,0 +1,624 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ellezio/zcm/internal/monitoring"
+	"github.com/ellezio/zcm/pkg/zbx"
+)
+
+// agentInfo describes agent itself for agent items
+type agentInfo struct {
+	location string
+	// hostname is host name used for active checks, system hostname by default
+	hostname string
+}
+
+func itemHandler(targets *monitoring.Targets, agent agentInfo) zbx.Handler {
+	mux := itemMux(targets, agent)
+
+	return zbx.ItemHandler(func(key string) (interface{}, error) {
+		value, err := mux.Item(key)
+		if err != nil {
+			slog.Warn("item error", "key", key, "err", err)
+			return nil, err
+		}
+
+		slog.Debug("item", "key", key, "value", value)
+		return value, nil
+	})
+}
+
+// itemMux routes agent's own items by key, every other key is item of target
+func itemMux(targets *monitoring.Targets, agent agentInfo) *zbx.ServeMux {
+	mux := zbx.NewServeMux()
+
+	// standard keys of Zabbix agent, used by availability checks of templates
+	mux.HandleFunc("agent.ping", func(string) (interface{}, error) {
+		return 1, nil
+	})
+	mux.HandleFunc("agent.version", func(string) (interface{}, error) {
+		return agentVersion(), nil
+	})
+	mux.HandleFunc("agent.hostname", func(string) (interface{}, error) {
+		return agent.hostname, nil
+	})
+
+	mux.HandleFunc("zcm.agent.location", func(string) (interface{}, error) {
+		return agent.location, nil
+	})
+	mux.HandleFunc("zcm.config.fingerprint", func(string) (interface{}, error) {
+		return targets.Fingerprint(), nil
+	})
+	mux.HandleFunc("zcm.config.loaded", func(string) (interface{}, error) {
+		return boolValue(targets.Loaded()), nil
+	})
+	mux.HandleFunc("zcm.failing", func(string) (interface{}, error) {
+		return failingTargets(targets)
+	})
+	mux.HandleFunc("zcm.targets.discovery", func(string) (interface{}, error) {
+		return targetsDiscovery(targets)
+	})
+
+	transportConns := func(key string) (interface{}, error) {
+		name, params, err := zbx.ParseKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		stats := targets.TransportStats()
+		conns := stats.OpenConns
+		if name == "zcm.transport.idleConns" {
+			conns = stats.IdleConns
+		}
+
+		// connections to host:port given as parameter
+		if len(params) > 0 {
+			return conns[params[0]], nil
+		}
+
+		total := 0
+		for _, n := range conns {
+			total += n
+		}
+		return total, nil
+	}
+	mux.HandleFunc("zcm.transport.openConns", transportConns)
+	mux.HandleFunc("zcm.transport.idleConns", transportConns)
+
+	mux.HandleFunc("zcm.transport.hosts", func(string) (interface{}, error) {
+		b, err := json.Marshal(targets.TransportStats().OpenConns)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	})
+	mux.HandleFunc("zcm.transport.handshakes", func(string) (interface{}, error) {
+		return targets.TransportStats().Handshakes, nil
+	})
+	mux.HandleFunc("zcm.transport.handshakeRate", func(string) (interface{}, error) {
+		return targets.TransportStats().HandshakeRate, nil
+	})
+
+	mux.HandleFunc("zcm.dns.hits", func(string) (interface{}, error) {
+		return targets.DNSStats().Hits, nil
+	})
+	mux.HandleFunc("zcm.dns.misses", func(string) (interface{}, error) {
+		return targets.DNSStats().Misses, nil
+	})
+	mux.HandleFunc("zcm.dns.entries", func(string) (interface{}, error) {
+		return targets.DNSStats().Entries, nil
+	})
+	mux.HandleFunc("zcm.dns.hitRatio", func(string) (interface{}, error) {
+		stats := targets.DNSStats()
+		if stats.Hits+stats.Misses == 0 {
+			return 0.0, nil
+		}
+		return float64(stats.Hits) / float64(stats.Hits+stats.Misses), nil
+	})
+
+	mux.HandleFunc("*", func(key string) (interface{}, error) {
+		return targetItemValue(targets, key)
+	})
+
+	return mux
+}
+
+// targetItemValue returns value of target's item, <target>.<parameter>
+// with optional variant as parameter, e.g. cdn.responseTime[10.0.0.1]
+func targetItemValue(targets *monitoring.Targets, key string) (interface{}, error) {
+	base, params, err := zbx.ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(params) > 1 {
+		return nil, errors.New("item key accepts at most one parameter (variant)")
+	}
+
+	variant := ""
+	if len(params) == 1 {
+		variant = params[0]
+	}
+
+	// aggregate of response times in target's history, e.g. api.responseTime.p95
+	if open := strings.LastIndex(base, ".responseTime."); open != -1 && !strings.HasSuffix(base, ".age") {
+		itemKey, aggregate := base[:open], base[open+len(".responseTime."):]
+		return historyValue(targets, itemKey, aggregate)
+	}
+
+	// error budget burn rate within window, e.g. api.burnRate.1h
+	if open := strings.LastIndex(base, ".burnRate."); open != -1 {
+		itemKey, window := base[:open], base[open+len(".burnRate."):]
+		d, err := time.ParseDuration(window)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid burn rate window \"%s\", expected duration e.g. 5m or 1h", window))
+		}
+		return targets.BurnRate(itemKey, d)
+	}
+
+	// age of parameter's value, e.g. api.responseTime.age
+	age := false
+	if strings.HasSuffix(base, ".age") {
+		base = strings.TrimSuffix(base, ".age")
+		age = true
+	}
+
+	// extracted value, e.g. api.extract.queue_depth
+	sep, extract := strings.LastIndex(base, ".extract."), true
+	if sep == -1 {
+		sep, extract = strings.LastIndex(base, "."), false
+	}
+	if sep == -1 {
+		return nil, errors.New("item key doesn't specify parameter (<item>.<parameter>)")
+	}
+
+	itemKey := base[:sep]
+	param := base[sep+1:]
+
+	data, ok := targets.GetData(itemKey)
+	if !ok {
+		return nil, errors.New("unsupported item key")
+	}
+
+	if variant != "" {
+		v, ok := data.Variants[variant]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("unknown variant: %s", variant))
+		}
+		data = v
+	}
+
+	var value interface{}
+	if extract {
+		value, err = extractedValue(data, strings.TrimPrefix(param, "extract."))
+	} else {
+		value, err = paramValue(targets, itemKey, data, param)
+	}
+	if err != nil || !age {
+		return value, err
+	}
+
+	if data.LastCheck.IsZero() {
+		return -1, nil
+	}
+	return int64(time.Since(data.LastCheck).Seconds()), nil
+}
+
+func paramValue(targets *monitoring.Targets, itemKey string, data monitoring.TargetData, param string) (interface{}, error) {
+	switch param {
+	case "responseTime":
+		v := data.LastResponseTime.Milliseconds()
+		if data.Running && v < time.Since(data.Start).Milliseconds() {
+			v = time.Since(data.Start).Milliseconds()
+		}
+		return v, nil
+
+	case "responseTimeMin":
+		return data.Sample.MinResponseTime.Milliseconds(), nil
+
+	case "responseTimeAvg":
+		return data.Sample.AvgResponseTime.Milliseconds(), nil
+
+	case "responseTimeMax":
+		return data.Sample.MaxResponseTime.Milliseconds(), nil
+
+	case "sampleSize":
+		return data.Sample.Size, nil
+
+	case "sampleFailures":
+		return data.Sample.Failures, nil
+
+	case "failedStreak":
+		return data.FailedStreak, nil
+
+	case "breaker":
+		return data.Breaker, nil
+
+	case "availability":
+		availability, ok := targets.Availability(itemKey)
+		if !ok {
+			return nil, errors.New("no checks within availability window")
+		}
+		return availability, nil
+
+	case "apdex":
+		return data.Apdex, nil
+
+	case "sloCompliance", "errorBudget":
+		status, ok := targets.SLO(itemKey)
+		if !ok {
+			return nil, errors.New("no checks within slo window, or target has no slo")
+		}
+		if param == "sloCompliance" {
+			return status.Compliance, nil
+		}
+		return status.ErrorBudget, nil
+
+	case "statusCode":
+		return data.LastStatusCode, nil
+
+	case "status":
+		return data.LastStatus, nil
+
+	case "lastError":
+		return data.LastError, nil
+
+	case "ok":
+		return boolValue(!data.LastCheck.IsZero() && !data.LastFailed), nil
+
+	case "timeToFirstEvent":
+		return data.LastTimeToFirstEvent.Milliseconds(), nil
+
+	case "eventReceived":
+		return boolValue(data.LastEventReceived), nil
+
+	case "cacheValidation":
+		return boolValue(data.LastCacheValid), nil
+
+	case "validatorStable":
+		return boolValue(data.LastValidatorStable), nil
+
+	case "cacheStatus":
+		return data.LastCacheStatus, nil
+
+	case "cacheHit":
+		return boolValue(data.LastCacheStatus == "hit"), nil
+
+	case "cacheAge":
+		return data.LastCacheAge, nil
+
+	case "bodyMatch":
+		return boolValue(data.LastBodyMatch), nil
+
+	case "goldenSimilarity":
+		return data.LastGoldenSimilarity, nil
+
+	case "goldenDiff":
+		return strings.Join(data.LastGoldenDiffs, "\n"), nil
+
+	case "tlsVersion":
+		return data.LastTLSVersion, nil
+
+	case "tlsCipher":
+		return data.LastTLSCipher, nil
+
+	case "tlsCertificate":
+		return data.LastTLSCertificate, nil
+
+	case "distinctCertificates":
+		return data.DistinctCertificates, nil
+
+	case "dnsTime":
+		return float64(data.LastDNSTime.Microseconds()) / 1000, nil
+
+	case "connectTime":
+		return float64(data.LastConnectTime.Microseconds()) / 1000, nil
+
+	case "tlsTime":
+		return float64(data.LastTLSTime.Microseconds()) / 1000, nil
+
+	case "ttfb":
+		return float64(data.LastTTFB.Microseconds()) / 1000, nil
+
+	case "downloadTime":
+		return float64(data.LastDownloadTime.Microseconds()) / 1000, nil
+
+	case "responseSize":
+		return data.LastResponseSize, nil
+
+	case "contentType":
+		return data.LastContentType, nil
+
+	case "bodyError":
+		return data.LastBodyError, nil
+
+	case "tcpRtt":
+		return float64(data.LastTCPRTT.Microseconds()) / 1000, nil
+
+	case "tcpRttVar":
+		return float64(data.LastTCPRTTVar.Microseconds()) / 1000, nil
+
+	case "tcpRetransmits":
+		return data.LastTCPRetransmits, nil
+
+	case "subresources":
+		return data.LastSubresources, nil
+
+	case "brokenSubresources":
+		return data.LastBrokenSubresources, nil
+
+	case "slowestSubresource":
+		return data.LastSlowestSubresource, nil
+
+	case "slowestSubresourceTime":
+		return data.LastSlowestSubresourceTime.Milliseconds(), nil
+
+	case "openPorts":
+		return portsValue(data.LastOpenPorts), nil
+
+	case "addedPorts":
+		return portsValue(data.LastAddedPorts), nil
+
+	case "removedPorts":
+		return portsValue(data.LastRemovedPorts), nil
+
+	case "portDrift":
+		return boolValue(len(data.LastAddedPorts) > 0 || len(data.LastRemovedPorts) > 0), nil
+
+	case "listed":
+		return boolValue(data.LastListed), nil
+
+	case "listedCount":
+		return len(listedOn(data)), nil
+
+	case "listedOn":
+		return strings.Join(listedOn(data), ","), nil
+
+	case "daysUntilExpiry":
+		return data.LastDaysUntilExpiry, nil
+
+	case "domainExpiry":
+		if data.LastDomainExpiry.IsZero() {
+			return 0, nil
+		}
+		return data.LastDomainExpiry.Unix(), nil
+
+	case "exitCode":
+		return data.LastExitCode, nil
+
+	case "output":
+		return data.LastOutput, nil
+
+	case "syntaxErrors":
+		return data.LastSyntaxErrors, nil
+
+	case "sitemaps":
+		return data.LastSitemaps, nil
+
+	case "disallowAll":
+		return boolValue(data.LastDisallowAll), nil
+
+	case "sitemapEntries":
+		return data.LastSitemapEntries, nil
+
+	case "lastmod":
+		if data.LastLastmod.IsZero() {
+			return 0, nil
+		}
+		return data.LastLastmod.Unix(), nil
+
+	case "daysSinceLastmod":
+		return data.LastDaysSinceLastmod, nil
+
+	case "rangeValid":
+		return boolValue(data.LastRangeValid), nil
+
+	case "contentRange":
+		return data.LastContentRange, nil
+
+	case "headersTooLarge":
+		return boolValue(data.LastHeadersTooLarge), nil
+
+	case "productVendor":
+		return data.LastProductVendor, nil
+
+	case "productVersion":
+		return data.LastProductVersion, nil
+
+	case "expectedFailure":
+		return boolValue(data.LastExpectedFailure), nil
+
+	case "worstEdge", "worstUrl", "worstHost", "worstServerName", "worstVariant":
+		return data.WorstVariant, nil
+
+	case "failingEdges", "failingUrls", "failingHosts", "failingServerNames", "failingVariants":
+		return data.FailingVariants, nil
+
+	case "interval":
+		return data.Interval.Milliseconds(), nil
+
+	case "stale":
+		stale, _ := targets.IsStale(itemKey)
+		return boolValue(stale), nil
+
+	case "discovery":
+		macro := "{#HOST}"
+		names, ok := targets.SweepHosts(itemKey)
+		if !ok {
+			macro = "{#VARIANT}"
+			names, ok = targets.MatrixVariants(itemKey)
+		}
+		if !ok {
+			return nil, errors.New("discovery is available only for targets with subnet or header matrix")
+		}
+
+		lld := make([]map[string]string, len(names))
+		for i, name := range names {
+			lld[i] = map[string]string{macro: name}
+		}
+		b, err := json.Marshal(lld)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("error while encoding discovery: %s", err))
+		}
+		return string(b), nil
+
+	case "labels":
+		labels, _ := targets.Labels(itemKey)
+		b, err := json.Marshal(labels)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("error while encoding labels: %s", err))
+		}
+		return string(b), nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("unknown parameter: %s", param))
+}
+
+// historyValue aggregates response times of checks in target's history
+// in milliseconds, aggregate is avg, min, max or pNN percentile, e.g. p95
+func historyValue(targets *monitoring.Targets, itemKey string, aggregate string) (interface{}, error) {
+	percentile := -1
+	if p, ok := strings.CutPrefix(aggregate, "p"); ok {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 100 {
+			return nil, errors.New(fmt.Sprintf("invalid percentile: %s", aggregate))
+		}
+		percentile = n
+	} else if aggregate != "avg" && aggregate != "min" && aggregate != "max" {
+		return nil, errors.New(fmt.Sprintf("unknown aggregate: %s", aggregate))
+	}
+
+	history, ok := targets.History(itemKey)
+	if !ok {
+		return nil, errors.New("unsupported item key")
+	}
+
+	times := monitoring.ResponseTimes(history)
+	if len(times) == 0 {
+		return 0, nil
+	}
+
+	switch aggregate {
+	case "min":
+		return times[0].Milliseconds(), nil
+	case "max":
+		return times[len(times)-1].Milliseconds(), nil
+	case "avg":
+		var total time.Duration
+		for _, t := range times {
+			total += t
+		}
+		return (total / time.Duration(len(times))).Milliseconds(), nil
+	}
+
+	return monitoring.Percentile(times, percentile).Milliseconds(), nil
+}
+
+func extractedValue(data monitoring.TargetData, name string) (interface{}, error) {
+	value, ok := data.LastExtracted[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("value %s not extracted", name))
+	}
+	return value, nil
+}
+
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// listedOn returns blacklists host is listed on, sorted by name
+func listedOn(data monitoring.TargetData) []string {
+	var zones []string
+	for zone, v := range data.Variants {
+		if v.LastListed {
+			zones = append(zones, zone)
+		}
+	}
+	slices.Sort(zones)
+	return zones
+}
+
+// portsValue formats ports as comma separated list, e.g. 22,443
+func portsValue(ports []int) string {
+	s := make([]string, len(ports))
+	for i, p := range ports {
+		s[i] = strconv.Itoa(p)
+	}
+	return strings.Join(s, ",")
+}
+
+// failingTarget is entry of zcm.failing item
+type failingTarget struct {
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+	// Since is unix time of the first failed check in a row
+	Since int64 `json:"since"`
+	// Duration is number of seconds target has been failing for
+	Duration int64 `json:"duration"`
+}
+
+// targetsDiscovery returns targets for low-level discovery with target's
+// name, check type and labels as macros, e.g. {#TARGET}, {#TYPE}, {#LABEL.TEAM}
+func targetsDiscovery(targets *monitoring.Targets) (string, error) {
+	lld := []map[string]string{}
+	for _, name := range targets.Names() {
+		checkType, ok := targets.Type(name)
+		if !ok {
+			continue
+		}
+
+		macros := map[string]string{"{#TARGET}": name, "{#TYPE}": checkType}
+		labels, _ := targets.Labels(name)
+		for k, v := range labels {
+			macros["{#LABEL."+strings.ToUpper(k)+"}"] = v
+		}
+		lld = append(lld, macros)
+	}
+
+	b, err := json.Marshal(map[string]interface{}{"data": lld})
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("error while encoding discovery: %s", err))
+	}
+	return string(b), nil
+}
+
+// failingTargets returns JSON array of targets whose last check failed,
+// ordered by name
+func failingTargets(targets *monitoring.Targets) (string, error) {
+	now := time.Now()
+	failing := []failingTarget{}
+	for _, name := range targets.Names() {
+		data, ok := targets.GetData(name)
+		if !ok || !data.LastFailed {
+			continue
+		}
+
+		since := data.FailingSince
+		if since.IsZero() {
+			since = data.LastCheck
+		}
+
+		failing = append(failing, failingTarget{
+			Target:   name,
+			Reason:   data.LastFailure,
+			Since:    since.Unix(),
+			Duration: int64(now.Sub(since).Seconds()),
+		})
+	}
+
+	b, err := json.Marshal(failing)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
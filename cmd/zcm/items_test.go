@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ellezio/zcm/internal/monitoring"
+)
+
+// BenchmarkItemHandler reads items of checked targets from parallel goroutines
+func BenchmarkItemHandler(b *testing.B) {
+	// tcp checks of local listener, which accepts and closes connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	names := make([]string, 100)
+	var doc strings.Builder
+	for i := range names {
+		names[i] = fmt.Sprintf("tcp-%d", i)
+		fmt.Fprintf(&doc, "%s: {type: tcp, host: 127.0.0.1, port: %d, interval: 3600000, history: 20}\n", names[i], port)
+	}
+
+	targets, err := monitoring.ParseTargets([]byte(doc.String()))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var keys []string
+	for _, name := range names {
+		for i := 0; i < 20; i++ {
+			targets.CheckOnce(name)
+		}
+		for _, item := range []string{"ok", "responseTime", "responseTime.p95", "availability", "status"} {
+			keys = append(keys, name+"."+item)
+		}
+	}
+
+	handler := itemHandler(targets, agentInfo{})
+	var next atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := keys[next.Add(1)%int64(len(keys))]
+			if _, err := handler.Item(key); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -1,79 +1,389 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io/fs"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/ellezio/zcm/internal/dashboard"
+	"github.com/ellezio/zcm/internal/exporter"
+	"github.com/ellezio/zcm/internal/grafana"
 	"github.com/ellezio/zcm/internal/monitoring"
-	"github.com/ellezio/zcm/internal/zbx"
+	"github.com/ellezio/zcm/internal/siem"
+	"github.com/ellezio/zcm/internal/syslog"
+	"github.com/ellezio/zcm/pkg/store"
+	"github.com/ellezio/zcm/pkg/zbx"
 )
 
+// version is set at build time with -ldflags "-X main.version=1.2.3",
+// otherwise module version from build info is used
+var version = ""
+
+func agentVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		var command func([]string) error
+
+		switch os.Args[1] {
+		case "targets":
+			command = runTargetsCommand
+		case "selftest":
+			command = runSelftest
+		case "soak":
+			command = runSoak
+		case "aggregate":
+			command = runAggregate
+		case "validate":
+			command = runValidate
+		}
+
+		if command != nil {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(exitCode(err))
+			}
+			return
+		}
+	}
+
 	cli, err := parseCLIArgs(os.Args)
 	if err != nil {
-		fmt.Println(err)
+		fatal(configError(err))
 	}
 
-	targets, err := monitoring.LoadTargets(cli.targetsFile)
+	logger, err := newLogger(cli)
 	if err != nil {
-		log.Fatal(err)
+		fatal(configError(err))
 	}
+	slog.SetDefault(logger)
 
-	go targets.StartMonitoring()
+	targets, err := monitoring.LoadTargets(cli.targetsFile, cli.env)
+	if err != nil {
+		if _, statErr := os.Stat(cli.targetsFile); !cli.waitForConfig || !errors.Is(statErr, fs.ErrNotExist) {
+			fatal(configError(err))
+		}
 
-	port := os.Getenv("ZCM_PORT")
-	if port == "" {
-		port = "10050"
+		slog.Warn("targets file doesn't exist, waiting for it", "file", cli.targetsFile)
+		targets = monitoring.WaitForTargets(cli.targetsFile, cli.env)
+	} else {
+		slog.Info("targets loaded", "targets", len(targets.Names()), "fingerprint", targets.Fingerprint())
 	}
 
-	address := fmt.Sprintf("0.0.0.0:%s", port)
-	log.Println("Listening at", address)
-	if err := zbx.ListenAndServe(address, itemHandler(targets)); err != nil {
-		log.Fatal(err)
+	hostname := cli.hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	agent := agentInfo{location: cli.location, hostname: hostname}
+
+	targets.LimitHostConcurrency(cli.hostConcurrency)
+	if !cli.noDNSCache {
+		targets.CacheDNS(cli.dnsMinTTL, cli.dnsMaxTTL)
 	}
-}
 
-func itemHandler(targets *monitoring.Targets) func(string) interface{} {
-	return func(key string) interface{} {
-		sep := strings.LastIndex(key, ".")
-		if sep == -1 {
-			log.Printf("item key \"%s\" doesn't specify parameter (<item>.<parameter>)", key)
-			return nil
+	// SIGINT and SIGTERM stop listeners and abort in-flight checks
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var background sync.WaitGroup
+
+	if cli.siemAddress != "" {
+		sender, err := siem.NewSender(cli.siemAddress, cli.siemFormat, hostname, cli.siemEvents)
+		if err != nil {
+			fatal(configError(err))
 		}
+		targets.HandleEvents(sender.Send, cli.siemDownAfter)
+
+		slog.Info("sending events to siem", "address", cli.siemAddress)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			sender.Run(ctx)
+		}()
+	}
+
+	st, err := store.Open(cli.storageType, cli.storagePath)
+	if err != nil {
+		fatal(configError(err))
+	}
+	if err := targets.UseStore(st); err != nil {
+		slog.Warn("loading saved state failed, targets start from scratch", "err", err)
+	}
 
-		itemKey := key[:sep]
-		param := key[sep+1:]
+	targets.StartMonitoring(ctx)
 
-		if data, ok := targets.GetData(itemKey); ok {
-			var value interface{}
+	stopFlush := make(chan struct{})
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
 
-			switch param {
-			case "responseTime":
-				v := data.LastResponseTime.Milliseconds()
-				if data.Running && v < time.Since(data.Start).Milliseconds() {
-					v = time.Since(data.Start).Milliseconds()
+		ticker := time.NewTicker(cli.storageFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := targets.SaveState(); err != nil {
+					slog.Warn("saving state failed", "err", err)
 				}
-				value = v
+			case <-stopFlush:
+				return
+			}
+		}
+	}()
+
+	watching := false
+	if !cli.noWatch {
+		if err := targets.WatchConfig(); err != nil {
+			slog.Warn("watching targets file disabled", "err", err)
+		} else {
+			watching = true
+		}
+	}
+
+	if !targets.Loaded() {
+		go waitForTargetsFile(ctx, targets, cli, watching)
+	}
 
-			case "statusCode":
-				value = data.LastStatusCode
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := targets.Reload(); err != nil {
+				slog.Error("targets reload failed, keeping previous configuration", "err", err)
+			}
+		}
+	}()
 
-			case "status":
-				value = data.LastStatus
+	if cli.serverActive != "" {
+		slog.Info("sending active checks", "server", cli.serverActive, "hostname", hostname)
+		background.Add(1)
+		go func() {
+			defer background.Done()
 
-			default:
-				log.Printf("item key: %s, unknown parameter: %s", key, param)
-				return nil
+			err := zbx.RunActive(ctx, zbx.ActiveOptions{
+				ServerAddress:   cli.serverActive,
+				Hostname:        hostname,
+				MaxResponseSize: cli.maxRequestSize,
+			}, itemHandler(targets, agent))
+			if err != nil {
+				fatal(err)
 			}
+		}()
+	}
+
+	if cli.metricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", exporter.Handler(targets, cli.location))
+		mux.Handle("/grafana/", http.StripPrefix("/grafana", grafana.Handler(targets)))
+		metrics := &http.Server{Addr: cli.metricsAddress, Handler: mux}
+
+		slog.Info("serving metrics", "address", cli.metricsAddress)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+
+			if err := metrics.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal(err)
+			}
+		}()
+		context.AfterFunc(ctx, func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			metrics.Shutdown(shutdownCtx)
+		})
+	}
+
+	if cli.dashboardAddress != "" {
+		dashboardServer := &http.Server{Addr: cli.dashboardAddress, Handler: dashboard.Handler(targets, cli.location)}
+
+		slog.Info("serving dashboard", "address", cli.dashboardAddress)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+
+			if err := dashboardServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal(err)
+			}
+		}()
+		context.AfterFunc(ctx, func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			dashboardServer.Shutdown(shutdownCtx)
+		})
+	}
 
-			log.Printf("item key: %s, value: %v", key, value)
-			return value
+	if cli.admin.address != "" {
+		adminServer, err := newAdminServer(cli.admin, targets)
+		if err != nil {
+			fatal(configError(err))
 		}
 
-		log.Printf("unsupported item key: %s", key)
-		return nil
+		listener, err := listenAdmin(cli.admin.address)
+		if err != nil {
+			fatal(err)
+		}
+
+		slog.Info("serving admin api", "address", cli.admin.address, "tls", adminServer.TLSConfig != nil)
+		if isCleartextAdmin(cli.admin.address, adminServer.TLSConfig != nil) {
+			slog.Warn("admin api is served without TLS on network address, bearer tokens are sent in cleartext, set cert-file and key-file in admin section or listen on loopback or unix socket", "address", cli.admin.address)
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+
+			var err error
+			if adminServer.TLSConfig != nil {
+				err = adminServer.ServeTLS(listener, "", "")
+			} else {
+				err = adminServer.Serve(listener)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal(err)
+			}
+		}()
+		context.AfterFunc(ctx, func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			adminServer.Shutdown(shutdownCtx)
+		})
 	}
+
+	server := &zbx.Server{
+		Addresses:         cli.listenAddresses,
+		Handler:           itemHandler(targets, agent),
+		RequireEncryption: !cli.tlsAcceptUnencrypted,
+		AllowedPeers:      cli.allowedPeers,
+		ReadTimeout:       cli.readTimeout,
+		WriteTimeout:      cli.writeTimeout,
+		MaxRequestSize:    cli.maxRequestSize,
+	}
+
+	if cli.tlsAcceptPSK {
+		psk, err := zbx.LoadPSK(cli.tlsPSKIdentity, cli.tlsPSKFile)
+		if err != nil {
+			fatal(configError(err))
+		}
+		server.PSK = psk
+	}
+
+	if cli.tlsAcceptCert {
+		config, err := zbx.LoadCertConfig(cli.tlsCert)
+		if err != nil {
+			fatal(configError(err))
+		}
+		server.TLS = config
+	}
+
+	slog.Info("listening", "addresses", strings.Join(server.Addresses, ","))
+	if err := server.ListenAndServe(ctx); err != nil {
+		fatal(err)
+	}
+
+	slog.Info("shutting down")
+	targets.Wait()
+	background.Wait()
+
+	close(stopFlush)
+	<-flushed
+	if err := targets.SaveState(); err != nil {
+		slog.Error("saving state failed", "err", err)
+	}
+	st.Close()
+
+	slog.Info("stopped")
+}
+
+// waitForTargetsFile polls for targets file until it's loaded, either by
+// this loop or by file watcher, which is started once the file exists
+// when directory of the file didn't exist either
+func waitForTargetsFile(ctx context.Context, targets *monitoring.Targets, cli *cli, watching bool) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	// invalid files are reloaded and reported again only once they change
+	failed := ""
+	for !targets.Loaded() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := os.Stat(cli.targetsFile); err != nil {
+			continue
+		}
+		version := filesVersion(targets.ConfigFiles())
+		if version == failed {
+			continue
+		}
+		if err := targets.Reload(); err != nil {
+			failed = version
+			slog.Error("targets reload failed, keeping previous configuration", "err", err)
+		}
+	}
+
+	if !cli.noWatch && !watching {
+		if err := targets.WatchConfig(); err != nil {
+			slog.Warn("watching targets file disabled", "err", err)
+		}
+	}
+}
+
+// filesVersion returns size and modification time of files,
+// it changes whenever any of them is written, created or removed
+func filesVersion(files []string) string {
+	var version strings.Builder
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			fmt.Fprintf(&version, "%s:%d:%d;", f, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(&version, "%s:missing;", f)
+		}
+	}
+	return version.String()
+}
+
+func newLogger(cli *cli) (*slog.Logger, error) {
+	if cli.logSyslog != "" {
+		w, err := syslog.NewWriter(cli.logSyslog)
+		if err != nil {
+			return nil, err
+		}
+		facility, err := syslog.ParseFacility(cli.logFacility)
+		if err != nil {
+			return nil, err
+		}
+		hostname, _ := os.Hostname()
+		return slog.New(syslog.NewHandler(w, cli.logLevel, facility, hostname, "zcm")), nil
+	}
+
+	opts := &slog.HandlerOptions{Level: cli.logLevel}
+	if cli.logFormat == logFormatJSON {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+}
+
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(exitCode(err))
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilesVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "targets.yml")
+	overlay := filepath.Join(dir, "targets.prod.yml")
+	files := []string{path, overlay}
+
+	missing := filesVersion(files)
+	if err := os.WriteFile(path, []byte("a: {url: "), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filesVersion(files)
+	if invalid == missing {
+		t.Error("version didn't change when file was created")
+	}
+	if filesVersion(files) != invalid {
+		t.Error("version changed without change of files")
+	}
+
+	// the same size, only modification time changes
+	if err := os.WriteFile(path, []byte("b: {url: "), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	touched := filesVersion(files)
+	if touched == invalid {
+		t.Error("version didn't change when file was modified")
+	}
+
+	if err := os.WriteFile(overlay, []byte("a: {}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if filesVersion(files) == touched {
+		t.Error("version didn't change when overlay was created")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// exit codes of agent and subcommands, 0 means success
+const (
+	// exitChecksFailed is returned when command ran, but some checks failed
+	exitChecksFailed = 1
+	// exitConfigError is returned for invalid arguments, configuration or targets
+	exitConfigError = 2
+	// exitRuntimeError is returned when command couldn't run, e.g. network error
+	exitRuntimeError = 3
+)
+
+// exitError is error of command which exits with given code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func configError(err error) error {
+	return &exitError{code: exitConfigError, err: err}
+}
+
+func checksFailed(err error) error {
+	return &exitError{code: exitChecksFailed, err: err}
+}
+
+// exitCode returns exit code for error of command,
+// errors without code are runtime errors
+func exitCode(err error) int {
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitRuntimeError
+}
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// parseOutput parses value of --output argument
+func parseOutput(args []string, i int) (string, error) {
+	if i >= len(args) || (args[i] != outputTable && args[i] != outputJSON) {
+		return "", configError(errors.New(fmt.Sprintf("invalid argument for \"--output\", available: %s, %s", outputTable, outputJSON)))
+	}
+	return args[i], nil
+}
+
+// writeJSON prints machine-readable output of command
+func writeJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ellezio/zcm/internal/monitoring"
+	"github.com/ellezio/zcm/internal/testserver"
+)
+
+type selftestCase struct {
+	name      string
+	checkType string
+	auth      string
+	// target definition, %[1]s is replaced with test server url, %[2]s with its port
+	target string
+	runs   int
+	verify func(data monitoring.TargetData) error
+}
+
+var selftestCases = []selftestCase{
+	{
+		name: "get", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/"}`,
+		verify: expectStatus(200),
+	},
+	{
+		name: "post-json", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/json", method: POST, json: '{"key": "val"}'}`,
+		verify: expectStatus(200),
+	},
+	{
+		name: "post-form-data", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/form", method: POST, form-data: {key: val}}`,
+		verify: expectStatus(200),
+	},
+	{
+		name: "head", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/", method: HEAD}`,
+		verify: expectStatus(200),
+	},
+	{
+		name: "headers", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/headers", headers: {X-Zcm-Test: "1"}}`,
+		verify: expectStatus(200),
+	},
+	{
+		name: "auth-basic", checkType: "http", auth: "basic",
+		target: `{url: "%[1]s/auth/basic", authorization: {type: Basic, username: ` + testserver.Username + `, password: ` + testserver.Password + `}}`,
+		verify: expectStatus(200),
+	},
+	{
+		name: "auth-token", checkType: "http", auth: "token",
+		target: `{url: "%[1]s/auth/token", authorization: {type: Bearer, token: ` + testserver.Token + `}}`,
+		verify: expectStatus(200),
+	},
+	{
+		name: "auth-apikey", checkType: "http", auth: "apikey",
+		target: `{url: "%[1]s/auth/apikey", authorization: {type: apikey, value: ` + testserver.Token + `}}`,
+		verify: expectStatus(200),
+	},
+	{
+		name: "auth-oauth2", checkType: "http", auth: "oauth2",
+		target: `{url: "%[1]s/auth/token", authorization: {type: oauth2, token-url: "%[1]s/oauth/token", client-id: ` + testserver.Username + `, client-secret: ` + testserver.Password + `, scopes: [read]}}`,
+		verify: expectStatus(200),
+	},
+	{
+		name: "expect-failure", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/auth/token", expect-failure: {status-codes: [401]}}`,
+		verify: func(data monitoring.TargetData) error {
+			if !data.LastExpectedFailure {
+				return errors.New(fmt.Sprintf("expected 401 to be reported as expected failure, got %s", describeStatus(data)))
+			}
+			return nil
+		},
+	},
+	{
+		name: "expect-status", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/auth/token", expect-status: [2xx, 401]}`,
+		verify: func(data monitoring.TargetData) error {
+			if data.LastStatusCode != 401 || data.LastFailed {
+				return errors.New(fmt.Sprintf("expected 401 to pass expect-status, got %s", describeStatus(data)))
+			}
+			return nil
+		},
+	},
+	{
+		name: "timeout", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/events", timeout: 100ms}`,
+		verify: func(data monitoring.TargetData) error {
+			if data.LastStatus != "timeout" {
+				return errors.New(fmt.Sprintf("expected timeout, got %s", describeStatus(data)))
+			}
+			return nil
+		},
+	},
+	{
+		name: "cache-validation", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/cached", cache-validation: true}`,
+		runs:   2,
+		verify: func(data monitoring.TargetData) error {
+			if data.LastStatusCode != 304 || !data.LastCacheValid {
+				return errors.New(fmt.Sprintf("expected valid 304 response, got %s", describeStatus(data)))
+			}
+			return nil
+		},
+	},
+	{
+		name: "edges", checkType: "http", auth: "none",
+		target: `{url: "http://zcm.selftest:%[2]s/", edges: [127.0.0.1]}`,
+		verify: func(data monitoring.TargetData) error {
+			if data.LastStatusCode != 200 || data.WorstVariant != "127.0.0.1" || data.FailingVariants != 0 {
+				return errors.New(fmt.Sprintf("expected edge 127.0.0.1 with status 200, got %s", describeStatus(data)))
+			}
+			return nil
+		},
+	},
+	{
+		name: "body-contains", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/large?size=10000000", expect-body-contains: ` + testserver.Marker + `, body-memory-budget: 4096}`,
+		verify: expectBodyMatch,
+	},
+	{
+		name: "body-regex", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/large?size=10000000", expect-body-regex: "end-of-b[o]dy$", body-memory-budget: 4096}`,
+		verify: expectBodyMatch,
+	},
+	{
+		name: "extract", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/stats", extract: {queue_depth: "$.stats.queue.depth", worker: "$.workers[-1].name"}}`,
+		verify: func(data monitoring.TargetData) error {
+			if data.LastExtracted["queue_depth"] != int64(testserver.QueueDepth) || data.LastExtracted["worker"] != "w1" {
+				return errors.New(fmt.Sprintf("expected extracted queue depth %d and worker w1, got %v", testserver.QueueDepth, data.LastExtracted))
+			}
+			return nil
+		},
+	},
+	{
+		name: "script", checkType: "http", auth: "none",
+		target: `{url: "%[1]s/stats", script: "def check(response):\n` +
+			`  depth = json.decode(response.body)['stats']['queue']['depth']\n` +
+			`  if depth != ` + fmt.Sprint(testserver.QueueDepth) + `:\n    return 'unexpected queue depth ' + str(depth)\n` +
+			`  return response.headers['content-type'] == 'application/json'\n"}`,
+		verify: func(data monitoring.TargetData) error {
+			if data.LastStatusCode != 200 || data.LastFailed {
+				return errors.New(fmt.Sprintf("expected script to pass with status 200, got %s", describeStatus(data)))
+			}
+			return nil
+		},
+	},
+	{
+		name: "domain", checkType: "domain", auth: "none",
+		target: `{type: domain, domain: example.com, rdap-server: "%[1]s/rdap", min-days-until-expiry: 30}`,
+		verify: func(data monitoring.TargetData) error {
+			if data.LastDaysUntilExpiry != testserver.DomainExpiryDays {
+				return errors.New(fmt.Sprintf("expected expiry in %d days, got %d (%s)", testserver.DomainExpiryDays, data.LastDaysUntilExpiry, describeStatus(data)))
+			}
+			return nil
+		},
+	},
+	{
+		name: "sse", checkType: "sse", auth: "none",
+		target: `{url: "%[1]s/events", type: sse, event-timeout: 5000}`,
+		verify: func(data monitoring.TargetData) error {
+			if !data.LastEventReceived {
+				return errors.New(fmt.Sprintf("event not received, got %s", describeStatus(data)))
+			}
+			return nil
+		},
+	},
+}
+
+func expectStatus(code int) func(data monitoring.TargetData) error {
+	return func(data monitoring.TargetData) error {
+		if data.LastStatusCode != code {
+			return errors.New(fmt.Sprintf("expected status %d, got %s", code, describeStatus(data)))
+		}
+		return nil
+	}
+}
+
+func expectBodyMatch(data monitoring.TargetData) error {
+	if data.LastStatusCode != 200 || !data.LastBodyMatch {
+		return errors.New(fmt.Sprintf("expected body match with status 200, got %s", describeStatus(data)))
+	}
+	return nil
+}
+
+func describeStatus(data monitoring.TargetData) string {
+	if data.LastStatus == "" {
+		return "no response"
+	}
+	return data.LastStatus
+}
+
+// selftestRow is result of single selftest check
+type selftestRow struct {
+	Check  string `json:"check"`
+	Type   string `json:"type"`
+	Auth   string `json:"auth"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// runSelftest runs every supported check type and auth mode
+// against internal test server and prints pass/fail matrix
+func runSelftest(args []string) error {
+	output := outputTable
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--output", "-o":
+			i++
+			var err error
+			if output, err = parseOutput(args, i); err != nil {
+				return err
+			}
+
+		default:
+			return configError(errors.New(fmt.Sprintf("unknown argument \"%s\"", args[i])))
+		}
+	}
+
+	server := httptest.NewServer(testserver.NewHandler(testserver.Options{}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		return err
+	}
+
+	var doc strings.Builder
+	for _, c := range selftestCases {
+		fmt.Fprintf(&doc, "%s: %s\n", c.name, fmt.Sprintf(c.target, server.URL, u.Port()))
+	}
+
+	targets, err := monitoring.ParseTargets([]byte(doc.String()))
+	if err != nil {
+		return errors.New(fmt.Sprintf("error while preparing selftest targets, error: %s", err))
+	}
+
+	rows := make([]selftestRow, 0, len(selftestCases))
+	failed := 0
+	for _, c := range selftestCases {
+		var data monitoring.TargetData
+		for i := 0; i < max(c.runs, 1); i++ {
+			data, _ = targets.CheckOnce(c.name)
+		}
+
+		row := selftestRow{Check: c.name, Type: c.checkType, Auth: c.auth, Result: "PASS"}
+		if err := c.verify(data); err != nil {
+			row.Result, row.Detail = "FAIL", err.Error()
+			failed++
+		}
+		rows = append(rows, row)
+	}
+
+	if output == outputJSON {
+		if err := writeJSON(rows); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CHECK\tTYPE\tAUTH\tRESULT\tDETAIL")
+		for _, row := range rows {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", row.Check, row.Type, row.Auth, row.Result, row.Detail)
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return checksFailed(errors.New(fmt.Sprintf("%d of %d selftest checks failed", failed, len(selftestCases))))
+	}
+
+	return nil
+}
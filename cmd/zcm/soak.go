@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ellezio/zcm/internal/monitoring"
+	"github.com/ellezio/zcm/internal/testserver"
+)
+
+const (
+	soakInterval       = 1000
+	soakReloadInterval = 10 * time.Second
+	soakSampleInterval = time.Second
+	// soakLeakSlack is number of goroutines allowed to outlive the run,
+	// e.g. started lazily by runtime or net packages
+	soakLeakSlack = 5
+)
+
+// soakItems are read concurrently with checks, so readers race with writers
+var soakItems = []string{"ok", "responseTime", "responseTime.p95", "availability", "failedStreak", "status"}
+
+// soakReport is summary of soak run
+type soakReport struct {
+	Targets  int    `json:"targets"`
+	Duration string `json:"duration"`
+	Race     bool   `json:"race"`
+	// Checks are checks observed by sampling, so they're lower bound
+	Checks         int64    `json:"checks"`
+	Reloads        int      `json:"reloads"`
+	ItemReads      int64    `json:"itemReads"`
+	PeakGoroutines int      `json:"peakGoroutines"`
+	LeakedRoutines int      `json:"leakedGoroutines"`
+	PeakHeapMiB    float64  `json:"peakHeapMiB"`
+	Violations     []string `json:"violations"`
+}
+
+// runSoak runs many targets against internal test server for a long time
+// while reloading them and reading their items concurrently, then checks
+// that no goroutines leaked, no latency was negative and heap stayed bounded.
+// Binary has to be built with -race to catch data races as well, unless
+// --no-race is given.
+func runSoak(args []string) error {
+	count := 300
+	duration := 5 * time.Minute
+	maxHeap := 256
+	output := outputTable
+	noRace := false
+	// warnings of checks, e.g. of timeout cases, are expected and would
+	// drown violations
+	logLevel := slog.LevelError
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--targets":
+			i++
+			var err error
+			if i < len(args) {
+				count, err = strconv.Atoi(args[i])
+			}
+			if i >= len(args) || err != nil || count < 1 {
+				return configError(errors.New("invalid argument for \"--targets\""))
+			}
+
+		case "--duration":
+			i++
+			var err error
+			if i < len(args) {
+				duration, err = time.ParseDuration(args[i])
+			}
+			if i >= len(args) || err != nil || duration <= 0 {
+				return configError(errors.New("invalid argument for \"--duration\""))
+			}
+
+		case "--max-heap":
+			i++
+			var err error
+			if i < len(args) {
+				maxHeap, err = strconv.Atoi(args[i])
+			}
+			if i >= len(args) || err != nil || maxHeap < 1 {
+				return configError(errors.New("invalid argument for \"--max-heap\""))
+			}
+
+		case "--log-level":
+			i++
+			var level string
+			if i < len(args) {
+				level = args[i]
+			}
+			if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+				return configError(errors.New("invalid argument for \"--log-level\""))
+			}
+
+		case "--no-race":
+			noRace = true
+
+		case "--output", "-o":
+			i++
+			var err error
+			if output, err = parseOutput(args, i); err != nil {
+				return err
+			}
+
+		default:
+			return configError(errors.New(fmt.Sprintf("unknown argument \"%s\"", args[i])))
+		}
+	}
+
+	report := soakReport{Targets: count, Duration: duration.String(), Race: raceEnabled(), Violations: []string{}}
+	if !report.Race {
+		if !noRace {
+			return configError(errors.New("soak needs binary built with race detector (go build -race), pass --no-race to run it without"))
+		}
+		fmt.Fprintln(os.Stderr, "WARNING: race detector is disabled, data races won't be detected")
+	}
+
+	// checks log to default logger, so they share level with violations
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+	slog.SetDefault(logger)
+	baseline := runtime.NumGoroutine()
+
+	server := httptest.NewServer(testserver.NewHandler(testserver.Options{}))
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		server.Close()
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "zcm-soak")
+	if err != nil {
+		server.Close()
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "targets.yml")
+	if err := writeSoakTargets(path, count, server.URL, u.Port(), 0); err != nil {
+		server.Close()
+		return err
+	}
+
+	targets, err := monitoring.LoadTargets(path, "")
+	if err != nil {
+		server.Close()
+		return errors.New(fmt.Sprintf("error while preparing soak targets, error: %s", err))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	targets.StartMonitoring(ctx)
+
+	var (
+		mu         sync.Mutex
+		violations = map[string]bool{}
+		itemReads  atomic.Int64
+		readers    sync.WaitGroup
+	)
+	violation := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		v := fmt.Sprintf(format, args...)
+		if !violations[v] {
+			violations[v] = true
+			report.Violations = append(report.Violations, v)
+			logger.Error("soak violation", "violation", v)
+		}
+	}
+
+	mux := itemMux(targets, agentInfo{})
+	for r := 0; r < runtime.GOMAXPROCS(0); r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+
+			for ctx.Err() == nil {
+				for _, name := range targets.Names() {
+					for _, item := range soakItems {
+						// unsupported items are expected, e.g. of target without response yet
+						value, err := mux.Item(name + "." + item)
+						if err == nil && strings.HasPrefix(item, "responseTime") && isNegative(value) {
+							violation("%s.%s is negative: %v", name, item, value)
+						}
+						itemReads.Add(1)
+					}
+				}
+			}
+		}()
+	}
+
+	lastChecks := map[string]time.Time{}
+	deadline := time.After(duration)
+	sample := time.NewTicker(soakSampleInterval)
+	reload := time.NewTicker(soakReloadInterval)
+	progress := time.NewTicker(30 * time.Second)
+	started := time.Now()
+
+loop:
+	for {
+		select {
+		case <-deadline:
+			break loop
+
+		case <-reload.C:
+			report.Reloads++
+			if err := writeSoakTargets(path, count, server.URL, u.Port(), report.Reloads); err != nil {
+				violation("writing targets failed: %s", err)
+				continue
+			}
+			if err := targets.Reload(); err != nil {
+				violation("reload failed: %s", err)
+			}
+
+		case <-sample.C:
+			for _, name := range targets.Names() {
+				data, ok := targets.GetData(name)
+				if !ok {
+					continue
+				}
+				if data.LastResponseTime < 0 || data.LastTimeToFirstEvent < 0 {
+					violation("%s: negative latency %s, time to first event %s", name, data.LastResponseTime, data.LastTimeToFirstEvent)
+				}
+				if !data.LastCheck.IsZero() && !data.LastCheck.Equal(lastChecks[name]) {
+					lastChecks[name] = data.LastCheck
+					report.Checks++
+				}
+
+				history, _ := targets.History(name)
+				for _, e := range history {
+					if e.ResponseTime < 0 {
+						violation("%s: negative response time %s in history", name, e.ResponseTime)
+						break
+					}
+				}
+			}
+
+			report.PeakGoroutines = max(report.PeakGoroutines, runtime.NumGoroutine())
+
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			heap := float64(stats.HeapAlloc) / (1 << 20)
+			report.PeakHeapMiB = max(report.PeakHeapMiB, heap)
+			if heap > float64(maxHeap) {
+				violation("heap exceeded --max-heap %d MiB", maxHeap)
+			}
+
+		case <-progress.C:
+			// progress isn't a log, it's shown regardless of --log-level
+			fmt.Fprintf(os.Stderr, "soak running: elapsed %s, checks %d, goroutines %d, peak heap %d MiB\n", time.Since(started).Truncate(time.Second), report.Checks, runtime.NumGoroutine(), int(report.PeakHeapMiB))
+		}
+	}
+
+	sample.Stop()
+	reload.Stop()
+	progress.Stop()
+	cancel()
+	targets.Wait()
+	readers.Wait()
+	server.Close()
+
+	report.ItemReads = itemReads.Load()
+	report.PeakHeapMiB = float64(int(report.PeakHeapMiB*10)) / 10
+
+	// goroutines of closed connections exit asynchronously
+	leaked := 0
+	for wait := time.Now().Add(10 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+		leaked = runtime.NumGoroutine() - baseline
+		if leaked <= soakLeakSlack || time.Now().After(wait) {
+			break
+		}
+	}
+	if leaked > soakLeakSlack {
+		report.LeakedRoutines = leaked
+		violation("%d goroutines leaked", leaked)
+		pprof.Lookup("goroutine").WriteTo(os.Stderr, 1)
+	}
+
+	if output == outputJSON {
+		if err := writeJSON(report); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "TARGETS\t%d\n", report.Targets)
+		fmt.Fprintf(w, "DURATION\t%s\n", report.Duration)
+		race := "disabled"
+		if report.Race {
+			race = "enabled"
+		}
+		fmt.Fprintf(w, "RACE DETECTOR\t%s\n", race)
+		fmt.Fprintf(w, "CHECKS\t%d\n", report.Checks)
+		fmt.Fprintf(w, "RELOADS\t%d\n", report.Reloads)
+		fmt.Fprintf(w, "ITEM READS\t%d\n", report.ItemReads)
+		fmt.Fprintf(w, "PEAK GOROUTINES\t%d\n", report.PeakGoroutines)
+		fmt.Fprintf(w, "LEAKED GOROUTINES\t%d\n", report.LeakedRoutines)
+		fmt.Fprintf(w, "PEAK HEAP\t%.1f MiB\n", report.PeakHeapMiB)
+		for _, v := range report.Violations {
+			fmt.Fprintf(w, "VIOLATION\t%s\n", v)
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(report.Violations) > 0 {
+		return checksFailed(errors.New(fmt.Sprintf("soak failed with %d violations", len(report.Violations))))
+	}
+
+	return nil
+}
+
+// writeSoakTargets writes count targets cycling through selftest cases,
+// generation changes interval of every other target, so reload restarts them
+func writeSoakTargets(path string, count int, serverURL string, port string, generation int) error {
+	var doc strings.Builder
+	for i := 0; i < count; i++ {
+		c := selftestCases[i%len(selftestCases)]
+		interval := soakInterval
+		if i%2 == 1 {
+			interval += generation % 2
+		}
+
+		target := strings.TrimSuffix(fmt.Sprintf(c.target, serverURL, port), "}")
+		fmt.Fprintf(&doc, "%s-%d: %s, interval: %d, jitter: 500ms, history: 20}\n", c.name, i, target, interval)
+	}
+
+	return os.WriteFile(path, []byte(doc.String()), 0o600)
+}
+
+func isNegative(value interface{}) bool {
+	switch v := value.(type) {
+	case int64:
+		return v < 0
+	case float64:
+		return v < 0
+	}
+	return false
+}
+
+// raceEnabled reports whether binary was built with -race
+func raceEnabled() bool {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return false
+	}
+	for _, s := range info.Settings {
+		if s.Key == "-race" {
+			return s.Value == "true"
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+//go:build soak
+
+package main
+
+import (
+	"flag"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var (
+	soakTargets  = flag.Int("soak.targets", 300, "number of targets of soak test")
+	soakDuration = flag.Duration("soak.duration", 5*time.Minute, "duration of soak test")
+)
+
+// TestSoak runs soak test, it's excluded from regular runs:
+//
+//	go test -race -tags soak -run Soak -timeout 0 ./cmd/zcm -soak.duration 10m
+func TestSoak(t *testing.T) {
+	if !raceEnabled() {
+		t.Fatal("soak test needs race detector, run it with go test -race")
+	}
+
+	args := []string{"--targets", strconv.Itoa(*soakTargets), "--duration", soakDuration.String()}
+	if err := runSoak(args); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ellezio/zcm/internal/importer"
+)
+
+func runTargetsCommand(args []string) error {
+	if len(args) == 0 {
+		return configError(errors.New("missing targets subcommand, available: import"))
+	}
+
+	switch args[0] {
+	case "import":
+		return runTargetsImport(args[1:])
+	default:
+		return configError(errors.New(fmt.Sprintf("unknown targets subcommand \"%s\"", args[0])))
+	}
+}
+
+func runTargetsImport(args []string) error {
+	var (
+		curl, name  string
+		openapi     string
+		openapiOpts importer.OpenAPIOptions
+		zabbix      string
+
+		blackboxConfig, blackboxTargets string
+	)
+
+	argsLen := len(args)
+	for i := 0; i < argsLen; i++ {
+		switch args[i] {
+		case "--curl":
+			i++
+			if i < argsLen {
+				curl = args[i]
+			}
+
+			if curl == "" {
+				return configError(errors.New("invalid argument for \"--curl\""))
+			}
+
+		case "--name", "-n":
+			i++
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				name = args[i]
+			}
+
+			if name == "" {
+				return configError(errors.New("invalid argument for \"--name\""))
+			}
+
+		case "--openapi":
+			i++
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				openapi = args[i]
+			}
+
+			if openapi == "" {
+				return configError(errors.New("invalid argument for \"--openapi\""))
+			}
+
+		case "--zabbix-export":
+			i++
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				zabbix = args[i]
+			}
+
+			if zabbix == "" {
+				return configError(errors.New("invalid argument for \"--zabbix-export\""))
+			}
+
+		case "--blackbox-config":
+			i++
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				blackboxConfig = args[i]
+			}
+
+			if blackboxConfig == "" {
+				return configError(errors.New("invalid argument for \"--blackbox-config\""))
+			}
+
+		case "--blackbox-targets":
+			i++
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				blackboxTargets = args[i]
+			}
+
+			if blackboxTargets == "" {
+				return configError(errors.New("invalid argument for \"--blackbox-targets\""))
+			}
+
+		case "--base-url":
+			i++
+			if i < argsLen && !strings.HasPrefix(args[i], "-") {
+				openapiOpts.BaseUrl = args[i]
+			}
+
+			if openapiOpts.BaseUrl == "" {
+				return configError(errors.New("invalid argument for \"--base-url\""))
+			}
+
+		case "--all-operations":
+			openapiOpts.AllOperations = true
+
+		default:
+			return configError(errors.New(fmt.Sprintf("unknown argument \"%s\"", args[i])))
+		}
+	}
+
+	var (
+		targets  map[string]*importer.Target
+		warnings []string
+		sources  int
+	)
+
+	for _, source := range []string{curl, openapi, zabbix, blackboxConfig} {
+		if source != "" {
+			sources++
+		}
+	}
+
+	switch {
+	case sources > 1:
+		return configError(errors.New("only one import source can be used at once"))
+
+	case curl != "":
+		target, w, err := importer.FromCurl(curl)
+		if err != nil {
+			return configError(err)
+		}
+
+		if name == "" {
+			name = importer.TargetName(target.Url)
+		}
+		targets, warnings = map[string]*importer.Target{name: target}, w
+
+	case openapi != "":
+		data, err := os.ReadFile(openapi)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Error while reading file, error: %s", err))
+		}
+
+		targets, warnings, err = importer.FromOpenAPI(data, openapiOpts)
+		if err != nil {
+			return configError(err)
+		}
+
+	case zabbix != "":
+		data, err := os.ReadFile(zabbix)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Error while reading file, error: %s", err))
+		}
+
+		targets, warnings, err = importer.FromZabbixExport(data)
+		if err != nil {
+			return configError(err)
+		}
+
+	case blackboxConfig != "":
+		if blackboxTargets == "" {
+			return configError(errors.New("missing \"--blackbox-targets\" for \"--blackbox-config\""))
+		}
+
+		config, err := os.ReadFile(blackboxConfig)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Error while reading file, error: %s", err))
+		}
+
+		list, err := os.ReadFile(blackboxTargets)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Error while reading file, error: %s", err))
+		}
+
+		targets, warnings, err = importer.FromBlackbox(config, list)
+		if err != nil {
+			return configError(err)
+		}
+
+	default:
+		return configError(errors.New("missing import source, available: --curl, --openapi, --zabbix-export, --blackbox-config"))
+	}
+
+	for _, w := range warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+
+	out, err := importer.Marshal(targets)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(out)
+	return err
+}
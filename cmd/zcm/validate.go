@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ellezio/zcm/internal/monitoring"
+)
+
+// validateResult is machine-readable output of validate command
+type validateResult struct {
+	File    string   `json:"file"`
+	Valid   bool     `json:"valid"`
+	Targets int      `json:"targets"`
+	Errors  []string `json:"errors"`
+}
+
+// runValidate checks targets file without starting monitoring and
+// prints every error found in it
+func runValidate(args []string) error {
+	targetsFile, env := "monitoring-targets.yml", ""
+	output := outputTable
+
+	argsLen := len(args)
+	for i := 0; i < argsLen; i++ {
+		switch args[i] {
+		case "--targets-file", "-t":
+			i++
+			if i >= argsLen || args[i] == "" || strings.HasPrefix(args[i], "-") {
+				return configError(errors.New("invalid argument for \"--targets-file\""))
+			}
+			targetsFile = args[i]
+
+		case "--env", "-e":
+			i++
+			if i >= argsLen || args[i] == "" || strings.HasPrefix(args[i], "-") {
+				return configError(errors.New("invalid argument for \"--env\""))
+			}
+			env = args[i]
+
+		case "--output", "-o":
+			i++
+			var err error
+			if output, err = parseOutput(args, i); err != nil {
+				return err
+			}
+
+		default:
+			return configError(errors.New(fmt.Sprintf("unknown argument \"%s\"", args[i])))
+		}
+	}
+
+	count, errs := monitoring.ValidateTargets(targetsFile, env)
+
+	if output == outputJSON {
+		result := validateResult{File: targetsFile, Valid: len(errs) == 0, Targets: count, Errors: []string{}}
+		for _, err := range errs {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		if err := writeJSON(result); err != nil {
+			return err
+		}
+	} else if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	} else {
+		fmt.Printf("%s is valid, %d targets\n", targetsFile, count)
+	}
+
+	if len(errs) > 0 {
+		return configError(errors.New(fmt.Sprintf("%s is invalid, %d errors found", targetsFile, len(errs))))
+	}
+	return nil
+}
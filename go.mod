@@ -2,4 +2,18 @@ module github.com/ellezio/zcm
 
 go 1.22.6
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	filippo.io/age v1.2.1
+	github.com/fsnotify/fsnotify v1.7.0
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	golang.org/x/net v0.25.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.21.0
+
+require golang.org/x/crypto v0.24.0
+
+require github.com/mattn/go-sqlite3 v1.14.33
+
+require golang.org/x/text v0.16.0 // indirect
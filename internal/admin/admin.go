@@ -0,0 +1,365 @@
+// Package admin serves control API of agent, e.g. reload of targets.
+// Every request is authenticated with bearer token or client certificate,
+// mutating requests can be made idempotent with Idempotency-Key header
+// and are recorded in audit log.
+package admin
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ellezio/zcm/internal/monitoring"
+)
+
+// maxBodySize limits body of API requests
+const maxBodySize = 1 << 20
+
+// Scope is permission granted to caller, every endpoint requires one
+type Scope string
+
+const (
+	// ScopeRead allows reading state of agent and targets
+	ScopeRead Scope = "read"
+	// ScopeControl allows controlling monitoring, e.g. reload of targets
+	ScopeControl Scope = "control"
+	// ScopeConfigWrite allows changing configuration of targets
+	ScopeConfigWrite Scope = "config-write"
+)
+
+// AllScopes are granted to callers without explicit scopes
+var AllScopes = []Scope{ScopeRead, ScopeControl, ScopeConfigWrite}
+
+// ParseScopes parses comma separated list of scopes
+func ParseScopes(s string) ([]Scope, error) {
+	var scopes []Scope
+	for _, name := range strings.Split(s, ",") {
+		scope := Scope(strings.TrimSpace(name))
+		switch scope {
+		case ScopeRead, ScopeControl, ScopeConfigWrite:
+			scopes = append(scopes, scope)
+		default:
+			return nil, errors.New(fmt.Sprintf("unknown admin scope \"%s\", available: read, control, config-write", scope))
+		}
+	}
+	return scopes, nil
+}
+
+// Token is holder of bearer token, name identifies caller in audit log
+type Token struct {
+	Name   string
+	Scopes []Scope
+}
+
+type Options struct {
+	// Tokens maps bearer tokens to their holders
+	Tokens map[string]Token
+	// ClientCerts is set when server requires verified client certificate,
+	// its common name identifies caller when request has no token
+	ClientCerts bool
+	// CertScopes are granted to callers authenticated only with client
+	// certificate, all scopes when empty
+	CertScopes []Scope
+	// RequireIdempotencyKey rejects mutating requests without Idempotency-Key
+	RequireIdempotencyKey bool
+	// Audit receives audit log as JSON lines, it is logged only with slog when nil
+	Audit io.Writer
+}
+
+type handler struct {
+	targets *monitoring.Targets
+	opts    Options
+	mux     *http.ServeMux
+	// routes are endpoints by pattern
+	routes map[string]route
+	keys   *idempotencyStore
+	audit  *auditLog
+}
+
+type route struct {
+	scope Scope
+	// stream is set for endpoints which stream response, it is passed
+	// to caller as it is written and recorded for replay at the same time
+	stream bool
+}
+
+// Handler serves admin API
+//
+//	GET    /api/v1/status         - fingerprint and number of loaded targets (read)
+//	POST   /api/v1/reload         - reload targets file (control)
+//	POST   /api/v1/run            - run checks of all or filtered targets now and stream results (control)
+//	GET    /api/v1/targets        - names, types and sources of targets (read)
+//	POST   /api/v1/targets        - add target at runtime (config-write)
+//	PUT    /api/v1/targets/{name} - add or replace target added at runtime (config-write)
+//	DELETE /api/v1/targets/{name} - remove target added at runtime (config-write)
+func Handler(targets *monitoring.Targets, opts Options) http.Handler {
+	if len(opts.CertScopes) == 0 {
+		opts.CertScopes = AllScopes
+	}
+
+	h := &handler{
+		targets: targets,
+		opts:    opts,
+		mux:     http.NewServeMux(),
+		routes:  map[string]route{},
+		keys:    newIdempotencyStore(),
+		audit:   &auditLog{w: opts.Audit},
+	}
+
+	h.handle("GET /api/v1/status", route{scope: ScopeRead}, h.status)
+	h.handle("POST /api/v1/reload", route{scope: ScopeControl}, h.reload)
+	h.handle("POST /api/v1/run", route{scope: ScopeControl, stream: true}, h.run)
+	h.handle("GET /api/v1/targets", route{scope: ScopeRead}, h.listTargets)
+	h.handle("POST /api/v1/targets", route{scope: ScopeConfigWrite}, h.addTarget)
+	h.handle("PUT /api/v1/targets/{name}", route{scope: ScopeConfigWrite}, h.putTarget)
+	h.handle("DELETE /api/v1/targets/{name}", route{scope: ScopeConfigWrite}, h.removeTarget)
+
+	return h
+}
+
+func (h *handler) handle(pattern string, rt route, handler http.HandlerFunc) {
+	h.mux.HandleFunc(pattern, handler)
+	h.routes[pattern] = rt
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	identity, scopes, ok := h.authenticate(r)
+	if !ok {
+		h.audit.record(auditEntry{Remote: r.RemoteAddr, Method: r.Method, Path: r.URL.Path, Status: http.StatusUnauthorized, Error: "authentication failed"})
+		w.Header().Set("WWW-Authenticate", `Bearer realm="zcm"`)
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	// unknown endpoints are left to mux, so they are answered with 404 or 405
+	_, pattern := h.mux.Handler(r)
+	rt, known := h.routes[pattern]
+	if known {
+		if !slices.Contains(scopes, rt.scope) {
+			msg := fmt.Sprintf("%s lacks scope %s", identity, rt.scope)
+			h.audit.record(auditEntry{Identity: identity, Remote: r.RemoteAddr, Method: r.Method, Path: r.URL.Path, Status: http.StatusForbidden, Error: msg})
+			writeError(w, http.StatusForbidden, msg)
+			return
+		}
+	}
+
+	if !isMutating(r.Method) {
+		h.mux.ServeHTTP(w, r)
+		return
+	}
+
+	entry := auditEntry{Identity: identity, Remote: r.RemoteAddr, Method: r.Method, Path: r.URL.Path}
+	defer func() { h.audit.record(entry) }()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		entry.Status, entry.Error = http.StatusRequestEntityTooLarge, "request body too large"
+		writeError(w, entry.Status, entry.Error)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		if h.opts.RequireIdempotencyKey {
+			entry.Status, entry.Error = http.StatusBadRequest, "Idempotency-Key header is required"
+			writeError(w, entry.Status, entry.Error)
+			return
+		}
+
+		rec := newRecorder(w, rt.stream)
+		h.mux.ServeHTTP(rec, r)
+		rec.writeTo(w)
+		entry.Status, entry.Error = rec.status, rec.errorMessage()
+		return
+	}
+	entry.IdempotencyKey = key
+
+	if !isValidKey(key) {
+		entry.Status, entry.Error = http.StatusBadRequest, "Idempotency-Key must be 1 to 255 printable ASCII characters"
+		writeError(w, entry.Status, entry.Error)
+		return
+	}
+
+	res, status := h.keys.begin(identity+"\x00"+key, requestFingerprint(r, body))
+	switch status {
+	case keyInProgress:
+		entry.Status, entry.Error = http.StatusConflict, "request with this Idempotency-Key is in progress"
+		writeError(w, entry.Status, entry.Error)
+		return
+	case keyMismatch:
+		entry.Status, entry.Error = http.StatusUnprocessableEntity, "Idempotency-Key was used with different request"
+		writeError(w, entry.Status, entry.Error)
+		return
+	case keyCompleted:
+		w.Header().Set("Idempotent-Replayed", "true")
+		res.writeTo(w)
+		entry.Status, entry.Replayed = res.status, true
+		return
+	}
+
+	completed := false
+	defer func() {
+		// handler panicked, reservation would block retries until keyTTL
+		if !completed {
+			h.keys.release(identity + "\x00" + key)
+			entry.Status, entry.Error = http.StatusInternalServerError, "request handler failed"
+		}
+	}()
+
+	rec := newRecorder(w, rt.stream)
+	h.mux.ServeHTTP(rec, r)
+	rec.writeTo(w)
+	h.keys.complete(identity+"\x00"+key, rec)
+	completed = true
+	entry.Status, entry.Error = rec.status, rec.errorMessage()
+}
+
+// authenticate returns identity of caller, token holder's name or common
+// name of client certificate, and scopes granted to it
+func (h *handler) authenticate(r *http.Request) (string, []Scope, bool) {
+	var certName string
+	if h.opts.ClientCerts {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			return "", nil, false
+		}
+		certName = "cert:" + r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+
+	if len(h.opts.Tokens) == 0 {
+		return certName, h.opts.CertScopes, certName != ""
+	}
+
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", nil, false
+	}
+
+	// every token is compared, so time doesn't tell which one is close
+	var holder Token
+	for t, tok := range h.opts.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			holder = tok
+		}
+	}
+	return holder.Name, holder.Scopes, holder.Name != ""
+}
+
+func (h *handler) status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"fingerprint": h.targets.Fingerprint(),
+		"targets":     len(h.targets.Names()),
+	})
+}
+
+func (h *handler) reload(w http.ResponseWriter, r *http.Request) {
+	if err := h.targets.Reload(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("reload failed, keeping previous configuration: %s", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"fingerprint": h.targets.Fingerprint()})
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// LoadTokens reads tokens from file with one "name:token" or
+// "name:token:scopes" per line, scopes are comma separated and all scopes
+// are granted when they are omitted, empty lines and lines starting with # are skipped
+func LoadTokens(path string) (map[string]Token, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error while reading admin token file, error: %s", err))
+	}
+	defer f.Close()
+
+	tokens := map[string]Token{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, token, ok := strings.Cut(line, ":")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+
+		scopes := AllScopes
+		// token itself may contain colon, scopes are only what parses as scopes
+		if i := strings.LastIndex(token, ":"); i >= 0 {
+			if s, err := ParseScopes(token[i+1:]); err == nil {
+				scopes, token = s, strings.TrimSpace(token[:i])
+			}
+		}
+
+		if !ok || name == "" || len(token) < 16 {
+			return nil, errors.New(fmt.Sprintf("%s:%d: expected \"name:token\" or \"name:token:scopes\" with token of at least 16 characters", path, n))
+		}
+		if _, ok := tokens[token]; ok {
+			return nil, errors.New(fmt.Sprintf("%s:%d: token of %s is not unique", path, n, name))
+		}
+		tokens[token] = Token{Name: name, Scopes: scopes}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error while reading admin token file, error: %s", err))
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New(fmt.Sprintf("no tokens in admin token file %s", path))
+	}
+
+	return tokens, nil
+}
+
+// ServerTLSConfig returns TLS configuration of admin listener, client
+// certificates signed by CA of clientCAFile are required when it is set
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error while loading admin certificate, error: %s", err))
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		data, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("error while reading admin client ca file, error: %s", err))
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New(fmt.Sprintf("no PEM encoded certificates found in admin client ca file %s", clientCAFile))
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
@@ -0,0 +1,380 @@
+package admin
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ellezio/zcm/internal/monitoring"
+)
+
+func testHandler(t *testing.T, opts Options) *handler {
+	t.Helper()
+
+	targets, err := monitoring.ParseTargets([]byte("api: {url: https://example.com/health}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Handler(targets, opts).(*handler)
+}
+
+func serve(h http.Handler, method, path, token, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", token)
+	}
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+var testTokens = map[string]Token{
+	"read-token":  {Name: "reader", Scopes: []Scope{ScopeRead}},
+	"admin-token": {Name: "admin", Scopes: AllScopes},
+	"other-token": {Name: "other", Scopes: AllScopes},
+}
+
+func TestAuthentication(t *testing.T) {
+	h := testHandler(t, Options{Tokens: testTokens})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"without token", "GET", "/api/v1/status", "", http.StatusUnauthorized},
+		{"unknown token", "GET", "/api/v1/status", "Bearer wrong", http.StatusUnauthorized},
+		{"prefix of token", "GET", "/api/v1/status", "Bearer read", http.StatusUnauthorized},
+		{"empty token", "GET", "/api/v1/status", "Bearer ", http.StatusUnauthorized},
+		{"other scheme", "GET", "/api/v1/status", "Basic read-token", http.StatusUnauthorized},
+		{"token without scheme", "GET", "/api/v1/status", "read-token", http.StatusUnauthorized},
+		{"unauthenticated unknown endpoint", "GET", "/api/v1/unknown", "", http.StatusUnauthorized},
+		{"read scope", "GET", "/api/v1/status", "Bearer read-token", http.StatusOK},
+		{"scheme is case insensitive", "GET", "/api/v1/targets", "bearer read-token", http.StatusOK},
+		{"missing control scope", "POST", "/api/v1/reload", "Bearer read-token", http.StatusForbidden},
+		{"missing config-write scope", "DELETE", "/api/v1/targets/api", "Bearer read-token", http.StatusForbidden},
+		{"all scopes", "GET", "/api/v1/status", "Bearer admin-token", http.StatusOK},
+		{"unknown endpoint", "GET", "/api/v1/unknown", "Bearer admin-token", http.StatusNotFound},
+		{"unknown method", "PATCH", "/api/v1/status", "Bearer admin-token", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, tt.method, tt.path, tt.token, "", "")
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("WWW-Authenticate header is missing")
+			}
+			if tt.status == http.StatusForbidden && !strings.Contains(w.Body.String(), "reader lacks scope") {
+				t.Errorf("got body %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestClientCertificateScopes(t *testing.T) {
+	h := testHandler(t, Options{ClientCerts: true, CertScopes: []Scope{ScopeRead}})
+
+	request := func(method, path string, cn string) int {
+		r := httptest.NewRequest(method, path, nil)
+		if cn != "" {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if status := request("GET", "/api/v1/status", ""); status != http.StatusUnauthorized {
+		t.Errorf("without certificate: got status %d", status)
+	}
+	if status := request("GET", "/api/v1/status", "zabbix"); status != http.StatusOK {
+		t.Errorf("with certificate: got status %d", status)
+	}
+	if status := request("POST", "/api/v1/reload", "zabbix"); status != http.StatusForbidden {
+		t.Errorf("outside of certificate scopes: got status %d", status)
+	}
+}
+
+// handleTest registers endpoint counting its calls, fail decides
+// how call n fails, it can panic
+func handleTest(h *handler, calls *atomic.Int32, fail func(n int32, w http.ResponseWriter) bool) {
+	h.handle("POST /api/v1/test", route{scope: ScopeControl}, func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if fail != nil && fail(n, w) {
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"call": n, "body": string(body)})
+	})
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	h := testHandler(t, Options{Tokens: testTokens})
+	var calls atomic.Int32
+	handleTest(h, &calls, nil)
+
+	first := serve(h, "POST", "/api/v1/test", "Bearer admin-token", "key-1", "a")
+	if first.Code != http.StatusCreated || calls.Load() != 1 {
+		t.Fatalf("got status %d after %d calls", first.Code, calls.Load())
+	}
+
+	replay := serve(h, "POST", "/api/v1/test", "Bearer admin-token", "key-1", "a")
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() {
+		t.Errorf("got replay %d %s, want %d %s", replay.Code, replay.Body, first.Code, first.Body)
+	}
+	if replay.Header().Get("Idempotent-Replayed") != "true" || replay.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("got replay headers %v", replay.Header())
+	}
+	if calls.Load() != 1 {
+		t.Errorf("replayed request was executed, %d calls", calls.Load())
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		key    string
+		body   string
+		status int
+		calls  int32
+	}{
+		{"different body", "/api/v1/test", "Bearer admin-token", "key-1", "b", http.StatusUnprocessableEntity, 1},
+		{"different query", "/api/v1/test?x=1", "Bearer admin-token", "key-1", "a", http.StatusUnprocessableEntity, 1},
+		{"other caller with the same key", "/api/v1/test", "Bearer other-token", "key-1", "a", http.StatusCreated, 2},
+		{"other key", "/api/v1/test", "Bearer admin-token", "key-2", "a", http.StatusCreated, 3},
+		{"without key", "/api/v1/test", "Bearer admin-token", "", "a", http.StatusCreated, 4},
+		{"without key again", "/api/v1/test", "Bearer admin-token", "", "a", http.StatusCreated, 5},
+		{"non-ascii key", "/api/v1/test", "Bearer admin-token", "klíč", "a", http.StatusBadRequest, 5},
+		{"too long key", "/api/v1/test", "Bearer admin-token", strings.Repeat("k", 256), "a", http.StatusBadRequest, 5},
+		{"replay after other requests", "/api/v1/test", "Bearer admin-token", "key-1", "a", http.StatusCreated, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, "POST", tt.path, tt.token, tt.key, tt.body)
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if calls.Load() != tt.calls {
+				t.Errorf("got %d calls, want %d", calls.Load(), tt.calls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyRequired(t *testing.T) {
+	h := testHandler(t, Options{Tokens: testTokens, RequireIdempotencyKey: true})
+	var calls atomic.Int32
+	handleTest(h, &calls, nil)
+
+	if w := serve(h, "POST", "/api/v1/test", "Bearer admin-token", "", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := serve(h, "GET", "/api/v1/status", "Bearer admin-token", "", ""); w.Code != http.StatusOK {
+		t.Errorf("read request: got status %d, want %d", w.Code, http.StatusOK)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("request without key was executed")
+	}
+}
+
+func TestIdempotencyServerErrorIsNotStored(t *testing.T) {
+	h := testHandler(t, Options{Tokens: testTokens})
+	var calls atomic.Int32
+	handleTest(h, &calls, func(n int32, w http.ResponseWriter) bool {
+		if n == 1 {
+			writeError(w, http.StatusServiceUnavailable, "try later")
+			return true
+		}
+		return false
+	})
+
+	if w := serve(h, "POST", "/api/v1/test", "Bearer admin-token", "key", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d", w.Code)
+	}
+	if w := serve(h, "POST", "/api/v1/test", "Bearer admin-token", "key", ""); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry after server error: got status %d, headers %v", w.Code, w.Header())
+	}
+	if calls.Load() != 2 {
+		t.Errorf("got %d calls, want 2", calls.Load())
+	}
+}
+
+func TestEmptyResponse(t *testing.T) {
+	var audit bytes.Buffer
+	h := testHandler(t, Options{Tokens: testTokens, Audit: &audit})
+	var calls atomic.Int32
+	handleTest(h, &calls, func(n int32, w http.ResponseWriter) bool {
+		return true
+	})
+
+	for _, key := range []string{"", "key", "key"} {
+		if w := serve(h, "POST", "/api/v1/test", "Bearer admin-token", key, ""); w.Code != http.StatusOK || w.Body.Len() != 0 {
+			t.Errorf("key %q: got status %d, body %q", key, w.Code, w.Body)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("got %d calls, want 2", calls.Load())
+	}
+	if strings.Count(audit.String(), `"status":200`) != 3 {
+		t.Errorf("got audit log %s", audit.String())
+	}
+}
+
+func TestIdempotencyKeyReleasedAfterPanic(t *testing.T) {
+	var audit bytes.Buffer
+	h := testHandler(t, Options{Tokens: testTokens, Audit: &audit})
+	var calls atomic.Int32
+	handleTest(h, &calls, func(n int32, w http.ResponseWriter) bool {
+		if n == 1 {
+			panic("handler failed")
+		}
+		return false
+	})
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("handler didn't panic")
+			}
+		}()
+		serve(h, "POST", "/api/v1/test", "Bearer admin-token", "key", "")
+	}()
+
+	entry := auditEntry{}
+	if err := json.Unmarshal(audit.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid audit log %q: %s", audit.String(), err)
+	}
+	if entry.Status != http.StatusInternalServerError || entry.IdempotencyKey != "key" {
+		t.Errorf("got audit entry %+v", entry)
+	}
+
+	// retry isn't rejected as in progress
+	if w := serve(h, "POST", "/api/v1/test", "Bearer admin-token", "key", ""); w.Code != http.StatusCreated {
+		t.Fatalf("retry after panic: got status %d: %s", w.Code, w.Body)
+	}
+	if w := serve(h, "POST", "/api/v1/test", "Bearer admin-token", "key", ""); w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("completed retry isn't replayed, got status %d", w.Code)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("got %d calls, want 2", calls.Load())
+	}
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	s := newIdempotencyStore()
+	a := [32]byte{1}
+	b := [32]byte{2}
+
+	if _, status := s.begin("k", a); status != keyNew {
+		t.Fatalf("got status %d, want new", status)
+	}
+	if _, status := s.begin("k", a); status != keyInProgress {
+		t.Errorf("got status %d, want in progress", status)
+	}
+	if _, status := s.begin("k", b); status != keyMismatch {
+		t.Errorf("got status %d, want mismatch", status)
+	}
+
+	s.complete("k", &recorder{status: http.StatusOK, body: []byte("done")})
+	// completed key isn't released
+	s.release("k")
+	if res, status := s.begin("k", a); status != keyCompleted || string(res.body) != "done" {
+		t.Errorf("got status %d, want completed", status)
+	}
+
+	// released key is reserved again once, at the end of order
+	s.begin("r", a)
+	s.release("r")
+	s.begin("r", a)
+	if fmt.Sprint(s.order) != "[k r]" {
+		t.Errorf("got order %v, want [k r]", s.order)
+	}
+
+	s.entries["k"].created = s.entries["k"].created.Add(-keyTTL)
+	s.expire(s.entries["r"].created)
+	if _, ok := s.entries["k"]; ok || fmt.Sprint(s.order) != "[r]" {
+		t.Errorf("expired key is kept, order %v", s.order)
+	}
+}
+
+func TestRuntimeTargetRestrictions(t *testing.T) {
+	h := testHandler(t, Options{Tokens: testTokens})
+
+	tests := []struct {
+		name       string
+		definition string
+	}{
+		{"exec", `{"type": "exec", "command": ["touch", "/tmp/zcm-admin-test"]}`},
+		{"file in url", `{"url": "https://example.com/?k={file:/etc/hostname}"}`},
+		{"file in header", `{"url": "https://example.com", "headers": {"X-Key": "{file:/etc/hostname}"}}`},
+		{"file in token", `{"url": "https://example.com", "authorization": {"type": "Bearer", "token": "{file:/etc/hostname}"}}`},
+		{"token file", `{"url": "https://example.com", "authorization": {"type": "Bearer", "token-file": "/etc/hostname"}}`},
+		{"password file", `{"url": "https://example.com", "authorization": {"type": "Basic", "username": "a", "password-file": "/etc/hostname"}}`},
+		{"proxy password file", `{"url": "https://example.com", "proxy": "http://proxy:3128", "proxy-authorization": {"type": "NTLM", "username": "a", "password-file": "/etc/hostname"}}`},
+		{"golden file", `{"url": "https://example.com", "golden": {"file": "/tmp/zcm-admin-test"}}`},
+		{"ca file", `{"url": "https://example.com", "tls": {"ca-file": "/etc/hostname"}}`},
+		{"cert file", `{"url": "https://example.com", "tls": {"cert-file": "/etc/hostname", "key-file": "/etc/hostname"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, "POST", "/api/v1/targets", "Bearer admin-token", "", `{"restricted": `+tt.definition+`}`)
+			if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "runtime") {
+				t.Errorf("POST: got status %d: %s", w.Code, w.Body)
+			}
+			w = serve(h, "PUT", "/api/v1/targets/restricted", "Bearer admin-token", "", tt.definition)
+			if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "runtime") {
+				t.Errorf("PUT: got status %d: %s", w.Code, w.Body)
+			}
+			if h.targets.IsRuntime("restricted") {
+				t.Error("restricted target was added")
+			}
+		})
+	}
+
+	w := serve(h, "PUT", "/api/v1/targets/allowed", "Bearer admin-token", "", `{"url": "https://example.com", "tls": {"insecure-skip-verify": true}}`)
+	if w.Code != http.StatusCreated {
+		t.Errorf("allowed target: got status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestListTargets(t *testing.T) {
+	targets, err := monitoring.ParseTargets([]byte("api: {url: https://example.com/health, labels: {team: backend, env: prod}}\ndb: {type: tcp, host: 127.0.0.1, port: 5432}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Handler(targets, Options{Tokens: testTokens})
+	if w := serve(h, "PUT", "/api/v1/targets/web", "Bearer admin-token", "", `{"url": "https://example.com", "labels": {"team": "frontend"}}`); w.Code != http.StatusCreated {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+
+	w := serve(h, "GET", "/api/v1/targets", "Bearer read-token", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	want := `[{"name":"api","type":"http","source":"file","labels":{"env":"prod","team":"backend"}},` +
+		`{"name":"db","type":"tcp","source":"file","labels":{}},` +
+		`{"name":"web","type":"http","source":"runtime","labels":{"team":"frontend"}}]`
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
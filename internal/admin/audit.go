@@ -0,0 +1,48 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// auditEntry records who called mutating endpoint and with what result,
+// failed authentications are recorded without identity
+type auditEntry struct {
+	Time           string `json:"time"`
+	Identity       string `json:"identity,omitempty"`
+	Remote         string `json:"remote"`
+	Method         string `json:"method"`
+	Path           string `json:"path"`
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	Status         int    `json:"status"`
+	Replayed       bool   `json:"replayed,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+type auditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (a *auditLog) record(e auditEntry) {
+	e.Time = time.Now().UTC().Format(time.RFC3339Nano)
+
+	slog.Info("admin request", "identity", e.Identity, "remote", e.Remote, "method", e.Method, "path", e.Path,
+		"idempotency-key", e.IdempotencyKey, "status", e.Status, "replayed", e.Replayed, "error", e.Error)
+
+	if a.w == nil {
+		return
+	}
+
+	b, _ := json.Marshal(e)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.w.Write(append(b, '\n')); err != nil {
+		slog.Error("writing admin audit log failed", "err", err)
+	}
+}
@@ -0,0 +1,232 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// keyTTL is how long responses are kept for replay
+	keyTTL = 24 * time.Hour
+	// maxKeys limits number of kept responses, the oldest are dropped first
+	maxKeys = 10000
+)
+
+type keyStatus int
+
+const (
+	keyNew keyStatus = iota
+	keyInProgress
+	keyMismatch
+	keyCompleted
+)
+
+// idempotencyStore keeps responses of mutating requests by caller and
+// Idempotency-Key, so retried request is answered with the first response
+// instead of being executed again
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*keyEntry
+	// order is keys in order of creation, entries expire in the same order
+	order []string
+}
+
+type keyEntry struct {
+	fingerprint [sha256.Size]byte
+	created     time.Time
+	// res is nil while request is in progress
+	res *recorder
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{entries: map[string]*keyEntry{}}
+}
+
+// begin reserves key for request with fingerprint, response of completed
+// request is returned with keyCompleted
+func (s *idempotencyStore) begin(key string, fingerprint [sha256.Size]byte) (*recorder, keyStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(time.Now())
+
+	if e, ok := s.entries[key]; ok {
+		switch {
+		case e.fingerprint != fingerprint:
+			return nil, keyMismatch
+		case e.res == nil:
+			return nil, keyInProgress
+		}
+		return e.res, keyCompleted
+	}
+
+	if len(s.order) >= maxKeys {
+		delete(s.entries, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.entries[key] = &keyEntry{fingerprint: fingerprint, created: time.Now()}
+	s.order = append(s.order, key)
+
+	return nil, keyNew
+}
+
+// complete stores response of request, server errors aren't stored
+// so the request can be retried with the same key. Response must be
+// already written, stored one is replayed whole even if it was streamed.
+func (s *idempotencyStore) complete(key string, res *recorder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	if res.status >= 500 {
+		s.remove(key)
+		return
+	}
+	res.stream = nil
+	e.res = res
+}
+
+// release drops reservation of key which wasn't completed, e.g. when
+// handler panicked, so the request can be retried with the same key
+func (s *idempotencyStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.res == nil {
+		s.remove(key)
+	}
+}
+
+// remove drops key from entries and order, so key reserved again isn't
+// expired or evicted by its previous position
+func (s *idempotencyStore) remove(key string) {
+	delete(s.entries, key)
+	if i := slices.Index(s.order, key); i != -1 {
+		s.order = slices.Delete(s.order, i, i+1)
+	}
+}
+
+func (s *idempotencyStore) expire(now time.Time) {
+	n := 0
+	for _, key := range s.order {
+		e, ok := s.entries[key]
+		if ok && now.Sub(e.created) < keyTTL {
+			break
+		}
+		delete(s.entries, key)
+		n++
+	}
+	s.order = s.order[n:]
+}
+
+// requestFingerprint identifies request reusing key, so the key
+// can't replay response of different request
+func requestFingerprint(r *http.Request, body []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func isValidKey(key string) bool {
+	if len(key) > 255 {
+		return false
+	}
+	for _, c := range []byte(key) {
+		if c < ' ' || c > '~' {
+			return false
+		}
+	}
+	return key != ""
+}
+
+// recorder keeps response of handler so it can be stored for replay
+type recorder struct {
+	header http.Header
+	status int
+	body   []byte
+	// stream is set when response is passed to it as it is written
+	stream http.ResponseWriter
+}
+
+// newRecorder returns recorder of response to w, streamed response
+// is written to w immediately
+func newRecorder(w http.ResponseWriter, stream bool) *recorder {
+	r := &recorder{header: w.Header()}
+	if stream {
+		r.stream = w
+	}
+	return r
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status != 0 {
+		return
+	}
+	r.status = status
+	if r.stream != nil {
+		r.stream.WriteHeader(status)
+	}
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body = append(r.body, b...)
+	if r.stream != nil {
+		return r.stream.Write(b)
+	}
+	return len(b), nil
+}
+
+// Flush sends streamed response written so far
+func (r *recorder) Flush() {
+	if f, ok := r.stream.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeTo writes recorded response unless it was streamed, replayed
+// responses keep content type
+func (r *recorder) writeTo(w http.ResponseWriter) {
+	// handler which wrote nothing responds with 200 like in net/http,
+	// WriteHeader(0) would panic
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if r.stream != nil {
+		return
+	}
+	if ct := r.header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.WriteHeader(r.status)
+	w.Write(r.body)
+}
+
+// errorMessage returns error of JSON error response for audit log
+func (r *recorder) errorMessage() string {
+	if r.status < 400 {
+		return ""
+	}
+	var res struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(r.body, &res)
+	return res.Error
+}
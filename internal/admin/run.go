@@ -0,0 +1,161 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRunConcurrency limits number of checks run in parallel by run endpoint,
+// checks of the same host are further limited by host-concurrency
+const maxRunConcurrency = 16
+
+// runEvent is line of newline delimited JSON streamed by run endpoint
+type runEvent struct {
+	Event        string   `json:"event"`
+	Target       string   `json:"target,omitempty"`
+	OK           *bool    `json:"ok,omitempty"`
+	Status       string   `json:"status,omitempty"`
+	StatusCode   int      `json:"statusCode,omitempty"`
+	ResponseTime *float64 `json:"responseTime,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Targets      int      `json:"targets,omitempty"`
+	Passed       *int     `json:"passed,omitempty"`
+	Failed       *int     `json:"failed,omitempty"`
+	Duration     *float64 `json:"duration,omitempty"`
+}
+
+// run runs checks of targets selected by target (name or pattern) and
+// label (name=value) query parameters now, results are streamed as
+// checks finish
+func (h *handler) run(w http.ResponseWriter, r *http.Request) {
+	names, err := h.selectTargets(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(names) == 0 {
+		writeError(w, http.StatusNotFound, "no target matches filter")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	send := func(e runEvent) {
+		enc.Encode(e)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+
+	start := time.Now()
+	send(runEvent{Event: "start", Targets: len(names)})
+
+	results := make(chan runEvent)
+	sem := make(chan struct{}, maxRunConcurrency)
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-r.Context().Done():
+				return
+			}
+
+			e := runEvent{Event: "result", Target: name}
+			if data, ok := h.targets.RunNow(r.Context(), name); ok {
+				passed := !data.LastFailed
+				responseTime := float64(data.LastResponseTime.Microseconds()) / 1000
+				e.OK, e.Status, e.StatusCode, e.ResponseTime, e.Error = &passed, data.LastStatus, data.LastStatusCode, &responseTime, data.LastFailure
+			} else {
+				e.Error = "check didn't finish, target was removed or request cancelled"
+			}
+
+			select {
+			case results <- e:
+			case <-r.Context().Done():
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	passed, failed := 0, 0
+	for e := range results {
+		if e.OK != nil && *e.OK {
+			passed++
+		} else {
+			failed++
+		}
+		send(e)
+	}
+
+	duration := float64(time.Since(start).Microseconds()) / 1000
+	send(runEvent{Event: "done", Targets: len(names), Passed: &passed, Failed: &failed, Duration: &duration})
+}
+
+// selectTargets returns names of targets matching every given filter,
+// all targets without filters
+func (h *handler) selectTargets(r *http.Request) ([]string, error) {
+	patterns := r.URL.Query()["target"]
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid target pattern \"%s\"", p))
+		}
+	}
+
+	labels := map[string]string{}
+	for _, l := range r.URL.Query()["label"] {
+		name, value, ok := strings.Cut(l, "=")
+		if !ok || name == "" {
+			return nil, errors.New(fmt.Sprintf("invalid label filter \"%s\", expected name=value", l))
+		}
+		labels[name] = value
+	}
+
+	var names []string
+	for _, name := range h.targets.Names() {
+		if len(patterns) > 0 && !matchesAny(patterns, name) {
+			continue
+		}
+		if len(labels) > 0 {
+			targetLabels, _ := h.targets.Labels(name)
+			if !hasLabels(targetLabels, labels) {
+				continue
+			}
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLabels(labels, want map[string]string) bool {
+	for k, v := range want {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
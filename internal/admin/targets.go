@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ellezio/zcm/internal/monitoring"
+)
+
+type targetInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Source is file for targets of targets file, runtime for targets added by API
+	Source string            `json:"source"`
+	Labels map[string]string `json:"labels"`
+}
+
+func (h *handler) listTargets(w http.ResponseWriter, r *http.Request) {
+	names := h.targets.Names()
+	list := make([]targetInfo, 0, len(names))
+	for _, name := range names {
+		typ, _ := h.targets.Type(name)
+		source := "file"
+		if h.targets.IsRuntime(name) {
+			source = "runtime"
+		}
+		labels, _ := h.targets.Labels(name)
+		list = append(list, targetInfo{Name: name, Type: typ, Source: source, Labels: labels})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// addTarget adds target given in body as document of targets file with single target
+func (h *handler) addTarget(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name, err := h.targets.AddTarget(body)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"name": name, "fingerprint": h.targets.Fingerprint()})
+}
+
+// putTarget adds or replaces target with definition given in body
+func (h *handler) putTarget(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := r.PathValue("name")
+	created, err := h.targets.PutTarget(name, body)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, map[string]string{"name": name, "fingerprint": h.targets.Fingerprint()})
+}
+
+func (h *handler) removeTarget(w http.ResponseWriter, r *http.Request) {
+	if err := h.targets.RemoveTarget(r.PathValue("name")); err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"fingerprint": h.targets.Fingerprint()})
+}
+
+// writeTargetError writes error of target change, invalid definition is
+// answered with 422
+func writeTargetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, monitoring.ErrTargetNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, monitoring.ErrTargetExists), errors.Is(err, monitoring.ErrFileTarget):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+	}
+}
@@ -0,0 +1,200 @@
+// Package dashboard serves HTML page with state of targets, so it can be
+// glanced at directly when Zabbix itself is down
+package dashboard
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ellezio/zcm/internal/monitoring"
+)
+
+//go:embed dashboard.html
+var pageSource string
+
+var page = template.Must(template.New("dashboard").Parse(pageSource))
+
+const (
+	sparklineWidth  = 160
+	sparklineHeight = 28
+	// refreshInterval is how often the page reloads itself, in seconds
+	refreshInterval = 10
+)
+
+type pageData struct {
+	Title   string
+	Now     string
+	Refresh int
+	Targets []targetRow
+	Failing int
+	Pending int
+}
+
+type targetRow struct {
+	Name         string
+	Type         string
+	State        string
+	Status       string
+	ResponseTime string
+	LastCheck    string
+	Failure      string
+	Sparkline    sparkline
+}
+
+// sparkline is response time of checks in target's history, points are
+// coordinates of polyline, failed checks are marked
+type sparkline struct {
+	Width, Height int
+	Points        string
+	Failed        []point
+	Max           string
+}
+
+type point struct {
+	X, Y float64
+}
+
+// Handler serves dashboard at /, location is shown in title when given
+func Handler(targets *monitoring.Targets, location string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		now := time.Now()
+		data := pageData{
+			Title:   "zcm",
+			Now:     now.Format(time.DateTime),
+			Refresh: refreshInterval,
+		}
+		if location != "" {
+			data.Title = "zcm " + location
+		}
+
+		for _, name := range targets.Names() {
+			row, ok := rowOf(targets, name, now)
+			if !ok {
+				continue
+			}
+			switch row.State {
+			case "failing":
+				data.Failing++
+			case "pending":
+				data.Pending++
+			}
+			data.Targets = append(data.Targets, row)
+		}
+
+		// failing targets first, so they are seen without scrolling
+		slices.SortStableFunc(data.Targets, func(a, b targetRow) int {
+			return boolOrder(a.State == "failing", b.State == "failing")
+		})
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := page.Execute(w, data); err != nil {
+			slog.Error("rendering dashboard failed", "err", err)
+		}
+	})
+}
+
+func rowOf(targets *monitoring.Targets, name string, now time.Time) (targetRow, bool) {
+	data, ok := targets.GetData(name)
+	if !ok {
+		return targetRow{}, false
+	}
+
+	typ, _ := targets.Type(name)
+	row := targetRow{Name: name, Type: typ, State: "ok", Status: data.LastStatus, Failure: data.LastFailure}
+	if row.Failure == "" {
+		row.Failure = data.LastError
+	}
+
+	switch {
+	case data.LastCheck.IsZero():
+		row.State, row.Status, row.LastCheck = "pending", "not checked yet", "-"
+	default:
+		row.LastCheck = ago(now.Sub(data.LastCheck))
+		row.ResponseTime = formatMillis(data.LastResponseTime)
+		if data.LastFailed {
+			row.State = "failing"
+		}
+	}
+
+	if entries, ok := targets.History(name); ok {
+		row.Sparkline = sparklineOf(entries)
+	}
+
+	return row, true
+}
+
+func sparklineOf(entries []monitoring.HistoryEntry) sparkline {
+	s := sparkline{Width: sparklineWidth, Height: sparklineHeight}
+	if len(entries) == 0 {
+		return s
+	}
+
+	var longest time.Duration
+	for _, e := range entries {
+		if !e.Error {
+			longest = max(longest, e.ResponseTime)
+		}
+	}
+	s.Max = formatMillis(longest)
+
+	step := float64(sparklineWidth)
+	if len(entries) > 1 {
+		step = float64(sparklineWidth) / float64(len(entries)-1)
+	}
+
+	points := make([]string, 0, len(entries))
+	for i, e := range entries {
+		x := float64(i) * step
+		// checks without response are drawn at the bottom
+		y := float64(sparklineHeight - 1)
+		if !e.Error && longest > 0 {
+			y = 1 + float64(sparklineHeight-2)*(1-float64(e.ResponseTime)/float64(longest))
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		if e.Failed {
+			s.Failed = append(s.Failed, point{X: x, Y: y})
+		}
+	}
+	s.Points = strings.Join(points, " ")
+
+	return s
+}
+
+func formatMillis(d time.Duration) string {
+	return fmt.Sprintf("%.1f ms", float64(d.Microseconds())/1000)
+}
+
+// ago formats time elapsed since event, e.g. 5s ago or 3m ago
+func ago(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+}
+
+func boolOrder(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return -1
+	}
+	return 1
+}
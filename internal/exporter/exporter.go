@@ -0,0 +1,191 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ellezio/zcm/internal/monitoring"
+)
+
+// LocationLabel is label with agent's location, it overrides target's label of the same name
+const LocationLabel = "location"
+
+// AgentInfoMetric is metric describing agent itself, its location is in
+// LocationLabel unless empty, so it can't be mistaken for target's label
+const AgentInfoMetric = "zcm_agent_info"
+
+type metric struct {
+	name  string
+	help  string
+	typ   string
+	value func(s series) float64
+	// present reports whether series has value of metric, all have when nil
+	present func(s series) bool
+}
+
+var metrics = []metric{
+	{
+		name: "zcm_target_up", typ: "gauge",
+		help: "Whether last check of target succeeded.",
+		value: func(s series) float64 {
+			return boolFloat(!s.data.LastCheck.IsZero() && !s.data.LastFailed)
+		},
+	},
+	{
+		name: "zcm_target_response_time_seconds", typ: "gauge",
+		help:  "Response time of last check.",
+		value: func(s series) float64 { return s.data.LastResponseTime.Seconds() },
+	},
+	{
+		name: "zcm_target_status_code", typ: "gauge",
+		help:  "HTTP status code of last check, 0 when request failed.",
+		value: func(s series) float64 { return float64(s.data.LastStatusCode) },
+	},
+	{
+		name: "zcm_target_last_check_timestamp_seconds", typ: "gauge",
+		help: "Unix time of last completed check.",
+		value: func(s series) float64 {
+			if s.data.LastCheck.IsZero() {
+				return 0
+			}
+			return float64(s.data.LastCheck.UnixMilli()) / 1000
+		},
+	},
+	{
+		name: "zcm_target_checks_total", typ: "counter",
+		help:  "Number of completed checks.",
+		value: func(s series) float64 { return float64(s.data.Checks) },
+	},
+	{
+		name: "zcm_target_failures_total", typ: "counter",
+		help:  "Number of failed checks, including failed assertions and error statuses.",
+		value: func(s series) float64 { return float64(s.data.Failures) },
+	},
+	{
+		name: "zcm_target_errors_total", typ: "counter",
+		help:  "Number of checks which failed with request error.",
+		value: func(s series) float64 { return float64(s.data.Errors) },
+	},
+	{
+		name: "zcm_target_availability_percent", typ: "gauge",
+		help:    "Percentage of successful checks within target's availability window.",
+		value:   func(s series) float64 { return s.availability },
+		present: func(s series) bool { return s.hasAvailability },
+	},
+	{
+		name: "zcm_target_error_budget_percent", typ: "gauge",
+		help:    "Percentage of error budget left within target's slo window, negative when exhausted.",
+		value:   func(s series) float64 { return s.slo.ErrorBudget },
+		present: func(s series) bool { return s.hasSLO },
+	},
+	{
+		name: "zcm_target_stale", typ: "gauge",
+		help:  "Whether no check completed within target's stale-after.",
+		value: func(s series) float64 { return boolFloat(s.stale) },
+	},
+}
+
+// Handler serves data of targets in Prometheus text exposition format,
+// target's labels and agent's location, unless empty, are added to every series
+func Handler(targets *monitoring.Targets, location string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		write(w, targets, location)
+	})
+}
+
+type series struct {
+	labels string
+	data   monitoring.TargetData
+	stale  bool
+
+	availability    float64
+	hasAvailability bool
+
+	slo    monitoring.SLOStatus
+	hasSLO bool
+}
+
+func write(w io.Writer, targets *monitoring.Targets, location string) {
+	var all []series
+	for _, name := range targets.Names() {
+		data, ok := targets.GetData(name)
+		if !ok {
+			continue
+		}
+
+		labels, ok := targets.Labels(name)
+		if !ok {
+			continue
+		}
+		if location != "" {
+			labels[LocationLabel] = location
+		}
+
+		stale, _ := targets.IsStale(name)
+		availability, hasAvailability := targets.Availability(name)
+		slo, hasSLO := targets.SLO(name)
+		all = append(all, series{
+			labels:          formatLabels(name, labels),
+			data:            data,
+			stale:           stale,
+			availability:    availability,
+			hasAvailability: hasAvailability,
+			slo:             slo,
+			hasSLO:          hasSLO,
+		})
+	}
+
+	fmt.Fprintf(w, "# HELP %s Information about agent, always 1.\n", AgentInfoMetric)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", AgentInfoMetric)
+	if location != "" {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} 1\n", AgentInfoMetric, LocationLabel, escape(location))
+	} else {
+		fmt.Fprintf(w, "%s 1\n", AgentInfoMetric)
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.typ)
+		for _, s := range all {
+			if m.present != nil && !m.present(s) {
+				continue
+			}
+			fmt.Fprintf(w, "%s{%s} %g\n", m.name, s.labels, m.value(s))
+		}
+	}
+}
+
+func formatLabels(target string, labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		// target name takes precedence over label of the same name
+		if name != "target" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	pairs := []string{fmt.Sprintf("target=\"%s\"", escape(target))}
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escape(labels[name])))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return escaper.Replace(value)
+}
+
+func boolFloat(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
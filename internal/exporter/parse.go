@@ -0,0 +1,118 @@
+package exporter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Sample is single series value read from text exposition format
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// ParseSamples reads samples of given metrics from text exposition format,
+// comments and other metrics are skipped
+func ParseSamples(r io.Reader, names ...string) ([]Sample, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var samples []Sample
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		end := strings.IndexAny(line, "{ ")
+		if end == -1 || !wanted[line[:end]] {
+			continue
+		}
+
+		sample, err := parseSample(line, end)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid sample \"%s\", error: %s", line, err))
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, scanner.Err()
+}
+
+func parseSample(line string, nameEnd int) (Sample, error) {
+	sample := Sample{Name: line[:nameEnd], Labels: map[string]string{}}
+
+	rest := line[nameEnd:]
+	if rest[0] == '{' {
+		rest = rest[1:]
+		for {
+			rest = strings.TrimLeft(rest, ", ")
+			if rest == "" {
+				return sample, errors.New("unterminated labels")
+			}
+			if rest[0] == '}' {
+				rest = rest[1:]
+				break
+			}
+
+			eq := strings.Index(rest, "=\"")
+			if eq == -1 {
+				return sample, errors.New("invalid label")
+			}
+			name := rest[:eq]
+
+			value, n, err := unquoteLabel(rest[eq+1:])
+			if err != nil {
+				return sample, err
+			}
+			sample.Labels[name] = value
+			rest = rest[eq+1+n:]
+		}
+	}
+
+	// value may be followed by timestamp
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return sample, errors.New("missing value")
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, err
+	}
+	sample.Value = value
+
+	return sample, nil
+}
+
+// unquoteLabel reads quoted label value and returns it with number of bytes read
+func unquoteLabel(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(s) {
+				break
+			}
+			if s[i] == 'n' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, errors.New("unterminated label value")
+}
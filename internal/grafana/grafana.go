@@ -0,0 +1,307 @@
+package grafana
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ellezio/zcm/internal/monitoring"
+)
+
+// series of target's history available for queries, as <target>.<series>
+var historySeries = map[string]func(e monitoring.HistoryEntry) (float64, bool){
+	// responseTime is in milliseconds, checks without response are skipped
+	"responseTime": func(e monitoring.HistoryEntry) (float64, bool) {
+		return float64(e.ResponseTime.Microseconds()) / 1000, !e.Error
+	},
+	"ok": func(e monitoring.HistoryEntry) (float64, bool) {
+		return boolFloat(!e.Failed), true
+	},
+}
+
+var seriesNames = []string{"responseTime", "ok"}
+
+// Handler serves live state of targets for Grafana, both as simple JSON
+// datasource (/, /search, /query, /annotations) and plain JSON documents
+// for Infinity datasource (/targets, /history)
+func Handler(targets *monitoring.Targets) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// connection test of datasource
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		names := []string{}
+		for _, name := range targets.Names() {
+			for _, s := range seriesNames {
+				names = append(names, name+"."+s)
+			}
+		}
+		writeJSON(w, names)
+	})
+
+	mux.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+		q := &query{}
+		if err := json.NewDecoder(r.Body).Decode(q); err != nil {
+			http.Error(w, fmt.Sprintf("invalid query: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		result := []interface{}{}
+		for _, qt := range q.Targets {
+			if qt.Type == "table" {
+				result = append(result, stateTable(targets))
+				continue
+			}
+
+			ts, err := timeSeries(targets, qt.Target, q.Range)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			result = append(result, ts)
+		}
+		writeJSON(w, result)
+	})
+
+	mux.HandleFunc("/annotations", func(w http.ResponseWriter, r *http.Request) {
+		q := &annotationQuery{}
+		if err := json.NewDecoder(r.Body).Decode(q); err != nil {
+			http.Error(w, fmt.Sprintf("invalid query: %s", err), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, failedChecks(targets, q))
+	})
+
+	mux.HandleFunc("/targets", func(w http.ResponseWriter, r *http.Request) {
+		states := []targetState{}
+		for _, name := range targets.Names() {
+			if s, ok := stateOf(targets, name); ok {
+				states = append(states, s)
+			}
+		}
+		writeJSON(w, states)
+	})
+
+	mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("target")
+		entries, ok := targets.History(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("target \"%s\" not found", name), http.StatusNotFound)
+			return
+		}
+
+		checks := make([]historyCheck, 0, len(entries))
+		for _, e := range entries {
+			checks = append(checks, historyCheck{
+				Time:         e.Time.UnixMilli(),
+				ResponseTime: float64(e.ResponseTime.Microseconds()) / 1000,
+				Ok:           !e.Failed,
+				Error:        e.Error,
+			})
+		}
+		writeJSON(w, checks)
+	})
+
+	return mux
+}
+
+type timeRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// contains reports whether t is within range, missing bounds don't limit it
+func (r timeRange) contains(t time.Time) bool {
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || !t.After(r.To))
+}
+
+type query struct {
+	Range   timeRange `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+		Type   string `json:"type"`
+	} `json:"targets"`
+}
+
+type annotationQuery struct {
+	Range      timeRange `json:"range"`
+	Annotation struct {
+		Name  string `json:"name"`
+		Query string `json:"query"`
+	} `json:"annotation"`
+}
+
+type timeSerie struct {
+	Target string `json:"target"`
+	// Datapoints are pairs of value and unix time in milliseconds
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type table struct {
+	Type    string          `json:"type"`
+	Columns []column        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+type column struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type annotation struct {
+	Time  int64    `json:"time"`
+	Title string   `json:"title"`
+	Text  string   `json:"text"`
+	Tags  []string `json:"tags"`
+}
+
+// targetState is current state of target, row of /targets and table query
+type targetState struct {
+	Target       string            `json:"target"`
+	Up           bool              `json:"up"`
+	ResponseTime float64           `json:"responseTime"`
+	StatusCode   int               `json:"statusCode"`
+	LastCheck    int64             `json:"lastCheck"`
+	Failure      string            `json:"failure"`
+	Labels       map[string]string `json:"labels"`
+}
+
+type historyCheck struct {
+	Time         int64   `json:"time"`
+	ResponseTime float64 `json:"responseTime"`
+	Ok           bool    `json:"ok"`
+	Error        bool    `json:"error"`
+}
+
+// timeSeries returns series of target's history, key is <target>.<series>
+func timeSeries(targets *monitoring.Targets, key string, r timeRange) (timeSerie, error) {
+	dot := strings.LastIndex(key, ".")
+	if dot == -1 {
+		return timeSerie{}, errors.New(fmt.Sprintf("invalid metric \"%s\", expected <target>.<series>", key))
+	}
+
+	name, seriesName := key[:dot], key[dot+1:]
+	value, ok := historySeries[seriesName]
+	if !ok {
+		return timeSerie{}, errors.New(fmt.Sprintf("unknown series \"%s\", available: %s", seriesName, strings.Join(seriesNames, ", ")))
+	}
+
+	entries, ok := targets.History(name)
+	if !ok {
+		return timeSerie{}, errors.New(fmt.Sprintf("target \"%s\" not found", name))
+	}
+
+	ts := timeSerie{Target: key, Datapoints: [][2]float64{}}
+	for _, e := range entries {
+		if !r.contains(e.Time) {
+			continue
+		}
+		if v, ok := value(e); ok {
+			ts.Datapoints = append(ts.Datapoints, [2]float64{v, float64(e.Time.UnixMilli())})
+		}
+	}
+	return ts, nil
+}
+
+func stateOf(targets *monitoring.Targets, name string) (targetState, bool) {
+	data, ok := targets.GetData(name)
+	if !ok {
+		return targetState{}, false
+	}
+
+	labels, _ := targets.Labels(name)
+	s := targetState{
+		Target:       name,
+		Up:           !data.LastCheck.IsZero() && !data.LastFailed,
+		ResponseTime: float64(data.LastResponseTime.Microseconds()) / 1000,
+		StatusCode:   data.LastStatusCode,
+		Failure:      data.LastFailure,
+		Labels:       labels,
+	}
+	if !data.LastCheck.IsZero() {
+		s.LastCheck = data.LastCheck.UnixMilli()
+	}
+	return s, true
+}
+
+func stateTable(targets *monitoring.Targets) table {
+	t := table{
+		Type: "table",
+		Columns: []column{
+			{Text: "Target", Type: "string"},
+			{Text: "Up", Type: "number"},
+			{Text: "Response time", Type: "number"},
+			{Text: "Status code", Type: "number"},
+			{Text: "Last check", Type: "time"},
+			{Text: "Failure", Type: "string"},
+		},
+		Rows: [][]interface{}{},
+	}
+
+	for _, name := range targets.Names() {
+		s, ok := stateOf(targets, name)
+		if !ok {
+			continue
+		}
+		t.Rows = append(t.Rows, []interface{}{s.Target, boolFloat(s.Up), s.ResponseTime, s.StatusCode, s.LastCheck, s.Failure})
+	}
+	return t
+}
+
+// failedChecks returns failed checks in range as annotations, of targets
+// given in annotation's query (comma separated) or of all targets
+func failedChecks(targets *monitoring.Targets, q *annotationQuery) []annotation {
+	names := targets.Names()
+	if query := strings.TrimSpace(q.Annotation.Query); query != "" {
+		names = strings.Split(query, ",")
+	}
+
+	annotations := []annotation{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		entries, ok := targets.History(name)
+		if !ok {
+			continue
+		}
+
+		for _, e := range entries {
+			if !e.Failed || !q.Range.contains(e.Time) {
+				continue
+			}
+
+			text := "check failed"
+			if e.Error {
+				text = "check failed without response"
+			}
+			annotations = append(annotations, annotation{
+				Time:  e.Time.UnixMilli(),
+				Title: name,
+				Text:  text,
+				Tags:  []string{name},
+			})
+		}
+	}
+	return annotations
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func boolFloat(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
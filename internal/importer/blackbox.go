@@ -0,0 +1,435 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultBlackboxModule is module blackbox_exporter probes with when none is given
+const defaultBlackboxModule = "http_2xx"
+
+type blackboxConfig struct {
+	Modules map[string]blackboxModule `yaml:"modules"`
+}
+
+type blackboxModule struct {
+	Prober  string            `yaml:"prober"`
+	Timeout string            `yaml:"timeout"`
+	HTTP    blackboxHTTPProbe `yaml:"http"`
+	TCP     blackboxTCPProbe  `yaml:"tcp"`
+}
+
+type blackboxHTTPProbe struct {
+	ValidStatusCodes             []int             `yaml:"valid_status_codes"`
+	Method                       string            `yaml:"method"`
+	Headers                      map[string]string `yaml:"headers"`
+	Body                         string            `yaml:"body"`
+	BasicAuth                    *blackboxAuth     `yaml:"basic_auth"`
+	BearerToken                  string            `yaml:"bearer_token"`
+	FailIfBodyNotMatchesRegexp   []string          `yaml:"fail_if_body_not_matches_regexp"`
+	FailIfBodyMatchesRegexp      []string          `yaml:"fail_if_body_matches_regexp"`
+	FailIfHeaderMatchesRegexp    []yaml.Node       `yaml:"fail_if_header_matches"`
+	FailIfHeaderNotMatchesRegexp []yaml.Node       `yaml:"fail_if_header_not_matches"`
+	FailIfSSL                    bool              `yaml:"fail_if_ssl"`
+	FailIfNotSSL                 bool              `yaml:"fail_if_not_ssl"`
+	NoFollowRedirects            bool              `yaml:"no_follow_redirects"`
+	FollowRedirects              *bool             `yaml:"follow_redirects"`
+	ProxyUrl                     string            `yaml:"proxy_url"`
+	TLSConfig                    blackboxTLSConfig `yaml:"tls_config"`
+}
+
+type blackboxTCPProbe struct {
+	QueryResponse []yaml.Node `yaml:"query_response"`
+	TLS           bool        `yaml:"tls"`
+}
+
+type blackboxAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type blackboxTLSConfig struct {
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	MinVersion         string `yaml:"min_version"`
+	MaxVersion         string `yaml:"max_version"`
+}
+
+// prometheusConfig is part of Prometheus configuration with probe jobs
+type prometheusConfig struct {
+	Global struct {
+		ScrapeInterval string `yaml:"scrape_interval"`
+	} `yaml:"global"`
+	ScrapeConfigs []prometheusScrapeConfig `yaml:"scrape_configs"`
+}
+
+type prometheusScrapeConfig struct {
+	JobName        string              `yaml:"job_name"`
+	MetricsPath    string              `yaml:"metrics_path"`
+	ScrapeInterval string              `yaml:"scrape_interval"`
+	Params         map[string][]string `yaml:"params"`
+	StaticConfigs  []struct {
+		Targets []string `yaml:"targets"`
+	} `yaml:"static_configs"`
+	FileSDConfigs []yaml.Node `yaml:"file_sd_configs"`
+}
+
+// blackboxProbe is target probed with module
+type blackboxProbe struct {
+	target   string
+	module   string
+	interval int
+}
+
+// FromBlackbox converts blackbox_exporter modules and list of probed targets
+// into zcm targets. List is either Prometheus configuration, whose jobs
+// scraping /probe give targets, module and interval, or plain text file with
+// one target per line optionally followed by module name. http, tcp and icmp
+// probers are supported, module settings which can't be expressed in target
+// are reported as warnings.
+func FromBlackbox(config []byte, list []byte) (map[string]*Target, []string, error) {
+	bc := &blackboxConfig{}
+	if err := yaml.Unmarshal(config, bc); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("error while parsing blackbox_exporter configuration, error: %s", err))
+	}
+
+	if len(bc.Modules) == 0 {
+		return nil, nil, errors.New("blackbox_exporter configuration doesn't define any module")
+	}
+
+	probes, warnings, err := blackboxProbes(list)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targets := map[string]*Target{}
+	for _, p := range probes {
+		module, ok := bc.Modules[p.module]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("%s skipped, module %s is not defined", p.target, p.module))
+			continue
+		}
+
+		target, w := module.convert(p.target)
+		for _, msg := range w {
+			warnings = append(warnings, fmt.Sprintf("%s (%s): %s", p.target, p.module, msg))
+		}
+		if target == nil {
+			continue
+		}
+
+		target.Interval = p.interval
+
+		name := nameSlug(p.target)
+		if u := target.Url; u != "" {
+			name = TargetName(u)
+		}
+		targets[uniqueName(targets, name+"-"+nameSlug(p.module))] = target
+	}
+
+	return targets, warnings, nil
+}
+
+// blackboxProbes reads targets with their modules from list
+func blackboxProbes(list []byte) ([]blackboxProbe, []string, error) {
+	pc := &prometheusConfig{}
+	if err := yaml.Unmarshal(list, pc); err == nil && len(pc.ScrapeConfigs) > 0 {
+		return pc.probes()
+	}
+
+	var probes []blackboxProbe
+	scanner := bufio.NewScanner(bytes.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, nil, errors.New(fmt.Sprintf("invalid targets line \"%s\", expected target optionally followed by module", line))
+		}
+
+		p := blackboxProbe{target: fields[0], module: defaultBlackboxModule}
+		if len(fields) == 2 {
+			p.module = fields[1]
+		}
+		probes = append(probes, p)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return probes, nil, nil
+}
+
+func (pc *prometheusConfig) probes() ([]blackboxProbe, []string, error) {
+	var (
+		probes   []blackboxProbe
+		warnings []string
+	)
+
+	for _, job := range pc.ScrapeConfigs {
+		modules := job.Params["module"]
+		if job.MetricsPath != "/probe" && len(modules) == 0 {
+			continue
+		}
+
+		module := defaultBlackboxModule
+		if len(modules) > 0 {
+			module = modules[0]
+		}
+
+		scrapeInterval := job.ScrapeInterval
+		if scrapeInterval == "" {
+			scrapeInterval = pc.Global.ScrapeInterval
+		}
+
+		interval := 0
+		if scrapeInterval != "" {
+			d, err := parsePrometheusDuration(scrapeInterval)
+			if err != nil {
+				return nil, nil, errors.New(fmt.Sprintf("job %s: %s", job.JobName, err))
+			}
+			interval = int(d.Milliseconds())
+		}
+
+		if len(job.FileSDConfigs) > 0 {
+			warnings = append(warnings, fmt.Sprintf("job %s: file_sd_configs are not supported, only static targets were imported", job.JobName))
+		}
+
+		for _, sc := range job.StaticConfigs {
+			for _, t := range sc.Targets {
+				probes = append(probes, blackboxProbe{target: t, module: module, interval: interval})
+			}
+		}
+	}
+
+	if len(probes) == 0 {
+		return nil, nil, errors.New("Prometheus configuration doesn't contain any probe job with static targets")
+	}
+
+	return probes, warnings, nil
+}
+
+// convert returns target probing given blackbox target like module does,
+// nil when module's prober isn't supported
+func (m *blackboxModule) convert(target string) (*Target, []string) {
+	var (
+		t        *Target
+		warnings []string
+	)
+
+	switch m.Prober {
+	case "http":
+		t, warnings = m.HTTP.convert(target)
+
+	case "tcp":
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			return nil, []string{"skipped, tcp target must be host:port"}
+		}
+		portNumber, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, []string{fmt.Sprintf("skipped, invalid port %s", port)}
+		}
+
+		t = &Target{Type: "tcp", Host: host, Port: portNumber}
+		if len(m.TCP.QueryResponse) > 0 {
+			warnings = append(warnings, "query_response is not supported and was skipped")
+		}
+		if m.TCP.TLS {
+			warnings = append(warnings, "tcp over tls is not supported, plain connection is checked")
+		}
+
+	case "icmp":
+		t = &Target{Type: "icmp", Host: target}
+
+	default:
+		return nil, []string{fmt.Sprintf("skipped, %s prober is not supported", m.Prober)}
+	}
+
+	if t != nil && m.Timeout != "" {
+		d, err := parsePrometheusDuration(m.Timeout)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("timeout \"%s\" not converted, default timeout is used", m.Timeout))
+		} else {
+			t.Timeout = d.String()
+		}
+	}
+
+	return t, warnings
+}
+
+func (p *blackboxHTTPProbe) convert(target string) (*Target, []string) {
+	var warnings []string
+
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	t := &Target{Url: target}
+
+	if p.Method != "" && p.Method != http.MethodGet {
+		t.Method = strings.ToUpper(p.Method)
+	}
+
+	headers := map[string]string{}
+	for k, v := range p.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+	contentType := headers["Content-Type"]
+	delete(headers, "Content-Type")
+
+	if p.Body != "" {
+		switch {
+		case json.Valid([]byte(p.Body)) && (contentType == "" || strings.HasPrefix(contentType, "application/json")):
+			t.Json = p.Body
+		default:
+			warnings = append(warnings, "request body which isn't json is not supported and was skipped")
+		}
+	}
+	if t.Method == http.MethodPost && t.Json == "" {
+		return nil, append(warnings, "skipped, POST request without body is not supported")
+	}
+
+	switch {
+	case p.BasicAuth != nil:
+		t.Authorization = &Authorization{Type: "Basic", Username: p.BasicAuth.Username, Password: p.BasicAuth.Password}
+	case p.BearerToken != "":
+		t.Authorization = &Authorization{Type: "Bearer", Token: p.BearerToken}
+	}
+	if auth, ok := headers["Authorization"]; ok && t.Authorization == nil {
+		authType, token, _ := strings.Cut(auth, " ")
+		t.Authorization = &Authorization{Type: authType, Token: strings.TrimSpace(token)}
+	}
+	delete(headers, "Authorization")
+
+	if len(headers) > 0 {
+		t.Headers = headers
+	}
+
+	if len(p.ValidStatusCodes) > 0 {
+		codes := append([]int(nil), p.ValidStatusCodes...)
+		sort.Ints(codes)
+		for _, c := range codes {
+			t.ExpectStatus = append(t.ExpectStatus, c)
+		}
+	}
+
+	if len(p.FailIfBodyNotMatchesRegexp) > 0 {
+		t.ExpectBodyRegex = p.FailIfBodyNotMatchesRegexp[0]
+		if len(p.FailIfBodyNotMatchesRegexp) > 1 {
+			warnings = append(warnings, "only the first of fail_if_body_not_matches_regexp was kept")
+		}
+	}
+
+	t.Proxy = p.ProxyUrl
+
+	tls := TLS{
+		InsecureSkipVerify: p.TLSConfig.InsecureSkipVerify,
+		CAFile:             p.TLSConfig.CAFile,
+		CertFile:           p.TLSConfig.CertFile,
+		KeyFile:            p.TLSConfig.KeyFile,
+	}
+	var ok bool
+	if tls.MinVersion, ok = blackboxTLSVersion(p.TLSConfig.MinVersion); !ok {
+		warnings = append(warnings, fmt.Sprintf("tls min_version %s is not supported and was skipped", p.TLSConfig.MinVersion))
+	}
+	if tls.MaxVersion, ok = blackboxTLSVersion(p.TLSConfig.MaxVersion); !ok {
+		warnings = append(warnings, fmt.Sprintf("tls max_version %s is not supported and was skipped", p.TLSConfig.MaxVersion))
+	}
+	if tls != (TLS{}) {
+		t.TLS = &tls
+	}
+
+	unsupported := []struct {
+		set  bool
+		name string
+	}{
+		{len(p.FailIfBodyMatchesRegexp) > 0, "fail_if_body_matches_regexp"},
+		{len(p.FailIfHeaderMatchesRegexp) > 0, "fail_if_header_matches"},
+		{len(p.FailIfHeaderNotMatchesRegexp) > 0, "fail_if_header_not_matches"},
+		{p.FailIfSSL, "fail_if_ssl"},
+		{p.FailIfNotSSL, "fail_if_not_ssl"},
+		{p.NoFollowRedirects || (p.FollowRedirects != nil && !*p.FollowRedirects), "disabled redirects"},
+		{p.TLSConfig.ServerName != "", "tls_config server_name"},
+	}
+	for _, u := range unsupported {
+		if u.set {
+			warnings = append(warnings, fmt.Sprintf("%s is not supported and was skipped", u.name))
+		}
+	}
+
+	return t, warnings
+}
+
+// blackboxTLSVersion converts blackbox TLS version (e.g. TLS12) to zcm's (e.g. 1.2)
+func blackboxTLSVersion(v string) (string, bool) {
+	switch v {
+	case "":
+		return "", true
+	case "TLS10":
+		return "1.0", true
+	case "TLS11":
+		return "1.1", true
+	case "TLS12":
+		return "1.2", true
+	case "TLS13":
+		return "1.3", true
+	}
+	return "", false
+}
+
+// parsePrometheusDuration parses Prometheus duration, which besides
+// Go units allows days (d), weeks (w) and years (y)
+func parsePrometheusDuration(s string) (time.Duration, error) {
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour, 'y': 365 * 24 * time.Hour}
+
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		j := i
+		for j < len(rest) && (rest[j] < '0' || rest[j] > '9') {
+			j++
+		}
+		if i == 0 || j == i {
+			return 0, errors.New(fmt.Sprintf("invalid duration \"%s\"", s))
+		}
+
+		n, _ := strconv.Atoi(rest[:i])
+		if unit, ok := units[rest[i]]; ok && j == i+1 {
+			total += time.Duration(n) * unit
+		} else {
+			d, err := time.ParseDuration(rest[:j])
+			if err != nil {
+				return 0, errors.New(fmt.Sprintf("invalid duration \"%s\"", s))
+			}
+			total += d
+		}
+		rest = rest[j:]
+	}
+
+	if total <= 0 {
+		return 0, errors.New(fmt.Sprintf("invalid duration \"%s\"", s))
+	}
+	return total, nil
+}
@@ -0,0 +1,351 @@
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// curl options taking a value which don't affect target definition
+var curlIgnoredValueOptions = map[string]bool{
+	"-o": true, "--output": true,
+	"-A": true, "--user-agent": true,
+	"-e": true, "--referer": true,
+	"-b": true, "--cookie": true,
+	"-c": true, "--cookie-jar": true,
+	"-w": true, "--write-out": true,
+	"-m": true, "--max-time": true,
+	"--connect-timeout": true,
+	"--retry":           true,
+}
+
+// FromCurl parses curl command line and returns equivalent target.
+// Options which can't be expressed in target are returned as warnings.
+func FromCurl(command string) (*Target, []string, error) {
+	args, err := splitCommandLine(command)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(args) > 0 && args[0] == "curl" {
+		args = args[1:]
+	}
+
+	var (
+		method   string
+		rawUrl   string
+		user     string
+		data     []string
+		isJson   bool
+		get      bool
+		insecure bool
+		headers  = map[string]string{}
+		warnings []string
+	)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if rawUrl != "" {
+				return nil, nil, errors.New(fmt.Sprintf("multiple urls are not supported: %s, %s", rawUrl, arg))
+			}
+			rawUrl = arg
+			continue
+		}
+
+		name, value, hasValue := arg, "", false
+		if strings.HasPrefix(arg, "--") {
+			if n, v, ok := strings.Cut(arg, "="); ok {
+				name, value, hasValue = n, v, true
+			}
+		} else if len(arg) > 2 {
+			// short option with attached value (-XPOST) or combined flags (-sSL)
+			if strings.ContainsRune("XHdu", rune(arg[1])) {
+				name, value, hasValue = arg[:2], arg[2:], true
+			} else {
+				for _, f := range arg[1:] {
+					switch f {
+					case 'G':
+						get = true
+					case 'I':
+						method = http.MethodHead
+					case 'k':
+						insecure = true
+					}
+				}
+				continue
+			}
+		}
+
+		takeValue := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			i++
+			if i >= len(args) {
+				return "", errors.New(fmt.Sprintf("missing value for curl option %s", name))
+			}
+			return args[i], nil
+		}
+
+		switch name {
+		case "-X", "--request":
+			v, err := takeValue()
+			if err != nil {
+				return nil, nil, err
+			}
+			method = strings.ToUpper(v)
+
+		case "-H", "--header":
+			v, err := takeValue()
+			if err != nil {
+				return nil, nil, err
+			}
+			k, hv, ok := strings.Cut(v, ":")
+			if !ok {
+				return nil, nil, errors.New(fmt.Sprintf("invalid header \"%s\"", v))
+			}
+			headers[http.CanonicalHeaderKey(strings.TrimSpace(k))] = strings.TrimSpace(hv)
+
+		case "-d", "--data", "--data-raw", "--data-binary", "--data-ascii":
+			v, err := takeValue()
+			if err != nil {
+				return nil, nil, err
+			}
+			if strings.HasPrefix(v, "@") && name != "--data-raw" {
+				return nil, nil, errors.New(fmt.Sprintf("reading data from file (%s) is not supported", v))
+			}
+			data = append(data, v)
+
+		case "--data-urlencode":
+			v, err := takeValue()
+			if err != nil {
+				return nil, nil, err
+			}
+			if k, dv, ok := strings.Cut(v, "="); ok {
+				data = append(data, k+"="+url.QueryEscape(dv))
+			} else {
+				data = append(data, url.QueryEscape(v))
+			}
+
+		case "--json":
+			v, err := takeValue()
+			if err != nil {
+				return nil, nil, err
+			}
+			data = append(data, v)
+			isJson = true
+
+		case "-u", "--user":
+			v, err := takeValue()
+			if err != nil {
+				return nil, nil, err
+			}
+			// curl prompts for password of user given without it
+			if !strings.Contains(v, ":") {
+				return nil, nil, errors.New(fmt.Sprintf("user \"%s\" of curl option %s has no password, expected user:password", v, name))
+			}
+			user = v
+
+		case "--url":
+			v, err := takeValue()
+			if err != nil {
+				return nil, nil, err
+			}
+			rawUrl = v
+
+		case "-G", "--get":
+			get = true
+
+		case "-I", "--head":
+			method = http.MethodHead
+
+		case "-k", "--insecure":
+			insecure = true
+
+		default:
+			if curlIgnoredValueOptions[name] && !hasValue {
+				i++
+			}
+		}
+	}
+
+	if rawUrl == "" {
+		return nil, nil, errors.New("url not found in curl command")
+	}
+
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "http://" + rawUrl
+	}
+
+	target := &Target{Url: rawUrl}
+	if insecure {
+		target.TLS = &TLS{InsecureSkipVerify: true}
+	}
+
+	if get && len(data) > 0 {
+		sep := "?"
+		if strings.Contains(rawUrl, "?") {
+			sep = "&"
+		}
+		target.Url = rawUrl + sep + strings.Join(data, "&")
+		data = nil
+	}
+
+	if method == "" {
+		method = http.MethodGet
+		if len(data) > 0 {
+			method = http.MethodPost
+		}
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodHead, http.MethodOptions:
+	default:
+		return nil, nil, errors.New(fmt.Sprintf("http method %s not supported", method))
+	}
+
+	if len(data) > 0 && method != http.MethodPost && method != http.MethodPut && method != http.MethodPatch {
+		return nil, nil, errors.New(fmt.Sprintf("request body is not supported with %s method", method))
+	}
+
+	if method != http.MethodGet {
+		target.Method = method
+	}
+
+	contentType := headers["Content-Type"]
+	delete(headers, "Content-Type")
+	if isJson {
+		delete(headers, "Accept")
+	}
+
+	if len(data) > 0 {
+		body := strings.Join(data, "&")
+
+		switch {
+		case isJson || strings.HasPrefix(contentType, "application/json"):
+			if !json.Valid([]byte(body)) {
+				return nil, nil, errors.New("request body is not valid json")
+			}
+			target.Json = body
+
+		case contentType == "" || strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+			values, err := url.ParseQuery(body)
+			if err != nil {
+				return nil, nil, errors.New(fmt.Sprintf("error while parsing form data, error: %s", err))
+			}
+			target.FormData = map[string]string{}
+			for k, v := range values {
+				if len(v) > 1 {
+					warnings = append(warnings, fmt.Sprintf("form field %s has multiple values, only first was kept", k))
+				}
+				target.FormData[k] = v[0]
+			}
+
+		default:
+			return nil, nil, errors.New(fmt.Sprintf("request body with content type %s is not supported", contentType))
+		}
+	} else if method == http.MethodPost {
+		return nil, nil, errors.New("POST request without body is not supported")
+	}
+
+	if user != "" {
+		username, password, _ := strings.Cut(user, ":")
+		target.Authorization = &Authorization{Type: "Basic", Username: username, Password: password}
+	} else if auth, ok := headers["Authorization"]; ok {
+		authType, token, _ := strings.Cut(auth, " ")
+		target.Authorization = &Authorization{Type: authType, Token: strings.TrimSpace(token)}
+		if authType == "Basic" {
+			if b, err := base64.StdEncoding.DecodeString(target.Authorization.Token); err == nil {
+				if username, password, ok := strings.Cut(string(b), ":"); ok {
+					target.Authorization = &Authorization{Type: authType, Username: username, Password: password}
+				}
+			}
+		}
+	}
+	delete(headers, "Authorization")
+
+	if len(headers) > 0 {
+		target.Headers = headers
+	}
+
+	return target, warnings, nil
+}
+
+// splitCommandLine splits command line into arguments following
+// POSIX shell quoting rules (single quotes, double quotes, backslash escapes)
+func splitCommandLine(command string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+	)
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '\\':
+			i++
+			if i >= len(runes) {
+				return nil, errors.New("unexpected end of command after \\")
+			}
+			// line continuation
+			if runes[i] == '\n' {
+				continue
+			}
+			current.WriteRune(runes[i])
+			inArg = true
+
+		case r == '\'':
+			end := strings.IndexRune(string(runes[i+1:]), '\'')
+			if end == -1 {
+				return nil, errors.New("unterminated single quote")
+			}
+			part := []rune(string(runes[i+1:])[:end])
+			current.WriteString(string(part))
+			i += len(part) + 1
+			inArg = true
+
+		case r == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				current.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, errors.New("unterminated double quote")
+			}
+			inArg = true
+
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
@@ -0,0 +1,210 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+	}{
+		{"plain", "curl -s https://example.com", []string{"curl", "-s", "https://example.com"}},
+		{"extra whitespace", "  curl\t-s \r\n https://example.com  ", []string{"curl", "-s", "https://example.com"}},
+		{"single quotes", `curl -H 'X-Name: a b'`, []string{"curl", "-H", "X-Name: a b"}},
+		{"single quotes keep backslash and dollar", `'a\"b $HOME'`, []string{`a\"b $HOME`}},
+		{"single quotes with multibyte", `'zażółć' x`, []string{"zażółć", "x"}},
+		{"double quotes", `curl -d "a b"`, []string{"curl", "-d", "a b"}},
+		{"double quotes escapes", `"a\"b\\c\$d\` + "`" + `e"`, []string{"a\"b\\c$d`e"}},
+		{"double quotes keep other backslashes", `"a\nb"`, []string{`a\nb`}},
+		{"backslash outside quotes", `a\ b\'c`, []string{"a b'c"}},
+		{"adjacent quoted parts", `a'b c'"d e"f`, []string{"ab cd ef"}},
+		{"empty quoted argument", `curl '' ""`, []string{"curl", "", ""}},
+		{"line continuation", "curl \\\n  -s \\\n  https://example.com", []string{"curl", "-s", "https://example.com"}},
+		{"line continuation in double quotes", "\"a\\\nb\"", []string{"ab"}},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitCommandLine(tt.command)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitCommandLineErrors(t *testing.T) {
+	for _, command := range []string{
+		`curl 'https://example.com`,
+		`curl "https://example.com`,
+		`curl -d "a\"`,
+		`curl https://example.com \`,
+	} {
+		if args, err := splitCommandLine(command); err == nil {
+			t.Errorf("%s: expected error, got %q", command, args)
+		}
+	}
+}
+
+func TestFromCurl(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		want     *Target
+		warnings int
+	}{
+		{
+			name:    "get",
+			command: "curl https://example.com/health",
+			want:    &Target{Url: "https://example.com/health"},
+		},
+		{
+			name:    "url without scheme",
+			command: "curl example.com",
+			want:    &Target{Url: "http://example.com"},
+		},
+		{
+			name:    "url option",
+			command: "curl --url https://example.com",
+			want:    &Target{Url: "https://example.com"},
+		},
+		{
+			name:    "combined short flags",
+			command: "curl -sSLk https://example.com",
+			want:    &Target{Url: "https://example.com", TLS: &TLS{InsecureSkipVerify: true}},
+		},
+		{
+			name:    "insecure",
+			command: "curl --insecure https://example.com",
+			want:    &Target{Url: "https://example.com", TLS: &TLS{InsecureSkipVerify: true}},
+		},
+		{
+			name:    "combined flags with head",
+			command: "curl -sI https://example.com",
+			want:    &Target{Url: "https://example.com", Method: "HEAD"},
+		},
+		{
+			name:    "attached method",
+			command: "curl -XPUT -d a=1 https://example.com",
+			want:    &Target{Url: "https://example.com", Method: "PUT", FormData: map[string]string{"a": "1"}},
+		},
+		{
+			name:    "request option",
+			command: "curl --request=delete https://example.com",
+			want:    &Target{Url: "https://example.com", Method: "DELETE"},
+		},
+		{
+			name:    "headers",
+			command: `curl -H 'x-request-id:  abc ' --header "Accept: application/json" -H'X-Attached: 1' https://example.com`,
+			want: &Target{Url: "https://example.com", Headers: map[string]string{
+				"X-Request-Id": "abc", "Accept": "application/json", "X-Attached": "1",
+			}},
+		},
+		{
+			name:    "form data",
+			command: "curl -d a=1 -d 'b=x y' https://example.com",
+			want:    &Target{Url: "https://example.com", Method: "POST", FormData: map[string]string{"a": "1", "b": "x y"}},
+		},
+		{
+			name:    "data raw keeps at sign",
+			command: "curl --data-raw '@user=1' https://example.com",
+			want:    &Target{Url: "https://example.com", Method: "POST", FormData: map[string]string{"@user": "1"}},
+		},
+		{
+			name:    "data urlencode",
+			command: "curl --data-urlencode 'q=a&b' https://example.com",
+			want:    &Target{Url: "https://example.com", Method: "POST", FormData: map[string]string{"q": "a&b"}},
+		},
+		{
+			name:    "json data with content type",
+			command: `curl -H 'Content-Type: application/json' -d '{"a": 1}' https://example.com`,
+			want:    &Target{Url: "https://example.com", Method: "POST", Json: `{"a": 1}`},
+		},
+		{
+			name:    "json option drops accept",
+			command: `curl --json '{"a": 1}' https://example.com`,
+			want:    &Target{Url: "https://example.com", Method: "POST", Json: `{"a": 1}`},
+		},
+		{
+			name:    "get with data",
+			command: "curl -G -d a=1 -d b=2 'https://example.com/?x=0'",
+			want:    &Target{Url: "https://example.com/?x=0&a=1&b=2"},
+		},
+		{
+			name:    "user",
+			command: "curl -u user:p@ss https://example.com",
+			want:    &Target{Url: "https://example.com", Authorization: &Authorization{Type: "Basic", Username: "user", Password: "p@ss"}},
+		},
+		{
+			name:    "attached user",
+			command: "curl -uuser:pass https://example.com",
+			want:    &Target{Url: "https://example.com", Authorization: &Authorization{Type: "Basic", Username: "user", Password: "pass"}},
+		},
+		{
+			name:    "bearer header",
+			command: "curl -H 'Authorization: Bearer abc' https://example.com",
+			want:    &Target{Url: "https://example.com", Authorization: &Authorization{Type: "Bearer", Token: "abc"}},
+		},
+		{
+			name:    "basic header",
+			command: "curl -H 'Authorization: Basic dXNlcjpwYXNz' https://example.com",
+			want:    &Target{Url: "https://example.com", Authorization: &Authorization{Type: "Basic", Username: "user", Password: "pass"}},
+		},
+		{
+			name:    "ignored options with values",
+			command: "curl -o /dev/null -w '%{http_code}' --max-time 5 -A agent https://example.com",
+			want:    &Target{Url: "https://example.com"},
+		},
+		{
+			name:    "line continuations",
+			command: "curl -X POST \\\n  -H 'Content-Type: application/json' \\\n  -d '{}' \\\n  https://example.com",
+			want:    &Target{Url: "https://example.com", Method: "POST", Json: "{}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warnings, err := FromCurl(tt.command)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("got warnings %q, want %d", warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestFromCurlErrors(t *testing.T) {
+	for _, command := range []string{
+		"curl",
+		"curl -s",
+		"curl https://a.example.com https://b.example.com",
+		"curl -H",
+		"curl -H 'no-colon' https://example.com",
+		"curl -d @body.json https://example.com",
+		"curl -X TRACE https://example.com",
+		"curl -X GET -d a=1 https://example.com",
+		"curl -X POST https://example.com",
+		"curl -u user https://example.com",
+		"curl --user=user https://example.com",
+		`curl --json '{' https://example.com`,
+		"curl -H 'Content-Type: text/plain' -d a https://example.com",
+		"curl 'https://example.com",
+		`curl -H "Accept: */* https://example.com`,
+	} {
+		if target, _, err := FromCurl(command); err == nil {
+			t.Errorf("%s: expected error, got %+v", command, target)
+		}
+	}
+}
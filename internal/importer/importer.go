@@ -0,0 +1,79 @@
+package importer
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Target struct {
+	Type          string            `yaml:"type,omitempty"`
+	Url           string            `yaml:"url,omitempty"`
+	Host          string            `yaml:"host,omitempty"`
+	Port          int               `yaml:"port,omitempty"`
+	Method        string            `yaml:"method,omitempty"`
+	Interval      int               `yaml:"interval,omitempty"`
+	Authorization *Authorization    `yaml:"authorization,omitempty"`
+	Headers       map[string]string `yaml:"headers,omitempty"`
+	FormData      map[string]string `yaml:"form-data,omitempty"`
+	Json          string            `yaml:"json,omitempty"`
+	Timeout       string            `yaml:"timeout,omitempty"`
+	// ExpectStatus holds codes as numbers and classes (e.g. 2xx) as strings
+	ExpectStatus    []interface{} `yaml:"expect-status,omitempty,flow"`
+	ExpectBodyRegex string        `yaml:"expect-body-regex,omitempty"`
+	Proxy           string        `yaml:"proxy,omitempty"`
+	TLS             *TLS          `yaml:"tls,omitempty"`
+}
+
+type TLS struct {
+	MinVersion         string `yaml:"min-version,omitempty"`
+	MaxVersion         string `yaml:"max-version,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure-skip-verify,omitempty"`
+	CAFile             string `yaml:"ca-file,omitempty"`
+	CertFile           string `yaml:"cert-file,omitempty"`
+	KeyFile            string `yaml:"key-file,omitempty"`
+}
+
+type Authorization struct {
+	Type     string `yaml:"type"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	Token    string `yaml:"token,omitempty"`
+}
+
+func Marshal(targets map[string]*Target) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(targets); err != nil {
+		return nil, err
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+var nameRegexp = regexp.MustCompile("[^a-zA-Z0-9]+")
+
+// TargetName derives target name from url's host and path,
+// e.g. https://api.example.com/v1/health gives api-example-com-v1-health
+func TargetName(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return nameSlug(rawUrl)
+	}
+
+	return nameSlug(u.Hostname() + u.Path)
+}
+
+// nameSlug replaces runs of characters other than letters and digits with dash
+func nameSlug(s string) string {
+	return strings.Trim(nameRegexp.ReplaceAllString(s, "-"), "-")
+}
@@ -0,0 +1,207 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type openapiSpec struct {
+	OpenAPI string          `yaml:"openapi"`
+	Swagger string          `yaml:"swagger"`
+	Servers []openapiServer `yaml:"servers"`
+	// swagger 2.0 server definition
+	Host     string   `yaml:"host"`
+	BasePath string   `yaml:"basePath"`
+	Schemes  []string `yaml:"schemes"`
+
+	Paths map[string]map[string]yaml.Node `yaml:"paths"`
+}
+
+type openapiServer struct {
+	Url       string `yaml:"url"`
+	Variables map[string]struct {
+		Default string `yaml:"default"`
+	} `yaml:"variables"`
+}
+
+type openapiOperation struct {
+	OperationId string             `yaml:"operationId"`
+	Summary     string             `yaml:"summary"`
+	Tags        []string           `yaml:"tags"`
+	Parameters  []openapiParameter `yaml:"parameters"`
+}
+
+type openapiParameter struct {
+	Name     string `yaml:"name"`
+	In       string `yaml:"in"`
+	Required bool   `yaml:"required"`
+}
+
+type OpenAPIOptions struct {
+	// BaseUrl overrides server url from the document
+	BaseUrl string
+	// AllOperations generates check for every GET operation
+	// instead of health/liveness endpoints only
+	AllOperations bool
+}
+
+// healthWords are words of path, operation id, summary or tag marking health
+// endpoint, whole words are matched, so e.g. /shipping isn't mistaken for ping
+var healthWords = map[string]bool{
+	"health": true, "healthz": true, "healthcheck": true,
+	"liveness": true, "livez": true, "alive": true,
+	"readiness": true, "readyz": true,
+	"ping": true, "status": true,
+}
+
+var camelCaseRegexp = regexp.MustCompile("([a-z0-9])([A-Z])")
+
+var wordSeparatorRegexp = regexp.MustCompile("[^a-z0-9]+")
+
+// FromOpenAPI generates GET targets from OpenAPI 3 or Swagger 2 document.
+// Operations requiring parameters are skipped and reported as warnings.
+func FromOpenAPI(data []byte, opts OpenAPIOptions) (map[string]*Target, []string, error) {
+	spec := &openapiSpec{}
+	if err := yaml.Unmarshal(data, spec); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("error while parsing OpenAPI document, error: %s", err))
+	}
+
+	if spec.OpenAPI == "" && spec.Swagger == "" {
+		return nil, nil, errors.New("document is neither OpenAPI 3 nor Swagger 2 specification")
+	}
+
+	baseUrl := opts.BaseUrl
+	if baseUrl == "" {
+		baseUrl = spec.serverUrl()
+	}
+
+	if !strings.Contains(baseUrl, "://") {
+		return nil, nil, errors.New(fmt.Sprintf("document doesn't define absolute server url (got \"%s\"), provide base url", baseUrl))
+	}
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+
+	paths := make([]string, 0, len(spec.Paths))
+	for path := range spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var (
+		targets  = map[string]*Target{}
+		warnings []string
+	)
+
+	for _, path := range paths {
+		item := spec.Paths[path]
+
+		node, ok := item["get"]
+		if !ok {
+			continue
+		}
+
+		op := &openapiOperation{}
+		if err := node.Decode(op); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("%s: error while parsing operation, error: %s", path, err))
+		}
+
+		var common []openapiParameter
+		if n, ok := item["parameters"]; ok {
+			if err := n.Decode(&common); err != nil {
+				return nil, nil, errors.New(fmt.Sprintf("%s: error while parsing parameters, error: %s", path, err))
+			}
+		}
+
+		if !opts.AllOperations && !op.isHealthCheck(path) {
+			continue
+		}
+
+		if param, ok := requiredParameter(append(common, op.Parameters...)); ok {
+			warnings = append(warnings, fmt.Sprintf("GET %s skipped, required %s parameter \"%s\"", path, param.In, param.Name))
+			continue
+		}
+
+		if strings.Contains(path, "{") {
+			warnings = append(warnings, fmt.Sprintf("GET %s skipped, path is templated", path))
+			continue
+		}
+
+		// operation id may contain dots or spaces, which can't be used in item keys
+		name := nameSlug(op.OperationId)
+		if name == "" {
+			name = TargetName(path)
+		}
+		name = uniqueName(targets, name)
+
+		targets[name] = &Target{Url: baseUrl + path}
+	}
+
+	return targets, warnings, nil
+}
+
+func (s *openapiSpec) serverUrl() string {
+	if len(s.Servers) > 0 {
+		u := s.Servers[0].Url
+		for name, v := range s.Servers[0].Variables {
+			u = strings.ReplaceAll(u, "{"+name+"}", v.Default)
+		}
+		return u
+	}
+
+	if s.Host != "" {
+		scheme := "https"
+		if len(s.Schemes) > 0 {
+			scheme = s.Schemes[0]
+		}
+		return scheme + "://" + s.Host + s.BasePath
+	}
+
+	return ""
+}
+
+func (op *openapiOperation) isHealthCheck(path string) bool {
+	for _, s := range append([]string{path, op.OperationId, op.Summary}, op.Tags...) {
+		if hasHealthWord(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasHealthWord splits s into words on separators and camel case,
+// e.g. /api/v1/health-check, getHealth or "Service status"
+func hasHealthWord(s string) bool {
+	s = strings.ToLower(camelCaseRegexp.ReplaceAllString(s, "$1 $2"))
+	for _, word := range wordSeparatorRegexp.Split(s, -1) {
+		if healthWords[word] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func requiredParameter(params []openapiParameter) (openapiParameter, bool) {
+	for _, p := range params {
+		if p.Required || p.In == "path" {
+			return p, true
+		}
+	}
+
+	return openapiParameter{}, false
+}
+
+func uniqueName(targets map[string]*Target, name string) string {
+	unique := name
+	for i := 2; ; i++ {
+		if _, ok := targets[unique]; !ok {
+			return unique
+		}
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+}
@@ -0,0 +1,122 @@
+package importer
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestHasHealthWord(t *testing.T) {
+	tests := map[string]bool{
+		"/health":              true,
+		"/api/v1/health-check": true,
+		"/_healthz":            true,
+		"/livez":               true,
+		"/ready/readyz":        true,
+		"/ping":                true,
+		"/orders/status":       true,
+		"getHealth":            true,
+		"HealthCheck":          true,
+		"Service status":       true,
+		"/shipping":            false,
+		"/mapping":             false,
+		"/statuses":            false,
+		"/unhealthy-items":     false,
+		"listOrders":           false,
+		"":                     false,
+	}
+
+	for s, want := range tests {
+		if got := hasHealthWord(s); got != want {
+			t.Errorf("hasHealthWord(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestFromOpenAPI(t *testing.T) {
+	spec := `
+openapi: 3.0.0
+servers:
+  - url: https://{host}/api
+    variables:
+      host: {default: api.example.com}
+paths:
+  /health:
+    get: {operationId: health.check}
+  /ready:
+    get: {operationId: "get readiness"}
+  /shipping:
+    get: {operationId: listShipping}
+  /mapping:
+    get: {}
+  /orders/{id}/status:
+    get:
+      parameters: [{name: id, in: path, required: true}]
+  /ping:
+    get:
+      parameters: [{name: verbose, in: query, required: true}]
+  /livez:
+    post: {}
+`
+
+	targets, warnings, err := FromOpenAPI([]byte(spec), OpenAPIOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]*Target{
+		"health-check":  {Url: "https://api.example.com/api/health"},
+		"get-readiness": {Url: "https://api.example.com/api/ready"},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("got targets %v, want %v", targets, want)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("expected warnings of skipped /orders/{id}/status and /ping, got %q", warnings)
+	}
+}
+
+func TestFromOpenAPIAllOperations(t *testing.T) {
+	spec := `
+swagger: "2.0"
+host: api.example.com
+basePath: /v1
+schemes: [http]
+paths:
+  /shipping:
+    get: {}
+  /mapping:
+    get: {operationId: mapping}
+  /other:
+    get: {operationId: mapping}
+`
+
+	targets, _, err := FromOpenAPI([]byte(spec), OpenAPIOptions{AllOperations: true, BaseUrl: "https://override.example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if want := []string{"mapping", "mapping-2", "shipping"}; !slices.Equal(names, want) {
+		t.Errorf("got names %q, want %q", names, want)
+	}
+	if u := targets["shipping"].Url; u != "https://override.example.com/shipping" {
+		t.Errorf("got url %s", u)
+	}
+}
+
+func TestFromOpenAPIErrors(t *testing.T) {
+	for _, spec := range []string{
+		"paths: {}",
+		"openapi: 3.0.0\nservers: [{url: /relative}]",
+		"openapi: [",
+	} {
+		if _, _, err := FromOpenAPI([]byte(spec), OpenAPIOptions{}); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
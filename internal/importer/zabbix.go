@@ -0,0 +1,408 @@
+package importer
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type zabbixExport struct {
+	Version   string       `xml:"version"`
+	Hosts     []zabbixHost `xml:"hosts>host"`
+	Templates []zabbixHost `xml:"templates>template"`
+}
+
+type zabbixHost struct {
+	HTTPTests []zabbixHTTPTest `xml:"httptests>httptest"`
+}
+
+type zabbixHTTPTest struct {
+	Name           string        `xml:"name"`
+	Delay          string        `xml:"delay"`
+	Agent          string        `xml:"agent"`
+	HTTPProxy      string        `xml:"http_proxy"`
+	Variables      []zabbixField `xml:"variables>variable"`
+	Headers        []zabbixField `xml:"headers>header"`
+	Status         string        `xml:"status"`
+	Authentication string        `xml:"authentication"`
+	HTTPUser       string        `xml:"http_user"`
+	HTTPPassword   string        `xml:"http_password"`
+	VerifyPeer     string        `xml:"verify_peer"`
+	VerifyHost     string        `xml:"verify_host"`
+	SSLCertFile    string        `xml:"ssl_cert_file"`
+	SSLKeyFile     string        `xml:"ssl_key_file"`
+	SSLKeyPassword string        `xml:"ssl_key_password"`
+	Steps          []zabbixStep  `xml:"steps>step"`
+}
+
+type zabbixStep struct {
+	Name            string        `xml:"name"`
+	Url             string        `xml:"url"`
+	QueryFields     []zabbixField `xml:"query_fields>query_field"`
+	Posts           zabbixPosts   `xml:"posts"`
+	Variables       []zabbixField `xml:"variables>variable"`
+	Headers         []zabbixField `xml:"headers>header"`
+	FollowRedirects string        `xml:"follow_redirects"`
+	RetrieveMode    string        `xml:"retrieve_mode"`
+	Timeout         string        `xml:"timeout"`
+	Required        string        `xml:"required"`
+	StatusCodes     string        `xml:"status_codes"`
+}
+
+// zabbixPosts is either raw request body or list of form fields
+type zabbixPosts struct {
+	Raw    string        `xml:",chardata"`
+	Fields []zabbixField `xml:"post_field"`
+}
+
+type zabbixField struct {
+	Name  string `xml:"name"`
+	Value string `xml:"value"`
+}
+
+// prefixes of variables extracted from responses of previous steps
+var zabbixDynamicVariablePrefixes = []string{"regex:", "jsondata:", "headers:"}
+
+var zabbixMacroRegexp = regexp.MustCompile(`\{\$[^}]*\}|\{[A-Z]+\.[A-Z.]+\}`)
+
+// FromZabbixExport converts web scenarios from Zabbix hosts or templates
+// export (XML) into targets. Every step becomes separate target named after
+// scenario and step, since zcm target makes single request. Steps depending
+// on previous ones or settings which can't be expressed in target are
+// reported as warnings.
+func FromZabbixExport(data []byte) (map[string]*Target, []string, error) {
+	export := &zabbixExport{}
+	if err := xml.Unmarshal(data, export); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("error while parsing Zabbix export, error: %s", err))
+	}
+
+	if export.Version == "" {
+		return nil, nil, errors.New("document is not Zabbix XML export")
+	}
+
+	var (
+		targets  = map[string]*Target{}
+		warnings []string
+	)
+
+	for _, host := range append(export.Hosts, export.Templates...) {
+		for _, test := range host.HTTPTests {
+			warnings = append(warnings, test.convert(targets)...)
+		}
+	}
+
+	if len(targets) == 0 {
+		warnings = append(warnings, "no web scenario steps were converted")
+	}
+
+	return targets, warnings, nil
+}
+
+func (t *zabbixHTTPTest) convert(targets map[string]*Target) []string {
+	var warnings []string
+	warn := func(format string, a ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf("scenario \"%s\": ", t.Name)+fmt.Sprintf(format, a...))
+	}
+
+	if t.Status == "DISABLED" {
+		warn("skipped, scenario is disabled")
+		return warnings
+	}
+
+	interval := 0
+	if t.Delay != "" {
+		d, err := parseZabbixDuration(t.Delay)
+		if err != nil {
+			warn("delay \"%s\" not converted, default interval is used", t.Delay)
+		} else {
+			interval = int(d.Milliseconds())
+		}
+	}
+
+	var authorization *Authorization
+	switch t.Authentication {
+	case "", "NONE":
+	case "BASIC":
+		authorization = &Authorization{Type: "Basic", Username: t.HTTPUser, Password: t.HTTPPassword}
+	default:
+		warn("%s authentication is not supported and was skipped", t.Authentication)
+	}
+
+	// zabbix defaults to http proxy when protocol is omitted
+	proxy := t.HTTPProxy
+	if proxy != "" && !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	// verification is disabled only when export says so explicitly
+	tls := TLS{InsecureSkipVerify: t.VerifyPeer == "NO" || t.VerifyHost == "NO"}
+
+	if t.SSLCertFile != "" {
+		// zabbix reads key from certificate file when key file isn't set
+		tls.CertFile, tls.KeyFile = t.SSLCertFile, t.SSLKeyFile
+		if tls.KeyFile == "" {
+			tls.KeyFile = tls.CertFile
+		}
+		warn("client certificate files are relative to SSLCertLocation and SSLKeyLocation of Zabbix server, adjust paths if needed")
+		if t.SSLKeyPassword != "" {
+			warn("encrypted client key is not supported, decrypt it before use")
+		}
+	}
+
+	variables, dynamic := zabbixVariables(t.Variables)
+
+	for i, step := range t.Steps {
+		name := t.Name
+		if len(t.Steps) > 1 {
+			name = t.Name + " " + step.Name
+		}
+		name = uniqueName(targets, nameSlug(name))
+
+		headers := map[string]string{}
+		if t.Agent != "" && t.Agent != "Zabbix" {
+			headers["User-Agent"] = t.Agent
+		}
+		for _, h := range t.Headers {
+			headers[http.CanonicalHeaderKey(h.Name)] = replaceZabbixVariables(h.Value, variables)
+		}
+
+		target, stepWarnings := step.convert(variables, dynamic)
+		for _, w := range stepWarnings {
+			warn("step %d \"%s\": %s", i+1, step.Name, w)
+		}
+
+		// variables defined by step are available from the next step
+		stepVariables, stepDynamic := zabbixVariables(step.Variables)
+		for k, v := range stepVariables {
+			variables[k] = v
+		}
+		dynamic = append(dynamic, stepDynamic...)
+
+		if target == nil {
+			continue
+		}
+
+		for k, v := range target.Headers {
+			headers[k] = v
+		}
+		if len(headers) > 0 {
+			target.Headers = headers
+		}
+
+		target.Interval = interval
+		target.Authorization = authorization
+		target.Proxy = proxy
+		if tls != (TLS{}) && strings.HasPrefix(target.Url, "https://") {
+			stepTLS := tls
+			target.TLS = &stepTLS
+		}
+
+		if zabbixMacroRegexp.MatchString(fmt.Sprint(target.Url, target.Headers, target.FormData, target.Json)) {
+			warn("step %d \"%s\": contains Zabbix macros, replace them before use", i+1, step.Name)
+		}
+
+		targets[name] = target
+	}
+
+	return warnings
+}
+
+// convert returns target making step's request, nil when step can't be converted
+func (s *zabbixStep) convert(variables map[string]string, dynamic []string) (*Target, []string) {
+	var warnings []string
+
+	fields := []string{s.Url, s.Posts.Raw, s.Required}
+	for _, f := range append(append(s.QueryFields, s.Posts.Fields...), s.Headers...) {
+		fields = append(fields, f.Name, f.Value)
+	}
+	for _, name := range dynamic {
+		for _, f := range fields {
+			if strings.Contains(f, name) {
+				return nil, []string{fmt.Sprintf("skipped, uses variable %s extracted from previous step", name)}
+			}
+		}
+	}
+
+	rawUrl := replaceZabbixVariables(s.Url, variables)
+	if len(s.QueryFields) > 0 {
+		query := make([]string, 0, len(s.QueryFields))
+		for _, f := range s.QueryFields {
+			query = append(query, url.QueryEscape(replaceZabbixVariables(f.Name, variables))+"="+url.QueryEscape(replaceZabbixVariables(f.Value, variables)))
+		}
+
+		sep := "?"
+		if strings.Contains(rawUrl, "?") {
+			sep = "&"
+		}
+		rawUrl += sep + strings.Join(query, "&")
+	}
+
+	target := &Target{Url: rawUrl}
+
+	raw := strings.TrimSpace(replaceZabbixVariables(s.Posts.Raw, variables))
+	switch {
+	case len(s.Posts.Fields) > 0:
+		target.FormData = map[string]string{}
+		for _, f := range s.Posts.Fields {
+			target.FormData[replaceZabbixVariables(f.Name, variables)] = replaceZabbixVariables(f.Value, variables)
+		}
+
+	case raw != "" && json.Valid([]byte(raw)):
+		target.Json = raw
+
+	case raw != "":
+		values, err := url.ParseQuery(raw)
+		if err != nil || !strings.Contains(raw, "=") {
+			return nil, []string{"skipped, raw post data is neither json nor form data"}
+		}
+		target.FormData = map[string]string{}
+		for k, v := range values {
+			target.FormData[k] = v[0]
+		}
+	}
+
+	if target.FormData != nil || target.Json != "" {
+		target.Method = http.MethodPost
+	} else if s.RetrieveMode == "HEADERS" {
+		target.Method = http.MethodHead
+	}
+
+	if len(s.Headers) > 0 {
+		target.Headers = map[string]string{}
+		for _, h := range s.Headers {
+			target.Headers[http.CanonicalHeaderKey(h.Name)] = replaceZabbixVariables(h.Value, variables)
+		}
+	}
+
+	if s.Timeout != "" {
+		if d, err := parseZabbixDuration(s.Timeout); err == nil {
+			target.Timeout = d.String()
+		} else {
+			warnings = append(warnings, fmt.Sprintf("timeout \"%s\" not converted, default timeout is used", s.Timeout))
+		}
+	}
+
+	if s.Required != "" {
+		if target.Method == http.MethodHead {
+			warnings = append(warnings, "required string is matched against headers in Zabbix and was skipped")
+		} else {
+			target.ExpectBodyRegex = replaceZabbixVariables(s.Required, variables)
+		}
+	}
+
+	if s.StatusCodes != "" {
+		codes, err := zabbixStatusCodes(s.StatusCodes)
+		if err != nil {
+			warnings = append(warnings, err.Error())
+		}
+		target.ExpectStatus = codes
+	}
+
+	if s.FollowRedirects == "NO" {
+		warnings = append(warnings, "redirects can't be disabled, they will be followed")
+	}
+
+	return target, warnings
+}
+
+// zabbixVariables splits variables into static values by name
+// and names of variables extracted from responses
+func zabbixVariables(fields []zabbixField) (map[string]string, []string) {
+	static := map[string]string{}
+	var dynamic []string
+
+	for _, f := range fields {
+		isDynamic := false
+		for _, prefix := range zabbixDynamicVariablePrefixes {
+			if strings.HasPrefix(f.Value, prefix) {
+				isDynamic = true
+				break
+			}
+		}
+
+		if isDynamic {
+			dynamic = append(dynamic, f.Name)
+		} else {
+			static[f.Name] = f.Value
+		}
+	}
+
+	return static, dynamic
+}
+
+func replaceZabbixVariables(s string, variables map[string]string) string {
+	for name, value := range variables {
+		s = strings.ReplaceAll(s, name, value)
+	}
+	return s
+}
+
+// parseZabbixDuration parses Zabbix time value, number of seconds
+// optionally followed by unit suffix (s, m, h, d, w)
+func parseZabbixDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+
+	unit := time.Second
+	if s != "" {
+		switch s[len(s)-1] {
+		case 's':
+			s = s[:len(s)-1]
+		case 'm':
+			unit, s = time.Minute, s[:len(s)-1]
+		case 'h':
+			unit, s = time.Hour, s[:len(s)-1]
+		case 'd':
+			unit, s = 24*time.Hour, s[:len(s)-1]
+		case 'w':
+			unit, s = 7*24*time.Hour, s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, errors.New(fmt.Sprintf("invalid time value \"%s\"", s))
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+// zabbixStatusCodes converts Zabbix list of codes and ranges (e.g. 200,300-399)
+// into expected statuses, whole hundreds of range become classes
+func zabbixStatusCodes(s string) ([]interface{}, error) {
+	var codes []interface{}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+
+		first, errFrom := strconv.Atoi(strings.TrimSpace(from))
+		last, errTo := strconv.Atoi(strings.TrimSpace(to))
+		if errFrom != nil || errTo != nil || first < 100 || last > 599 || first > last {
+			return codes, errors.New(fmt.Sprintf("status codes \"%s\" not converted", part))
+		}
+
+		for code := first; code <= last; code++ {
+			if code%100 == 0 && code+99 <= last {
+				codes = append(codes, fmt.Sprintf("%dxx", code/100))
+				code += 99
+				continue
+			}
+			codes = append(codes, code)
+		}
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,48 @@
+package monitoring
+
+import "time"
+
+// defaultApdexWindow is number of checks apdex score is computed over
+const defaultApdexWindow = 100
+
+type apdex struct {
+	// Satisfied is response time in milliseconds up to which user is satisfied
+	Satisfied int `yaml:"satisfied"`
+	// Tolerating is response time in milliseconds up to which user tolerates
+	// the response, default 4 times satisfied
+	Tolerating int `yaml:"tolerating"`
+	// Window is number of last checks score is computed over
+	Window int `yaml:"window"`
+}
+
+// apdexWindow keeps scores of last checks in ring buffer, counted in halves:
+// satisfied 2, tolerating 1 and frustrated (slow or failed) 0
+type apdexWindow struct {
+	scores []uint8
+	next   int
+	sum    int
+}
+
+// add records result and returns apdex score over the window,
+// (satisfied + tolerating/2) / checks
+func (w *apdexWindow) add(result checkResult, a *apdex) float64 {
+	var score uint8
+	switch {
+	case result.failed():
+	case result.responseTime <= time.Duration(a.Satisfied)*time.Millisecond:
+		score = 2
+	case result.responseTime <= time.Duration(a.Tolerating)*time.Millisecond:
+		score = 1
+	}
+
+	if len(w.scores) < a.Window {
+		w.scores = append(w.scores, score)
+	} else {
+		w.sum -= int(w.scores[w.next])
+		w.scores[w.next] = score
+		w.next = (w.next + 1) % len(w.scores)
+	}
+	w.sum += int(score)
+
+	return float64(w.sum) / float64(2*len(w.scores))
+}
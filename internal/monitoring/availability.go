@@ -0,0 +1,85 @@
+package monitoring
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultAvailabilityWindow = time.Hour
+	// availabilityBuckets is number of buckets window is split into,
+	// window slides by one bucket at a time
+	availabilityBuckets = 60
+)
+
+type availabilityBucket struct {
+	start    time.Time
+	checks   int
+	failures int
+}
+
+// availabilityWindow counts checks and failures of target in time buckets
+type availabilityWindow struct {
+	mu      sync.Mutex
+	buckets []availabilityBucket
+}
+
+func (w *availabilityWindow) add(now time.Time, failed bool, window time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	size := window / availabilityBuckets
+	start := now.Truncate(size)
+
+	if n := len(w.buckets); n == 0 || !w.buckets[n-1].start.Equal(start) {
+		w.buckets = append(w.buckets, availabilityBucket{start: start})
+	}
+
+	b := &w.buckets[len(w.buckets)-1]
+	b.checks++
+	if failed {
+		b.failures++
+	}
+
+	// drop buckets which slid out of the window
+	i := 0
+	for i < len(w.buckets) && !w.buckets[i].start.Add(size).After(now.Add(-window)) {
+		i++
+	}
+	w.buckets = append(w.buckets[:0], w.buckets[i:]...)
+}
+
+// percentage returns share of successful checks within window in percents,
+// false when no check finished within window
+func (w *availabilityWindow) percentage(now time.Time, window time.Duration) (float64, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	size := window / availabilityBuckets
+
+	var checks, failures int
+	for _, b := range w.buckets {
+		if b.start.Add(size).After(now.Add(-window)) {
+			checks += b.checks
+			failures += b.failures
+		}
+	}
+
+	if checks == 0 {
+		return 0, false
+	}
+	return 100 * float64(checks-failures) / float64(checks), true
+}
+
+// Availability returns percentage of successful checks of running target
+// within its availability window, false when target is unknown or had no checks
+func (t *Targets) Availability(key string) (float64, bool) {
+	t.mu.RLock()
+	m, ok := t.monitors[key]
+	t.mu.RUnlock()
+
+	if !ok {
+		return 0, false
+	}
+	return m.availability.percentage(time.Now(), m.target.availabilityWindow)
+}
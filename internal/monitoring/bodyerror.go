@@ -0,0 +1,55 @@
+package monitoring
+
+import (
+	"errors"
+	"io"
+)
+
+const (
+	// bodyErrorFail fails check whose response body couldn't be read
+	bodyErrorFail = "fail"
+	// bodyErrorIgnore reports body read error only with bodyError parameter
+	bodyErrorIgnore = "ignore"
+)
+
+// bodyReadError is error of reading response body after its headers were
+// received, e.g. truncated response or body which didn't arrive in time
+type bodyReadError struct {
+	err error
+}
+
+func (e *bodyReadError) Error() string {
+	return "reading response body failed: " + e.err.Error()
+}
+
+func (e *bodyReadError) Unwrap() error {
+	return e.err
+}
+
+// bodyReader marks errors of reading response body, so they can be told
+// apart from errors of request
+type bodyReader struct {
+	r io.Reader
+}
+
+func (b bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &bodyReadError{err: err}
+	}
+	return n, err
+}
+
+// markBodyError records body read error of result, the check passes
+// despite it when target ignores body errors
+func markBodyError(result *checkResult, target *targetInfo) {
+	var bodyErr *bodyReadError
+	if result.err == nil || !errors.As(result.err, &bodyErr) {
+		return
+	}
+
+	result.bodyErr = bodyErr
+	if target.BodyError == bodyErrorIgnore {
+		result.err = nil
+	}
+}
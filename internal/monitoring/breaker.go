@@ -0,0 +1,57 @@
+package monitoring
+
+import "time"
+
+const (
+	// defaultBreakerFailures is number of consecutive failures opening circuit breaker
+	defaultBreakerFailures = 5
+	// minBreakerOpenInterval is lower bound of default delay between probes of open breaker
+	minBreakerOpenInterval = 60000
+
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// circuitBreaker backs off from target which keeps failing, so agent
+// doesn't pound backend which is already down
+type circuitBreaker struct {
+	// Failures is number of consecutive failed checks opening breaker
+	Failures int `yaml:"failures"`
+	// OpenInterval is delay in milliseconds between probes while breaker is open,
+	// default 6 intervals but at least 60000
+	OpenInterval int `yaml:"open-interval"`
+}
+
+// breakerState tracks circuit breaker of monitor across checks
+type breakerState struct {
+	state    string
+	failures int
+}
+
+// begin marks check starting while breaker is open as probe
+func (s *breakerState) begin() {
+	if s.state == BreakerOpen {
+		s.state = BreakerHalfOpen
+	}
+}
+
+// add records result and returns delay before next check, which is
+// breaker's open interval once it opens. Failed probe opens breaker
+// again, successful one closes it.
+func (s *breakerState) add(result checkResult, b *circuitBreaker, interval time.Duration) time.Duration {
+	if !result.failed() {
+		s.state = BreakerClosed
+		s.failures = 0
+		return interval
+	}
+
+	s.failures++
+	if s.state == BreakerHalfOpen || s.failures >= b.Failures {
+		s.state = BreakerOpen
+		return time.Millisecond * time.Duration(b.OpenInterval)
+	}
+
+	s.state = BreakerClosed
+	return interval
+}
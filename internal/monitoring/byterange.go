@@ -0,0 +1,156 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// byteRange is single range of bytes requested by target's range field,
+// start is -1 for suffix range (last suffix bytes), end is -1 for range
+// open to the end of resource
+type byteRange struct {
+	start  int64
+	end    int64
+	suffix int64
+}
+
+// parseByteRange parses range given as bytes=0-1023, bytes=1024- or bytes=-512,
+// prefix "bytes=" is optional
+func parseByteRange(s string) (byteRange, error) {
+	invalid := errors.New(fmt.Sprintf("invalid range \"%s\", expected single range e.g. bytes=0-1023, bytes=1024- or bytes=-512", s))
+
+	spec := strings.TrimPrefix(strings.TrimSpace(s), "bytes=")
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok || strings.Contains(spec, ",") {
+		return byteRange{}, invalid
+	}
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 {
+			return byteRange{}, invalid
+		}
+		return byteRange{start: -1, end: -1, suffix: suffix}, nil
+	}
+
+	r := byteRange{end: -1}
+	var err error
+	if r.start, err = strconv.ParseInt(first, 10, 64); err != nil || r.start < 0 {
+		return byteRange{}, invalid
+	}
+	if last != "" {
+		if r.end, err = strconv.ParseInt(last, 10, 64); err != nil || r.end < r.start {
+			return byteRange{}, invalid
+		}
+	}
+
+	return r, nil
+}
+
+func (r byteRange) String() string {
+	switch {
+	case r.start < 0:
+		return fmt.Sprintf("bytes=-%d", r.suffix)
+	case r.end < 0:
+		return fmt.Sprintf("bytes=%d-", r.start)
+	}
+	return fmt.Sprintf("bytes=%d-%d", r.start, r.end)
+}
+
+// validateRange checks response to range request, server must answer with
+// 206 and Content-Range matching requested range, received is number of
+// body bytes which must match length of the range
+func validateRange(res *http.Response, r byteRange, received int64) error {
+	if res.StatusCode != http.StatusPartialContent {
+		if res.StatusCode == http.StatusOK {
+			return errors.New("server ignored Range header and returned whole resource")
+		}
+		return errors.New(fmt.Sprintf("expected 206 Partial Content for range %s, got %s", r, res.Status))
+	}
+
+	contentRange := res.Header.Get("Content-Range")
+	if contentRange == "" {
+		return errors.New("206 response without Content-Range header")
+	}
+
+	first, last, size, err := parseContentRange(contentRange)
+	if err != nil {
+		return err
+	}
+
+	// expected bounds, resolved against size of resource when it is known
+	wantFirst, wantLast := r.start, r.end
+	switch {
+	case r.start < 0:
+		wantFirst, wantLast = -1, -1
+		if size >= 0 {
+			wantFirst, wantLast = max(size-r.suffix, 0), size-1
+		}
+	case r.end < 0 || (size >= 0 && r.end >= size):
+		wantLast = -1
+		if size >= 0 {
+			wantLast = size - 1
+		}
+	}
+
+	if (wantFirst >= 0 && first != wantFirst) || (wantLast >= 0 && last != wantLast) {
+		return errors.New(fmt.Sprintf("Content-Range \"%s\" doesn't match requested range %s", contentRange, r))
+	}
+
+	if length := last - first + 1; received != length {
+		return errors.New(fmt.Sprintf("partial body has %d bytes, Content-Range \"%s\" announces %d", received, contentRange, length))
+	}
+
+	return nil
+}
+
+// parseContentRange parses Content-Range of single range, size is -1
+// when it is unknown (bytes 0-1023/*)
+func parseContentRange(s string) (first, last, size int64, err error) {
+	invalid := errors.New(fmt.Sprintf("invalid Content-Range \"%s\"", s))
+
+	spec, ok := strings.CutPrefix(s, "bytes ")
+	if !ok {
+		return 0, 0, 0, invalid
+	}
+	bounds, sizeSpec, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, 0, invalid
+	}
+	firstSpec, lastSpec, ok := strings.Cut(bounds, "-")
+	if !ok {
+		return 0, 0, 0, invalid
+	}
+
+	if first, err = strconv.ParseInt(firstSpec, 10, 64); err != nil {
+		return 0, 0, 0, invalid
+	}
+	if last, err = strconv.ParseInt(lastSpec, 10, 64); err != nil || last < first {
+		return 0, 0, 0, invalid
+	}
+
+	size = -1
+	if sizeSpec != "*" {
+		if size, err = strconv.ParseInt(sizeSpec, 10, 64); err != nil || last >= size {
+			return 0, 0, 0, invalid
+		}
+	}
+
+	return first, last, size, nil
+}
+
+// countingReader counts bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,82 @@
+package monitoring
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// normalized cache statuses reported by cacheStatus parameter
+const (
+	cacheStatusHit    = "hit"
+	cacheStatusMiss   = "miss"
+	cacheStatusStale  = "stale"
+	cacheStatusBypass = "bypass"
+)
+
+// readCacheStatus normalizes cache headers of response, status is empty when
+// response doesn't carry any of known headers and age is -1 without Age header
+func readCacheStatus(header http.Header) (status string, age int) {
+	age = -1
+	if v, err := strconv.Atoi(strings.TrimSpace(header.Get("Age"))); err == nil && v >= 0 {
+		age = v
+	}
+
+	// RFC 9211 Cache-Status, e.g. "ExampleCDN; hit" or "ExampleCDN; fwd=miss"
+	if v := lastListMember(header.Get("Cache-Status")); v != "" {
+		return parseCacheStatusMember(v), age
+	}
+
+	// Cloudflare, e.g. HIT, MISS, EXPIRED, DYNAMIC
+	if v := header.Get("CF-Cache-Status"); v != "" {
+		return normalizeCacheStatus(v), age
+	}
+
+	// Fastly, Varnish, CloudFront and nginx, e.g. "MISS, HIT" or "Hit from cloudfront"
+	for _, name := range []string{"X-Cache", "X-Cache-Status"} {
+		if v := lastListMember(header.Get(name)); v != "" {
+			return normalizeCacheStatus(v), age
+		}
+	}
+
+	return "", age
+}
+
+// lastListMember returns last member of comma separated header value,
+// which is added by cache closest to the client
+func lastListMember(value string) string {
+	members := strings.Split(value, ",")
+	return strings.TrimSpace(members[len(members)-1])
+}
+
+func parseCacheStatusMember(member string) string {
+	status := cacheStatusMiss
+	for _, param := range strings.Split(member, ";")[1:] {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch strings.ToLower(name) {
+		case "hit":
+			return cacheStatusHit
+		case "fwd":
+			switch strings.ToLower(strings.Trim(value, `"`)) {
+			case "bypass", "method", "request":
+				status = cacheStatusBypass
+			case "stale":
+				status = cacheStatusStale
+			}
+		}
+	}
+	return status
+}
+
+func normalizeCacheStatus(value string) string {
+	v := strings.ToUpper(value)
+	switch {
+	case strings.Contains(v, "STALE"), strings.Contains(v, "UPDATING"):
+		return cacheStatusStale
+	case strings.Contains(v, "HIT"), strings.Contains(v, "REVALIDATED"):
+		return cacheStatusHit
+	case strings.Contains(v, "PASS"), strings.Contains(v, "DYNAMIC"):
+		return cacheStatusBypass
+	}
+	return cacheStatusMiss
+}
@@ -0,0 +1,90 @@
+package monitoring
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// clientKeyPair is client certificate of target, it is loaded again when
+// certificate or key file changes, so renewed certificates are picked up
+// without reload
+type clientKeyPair struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+func newClientKeyPair(certFile, keyFile string) (*clientKeyPair, error) {
+	kp := &clientKeyPair{certFile: certFile, keyFile: keyFile}
+
+	modTimes, err := kp.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := kp.load(modTimes); err != nil {
+		return nil, err
+	}
+
+	return kp, nil
+}
+
+// getClientCertificate is used as tls.Config.GetClientCertificate, certificate
+// which can't be loaded again is logged and the previous one is kept
+func (kp *clientKeyPair) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	if modTimes, err := kp.stat(); err == nil && modTimes != kp.modTimes {
+		if err := kp.load(modTimes); err != nil {
+			slog.Warn("client certificate not reloaded, previous one is used", "cert-file", kp.certFile, "err", err)
+		}
+	}
+
+	return kp.cert, nil
+}
+
+func (kp *clientKeyPair) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, name := range []string{kp.certFile, kp.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return modTimes, errors.New(fmt.Sprintf("error while reading client certificate, error: %s", err))
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (kp *clientKeyPair) load(modTimes [2]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+	if err != nil {
+		return errors.New(fmt.Sprintf("error while loading client certificate, error: %s", err))
+	}
+
+	kp.cert = &cert
+	kp.modTimes = modTimes
+	return nil
+}
+
+// loadCAFile returns pool of PEM encoded certificates in file
+func loadCAFile(name string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error while reading ca file, error: %s", err))
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New(fmt.Sprintf("no PEM encoded certificates found in ca file %s", name))
+	}
+	return pool, nil
+}
@@ -0,0 +1,84 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// mediaRange is expected content type, type and subtype can be * and
+// subtype can be suffix wildcard (e.g. *+json), parameters given in range
+// (e.g. charset) must be present in content type
+type mediaRange struct {
+	typ     string
+	subtype string
+	params  map[string]string
+}
+
+// parseMediaRanges parses expected content types, quality parameter of
+// Accept header is dropped
+func parseMediaRanges(specs []string) ([]mediaRange, error) {
+	ranges := make([]mediaRange, 0, len(specs))
+	for _, spec := range specs {
+		mediaType, params, err := mime.ParseMediaType(spec)
+		typ, subtype, ok := strings.Cut(mediaType, "/")
+		if err != nil || !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+			return nil, errors.New(fmt.Sprintf("invalid content type \"%s\", expected e.g. application/json, text/* or application/*+json", spec))
+		}
+		delete(params, "q")
+
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, params: params})
+	}
+	return ranges, nil
+}
+
+func (r mediaRange) matches(mediaType string, params map[string]string) bool {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+
+	if r.typ != "*" && r.typ != typ {
+		return false
+	}
+	switch {
+	case r.subtype == "*":
+	case strings.HasPrefix(r.subtype, "*+"):
+		if !strings.HasSuffix(subtype, r.subtype[1:]) {
+			return false
+		}
+	case r.subtype != subtype:
+		return false
+	}
+
+	for k, v := range r.params {
+		if !strings.EqualFold(params[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkContentType returns error when Content-Type of response doesn't match
+// any of expected ranges, responses without body (204, 304) aren't checked
+func checkContentType(res *http.Response, ranges []mediaRange) error {
+	if res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	contentType := res.Header.Get("Content-Type")
+	if contentType == "" {
+		return errors.New("response has no Content-Type")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return errors.New(fmt.Sprintf("invalid Content-Type \"%s\"", contentType))
+	}
+
+	for _, r := range ranges {
+		if r.matches(mediaType, params) {
+			return nil
+		}
+	}
+	return errors.New(fmt.Sprintf("unexpected Content-Type \"%s\"", contentType))
+}
@@ -0,0 +1,215 @@
+package monitoring
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http/httpguts"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[redacted]"
+
+// secret holds credential such as password or token. It's redacted when
+// printed or marshaled, so it can't leak to logs or API outputs by accident,
+// and its memory is wiped when target is dropped by reload. Wiping is best
+// effort, copies made while building requests are left to garbage collector.
+type secret struct {
+	v *secretValue
+}
+
+type secretValue struct {
+	mu sync.RWMutex
+	b  []byte
+}
+
+func newSecret(s string) secret {
+	if s == "" {
+		return secret{}
+	}
+	return secret{v: &secretValue{b: []byte(s)}}
+}
+
+// reveal returns plaintext of secret, it must not be logged
+func (s secret) reveal() string {
+	if s.v == nil {
+		return ""
+	}
+
+	s.v.mu.RLock()
+	defer s.v.mu.RUnlock()
+
+	return string(s.v.b)
+}
+
+func (s secret) isEmpty() bool {
+	if s.v == nil {
+		return true
+	}
+
+	s.v.mu.RLock()
+	defer s.v.mu.RUnlock()
+
+	return len(s.v.b) == 0
+}
+
+func (s secret) equal(other secret) bool {
+	return subtle.ConstantTimeCompare([]byte(s.reveal()), []byte(other.reveal())) == 1
+}
+
+// wipe overwrites secret's memory with zeros
+func (s secret) wipe() {
+	if s.v == nil {
+		return
+	}
+
+	s.v.mu.Lock()
+	defer s.v.mu.Unlock()
+
+	clear(s.v.b)
+	s.v.b = nil
+}
+
+func (s secret) String() string {
+	if s.isEmpty() {
+		return ""
+	}
+	return redacted
+}
+
+func (s secret) GoString() string {
+	return s.String()
+}
+
+func (s secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+func (s *secret) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+
+	// overlay replaces secret of base target
+	s.wipe()
+	*s = newSecret(value)
+	return nil
+}
+
+// replaceSecretWithEnvVar is replaceWithEnvVar for secrets
+func replaceSecretWithEnvVar(s *secret) error {
+	value := s.reveal()
+	if err := replaceWithEnvVar(&value); err != nil {
+		return err
+	}
+
+	if value != s.reveal() {
+		s.wipe()
+		*s = newSecret(value)
+	}
+	return nil
+}
+
+// readSecretFile returns content of file without trailing newline,
+// which editors and echo append
+func readSecretFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("secret file %s can't be read, error: %s", path, errors.Unwrap(err)))
+	}
+	defer clear(b)
+
+	value := strings.TrimRight(string(b), "\r\n")
+	if value == "" {
+		return "", errors.New(fmt.Sprintf("secret file %s is empty", path))
+	}
+	return value, nil
+}
+
+// loadSecretFile sets secret s from file at path, field is name of
+// the secret, which can't be given inline too
+func loadSecretFile(s *secret, path string, field string) error {
+	if path == "" {
+		return nil
+	}
+	if !s.isEmpty() {
+		return errors.New(fmt.Sprintf("\"%s\" and \"%s-file\" can't be combined", field, field))
+	}
+
+	value, err := readSecretFile(path)
+	if err != nil {
+		return err
+	}
+	*s = newSecret(value)
+	return nil
+}
+
+// authorizationAPIKey is authorization type sending api key in its own header
+const authorizationAPIKey = "apikey"
+
+const defaultAPIKeyHeader = "X-API-Key"
+
+// checkAPIKey validates fields of apikey authorization, header defaults
+// to X-API-Key and can't be set in target's headers too
+func (a *authorization) checkAPIKey(headers map[string]string) error {
+	if a.Username != "" || !a.Password.isEmpty() || !a.Token.isEmpty() || a.hasOAuth2Fields() {
+		return errors.New("only \"header\" and \"value\" are available for apikey authorization")
+	}
+	if a.Value.isEmpty() {
+		return errors.New("\"value\" is required for apikey authorization")
+	}
+
+	if a.Header == "" {
+		a.Header = defaultAPIKeyHeader
+	}
+	if !httpguts.ValidHeaderFieldName(a.Header) {
+		return errors.New(fmt.Sprintf("invalid header name \"%s\" of apikey authorization", a.Header))
+	}
+	for name := range headers {
+		if strings.EqualFold(name, a.Header) {
+			return errors.New(fmt.Sprintf("header \"%s\" of apikey authorization is also set in \"headers\"", a.Header))
+		}
+	}
+	return nil
+}
+
+// secrets returns all secrets of target
+func (t *targetInfo) secrets() []secret {
+	return []secret{t.Authorization.Password, t.Authorization.Token, t.Authorization.ClientSecret, t.Authorization.Value, t.ProxyAuthorization.Password}
+}
+
+func (t *targetInfo) wipeSecrets() {
+	for _, s := range t.secrets() {
+		s.wipe()
+	}
+	t.authHeader.wipe()
+	if t.oauth2 != nil {
+		t.oauth2.wipe()
+	}
+}
+
+func sameSecrets(a, b *targetInfo) bool {
+	as, bs := a.secrets(), b.secrets()
+	for i := range as {
+		if !as[i].equal(bs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func wipeTargets(tm targetsMetadata) {
+	for _, target := range tm {
+		target.wipeSecrets()
+	}
+}
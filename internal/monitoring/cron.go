@@ -0,0 +1,175 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is parsed cron expression, every field is set of allowed
+// values with bit n set for value n
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// anyDOM and anyDOW are set for "*" fields, when both day fields are
+	// restricted day matches if either of them matches (as in cron)
+	anyDOM, anyDOW bool
+}
+
+// cronMacros are shortcuts of common schedules
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is Sunday as well
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// parseCron parses standard 5 field cron expression (minute, hour, day of
+// month, month, day of week) with lists, ranges, steps and names of months
+// and days, or one of macros e.g. @hourly
+func parseCron(expr string) (*cronSchedule, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, errors.New(fmt.Sprintf("invalid schedule \"%s\", expected 5 fields: minute hour day-of-month month day-of-week", expr))
+	}
+
+	var bits [5]uint64
+	for i, f := range cronFields {
+		b, err := parseCronField(fields[i], f)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid schedule \"%s\", %s", expr, err))
+		}
+		bits[i] = b
+	}
+
+	s := &cronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		anyDOM: fields[2] == "*",
+		anyDOW: fields[4] == "*",
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	return s, nil
+}
+
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		invalid := errors.New(fmt.Sprintf("invalid %s \"%s\"", f.name, part))
+
+		spec, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepSpec); err != nil || step <= 0 {
+				return 0, invalid
+			}
+		}
+
+		from, to := f.min, f.max
+		if spec != "*" {
+			first, last, isRange := strings.Cut(spec, "-")
+			var err error
+			if from, err = cronValue(first, f); err != nil {
+				return 0, invalid
+			}
+			to = from
+			if isRange {
+				if to, err = cronValue(last, f); err != nil || to < from {
+					return 0, invalid
+				}
+			} else if hasStep {
+				// n/step is from n to the end of range
+				to = f.max
+			}
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func cronValue(s string, f cronField) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, errors.New("out of range")
+	}
+	return v, nil
+}
+
+// next returns the first time after t which matches schedule, zero time
+// when none matches within 5 years (e.g. 30th of February)
+func (s *cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + 5
+
+	for t.Year() <= limit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDOM || s.anyDOW {
+		return dom && dow
+	}
+	return dom || dow
+}
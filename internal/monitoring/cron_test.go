@@ -0,0 +1,172 @@
+package monitoring
+
+import (
+	"testing"
+	"time"
+)
+
+// cronBits returns set of values with bit n set for value n
+func cronBits(values ...int) uint64 {
+	var bits uint64
+	for _, v := range values {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+func cronRange(from, to, step int) uint64 {
+	var bits uint64
+	for v := from; v <= to; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr string
+		want cronSchedule
+	}{
+		{"* * * * *", cronSchedule{minute: cronRange(0, 59, 1), hour: cronRange(0, 23, 1), dom: cronRange(1, 31, 1), month: cronRange(1, 12, 1), dow: cronRange(0, 7, 1), anyDOM: true, anyDOW: true}},
+		{"*/15 8-18 * * 1-5", cronSchedule{minute: cronBits(0, 15, 30, 45), hour: cronRange(8, 18, 1), dom: cronRange(1, 31, 1), month: cronRange(1, 12, 1), dow: cronRange(1, 5, 1), anyDOM: true}},
+		{"10-50/20 0,12 1,15 * *", cronSchedule{minute: cronBits(10, 30, 50), hour: cronBits(0, 12), dom: cronBits(1, 15), month: cronRange(1, 12, 1), dow: cronRange(0, 7, 1), anyDOW: true}},
+		{"5/20 * * * *", cronSchedule{minute: cronBits(5, 25, 45), hour: cronRange(0, 23, 1), dom: cronRange(1, 31, 1), month: cronRange(1, 12, 1), dow: cronRange(0, 7, 1), anyDOM: true, anyDOW: true}},
+		{"0 0 * jan,Jun-AUG sun", cronSchedule{minute: cronBits(0), hour: cronBits(0), dom: cronRange(1, 31, 1), month: cronBits(1, 6, 7, 8), dow: cronBits(0), anyDOM: true}},
+		// 7 is Sunday as well
+		{"0 0 * * 7", cronSchedule{minute: cronBits(0), hour: cronBits(0), dom: cronRange(1, 31, 1), month: cronRange(1, 12, 1), dow: cronBits(0, 7), anyDOM: true}},
+		{"0 0 * * fri-sat", cronSchedule{minute: cronBits(0), hour: cronBits(0), dom: cronRange(1, 31, 1), month: cronRange(1, 12, 1), dow: cronBits(5, 6), anyDOM: true}},
+		{"0 0 13 * 5", cronSchedule{minute: cronBits(0), hour: cronBits(0), dom: cronBits(13), month: cronRange(1, 12, 1), dow: cronBits(5)}},
+		{"  0  *  *  *  *  ", cronSchedule{minute: cronBits(0), hour: cronRange(0, 23, 1), dom: cronRange(1, 31, 1), month: cronRange(1, 12, 1), dow: cronRange(0, 7, 1), anyDOM: true, anyDOW: true}},
+		{"@hourly", cronSchedule{minute: cronBits(0), hour: cronRange(0, 23, 1), dom: cronRange(1, 31, 1), month: cronRange(1, 12, 1), dow: cronRange(0, 7, 1), anyDOM: true, anyDOW: true}},
+		{"@weekly", cronSchedule{minute: cronBits(0), hour: cronBits(0), dom: cronRange(1, 31, 1), month: cronRange(1, 12, 1), dow: cronBits(0), anyDOM: true}},
+		{"@yearly", cronSchedule{minute: cronBits(0), hour: cronBits(0), dom: cronBits(1), month: cronBits(1), dow: cronRange(0, 7, 1), anyDOW: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@every 5m",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"-1 * * * *",
+		"5-1 * * * *",
+		"1- * * * *",
+		"-5 * * * *",
+		"*/0 * * * *",
+		"*/-5 * * * *",
+		"*/x * * * *",
+		"1,,2 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"* * * * sunday",
+		"* * * jan *-1",
+	} {
+		if s, err := parseCron(expr); err == nil {
+			t.Errorf("%q: expected error, got %+v", expr, s)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Monday
+	from := time.Date(2024, 1, 15, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2024, 1, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2024, 1, 15, 10, 15, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 15, 10, 15, 0, 0, time.UTC), time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{"@hourly", from, time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 9 * * *", from, time.Date(2024, 1, 16, 9, 30, 0, 0, time.UTC)},
+		{"10-50/20 8-18 * * 1-5", from, time.Date(2024, 1, 15, 10, 10, 0, 0, time.UTC)},
+		{"*/5 8-18 * * 1-5", time.Date(2024, 1, 19, 18, 56, 0, 0, time.UTC), time.Date(2024, 1, 22, 8, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", from, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * sun", from, time.Date(2024, 1, 21, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", from, time.Date(2024, 1, 21, 12, 0, 0, 0, time.UTC)},
+		// either 13th or Friday
+		{"0 0 13 * 5", from, time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2024, 2, 9, 1, 0, 0, 0, time.UTC), time.Date(2024, 2, 13, 0, 0, 0, 0, time.UTC)},
+		// both must match when one of day fields is "*"
+		{"0 0 * jan-mar mon", time.Date(2024, 3, 25, 10, 0, 0, 0, time.UTC), time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", from, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"59 23 31 12 *", from, time.Date(2024, 12, 31, 23, 59, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// never matches
+		{"0 0 30 2 *", from, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr+" from "+tt.from.Format(time.RFC3339), func(t *testing.T) {
+			s, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNextDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		// 2:00 CET jumps to 3:00 CEST on 31 March 2024
+		{"skipped time is skipped", "30 2 * * *", time.Date(2024, 3, 30, 12, 0, 0, 0, loc), time.Date(2024, 4, 1, 2, 30, 0, 0, loc)},
+		{"hour after change", "0 3 * * *", time.Date(2024, 3, 30, 12, 0, 0, 0, loc), time.Date(2024, 3, 31, 3, 0, 0, 0, loc)},
+		{"minutes across change", "*/30 * * * *", time.Date(2024, 3, 31, 1, 45, 0, 0, loc), time.Date(2024, 3, 31, 3, 0, 0, 0, loc)},
+		{"local midnight", "0 0 * * *", time.Date(2024, 10, 26, 12, 0, 0, 0, loc), time.Date(2024, 10, 27, 0, 0, 0, 0, loc)},
+		// 3:00 CEST goes back to 2:00 CET on 27 October 2024
+		{"hour after fall back", "0 4 * * *", time.Date(2024, 10, 27, 1, 0, 0, 0, loc), time.Date(2024, 10, 27, 4, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := s.next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if got.Location() != loc {
+				t.Errorf("got time in %s, want %s", got.Location(), loc)
+			}
+		})
+	}
+}
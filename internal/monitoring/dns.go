@@ -0,0 +1,264 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	DefaultDNSMinTTL = 5 * time.Second
+	DefaultDNSMaxTTL = 5 * time.Minute
+)
+
+type DNSStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+}
+
+// dnsCache keeps resolved addresses for TTL of DNS answer clamped to min and max,
+// failed lookups are not cached
+type dnsCache struct {
+	minTTL   time.Duration
+	maxTTL   time.Duration
+	resolver *net.Resolver
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+	hits    int64
+	misses  int64
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+func newDNSCache(minTTL, maxTTL time.Duration) *dnsCache {
+	c := &dnsCache{
+		minTTL:  minTTL,
+		maxTTL:  maxTTL,
+		entries: map[string]dnsEntry{},
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	c.resolver = &net.Resolver{
+		// go resolver is needed to see raw answers and their TTLs
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+
+			rec, ok := ctx.Value(ttlRecorderKey{}).(*ttlRecorder)
+			if !ok {
+				return conn, nil
+			}
+
+			if _, ok := conn.(net.PacketConn); ok {
+				return &ttlPacketConn{ttlConn{Conn: conn, rec: rec}}, nil
+			}
+			return &ttlConn{Conn: conn, rec: rec, stream: true}, nil
+		},
+	}
+
+	return c
+}
+
+func (c *dnsCache) lookupHost(ctx context.Context, host string) ([]string, error) {
+	if c == nil {
+		return net.DefaultResolver.LookupHost(ctx, host)
+	}
+
+	now := time.Now()
+
+	c.mu.Lock()
+	if e, ok := c.entries[host]; ok && now.Before(e.expires) {
+		c.hits++
+		c.mu.Unlock()
+		return e.addrs, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	rec := &ttlRecorder{}
+	addrs, err := c.resolver.LookupHost(context.WithValue(ctx, ttlRecorderKey{}, rec), host)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, ok := rec.get()
+	if !ok {
+		// answer didn't come from DNS, e.g. hosts file
+		ttl = c.minTTL
+	}
+	ttl = min(max(ttl, c.minTTL), c.maxTTL)
+
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, expires: now.Add(ttl)}
+	c.mu.Unlock()
+
+	return addrs, nil
+}
+
+// invalidate forgets host's addresses so next lookup goes to resolver
+func (c *dnsCache) invalidate(host string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	delete(c.entries, host)
+	c.mu.Unlock()
+}
+
+// dialContext dials addr using cached addresses of its host, addresses are
+// tried in order and cache entry is dropped when none of them is reachable
+func (c *dnsCache) dialContext(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	// lookups of resolver's LookupHost aren't traced, trace of request
+	// is notified here so DNS timing is reported with cache as well
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+	addrs, err := c.lookupHost(ctx, host)
+	if trace != nil && trace.DNSDone != nil {
+		trace.DNSDone(httptrace.DNSDoneInfo{Err: err})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var firstErr error
+	for _, ip := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	c.invalidate(host)
+	return nil, firstErr
+}
+
+func (c *dnsCache) stats() DNSStats {
+	if c == nil {
+		return DNSStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return DNSStats{Hits: c.hits, Misses: c.misses, Entries: len(c.entries)}
+}
+
+type ttlRecorderKey struct{}
+
+// ttlRecorder collects the lowest TTL of address records seen in DNS answers
+type ttlRecorder struct {
+	mu   sync.Mutex
+	ttl  uint32
+	seen bool
+}
+
+func (r *ttlRecorder) observe(msg []byte) {
+	var p dnsmessage.Parser
+	header, err := p.Start(msg)
+	if err != nil || header.RCode != dnsmessage.RCodeSuccess {
+		return
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for {
+		h, err := p.AnswerHeader()
+		if err != nil {
+			return
+		}
+
+		switch h.Type {
+		case dnsmessage.TypeA, dnsmessage.TypeAAAA, dnsmessage.TypeCNAME:
+			if !r.seen || h.TTL < r.ttl {
+				r.ttl, r.seen = h.TTL, true
+			}
+		}
+
+		if err := p.SkipAnswer(); err != nil {
+			return
+		}
+	}
+}
+
+func (r *ttlRecorder) get() (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return time.Duration(r.ttl) * time.Second, r.seen
+}
+
+// ttlConn passes DNS answers read by resolver to recorder
+type ttlConn struct {
+	net.Conn
+	rec *ttlRecorder
+
+	// stream connections prefix messages with 2 byte length
+	stream bool
+	buf    []byte
+}
+
+func (c *ttlConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n == 0 {
+		return n, err
+	}
+
+	if !c.stream {
+		c.rec.observe(b[:n])
+		return n, err
+	}
+
+	c.buf = append(c.buf, b[:n]...)
+	for len(c.buf) >= 2 {
+		size := int(binary.BigEndian.Uint16(c.buf))
+		if len(c.buf) < 2+size {
+			break
+		}
+		c.rec.observe(c.buf[2 : 2+size])
+		c.buf = c.buf[2+size:]
+	}
+
+	return n, err
+}
+
+// ttlPacketConn keeps resolver treating connection as datagram one
+type ttlPacketConn struct {
+	ttlConn
+}
+
+func (c *ttlPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Read(b)
+	return n, c.RemoteAddr(), err
+}
+
+func (c *ttlPacketConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	return c.Write(b)
+}
@@ -0,0 +1,130 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const checkTypeDNSBL = "dnsbl"
+
+// checkDNSBL looks up every address of target's host in each of target's
+// blacklists, results of blacklists are reported as variants and the host
+// counts as listed when any of its addresses is listed on any blacklist
+func checkDNSBL(ctx context.Context, target *targetInfo, state *monitorState) checkResult {
+	start := time.Now()
+
+	addrs := []string{target.Host}
+	if net.ParseIP(target.Host) == nil {
+		var err error
+		if addrs, err = state.dns.lookupHost(ctx, target.Host); err != nil {
+			return checkResult{responseTime: time.Since(start), err: err}
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]checkResult, len(target.Blacklists))
+	)
+
+	for _, zone := range target.Blacklists {
+		wg.Add(1)
+		go func(zone string) {
+			defer wg.Done()
+
+			r := lookupDNSBL(ctx, zone, addrs)
+
+			mu.Lock()
+			results[zone] = r
+			mu.Unlock()
+		}(zone)
+	}
+
+	wg.Wait()
+
+	var (
+		worst     string
+		worstRes  checkResult
+		isChecked bool
+	)
+	for _, zone := range target.Blacklists {
+		if r := results[zone]; !isChecked || isWorse(r, worstRes) {
+			worst, worstRes, isChecked = zone, r, true
+		}
+	}
+
+	result := worstRes
+	result.responseTime = time.Since(start)
+	result.variants = results
+	result.worstVariant = worst
+
+	for _, r := range results {
+		if r.failed() {
+			result.failingVariants++
+		}
+		result.listed = result.listed || r.listed
+	}
+
+	return result
+}
+
+// lookupDNSBL queries single blacklist zone for given addresses,
+// address is listed when its reversed form resolves under the zone
+func lookupDNSBL(ctx context.Context, zone string, addrs []string) checkResult {
+	start := time.Now()
+
+	var result checkResult
+	for _, addr := range addrs {
+		name, ok := dnsblName(addr, zone)
+		if !ok {
+			continue
+		}
+
+		codes, err := net.DefaultResolver.LookupHost(ctx, name)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				continue
+			}
+
+			result.err = errors.New(fmt.Sprintf("error while querying %s, error: %s", zone, err))
+			break
+		}
+
+		result.listed = true
+		result.assertErr = errors.New(fmt.Sprintf("%s is listed on %s (%s)", addr, zone, strings.Join(codes, ",")))
+		break
+	}
+
+	result.responseTime = time.Since(start)
+	return result
+}
+
+// dnsblName returns name to query blacklist zone for address with,
+// octets of IPv4 and nibbles of IPv6 address are reversed,
+// e.g. 192.0.2.5 gives 5.2.0.192.zen.spamhaus.org
+func dnsblName(addr string, zone string) (string, bool) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", false
+	}
+
+	var parts []string
+	if ip4 := ip.To4(); ip4 != nil {
+		for i := len(ip4) - 1; i >= 0; i-- {
+			parts = append(parts, strconv.Itoa(int(ip4[i])))
+		}
+	} else {
+		for i := len(ip) - 1; i >= 0; i-- {
+			parts = append(parts, strconv.FormatUint(uint64(ip[i]&0x0f), 16), strconv.FormatUint(uint64(ip[i]>>4), 16))
+		}
+	}
+
+	return strings.Join(parts, ".") + "." + strings.TrimSuffix(zone, "."), true
+}
@@ -0,0 +1,113 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	checkTypeDomain = "domain"
+
+	// defaultRDAPServer redirects queries to registry's authoritative RDAP server
+	defaultRDAPServer = "https://rdap.org"
+
+	// rdapResponseLimit caps size of RDAP response read into memory
+	rdapResponseLimit = 1 << 20
+)
+
+type rdapDomain struct {
+	Events []rdapEvent `json:"events"`
+}
+
+type rdapEvent struct {
+	EventAction string `json:"eventAction"`
+	EventDate   string `json:"eventDate"`
+}
+
+// checkDomain queries RDAP server for registration of target's domain
+// and reports time left until the registration expires
+func checkDomain(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState) checkResult {
+	query := strings.TrimSuffix(target.RDAPServer, "/") + "/domain/" + url.PathEscape(target.Domain)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, query, nil)
+	if err != nil {
+		return checkResult{err: err}
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	req = state.stats.instrument(req)
+
+	release, err := state.limiter.acquire(ctx, hostKey(req.URL))
+	if err != nil {
+		return checkResult{err: err}
+	}
+	defer release()
+
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return checkResult{responseTime: time.Since(start), err: err}
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, rdapResponseLimit))
+
+	result := checkResult{responseTime: time.Since(start)}
+	result.status = res.Status
+	result.statusCode = res.StatusCode
+
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	if res.StatusCode != http.StatusOK {
+		result.err = errors.New(fmt.Sprintf("unexpected status %s for rdap query of %s", res.Status, target.Domain))
+		return result
+	}
+
+	var domain rdapDomain
+	if err := json.Unmarshal(body, &domain); err != nil {
+		result.err = errors.New(fmt.Sprintf("error while parsing rdap response, error: %s", err))
+		return result
+	}
+
+	expiry, err := domain.expiration()
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	result.domainExpiry = expiry
+	result.daysUntilExpiry = int(math.Floor(time.Until(expiry).Hours() / 24))
+
+	if result.daysUntilExpiry < target.MinDaysUntilExpiry {
+		result.assertErr = errors.New(fmt.Sprintf("domain %s expires in %d days (%s), expected at least %d",
+			target.Domain, result.daysUntilExpiry, expiry.Format(time.DateOnly), target.MinDaysUntilExpiry))
+	}
+
+	return result
+}
+
+func (d rdapDomain) expiration() (time.Time, error) {
+	for _, e := range d.Events {
+		if e.EventAction != "expiration" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, e.EventDate)
+		if err != nil {
+			return time.Time{}, errors.New(fmt.Sprintf("invalid expiration date \"%s\" in rdap response", e.EventDate))
+		}
+		return t, nil
+	}
+
+	return time.Time{}, errors.New("rdap response doesn't contain expiration event")
+}
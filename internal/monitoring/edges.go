@@ -0,0 +1,134 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+type edgeMonitor struct {
+	client *http.Client
+	state  *monitorState
+}
+
+// checkEdges runs target's check against every edge address,
+// connecting directly to the edge while keeping host and SNI from target's url.
+// Result of the worst edge is used as target's result.
+func checkEdges(ctx context.Context, target *targetInfo, state *monitorState) checkResult {
+	u, err := url.Parse(target.Url)
+	if err != nil {
+		return checkResult{err: err}
+	}
+
+	edges := target.Edges
+	if target.ResolveEdges {
+		addrs, err := state.dns.lookupHost(ctx, u.Hostname())
+		if err != nil {
+			return checkResult{err: err}
+		}
+		edges = append(append([]string{}, edges...), addrs...)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	if state.edges == nil {
+		state.edges = map[string]*edgeMonitor{}
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]checkResult, len(edges))
+	)
+
+	for _, edge := range edges {
+		if _, ok := results[edge]; ok {
+			continue
+		}
+		results[edge] = checkResult{}
+
+		em, ok := state.edges[edge]
+		if !ok {
+			em = newEdgeMonitor(net.JoinHostPort(edge, port), target, state)
+			state.edges[edge] = em
+		}
+
+		wg.Add(1)
+		go func(edge string) {
+			defer wg.Done()
+
+			r := runSingleCheck(ctx, em.client, target, em.state)
+
+			mu.Lock()
+			results[edge] = r
+			mu.Unlock()
+		}(edge)
+	}
+
+	wg.Wait()
+
+	// forget edges which are no longer resolved
+	for edge := range state.edges {
+		if _, ok := results[edge]; !ok {
+			state.edges[edge].client.CloseIdleConnections()
+			delete(state.edges, edge)
+		}
+	}
+
+	if len(results) == 0 {
+		return checkResult{err: errors.New(fmt.Sprintf("no edges resolved for %s", u.Hostname()))}
+	}
+
+	var (
+		worst     string
+		worstRes  checkResult
+		isChecked bool
+	)
+	for edge, r := range results {
+		if !isChecked || isWorse(r, worstRes) {
+			worst, worstRes, isChecked = edge, r, true
+		}
+	}
+
+	result := worstRes
+	result.variants = results
+	result.worstVariant = worst
+
+	for _, r := range results {
+		if r.failed() {
+			result.failingVariants++
+		}
+	}
+
+	return result
+}
+
+func newEdgeMonitor(addr string, target *targetInfo, parent *monitorState) *edgeMonitor {
+	return &edgeMonitor{
+		client: &http.Client{
+			Timeout:   target.timeout,
+			Transport: parent.stats.newTransport(addr, nil, target),
+		},
+		state: &monitorState{limiter: parent.limiter, stats: parent.stats},
+	}
+}
+
+// isWorse reports whether a is worse than b; failed checks
+// are worse than successful, otherwise slower is worse
+func isWorse(a, b checkResult) bool {
+	if a.failed() != b.failed() {
+		return a.failed()
+	}
+
+	return a.responseTime > b.responseTime
+}
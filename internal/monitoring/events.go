@@ -0,0 +1,107 @@
+package monitoring
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"time"
+)
+
+// types of events reported to handler given to HandleEvents
+const (
+	EventDown        = "down"
+	EventUp          = "up"
+	EventAuthFailure = "auth-failure"
+	EventPinMismatch = "pin-mismatch"
+)
+
+// Event is notable change of target's state, e.g. for SIEM
+type Event struct {
+	Time   time.Time
+	Type   string
+	Target string
+	// Address is url of target, or host or domain for checks without url
+	Address    string
+	StatusCode int
+	// Reason describes failure which caused the event, empty for up event
+	Reason string
+	Labels map[string]string
+}
+
+// eventState keeps conditions of target reported by the last events,
+// every event is reported once when condition starts
+type eventState struct {
+	down        bool
+	authFailure bool
+	pinMismatch bool
+}
+
+// HandleEvents calls handler with events of all targets. Target goes down
+// after downAfter consecutive failed checks and up with first successful
+// one, authentication failures (401, 403 and 407 statuses) and certificate
+// pin mismatches are reported when they start. handler is called from check
+// loops, so it shouldn't block. Must be called before StartMonitoring.
+func (t *Targets) HandleEvents(handler func(Event), downAfter int) {
+	t.eventHandler = handler
+	t.downAfter = max(downAfter, 1)
+}
+
+// detectEvents reports events caused by result of check, failedStreak
+// is number of consecutive failed checks including this one
+func (t *Targets) detectEvents(m *monitor, result checkResult, failedStreak int64) {
+	if t.eventHandler == nil {
+		return
+	}
+
+	emit := func(eventType, reason string) {
+		t.eventHandler(Event{
+			Time:       time.Now(),
+			Type:       eventType,
+			Target:     m.key,
+			Address:    m.target.address(),
+			StatusCode: result.statusCode,
+			Reason:     reason,
+			Labels:     maps.Clone(m.target.Labels),
+		})
+	}
+
+	state := &m.events
+
+	authFailure := result.statusCode == http.StatusUnauthorized || result.statusCode == http.StatusForbidden ||
+		result.statusCode == http.StatusProxyAuthRequired
+	if authFailure && !state.authFailure {
+		emit(EventAuthFailure, fmt.Sprintf("authentication failed with status %s", result.status))
+	}
+	state.authFailure = authFailure
+
+	if result.pinMismatch && !state.pinMismatch {
+		emit(EventPinMismatch, result.failureReason())
+	}
+	state.pinMismatch = result.pinMismatch
+
+	switch {
+	case failedStreak >= int64(t.downAfter) && !state.down:
+		state.down = true
+		emit(EventDown, result.failureReason())
+	case failedStreak == 0 && state.down:
+		state.down = false
+		emit(EventUp, "")
+	}
+}
+
+// address returns what target checks, its url, host or domain
+func (t *targetInfo) address() string {
+	switch {
+	case t.Url != "":
+		return t.Url
+	case t.Host != "":
+		return t.Host
+	case t.Subnet != "":
+		return t.Subnet
+	case t.Domain != "":
+		return t.Domain
+	case len(t.Command) > 0:
+		return t.Command[0]
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	checkTypeExec = "exec"
+
+	// defaultExecTimeout bounds command unless target sets timeout
+	defaultExecTimeout = 10 * time.Second
+
+	// execOutputLimit caps size of command's output kept in memory
+	execOutputLimit = 64 << 10
+
+	// execWaitDelay is how long output is waited for after command exits
+	// or is killed, when its children keep output open
+	execWaitDelay = time.Second
+)
+
+// limitedBuffer keeps first limit bytes written to it and discards the rest
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if left := b.limit - b.buf.Len(); left > 0 {
+		b.buf.Write(p[:min(left, len(p))])
+	}
+	return len(p), nil
+}
+
+// checkExec runs target's command and reports its exit code and output,
+// check fails when command can't be run, times out or exits with code
+// which isn't expected
+func checkExec(ctx context.Context, target *targetInfo) checkResult {
+	cmd := exec.CommandContext(ctx, target.Command[0], target.Command[1:]...)
+	cmd.WaitDelay = execWaitDelay
+
+	stdout := &limitedBuffer{limit: execOutputLimit}
+	stderr := &limitedBuffer{limit: execOutputLimit}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	result := checkResult{responseTime: time.Since(start), exitCode: -1}
+
+	if ctx.Err() != nil {
+		result.err = ctx.Err()
+		return result
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		result.err = err
+		return result
+	}
+
+	result.exitCode = cmd.ProcessState.ExitCode()
+	result.status = fmt.Sprintf("exit %d", result.exitCode)
+	result.output = parseExecOutput(stdout.buf.String())
+
+	if !slices.Contains(target.ExpectExitCodes, result.exitCode) {
+		reason := strings.TrimSpace(stderr.buf.String())
+		if line, _, _ := strings.Cut(reason, "\n"); line != "" {
+			result.assertErr = errors.New(fmt.Sprintf("command exited with code %d: %s", result.exitCode, line))
+		} else {
+			result.assertErr = errors.New(fmt.Sprintf("command exited with code %d", result.exitCode))
+		}
+	}
+
+	return result
+}
+
+// parseExecOutput returns trimmed output as number when it is one,
+// otherwise as string
+func parseExecOutput(output string) interface{} {
+	output = strings.TrimSpace(output)
+	if n, err := strconv.ParseInt(output, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(output, 64); err == nil {
+		return f
+	}
+	return output
+}
@@ -0,0 +1,164 @@
+package monitoring
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	expectErrorAny               = "any"
+	expectErrorConnectionRefused = "connection-refused"
+	expectErrorTimeout           = "timeout"
+	expectErrorDNS               = "dns"
+	expectErrorTLS               = "tls"
+	expectErrorHeadersTooLarge   = "headers-too-large"
+	expectErrorBodyRead          = "body-read"
+)
+
+// expectFailure describes how check of target is expected to fail,
+// e.g. for endpoints which must not be reachable
+type expectFailure struct {
+	StatusCodes []int  `yaml:"status-codes"`
+	Error       string `yaml:"error"`
+}
+
+func isExpectErrorSupported(kind string) bool {
+	switch kind {
+	case expectErrorAny, expectErrorConnectionRefused, expectErrorTimeout, expectErrorDNS, expectErrorTLS, expectErrorHeadersTooLarge, expectErrorBodyRead:
+		return true
+	}
+	return false
+}
+
+// applyExpectFailure turns result failing in expected way into successful one
+// and successful or differently failing result into failed assertion
+func applyExpectFailure(result *checkResult, e *expectFailure) {
+	met := false
+	if result.err != nil {
+		met = e.Error != "" && errorMatches(result.err, e.Error)
+	} else {
+		met = slices.Contains(e.StatusCodes, result.statusCode)
+	}
+
+	if met {
+		result.err = nil
+		result.assertErr = nil
+		result.expectedFailure = true
+		return
+	}
+
+	got := result.status
+	if result.err != nil {
+		got = result.err.Error()
+	}
+	result.assertErr = errors.New(fmt.Sprintf("expected failure (%s) but got %s", e, got))
+}
+
+func errorMatches(err error, kind string) bool {
+	switch kind {
+	case expectErrorAny:
+		return true
+
+	case expectErrorConnectionRefused:
+		return errors.Is(err, syscall.ECONNREFUSED)
+
+	case expectErrorTimeout:
+		var netErr net.Error
+		return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+
+	case expectErrorDNS:
+		var dnsErr *net.DNSError
+		return errors.As(err, &dnsErr)
+
+	case expectErrorTLS:
+		var (
+			recordErr    tls.RecordHeaderError
+			alertErr     tls.AlertError
+			verifyErr    *tls.CertificateVerificationError
+			authorityErr x509.UnknownAuthorityError
+			hostnameErr  x509.HostnameError
+			invalidErr   x509.CertificateInvalidError
+		)
+		return errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+			errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+
+	case expectErrorHeadersTooLarge:
+		// transport doesn't export errors of HTTP/1 and HTTP/2 header limits
+		msg := err.Error()
+		return strings.Contains(msg, "server response headers exceeded") || strings.Contains(msg, "header list larger than advertised limit")
+
+	case expectErrorBodyRead:
+		var bodyErr *bodyReadError
+		return errors.As(err, &bodyErr)
+	}
+
+	return false
+}
+
+// statusRange is inclusive range of expected status codes
+type statusRange struct {
+	from, to int
+}
+
+// parseExpectStatus parses expected status codes, each given as
+// code (e.g. 204) or class (e.g. 2xx)
+func parseExpectStatus(specs []string) ([]statusRange, error) {
+	ranges := make([]statusRange, 0, len(specs))
+	for _, spec := range specs {
+		s := strings.ToLower(strings.TrimSpace(spec))
+
+		if len(s) == 3 && s[0] >= '1' && s[0] <= '5' && s[1:] == "xx" {
+			class := int(s[0]-'0') * 100
+			ranges = append(ranges, statusRange{class, class + 99})
+			continue
+		}
+
+		code, err := strconv.Atoi(s)
+		if err != nil || code < 100 || code > 599 {
+			return nil, errors.New(fmt.Sprintf("invalid expected status \"%s\", expected code (e.g. 204) or class (e.g. 2xx)", spec))
+		}
+		ranges = append(ranges, statusRange{code, code})
+	}
+
+	return ranges, nil
+}
+
+// applyExpectStatus marks result's status as expected or fails assertion
+// when response status isn't one of target's expected statuses
+func applyExpectStatus(result *checkResult, target *targetInfo) {
+	if result.err != nil || result.statusCode == 0 {
+		return
+	}
+
+	for _, r := range target.expectStatus {
+		if result.statusCode >= r.from && result.statusCode <= r.to {
+			result.statusExpected = true
+			return
+		}
+	}
+
+	result.assertErr = errors.New(fmt.Sprintf("unexpected status %s, expected %s", result.status, strings.Join(target.ExpectStatus, ", ")))
+}
+
+func (e *expectFailure) String() string {
+	var parts []string
+	if len(e.StatusCodes) > 0 {
+		codes := make([]string, len(e.StatusCodes))
+		for i, code := range e.StatusCodes {
+			codes[i] = strconv.Itoa(code)
+		}
+		parts = append(parts, "status "+strings.Join(codes, "/"))
+	}
+	if e.Error != "" {
+		parts = append(parts, e.Error+" error")
+	}
+	return strings.Join(parts, " or ")
+}
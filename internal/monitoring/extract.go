@@ -0,0 +1,166 @@
+package monitoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// extractBodyLimit caps size of body read into memory to extract values from
+// or pass to script
+const extractBodyLimit = 4 << 20
+
+var extractNameRegexp = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// jsonPathStep is object key or array index, negative index counts from the end
+type jsonPathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseJSONPath parses subset of JSONPath selecting single value,
+// e.g. $.stats.queue.depth, $.items[0].name or $['key with spaces']
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	invalid := errors.New(fmt.Sprintf("invalid json path \"%s\"", path))
+
+	if !strings.HasPrefix(path, "$") {
+		return nil, invalid
+	}
+
+	var steps []jsonPathStep
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, invalid
+			}
+			steps = append(steps, jsonPathStep{key: key})
+			rest = rest[end+1:]
+
+		case '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, invalid
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+				continue
+			}
+
+			index, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, invalid
+			}
+			steps = append(steps, jsonPathStep{index: index, isIndex: true})
+
+		default:
+			return nil, invalid
+		}
+	}
+
+	return steps, nil
+}
+
+// readExtractBody reads whole body, which has to fit in extractBodyLimit
+func readExtractBody(body io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, extractBodyLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > extractBodyLimit {
+		return nil, errors.New(fmt.Sprintf("response body exceeds %d bytes limit for value extraction, script, golden and subresources", extractBodyLimit))
+	}
+	return data, nil
+}
+
+// extractValues extracts target's values from json body, numbers, strings
+// and booleans are extracted as they are, objects, arrays and null as json
+func extractValues(data []byte, target *targetInfo) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, errors.New(fmt.Sprintf("response body is not valid json, error: %s", err))
+	}
+
+	values := make(map[string]interface{}, len(target.extractPaths))
+	var missing []string
+	for name, path := range target.extractPaths {
+		v, ok := lookupJSONPath(doc, path)
+		if !ok {
+			missing = append(missing, fmt.Sprintf("%s (%s)", name, target.Extract[name]))
+			continue
+		}
+		values[name] = extractedValue(v)
+	}
+
+	if len(missing) > 0 {
+		return values, errors.New(fmt.Sprintf("values not found in response body: %s", strings.Join(missing, ", ")))
+	}
+
+	return values, nil
+}
+
+func lookupJSONPath(doc interface{}, path []jsonPathStep) (interface{}, bool) {
+	current := doc
+	for _, step := range path {
+		if step.isIndex {
+			arr, ok := current.([]interface{})
+			if !ok {
+				return nil, false
+			}
+
+			i := step.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, false
+			}
+			current = arr[i]
+			continue
+		}
+
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[step.key]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func extractedValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case string, bool:
+		return v
+	}
+
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,157 @@
+package monitoring
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []jsonPathStep
+	}{
+		{"$", nil},
+		{"$.status", []jsonPathStep{{key: "status"}}},
+		{"$.stats.queue.depth", []jsonPathStep{{key: "stats"}, {key: "queue"}, {key: "depth"}}},
+		{"$.items[0].name", []jsonPathStep{{key: "items"}, {index: 0, isIndex: true}, {key: "name"}}},
+		{"$.items[-1]", []jsonPathStep{{key: "items"}, {index: -1, isIndex: true}}},
+		{"$[2][3]", []jsonPathStep{{index: 2, isIndex: true}, {index: 3, isIndex: true}}},
+		{"$['key with spaces']", []jsonPathStep{{key: "key with spaces"}}},
+		{`$["a.b"].c`, []jsonPathStep{{key: "a.b"}, {key: "c"}}},
+		{"$['']", []jsonPathStep{{key: ""}}},
+		{"$.a-b.c_d", []jsonPathStep{{key: "a-b"}, {key: "c_d"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseJSONPath(tt.path)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	for _, path := range []string{
+		"",
+		"status",
+		".status",
+		"$.",
+		"$..a",
+		"$.a.",
+		"$a",
+		"$[",
+		"$[0",
+		"$[]",
+		"$[x]",
+		"$[1.5]",
+		"$['a\"]",
+		"$[*]",
+		"$.a[?(@.b)]",
+	} {
+		if steps, err := parseJSONPath(path); err == nil {
+			t.Errorf("%q: expected error, got %+v", path, steps)
+		}
+	}
+}
+
+func TestExtractValues(t *testing.T) {
+	body := `{
+		"status": "ok",
+		"healthy": true,
+		"stats": {"queue": {"depth": 42}, "load": 0.75, "big": 12345678901234567890},
+		"items": [{"name": "first"}, {"name": "last"}],
+		"tags": ["a", "b"],
+		"nothing": null,
+		"key with spaces": -3,
+		"a.b": "dotted"
+	}`
+
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"$.status", "ok"},
+		{"$.healthy", true},
+		{"$.stats.queue.depth", int64(42)},
+		{"$.stats.load", 0.75},
+		{"$.stats.big", 12345678901234567890.0},
+		{"$.items[0].name", "first"},
+		{"$.items[-1].name", "last"},
+		{"$.tags", `["a","b"]`},
+		{"$.stats.queue", `{"depth":42}`},
+		{"$.nothing", "null"},
+		{"$['key with spaces']", int64(-3)},
+		{`$["a.b"]`, "dotted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			steps, err := parseJSONPath(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			target := &targetInfo{Extract: map[string]string{"v": tt.path}, extractPaths: map[string][]jsonPathStep{"v": steps}}
+
+			values, err := extractValues([]byte(body), target)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(values["v"], tt.want) {
+				t.Errorf("got %#v, want %#v", values["v"], tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractValuesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		path string
+		err  string
+	}{
+		{"not json", "<html>", "$.a", "response body is not valid json"},
+		{"empty body", "", "$.a", "response body is not valid json"},
+		{"missing key", `{"a": 1}`, "$.b", "values not found in response body: v ($.b)"},
+		{"key of array", `{"a": [1]}`, "$.a.b", "values not found"},
+		{"index of object", `{"a": {"0": 1}}`, "$.a[0]", "values not found"},
+		{"index out of range", `{"a": [1]}`, "$.a[1]", "values not found"},
+		{"negative index out of range", `{"a": [1]}`, "$.a[-2]", "values not found"},
+		{"key of scalar", `{"a": "text"}`, "$.a.b", "values not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := parseJSONPath(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			target := &targetInfo{Extract: map[string]string{"v": tt.path}, extractPaths: map[string][]jsonPathStep{"v": steps}}
+
+			if _, err := extractValues([]byte(tt.body), target); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestExtractValuesKeepsFoundValues(t *testing.T) {
+	target := &targetInfo{
+		Extract:      map[string]string{"found": "$.a", "missing": "$.b"},
+		extractPaths: map[string][]jsonPathStep{"found": {{key: "a"}}, "missing": {{key: "b"}}},
+	}
+
+	values, err := extractValues([]byte(`{"a": 1}`), target)
+	if err == nil {
+		t.Fatal("expected error of missing value")
+	}
+	if !reflect.DeepEqual(values, map[string]interface{}{"found": int64(1)}) {
+		t.Errorf("got %v", values)
+	}
+}
@@ -0,0 +1,346 @@
+package monitoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+const (
+	goldenCompareStructure = "structure"
+	goldenCompareValues    = "values"
+
+	// maxGoldenDiffs caps number of differences reported by goldenDiff parameter
+	maxGoldenDiffs = 10
+)
+
+// golden compares responses with golden response recorded from the first
+// successful one, to catch silent drift of API contract
+type golden struct {
+	// File keeps golden response across restarts, golden response
+	// is kept only in memory when empty
+	File string `yaml:"file"`
+	// Paths selects compared values of json body, whole body is compared when empty
+	Paths []string `yaml:"paths"`
+	// Compare is structure (keys and types) or values, default structure
+	Compare string `yaml:"compare"`
+	// MinSimilarity fails check when similarity drops below it, default 1
+	MinSimilarity *float64 `yaml:"min-similarity"`
+
+	paths [][]jsonPathStep
+}
+
+func (g *golden) prepare() error {
+	if g.Compare == "" {
+		g.Compare = goldenCompareStructure
+	} else if g.Compare != goldenCompareStructure && g.Compare != goldenCompareValues {
+		return errors.New(fmt.Sprintf("unsupported golden compare mode \"%s\", available: structure, values", g.Compare))
+	}
+
+	if g.MinSimilarity == nil {
+		one := 1.0
+		g.MinSimilarity = &one
+	} else if *g.MinSimilarity < 0 || *g.MinSimilarity > 1 {
+		return errors.New("golden \"min-similarity\" must be between 0 and 1")
+	}
+
+	g.paths = make([][]jsonPathStep, len(g.Paths))
+	for i, path := range g.Paths {
+		steps, err := parseJSONPath(path)
+		if err != nil {
+			return errors.New(fmt.Sprintf("golden path: %s", err))
+		}
+		g.paths[i] = steps
+	}
+
+	return nil
+}
+
+// goldenDocument is compared form of response body, json document, values
+// selected by paths keyed by path or lines of body which isn't json
+type goldenDocument struct {
+	JSON  interface{} `json:"json"`
+	Lines []string    `json:"lines,omitempty"`
+}
+
+func newGoldenDocument(body []byte, g *golden) (*goldenDocument, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		if len(g.paths) > 0 {
+			return nil, errors.New(fmt.Sprintf("response body is not valid json, error: %s", err))
+		}
+		return &goldenDocument{Lines: strings.Split(string(body), "\n")}, nil
+	}
+
+	if len(g.paths) == 0 {
+		return &goldenDocument{JSON: doc}, nil
+	}
+
+	selected := make(map[string]interface{}, len(g.paths))
+	for i, path := range g.paths {
+		if v, ok := lookupJSONPath(doc, path); ok {
+			selected[g.Paths[i]] = v
+		}
+	}
+	return &goldenDocument{JSON: selected}, nil
+}
+
+// loadGolden reads golden response from target's golden file,
+// nil when it wasn't recorded yet
+func loadGolden(g *golden) (*goldenDocument, error) {
+	if g.File == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(g.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	doc := &goldenDocument{}
+	if err := dec.Decode(doc); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid golden file %s, error: %s", g.File, err))
+	}
+	return doc, nil
+}
+
+func saveGolden(g *golden, doc *goldenDocument) error {
+	if g.File == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(g.File), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(g.File, append(data, '\n'), 0o644)
+}
+
+// compareGolden compares body with golden response, which is recorded
+// from body when there is none yet
+func compareGolden(result *checkResult, body []byte, target *targetInfo, state *monitorState) {
+	g := target.Golden
+
+	current, err := newGoldenDocument(body, g)
+	if err != nil {
+		result.assertErr = err
+		return
+	}
+
+	if state.golden == nil {
+		if state.golden, err = loadGolden(g); err != nil {
+			result.err = err
+			return
+		}
+	}
+
+	if state.golden == nil {
+		if result.statusCode >= 400 {
+			return
+		}
+
+		state.golden = current
+		if err := saveGolden(g, current); err != nil {
+			slog.Error("error while saving golden response", "file", g.File, "err", err)
+		}
+		result.goldenSimilarity = 1
+		return
+	}
+
+	similarity, diffs := diffGolden(state.golden, current, g.Compare)
+	result.goldenSimilarity = similarity
+	result.goldenDiffs = diffs
+
+	if similarity < *g.MinSimilarity {
+		result.assertErr = errors.New(fmt.Sprintf("response deviates from golden response (similarity %.2f): %s", similarity, formatGoldenDiffs(diffs)))
+	}
+}
+
+// diffGolden returns similarity between 0 and 1 (share of matching nodes
+// or lines) and list of differences
+func diffGolden(golden, current *goldenDocument, compare string) (float64, []string) {
+	if golden.Lines != nil || current.Lines != nil {
+		return diffLines(golden.Lines, current.Lines)
+	}
+
+	d := &jsonDiff{values: compare == goldenCompareValues}
+	d.walk("$", golden.JSON, current.JSON)
+
+	if d.total == 0 {
+		return 1, nil
+	}
+	return float64(d.matching) / float64(d.total), d.diffs
+}
+
+type jsonDiff struct {
+	values   bool
+	matching int
+	total    int
+	diffs    []string
+}
+
+func (d *jsonDiff) walk(path string, golden, current interface{}) {
+	d.total++
+
+	if jsonKind(golden) != jsonKind(current) {
+		d.diffs = append(d.diffs, fmt.Sprintf("%s changed from %s to %s", path, jsonKind(golden), jsonKind(current)))
+		d.total += max(countNodes(golden), countNodes(current)) - 1
+		return
+	}
+	d.matching++
+
+	switch g := golden.(type) {
+	case map[string]interface{}:
+		c := current.(map[string]interface{})
+
+		keys := make([]string, 0, len(g)+len(c))
+		for k := range g {
+			keys = append(keys, k)
+		}
+		for k := range c {
+			if _, ok := g[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+
+		for _, k := range keys {
+			gv, inGolden := g[k]
+			cv, inCurrent := c[k]
+			switch {
+			case !inCurrent:
+				d.diffs = append(d.diffs, fmt.Sprintf("%s removed", childPath(path, k)))
+				d.total += countNodes(gv)
+			case !inGolden:
+				d.diffs = append(d.diffs, fmt.Sprintf("%s added", childPath(path, k)))
+				d.total += countNodes(cv)
+			default:
+				d.walk(childPath(path, k), gv, cv)
+			}
+		}
+
+	case []interface{}:
+		c := current.([]interface{})
+		if !d.values {
+			// structure of array is given by its first item
+			if len(g) > 0 && len(c) > 0 {
+				d.walk(path+"[0]", g[0], c[0])
+			}
+			return
+		}
+
+		for i := 0; i < max(len(g), len(c)); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(c):
+				d.diffs = append(d.diffs, fmt.Sprintf("%s removed", itemPath))
+				d.total += countNodes(g[i])
+			case i >= len(g):
+				d.diffs = append(d.diffs, fmt.Sprintf("%s added", itemPath))
+				d.total += countNodes(c[i])
+			default:
+				d.walk(itemPath, g[i], c[i])
+			}
+		}
+
+	default:
+		if d.values && !reflect.DeepEqual(golden, current) {
+			d.matching--
+			d.diffs = append(d.diffs, fmt.Sprintf("%s changed from %v to %v", path, golden, current))
+		}
+	}
+}
+
+func childPath(path, key string) string {
+	if extractNameRegexp.MatchString(key) {
+		return path + "." + key
+	}
+	return fmt.Sprintf("%s['%s']", path, key)
+}
+
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	return "number"
+}
+
+func countNodes(v interface{}) int {
+	n := 1
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, child := range v {
+			n += countNodes(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			n += countNodes(child)
+		}
+	}
+	return n
+}
+
+// diffLines compares bodies which aren't json by their lines regardless of order
+func diffLines(golden, current []string) (float64, []string) {
+	counts := map[string]int{}
+	for _, line := range golden {
+		counts[line]++
+	}
+
+	common := 0
+	var diffs []string
+	for _, line := range current {
+		if counts[line] > 0 {
+			counts[line]--
+			common++
+		} else {
+			diffs = append(diffs, fmt.Sprintf("line added: %q", line))
+		}
+	}
+	for _, line := range golden {
+		if counts[line] > 0 {
+			counts[line]--
+			diffs = append(diffs, fmt.Sprintf("line removed: %q", line))
+		}
+	}
+
+	if len(golden)+len(current) == 0 {
+		return 1, nil
+	}
+	return float64(2*common) / float64(len(golden)+len(current)), diffs
+}
+
+func formatGoldenDiffs(diffs []string) string {
+	if len(diffs) <= maxGoldenDiffs {
+		return strings.Join(diffs, "; ")
+	}
+	return fmt.Sprintf("%s; and %d more", strings.Join(diffs[:maxGoldenDiffs], "; "), len(diffs)-maxGoldenDiffs)
+}
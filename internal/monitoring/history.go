@@ -0,0 +1,83 @@
+package monitoring
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultHistorySize is number of last checks kept in target's history
+const defaultHistorySize = 60
+
+// HistoryEntry is result of single check kept in target's history
+type HistoryEntry struct {
+	Time         time.Time
+	ResponseTime time.Duration
+	Failed       bool
+	// Error is set when check got no response, its response time isn't meaningful
+	Error bool
+}
+
+// history keeps last checks of target in ring buffer
+type history struct {
+	mu      sync.Mutex
+	entries []HistoryEntry
+	next    int
+}
+
+func (h *history) add(e HistoryEntry, size int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.entries) < size {
+		h.entries = append(h.entries, e)
+		return
+	}
+
+	h.entries[h.next] = e
+	h.next = (h.next + 1) % len(h.entries)
+}
+
+// snapshot returns entries from the oldest to the newest
+func (h *history) snapshot() []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := make([]HistoryEntry, 0, len(h.entries))
+	entries = append(entries, h.entries[h.next:]...)
+	return append(entries, h.entries[:h.next]...)
+}
+
+// History returns last checks of running target from the oldest to the newest
+func (t *Targets) History(key string) ([]HistoryEntry, bool) {
+	t.mu.RLock()
+	m, ok := t.monitors[key]
+	t.mu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	return m.history.snapshot(), true
+}
+
+// ResponseTimes returns sorted response times of checks in history which got response
+func ResponseTimes(entries []HistoryEntry) []time.Duration {
+	times := make([]time.Duration, 0, len(entries))
+	for _, e := range entries {
+		if !e.Error {
+			times = append(times, e.ResponseTime)
+		}
+	}
+	slices.Sort(times)
+	return times
+}
+
+// Percentile returns p-th percentile of sorted durations with nearest-rank method
+func Percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
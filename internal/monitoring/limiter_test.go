@@ -0,0 +1,67 @@
+package monitoring
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHostKey(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/health":      "example.com:443",
+		"https://example.com:443/":        "example.com:443",
+		"HTTPS://Example.COM/":            "example.com:443",
+		"http://example.com":              "example.com:80",
+		"http://example.com:80":           "example.com:80",
+		"http://example.com:8080":         "example.com:8080",
+		"https://[2001:db8::1]/":          "[2001:db8::1]:443",
+		"https://[2001:db8::1]:8443/path": "[2001:db8::1]:8443",
+	}
+
+	for raw, want := range tests {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hostKey(u); got != want {
+			t.Errorf("hostKey(%s) = %s, want %s", raw, got, want)
+		}
+	}
+}
+
+func TestHostLimiterSharesSlotsOfDefaultPort(t *testing.T) {
+	l := newHostLimiter(1)
+
+	a, _ := url.Parse("https://example.com/a")
+	b, _ := url.Parse("https://example.com:443/b")
+
+	release, err := l.acquire(context.Background(), hostKey(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, hostKey(b)); err == nil {
+		t.Fatal("expected second request to the same host to wait for slot")
+	}
+
+	release()
+	release() // releasing twice frees only one slot
+
+	second, err := l.acquire(context.Background(), hostKey(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second()
+}
+
+func TestNilHostLimiter(t *testing.T) {
+	var l *hostLimiter
+	release, err := l.acquire(context.Background(), "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
@@ -0,0 +1,105 @@
+package monitoring
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const defaultBodyMemoryBudget = 64 * 1024
+
+// containsMatcher looks for needle in stream written to it,
+// keeping only len(needle)-1 bytes of previous writes
+type containsMatcher struct {
+	needle  []byte
+	tail    []byte
+	scratch []byte
+	matched bool
+}
+
+func (m *containsMatcher) Write(p []byte) (int, error) {
+	if m.matched {
+		return len(p), nil
+	}
+
+	keep := len(m.needle) - 1
+
+	// needle crossing boundary between previous writes and p
+	m.scratch = append(append(m.scratch[:0], m.tail...), p[:min(len(p), keep)]...)
+	if bytes.Contains(m.scratch, m.needle) || bytes.Contains(p, m.needle) {
+		m.matched = true
+		return len(p), nil
+	}
+
+	if len(p) >= keep {
+		m.tail = append(m.tail[:0], p[len(p)-keep:]...)
+	} else {
+		m.tail = append(m.tail[:0], m.scratch[max(len(m.scratch)-keep, 0):]...)
+	}
+
+	return len(p), nil
+}
+
+// matchBody evaluates target's body assertions while streaming the body,
+// at most memory budget bytes of body are buffered at once
+func matchBody(body io.Reader, target *targetInfo) (bool, error) {
+	budget := target.BodyMemoryBudget
+
+	var contains *containsMatcher
+	if target.ExpectBodyContains != "" {
+		contains = &containsMatcher{
+			needle: []byte(target.ExpectBodyContains),
+		}
+	}
+
+	matched := true
+
+	if target.bodyRegexp != nil {
+		r := body
+		if contains != nil {
+			r = io.TeeReader(body, contains)
+		}
+
+		if !target.bodyRegexp.MatchReader(bufio.NewReaderSize(r, budget)) {
+			matched = false
+		}
+	}
+
+	// drain rest of body, feeding it to contains matcher if present
+	var w io.Writer = io.Discard
+	if contains != nil {
+		w = contains
+	}
+
+	if _, err := io.CopyBuffer(w, body, make([]byte, budget)); err != nil {
+		return false, err
+	}
+
+	if contains != nil && !contains.matched {
+		matched = false
+	}
+
+	return matched, nil
+}
+
+func bodyAssertionError(target *targetInfo) error {
+	var expected []string
+	if target.ExpectBodyContains != "" {
+		expected = append(expected, fmt.Sprintf("contain \"%s\"", target.ExpectBodyContains))
+	}
+	if target.ExpectBodyRegex != "" {
+		expected = append(expected, fmt.Sprintf("match regex \"%s\"", target.ExpectBodyRegex))
+	}
+
+	msg := "response body doesn't"
+	for i, e := range expected {
+		if i > 0 {
+			msg += " and"
+		}
+		msg += " " + e
+	}
+
+	return errors.New(msg)
+}
@@ -0,0 +1,221 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxMatrixVariants caps number of header combinations checked by target
+const maxMatrixVariants = 64
+
+// headerValue is value of header in matrix, name identifies it in variant's name
+type headerValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// headerValues are given as yaml list, where values name themselves
+// (e.g. languages), or as map of names to values (e.g. long user agents)
+type headerValues []headerValue
+
+func (h *headerValues) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		var list []string
+		if err := node.Decode(&list); err != nil {
+			return err
+		}
+		values := make(headerValues, len(list))
+		for i, value := range list {
+			values[i] = headerValue{Name: value, Value: value}
+		}
+		*h = values
+
+	case yaml.MappingNode:
+		// content keeps order of map given in file
+		values := make(headerValues, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			var name, value string
+			if err := node.Content[i].Decode(&name); err != nil {
+				return err
+			}
+			if err := node.Content[i+1].Decode(&value); err != nil {
+				return err
+			}
+			values = append(values, headerValue{Name: name, Value: value})
+		}
+		*h = values
+
+	default:
+		return errors.New(fmt.Sprintf("line %d: header matrix values must be list or map", node.Line))
+	}
+	return nil
+}
+
+// matrixVariant is one combination of header values of matrix
+type matrixVariant struct {
+	name    string
+	headers map[string]string
+}
+
+// prepareHeaderMatrix validates target's header matrix and generates its
+// combinations, variant's name joins names of its values with / in order
+// of header names, e.g. de/mobile
+func prepareHeaderMatrix(v *targetInfo) ([]matrixVariant, error) {
+	headers := make([]string, 0, len(v.HeaderMatrix))
+	for header, values := range v.HeaderMatrix {
+		if len(values) == 0 {
+			return nil, errors.New(fmt.Sprintf("header matrix: header \"%s\" has no values", header))
+		}
+		for name := range v.Headers {
+			if strings.EqualFold(name, header) {
+				return nil, errors.New(fmt.Sprintf("header matrix: header \"%s\" is also set in \"headers\"", header))
+			}
+		}
+		if len(v.Accept) > 0 && strings.EqualFold(header, "Accept") {
+			return nil, errors.New("header matrix: \"accept\" cannot be combined with Accept header")
+		}
+
+		names := map[string]bool{}
+		for i, value := range values {
+			if value.Name == "" || strings.ContainsAny(value.Name, "[]\"/,") {
+				return nil, errors.New(fmt.Sprintf("header matrix: invalid name \"%s\" of %s value, it cannot be empty or contain [ ] \" / ,", value.Name, header))
+			}
+			if names[value.Name] {
+				return nil, errors.New(fmt.Sprintf("header matrix: duplicate name \"%s\" of %s value", value.Name, header))
+			}
+			names[value.Name] = true
+
+			if err := replaceWithEnvVar(&values[i].Value); err != nil {
+				return nil, errors.New(fmt.Sprintf("header matrix: %s", err))
+			}
+		}
+		headers = append(headers, header)
+	}
+	slices.SortFunc(headers, func(a, b string) int {
+		return strings.Compare(http.CanonicalHeaderKey(a), http.CanonicalHeaderKey(b))
+	})
+
+	for i := 1; i < len(headers); i++ {
+		if strings.EqualFold(headers[i-1], headers[i]) {
+			return nil, errors.New(fmt.Sprintf("header matrix: header \"%s\" is given twice", headers[i]))
+		}
+	}
+
+	total := 1
+	for _, header := range headers {
+		total *= len(v.HeaderMatrix[header])
+		if total > maxMatrixVariants {
+			return nil, errors.New(fmt.Sprintf("header matrix exceeds %d combinations", maxMatrixVariants))
+		}
+	}
+
+	variants := []matrixVariant{{headers: map[string]string{}}}
+	for _, header := range headers {
+		next := make([]matrixVariant, 0, len(variants)*len(v.HeaderMatrix[header]))
+		for _, base := range variants {
+			for _, value := range v.HeaderMatrix[header] {
+				variant := matrixVariant{name: value.Name, headers: make(map[string]string, len(base.headers)+1)}
+				if base.name != "" {
+					variant.name = base.name + "/" + value.Name
+				}
+				for k, hv := range base.headers {
+					variant.headers[k] = hv
+				}
+				variant.headers[header] = value.Value
+				next = append(next, variant)
+			}
+		}
+		variants = next
+	}
+
+	return variants, nil
+}
+
+type matrixMonitor struct {
+	// target is copy of monitored target with headers of variant
+	target *targetInfo
+	state  *monitorState
+}
+
+// checkHeaderMatrix runs target's check once for every combination of its
+// header matrix, e.g. to verify localized or device specific responses.
+// Result of the worst combination is used as target's result.
+func checkHeaderMatrix(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState) checkResult {
+	if state.matrix == nil {
+		state.matrix = map[string]*matrixMonitor{}
+	}
+
+	names := make([]string, len(target.matrixVariants))
+	for i, mv := range target.matrixVariants {
+		if _, ok := state.matrix[mv.name]; !ok {
+			state.matrix[mv.name] = newMatrixMonitor(mv, target, state)
+		}
+		names[i] = mv.name
+	}
+
+	results := runSteps(ctx, target.Pacing, names, func(ctx context.Context, name string) checkResult {
+		m := state.matrix[name]
+		return runSingleCheck(ctx, client, m.target, m.state)
+	})
+
+	var (
+		worst     string
+		worstRes  checkResult
+		isChecked bool
+	)
+	for _, mv := range target.matrixVariants {
+		if r := results[mv.name]; !isChecked || isWorse(r, worstRes) {
+			worst, worstRes, isChecked = mv.name, r, true
+		}
+	}
+
+	result := worstRes
+	result.variants = results
+	result.worstVariant = worst
+
+	for _, r := range results {
+		if r.failed() {
+			result.failingVariants++
+		}
+	}
+
+	return result
+}
+
+func newMatrixMonitor(mv matrixVariant, target *targetInfo, parent *monitorState) *matrixMonitor {
+	variant := *target
+	variant.Headers = make(map[string]string, len(target.Headers)+len(mv.headers))
+	for k, v := range target.Headers {
+		variant.Headers[k] = v
+	}
+	for k, v := range mv.headers {
+		variant.Headers[k] = v
+	}
+
+	return &matrixMonitor{
+		target: &variant,
+		state:  &monitorState{limiter: parent.limiter, stats: parent.stats, dns: parent.dns},
+	}
+}
+
+// MatrixVariants returns names of header matrix combinations of target,
+// e.g. for low-level discovery of variants
+func (t *Targets) MatrixVariants(key string) ([]string, bool) {
+	target, ok := t.target(key)
+	if !ok || len(target.matrixVariants) == 0 {
+		return nil, false
+	}
+
+	names := make([]string, len(target.matrixVariants))
+	for i, mv := range target.matrixVariants {
+		names[i] = mv.name
+	}
+	return names, true
+}
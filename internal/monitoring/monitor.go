@@ -0,0 +1,1080 @@
+package monitoring
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+type checkResult struct {
+	responseTime time.Duration
+	status       string
+	statusCode   int
+	err          error
+
+	timeToFirstEvent time.Duration
+	eventReceived    bool
+
+	cacheValid      bool
+	validatorStable bool
+
+	bodyMatch bool
+
+	goldenSimilarity float64
+	goldenDiffs      []string
+
+	// extracted values by name, see targetInfo.Extract
+	extracted map[string]interface{}
+
+	cacheStatus string
+	cacheAge    int
+
+	tcp tcpInfo
+
+	subresources subresourceResult
+
+	// syntaxErrors is number of errors found in robots.txt or sitemap
+	syntaxErrors int
+	robots       robotsResult
+	sitemap      sitemapResult
+	winrm        winrmResult
+
+	tlsVersion     string
+	tlsCipher      string
+	tlsCertificate string
+
+	// timing is duration of phases of request
+	timing requestTiming
+
+	// responseSize is number of body bytes read
+	responseSize int64
+	contentType  string
+	// bodyErr is set when body couldn't be read after headers were received
+	bodyErr error
+
+	// rangeValid is set when server answered range request correctly
+	rangeValid   bool
+	contentRange string
+
+	// headersTooLarge is set when response headers exceeded limit of target
+	headersTooLarge bool
+
+	// assertErr describes first failed assertion on otherwise successful response
+	assertErr error
+
+	// pinMismatch is set when none of served certificates matches target's pins
+	pinMismatch bool
+
+	// statusExpected is set when status matches target's expected statuses,
+	// status codes 4xx and 5xx don't fail such check
+	statusExpected bool
+
+	// expectedFailure is set when check failed the way target expects
+	expectedFailure bool
+
+	// listed is set when dnsbl check found host on blacklist
+	listed bool
+
+	domainExpiry    time.Time
+	daysUntilExpiry int
+
+	// exitCode and output of exec check's command
+	exitCode int
+	output   interface{}
+
+	openPorts    []int
+	addedPorts   []int
+	removedPorts []int
+
+	// results of the same check executed against multiple variants (e.g. edges)
+	variants        map[string]checkResult
+	worstVariant    string
+	failingVariants int
+	// distinctCertificates is number of different certificates served to variants
+	distinctCertificates int
+
+	// finished is set when result may be older than check it's reported by
+	finished time.Time
+}
+
+func (r checkResult) failed() bool {
+	if r.expectedFailure {
+		return false
+	}
+	return r.err != nil || r.assertErr != nil || (r.statusCode >= 400 && !r.statusExpected)
+}
+
+// failureReason describes why check failed, empty when it didn't
+func (r checkResult) failureReason() string {
+	switch {
+	case !r.failed():
+		return ""
+	case r.err != nil:
+		return r.err.Error()
+	case r.assertErr != nil:
+		return r.assertErr.Error()
+	}
+	return fmt.Sprintf("unexpected status %s", r.status)
+}
+
+// monitorState keeps data carried between consecutive checks of a target
+type monitorState struct {
+	etag         string
+	lastModified string
+
+	// golden is golden response of target, nil until recorded or loaded
+	golden *goldenDocument
+
+	edges       map[string]*edgeMonitor
+	serverNames map[string]*sniMonitor
+	matrix      map[string]*matrixMonitor
+	rotation    *rotation
+
+	limiter *hostLimiter
+	stats   *transportStats
+	// dns is nil when target bypasses dns cache
+	dns *dnsCache
+}
+
+type monitor struct {
+	key    string
+	target *targetInfo
+	client *http.Client
+	state  *monitorState
+
+	// interval is current delay between checks, see nextInterval
+	interval time.Duration
+
+	sampler sampler
+	apdex   apdexWindow
+	history history
+	breaker breakerState
+
+	availability availabilityWindow
+	slo          sloWindow
+
+	events eventState
+
+	// trigger requests immediate check, channel is closed once it finishes
+	trigger chan chan struct{}
+	// started is when monitor was created
+	started time.Time
+	// fingerprint identifies target's definition in store, see UseStore
+	fingerprint string
+
+	// ctx is cancelled when target is removed or changed by reload
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// StartMonitoring starts check loop for every target, targets added
+// by later reloads are started as well. Once ctx is cancelled in-flight
+// checks are aborted and loops stop, see Wait.
+func (t *Targets) StartMonitoring(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.running = true
+	t.ctx = ctx
+	for name, target := range t.inner {
+		t.startMonitor(name, target)
+	}
+}
+
+// Wait blocks until check loops return after context given to StartMonitoring is cancelled
+func (t *Targets) Wait() {
+	t.loops.Wait()
+}
+
+// startMonitor must be called with t.mu held
+func (t *Targets) startMonitor(key string, target *targetInfo) {
+	if t.ctx.Err() != nil {
+		return
+	}
+
+	if target.TLS != nil && target.TLS.InsecureSkipVerify {
+		slog.Warn("TLS certificate verification is disabled, any certificate is accepted", "target", key)
+	}
+
+	m := t.newMonitor(key, target)
+
+	t.loops.Add(1)
+	go func() {
+		defer t.loops.Done()
+
+		var done chan struct{}
+		delay := m.target.firstDelay(time.Now())
+		for {
+			timer := time.NewTimer(delay)
+			select {
+			case <-m.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			case done = <-m.trigger:
+				timer.Stop()
+			}
+
+			interval := t.runMonitor(m)
+			if done != nil {
+				close(done)
+				done = nil
+			}
+			delay = m.target.withJitter(interval)
+		}
+	}()
+}
+
+// stopMonitor must be called with t.mu held
+func (t *Targets) stopMonitor(key string) {
+	if m, ok := t.monitors[key]; ok {
+		m.cancel()
+		m.client.CloseIdleConnections()
+		delete(t.monitors, key)
+	}
+	t.data.Delete(key)
+}
+
+// CheckOnce runs single check of target synchronously and returns its data
+func (t *Targets) CheckOnce(key string) (TargetData, bool) {
+	t.mu.Lock()
+	target, ok := t.inner[key]
+	if !ok {
+		t.mu.Unlock()
+		return TargetData{}, false
+	}
+
+	m, ok := t.monitors[key]
+	if !ok {
+		m = t.newMonitor(key, target)
+	}
+	t.mu.Unlock()
+
+	t.runMonitor(m)
+	return t.GetData(key)
+}
+
+// RunNow runs check of target immediately and returns its data. Check of
+// running monitor is made by its loop, so it doesn't overlap with scheduled
+// one, and the next scheduled check follows after target's interval.
+// It returns false when target doesn't exist or ctx is cancelled first.
+func (t *Targets) RunNow(ctx context.Context, key string) (TargetData, bool) {
+	t.mu.RLock()
+	_, ok := t.inner[key]
+	m, running := t.monitors[key]
+	running = running && t.running
+	t.mu.RUnlock()
+
+	if !ok {
+		return TargetData{}, false
+	}
+	if !running {
+		return t.CheckOnce(key)
+	}
+
+	done := make(chan struct{})
+	select {
+	case m.trigger <- done:
+	case <-m.ctx.Done():
+		return TargetData{}, false
+	case <-ctx.Done():
+		return TargetData{}, false
+	}
+
+	select {
+	case <-done:
+		return t.GetData(key)
+	case <-m.ctx.Done():
+		return TargetData{}, false
+	case <-ctx.Done():
+		return TargetData{}, false
+	}
+}
+
+// monitorStart returns when monitor of target was created, zero time when it isn't running
+func (t *Targets) monitorStart(key string) time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if m, ok := t.monitors[key]; ok {
+		return m.started
+	}
+	return time.Time{}
+}
+
+// newMonitor must be called with t.mu held
+func (t *Targets) newMonitor(key string, target *targetInfo) *monitor {
+	if t.monitors == nil {
+		t.monitors = map[string]*monitor{}
+	}
+
+	dns := t.dns
+	if target.BypassDNSCache {
+		dns = nil
+	}
+
+	parent := t.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	m := &monitor{
+		key:    key,
+		target: target,
+		client: &http.Client{
+			Timeout:   target.timeout,
+			Transport: t.stats.newTransport("", dns, target),
+		},
+		state:   &monitorState{limiter: t.limiter, stats: t.stats, dns: dns},
+		trigger: make(chan chan struct{}),
+		started: time.Now(),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	t.monitors[key] = m
+	t.data.Store(key, TargetData{})
+
+	if t.store != nil {
+		m.fingerprint, _ = fingerprint(targetsMetadata{key: target})
+		t.restore(m)
+	}
+
+	return m
+}
+
+// update modifies target's data unless monitor was replaced or stopped in the meantime
+func (t *Targets) update(m *monitor, fn func(data *TargetData)) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.monitors[m.key] != m {
+		return false
+	}
+
+	if data, ok := t.GetData(m.key); ok {
+		fn(&data)
+		t.data.Store(m.key, data)
+	}
+
+	return true
+}
+
+// runMonitor runs check and returns delay before the next one
+func (t *Targets) runMonitor(m *monitor) time.Duration {
+	breaker := m.target.CircuitBreaker
+	if breaker != nil {
+		m.breaker.begin()
+	}
+
+	t.update(m, func(data *TargetData) {
+		data.Start = time.Now()
+		data.Running = true
+		if breaker != nil {
+			data.Breaker = m.breaker.state
+		}
+	})
+
+	raw := runCheck(m.ctx, m.client, m.target, m.state)
+	if m.ctx.Err() != nil {
+		// check aborted by shutdown or reload isn't recorded
+		t.update(m, func(data *TargetData) { data.Running = false })
+		return 0
+	}
+	interval := m.nextInterval(raw)
+	if breaker != nil {
+		interval = m.breaker.add(raw, breaker, interval)
+	}
+
+	// sampled target reports one result per sample
+	var (
+		result   = raw
+		stats    SampleStats
+		complete = true
+	)
+	if m.target.SampleSize > 1 {
+		result, stats, complete = m.sampler.add(raw, m.target.SampleSize)
+	}
+
+	m.history.add(HistoryEntry{
+		Time:         time.Now(),
+		ResponseTime: raw.responseTime,
+		Failed:       raw.failed(),
+		Error:        raw.err != nil,
+	}, m.target.History)
+
+	m.availability.add(time.Now(), raw.failed(), m.target.availabilityWindow)
+	if m.target.SLO != nil {
+		m.slo.add(time.Now(), m.target.SLO.bad(raw), m.target.SLO.window)
+	}
+
+	var score float64
+	if m.target.Apdex != nil {
+		score = m.apdex.add(raw, m.target.Apdex)
+	}
+
+	var failedStreak int64
+	current := t.update(m, func(data *TargetData) {
+		data.Running = false
+		data.Interval = interval
+		if complete {
+			data.LastCheck = time.Now()
+			data.apply(result)
+			data.Sample = stats
+		}
+
+		data.Apdex = score
+		if breaker != nil {
+			data.Breaker = m.breaker.state
+		}
+
+		data.Checks++
+		if raw.failed() {
+			if data.FailedStreak == 0 {
+				data.FailingSince = time.Now()
+			}
+			data.Failures++
+			data.FailedStreak++
+		} else {
+			data.FailedStreak = 0
+			data.FailingSince = time.Time{}
+		}
+		if raw.err != nil {
+			data.Errors++
+		}
+		failedStreak = data.FailedStreak
+	})
+	if current {
+		t.detectEvents(m, raw, failedStreak)
+	}
+	if !current || !complete {
+		return interval
+	}
+
+	if stats.Failures > 0 {
+		slog.Warn("sampled checks failed", "target", m.key, "failures", stats.Failures, "size", stats.Size)
+	}
+
+	if result.err != nil {
+		slog.Warn("request error", "target", m.key, "err", result.err)
+	} else if result.assertErr != nil {
+		slog.Warn("assertion failed", "target", m.key, "err", result.assertErr)
+	}
+
+	return interval
+}
+
+// nextInterval returns delay before next check, until the next scheduled
+// time for target with schedule. In adaptive mode it drops to
+// min interval while target is failing or degraded and doubles back
+// to target's interval once it's healthy.
+func (m *monitor) nextInterval(result checkResult) time.Duration {
+	if m.target.cron != nil {
+		return untilScheduled(m.target.cron, time.Now())
+	}
+
+	base := time.Millisecond * time.Duration(m.target.Interval)
+
+	a := m.target.AdaptiveInterval
+	if a == nil {
+		return base
+	}
+
+	degraded := result.failed()
+	if a.DegradedResponseTime > 0 && result.responseTime > time.Millisecond*time.Duration(a.DegradedResponseTime) {
+		degraded = true
+	}
+
+	if degraded {
+		m.interval = time.Millisecond * time.Duration(a.MinInterval)
+	} else if m.interval == 0 {
+		m.interval = base
+	} else {
+		m.interval = min(m.interval*2, base)
+	}
+
+	return m.interval
+}
+
+func (d *TargetData) apply(result checkResult) {
+	d.LastResponseTime = result.responseTime
+	d.LastStatus = result.status
+	d.LastStatusCode = result.statusCode
+	d.LastFailed = result.failed()
+	d.LastFailure = result.failureReason()
+	d.LastError = ""
+	if result.err != nil {
+		d.LastError = result.err.Error()
+	}
+	d.LastTimeToFirstEvent = result.timeToFirstEvent
+	d.LastEventReceived = result.eventReceived
+	d.LastCacheValid = result.cacheValid
+	d.LastValidatorStable = result.validatorStable
+	d.LastBodyMatch = result.bodyMatch
+	d.LastGoldenSimilarity = result.goldenSimilarity
+	d.LastGoldenDiffs = result.goldenDiffs
+	d.LastExtracted = result.extracted
+	d.LastCacheStatus = result.cacheStatus
+	d.LastCacheAge = result.cacheAge
+	d.LastExpectedFailure = result.expectedFailure
+	d.LastListed = result.listed
+	d.LastDomainExpiry = result.domainExpiry
+	d.LastDaysUntilExpiry = result.daysUntilExpiry
+	d.LastExitCode = result.exitCode
+	d.LastOutput = result.output
+	d.LastOpenPorts = result.openPorts
+	d.LastAddedPorts = result.addedPorts
+	d.LastRemovedPorts = result.removedPorts
+	d.LastTLSVersion = result.tlsVersion
+	d.LastTLSCipher = result.tlsCipher
+	d.LastTLSCertificate = result.tlsCertificate
+	d.LastTCPRTT = result.tcp.rtt
+	d.LastTCPRTTVar = result.tcp.rttVar
+	d.LastTCPRetransmits = result.tcp.retransmits
+	d.LastSubresources = result.subresources.count
+	d.LastBrokenSubresources = result.subresources.broken
+	d.LastSlowestSubresource = result.subresources.slowest
+	d.LastSlowestSubresourceTime = result.subresources.slowestTime
+	d.LastSyntaxErrors = result.syntaxErrors
+	d.LastSitemaps = result.robots.sitemaps
+	d.LastDisallowAll = result.robots.disallowAll
+	d.LastSitemapEntries = result.sitemap.entries
+	d.LastLastmod = result.sitemap.lastmod
+	d.LastDaysSinceLastmod = result.sitemap.daysSinceLastmod
+	d.LastHeadersTooLarge = result.headersTooLarge
+	d.LastDNSTime = result.timing.dns
+	d.LastConnectTime = result.timing.connect
+	d.LastTLSTime = result.timing.tls
+	d.LastTTFB = result.timing.ttfb
+	d.LastDownloadTime = result.timing.download
+	d.LastResponseSize = result.responseSize
+	d.LastContentType = result.contentType
+	d.LastBodyError = ""
+	if result.bodyErr != nil {
+		d.LastBodyError = result.bodyErr.Error()
+	}
+	d.LastRangeValid = result.rangeValid
+	d.LastContentRange = result.contentRange
+	d.LastProductVendor = result.winrm.productVendor
+	d.LastProductVersion = result.winrm.productVersion
+
+	d.Variants = nil
+	if result.variants != nil {
+		d.Variants = make(map[string]TargetData, len(result.variants))
+		for name, r := range result.variants {
+			v := TargetData{LastCheck: d.LastCheck}
+			if !r.finished.IsZero() {
+				v.LastCheck = r.finished
+			}
+			v.apply(r)
+			d.Variants[name] = v
+		}
+	}
+	d.WorstVariant = result.worstVariant
+	d.FailingVariants = result.failingVariants
+	d.DistinctCertificates = result.distinctCertificates
+}
+
+// statusTimeout is reported as status of check which didn't finish within target's timeout
+const statusTimeout = "timeout"
+
+// statusHeadersTooLarge is reported as status of check whose response
+// headers exceeded target's max-response-header-bytes
+const statusHeadersTooLarge = "headers too large"
+
+func runCheck(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState) checkResult {
+	if target.Subnet != "" {
+		// timeout bounds check of each host
+		return checkSweep(ctx, target, state)
+	}
+
+	// bounds checks which don't go through client, e.g. portscan and dnsbl,
+	// and all steps of paced check
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout(target))
+	defer cancel()
+
+	if len(target.Edges) > 0 || target.ResolveEdges {
+		return checkEdges(ctx, target, state)
+	}
+
+	if len(target.Urls) > 0 {
+		return checkRotation(ctx, client, target, state)
+	}
+
+	if target.TLS != nil && len(target.TLS.ServerNames) > 0 {
+		return checkServerNames(ctx, target, state)
+	}
+
+	if len(target.matrixVariants) > 0 {
+		return checkHeaderMatrix(ctx, client, target, state)
+	}
+
+	return runSingleCheck(ctx, client, target, state)
+}
+
+func runSingleCheck(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState) checkResult {
+	var result checkResult
+	switch target.Type {
+	case checkTypeSSE:
+		result = checkSSE(ctx, client, target, state)
+	case checkTypePortScan:
+		result = checkPortScan(ctx, target)
+	case checkTypeICMP:
+		result = checkICMP(ctx, target.Host, state)
+	case checkTypeTCP:
+		result = checkTCP(ctx, target, target.Host, state)
+	case checkTypeDNSBL:
+		result = checkDNSBL(ctx, target, state)
+	case checkTypeDomain:
+		result = checkDomain(ctx, client, target, state)
+	case checkTypeExec:
+		result = checkExec(ctx, target)
+	case checkTypeRobots:
+		result = checkRobots(ctx, client, target, state)
+	case checkTypeSitemap:
+		result = checkSitemap(ctx, client, target, state)
+	case checkTypeWinRM:
+		result = checkWinRM(ctx, client, target, state)
+	default:
+		result = checkHTTP(ctx, client, target, state)
+	}
+
+	markBodyError(&result, target)
+	markTimeout(&result)
+	markHeadersTooLarge(&result)
+
+	if len(target.expectStatus) > 0 {
+		applyExpectStatus(&result, target)
+	}
+
+	if target.ExpectFailure != nil {
+		applyExpectFailure(&result, target.ExpectFailure)
+	}
+
+	return result
+}
+
+// markTimeout reports timed out check with timeout status
+func markTimeout(result *checkResult) {
+	if result.err != nil && errorMatches(result.err, expectErrorTimeout) {
+		result.status = statusTimeout
+	}
+}
+
+// markHeadersTooLarge reports check aborted by response header limit
+// with its own status, so it isn't mistaken for network error
+func markHeadersTooLarge(result *checkResult) {
+	if result.err != nil && errorMatches(result.err, expectErrorHeadersTooLarge) {
+		result.status = statusHeadersTooLarge
+		result.headersTooLarge = true
+	}
+}
+
+// prepareRequest builds parts of target's request which don't change
+// between checks, so they aren't encoded again on every check
+func (t *targetInfo) prepareRequest() error {
+	t.requestBody, t.contentType = nil, ""
+	if methodAllowsBody(t.Method) {
+		if t.FormData != nil {
+			values := url.Values{}
+			for k, v := range t.FormData {
+				values.Add(k, v)
+			}
+			t.requestBody = []byte(values.Encode())
+			t.contentType = "application/x-www-form-urlencoded; charset=utf-8"
+		} else if t.Json != "" {
+			t.requestBody = []byte(t.Json)
+			t.contentType = "application/json; charset=utf-8"
+		}
+	}
+
+	t.authHeader.wipe()
+	t.authHeader = secret{}
+	t.authHeaderName = "Authorization"
+	t.oauth2 = nil
+	if strings.EqualFold(t.Authorization.Type, authorizationOAuth2) {
+		t.oauth2 = newOAuth2Source(t.Authorization, t.timeout)
+	} else if strings.EqualFold(t.Authorization.Type, authorizationAPIKey) {
+		t.authHeaderName = t.Authorization.Header
+		t.authHeader = newSecret(t.Authorization.Value.reveal())
+	} else if t.Authorization.Type != "" {
+		token := t.Authorization.Token.reveal()
+		if token == "" {
+			auth := t.Authorization.Username + ":" + t.Authorization.Password.reveal()
+			token = base64.StdEncoding.EncodeToString([]byte(auth))
+		}
+		t.authHeader = newSecret(t.Authorization.Type + " " + token)
+	}
+
+	// secret isn't part of the error, it may come from env variable or file
+	if !t.authHeader.isEmpty() && !httpguts.ValidHeaderFieldValue(t.authHeader.reveal()) {
+		return errors.New("authorization contains characters invalid in header, e.g. new line")
+	}
+	return nil
+}
+
+func newRequest(ctx context.Context, target *targetInfo) (*http.Request, error) {
+	var body io.Reader
+	if target.requestBody != nil {
+		body = bytes.NewReader(target.requestBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, target.Method, target.Url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.contentType != "" {
+		req.Header.Set("Content-Type", target.contentType)
+	}
+
+	if len(target.Accept) > 0 {
+		req.Header.Set("Accept", strings.Join(target.Accept, ", "))
+	}
+
+	if target.Type == checkTypeSSE {
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Cache-Control", "no-cache")
+	}
+
+	if err := setAuthorization(ctx, req, target); err != nil {
+		return nil, err
+	}
+
+	for k, v := range target.Headers {
+		req.Header.Set(k, v)
+	}
+
+	return req, nil
+}
+
+// setAuthorization sets Authorization header (or header of api key) of
+// target, oauth2 token is fetched when not cached
+func setAuthorization(ctx context.Context, req *http.Request, target *targetInfo) error {
+	if target.oauth2 != nil {
+		header, err := target.oauth2.header(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", header)
+		return nil
+	}
+
+	if !target.authHeader.isEmpty() {
+		req.Header.Set(target.authHeaderName, target.authHeader.reveal())
+	}
+	return nil
+}
+
+func checkHTTP(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState) checkResult {
+	req, err := newRequest(ctx, target)
+	if err != nil {
+		return checkResult{err: err}
+	}
+	req = state.stats.instrument(req)
+	req, timing := traceTiming(req)
+
+	var conn net.Conn
+	if target.TCPInfo {
+		req = captureConn(req, &conn)
+	}
+
+	if target.byteRange != nil {
+		req.Header.Set("Range", target.byteRange.String())
+	}
+
+	conditional := false
+	if target.CacheValidation {
+		if state.etag != "" {
+			req.Header.Set("If-None-Match", state.etag)
+			conditional = true
+		}
+		if state.lastModified != "" {
+			req.Header.Set("If-Modified-Since", state.lastModified)
+			conditional = true
+		}
+	}
+
+	release, err := state.limiter.acquire(req.Context(), hostKey(req.URL))
+	if err != nil {
+		return checkResult{err: err}
+	}
+	defer release()
+
+	start := time.Now()
+	res, err := client.Do(req)
+
+	// rejected oauth2 token (e.g. revoked before expiry) is refreshed and
+	// request is retried once
+	if err == nil && res.StatusCode == http.StatusUnauthorized && target.oauth2 != nil {
+		io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+		res.Body.Close()
+		target.oauth2.invalidate(req.Header.Get("Authorization"))
+
+		retry := req.Clone(req.Context())
+		if req.GetBody != nil {
+			retry.Body, err = req.GetBody()
+		}
+		if err == nil {
+			err = setAuthorization(retry.Context(), retry, target)
+		}
+		if err == nil {
+			start = time.Now()
+			res, err = client.Do(retry)
+		}
+	}
+
+	result := checkResult{responseTime: time.Since(start)}
+	if err != nil {
+		result.err = err
+		result.timing = timing.finish()
+		return result
+	}
+
+	result.status = res.Status
+	result.statusCode = res.StatusCode
+
+	if res.TLS != nil {
+		result.tlsVersion = tlsVersionName(res.TLS.Version)
+		result.tlsCipher = tls.CipherSuiteName(res.TLS.CipherSuite)
+		result.tlsCertificate = certificateFingerprint(res.TLS)
+
+		if target.TLS != nil {
+			result.assertErr = target.TLS.verifyConnection(res.TLS)
+			result.pinMismatch = !target.TLS.matchesPins(res.TLS)
+		}
+	}
+
+	if target.CacheStatus {
+		result.cacheStatus, result.cacheAge = readCacheStatus(res.Header)
+	}
+
+	result.contentType = res.Header.Get("Content-Type")
+	if len(target.contentTypes) > 0 && result.assertErr == nil {
+		result.assertErr = checkContentType(res, target.contentTypes)
+	}
+
+	var (
+		counted = &countingReader{r: bodyReader{r: res.Body}}
+		body    = io.Reader(counted)
+		data    []byte
+	)
+	if len(target.extractPaths) > 0 || target.scriptCheck != nil || target.Golden != nil || target.Subresources != nil {
+		// values are extracted from whole body, assertions, script, golden comparison and subresources use the same copy
+		data, err = readExtractBody(body)
+		if err != nil {
+			result.err = err
+		} else if len(target.extractPaths) > 0 {
+			result.extracted, result.assertErr = extractValues(data, target)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	if target.ExpectBodyContains != "" || target.ExpectBodyRegex != "" {
+		matched, err := matchBody(body, target)
+		if err != nil {
+			result.err = err
+		} else if !matched {
+			result.assertErr = bodyAssertionError(target)
+		}
+		result.bodyMatch = matched
+	} else if _, err := io.Copy(io.Discard, body); err != nil && result.err == nil {
+		// truncated body or body which doesn't arrive within timeout fails the check as well
+		result.err = err
+	}
+	result.timing = timing.finish()
+	result.responseSize = counted.n
+
+	if target.byteRange != nil && result.err == nil {
+		if _, err := io.Copy(io.Discard, counted); err != nil {
+			result.err = err
+		} else {
+			result.contentRange = res.Header.Get("Content-Range")
+			err := validateRange(res, *target.byteRange, counted.n)
+			result.rangeValid = err == nil
+			if err != nil && result.assertErr == nil {
+				result.assertErr = err
+			}
+		}
+		result.responseSize = counted.n
+	}
+
+	if target.Golden != nil && result.err == nil && result.assertErr == nil {
+		compareGolden(&result, data, target, state)
+	}
+
+	if target.scriptCheck != nil && result.err == nil && result.assertErr == nil {
+		result.assertErr = runScript(ctx, target, res, data, result)
+	}
+
+	if target.Subresources != nil && result.err == nil && res.StatusCode < 400 && isHTML(res) {
+		result.subresources = checkSubresources(ctx, client, target, state, res.Request.URL, data)
+		if target.Subresources.FailOnBroken && result.subresources.broken > 0 && result.assertErr == nil {
+			result.assertErr = errors.New(fmt.Sprintf("%d of %d subresources broken, first %s",
+				result.subresources.broken, result.subresources.count, result.subresources.firstBroken))
+		}
+	}
+
+	if conn != nil {
+		result.tcp, _ = readTCPInfo(conn)
+	}
+	res.Body.Close()
+
+	if target.CacheValidation {
+		validateCache(&result, res, state, conditional)
+	}
+
+	return result
+}
+
+// validateCache checks whether server honors conditional requests made
+// with validators (ETag, Last-Modified) stored from previous response
+func validateCache(result *checkResult, res *http.Response, state *monitorState, conditional bool) {
+	etag := res.Header.Get("ETag")
+	lastModified := res.Header.Get("Last-Modified")
+
+	result.cacheValid = true
+	result.validatorStable = true
+
+	switch {
+	case res.StatusCode == http.StatusNotModified:
+		if !conditional {
+			result.cacheValid = false
+			result.assertErr = errors.New("304 Not Modified returned for unconditional request")
+		}
+
+		// 304 should repeat validator which was matched
+		if etag != "" && state.etag != "" && etag != state.etag {
+			result.validatorStable = false
+		}
+
+		// keep stored validators, response doesn't have to carry all of them
+		if etag != "" {
+			state.etag = etag
+		}
+		if lastModified != "" {
+			state.lastModified = lastModified
+		}
+		return
+
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		result.cacheValid = false
+		result.assertErr = errors.New(fmt.Sprintf("unexpected status %s for cache validation", res.Status))
+		return
+
+	case etag == "" && lastModified == "":
+		result.cacheValid = false
+		result.assertErr = errors.New("response doesn't contain ETag nor Last-Modified validator")
+
+	case conditional:
+		if (state.etag != "" && etag == state.etag) || (state.etag == "" && lastModified == state.lastModified) {
+			result.cacheValid = false
+			result.assertErr = errors.New("full response returned although validators still match")
+		} else {
+			// resource changed since previous check
+			result.validatorStable = false
+		}
+	}
+
+	state.etag = etag
+	state.lastModified = lastModified
+}
+
+// checkSSE connects to server-sent events stream and waits
+// for the first dispatched event within target's event timeout
+func checkSSE(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState) checkResult {
+	timeout := time.Millisecond * time.Duration(target.EventTimeout)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := newRequest(ctx, target)
+	if err != nil {
+		return checkResult{err: err}
+	}
+	req = state.stats.instrument(req)
+
+	var conn net.Conn
+	if target.TCPInfo {
+		req = captureConn(req, &conn)
+	}
+
+	release, err := state.limiter.acquire(ctx, hostKey(req.URL))
+	if err != nil {
+		return checkResult{err: err}
+	}
+	defer release()
+
+	start := time.Now()
+	res, err := client.Do(req)
+
+	result := checkResult{responseTime: time.Since(start)}
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer res.Body.Close()
+
+	if conn != nil {
+		result.tcp, _ = readTCPInfo(conn)
+	}
+
+	result.status = res.Status
+	result.statusCode = res.StatusCode
+
+	if res.StatusCode != http.StatusOK {
+		result.err = errors.New(fmt.Sprintf("unexpected status %s for event stream", res.Status))
+		return result
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		result.err = errors.New(fmt.Sprintf("unexpected content type \"%s\" for event stream", res.Header.Get("Content-Type")))
+		return result
+	}
+
+	hasData := false
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// blank line dispatches event, but only if it carried any data
+		if line == "" {
+			if hasData {
+				result.timeToFirstEvent = time.Since(start)
+				result.eventReceived = true
+				return result
+			}
+			continue
+		}
+
+		field, _, _ := strings.Cut(line, ":")
+		if field == "data" {
+			hasData = true
+		}
+	}
+
+	result.timeToFirstEvent = time.Since(start)
+	if err := scanner.Err(); err != nil && ctx.Err() != nil {
+		result.err = errors.New(fmt.Sprintf("no event received within %s", timeout))
+	} else if err != nil {
+		result.err = err
+	} else {
+		result.err = errors.New("event stream closed before first event")
+	}
+
+	return result
+}
@@ -0,0 +1,120 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// benchmarkRequestTargets are targets of every kind of request body and authorization
+var benchmarkRequestTargets = map[string]string{
+	"form": "{url: https://host-%d.example.com/login, method: POST, form-data: {user: zcm, scope: monitoring read, redirect: '/home?a=1&b=2'}, authorization: {type: Basic, username: zcm, password: secret-%d}}",
+	"json": "{url: https://host-%d.example.com/api, method: PUT, json: '{\"id\": %d, \"tags\": [\"a\", \"b\"], \"enabled\": true}', authorization: {type: Bearer, token: token-value}, headers: {X-Request-Id: zcm}}",
+	"get":  "{url: 'https://host-%d.example.com/health?id=%d', headers: {Accept: application/json}}",
+}
+
+// parseRequestTargets returns count prepared targets of kind
+func parseRequestTargets(b *testing.B, kind string, count int) []*targetInfo {
+	var doc strings.Builder
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&doc, "%s-%d: "+benchmarkRequestTargets[kind]+"\n", kind, i, i, i)
+	}
+
+	targets, err := ParseTargets([]byte(doc.String()))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	names := make([]string, 0, len(targets.inner))
+	for name := range targets.inner {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	infos := make([]*targetInfo, len(names))
+	for i, name := range names {
+		infos[i] = targets.inner[name]
+	}
+	return infos
+}
+
+// BenchmarkNewRequest builds requests of many targets the way every check does
+func BenchmarkNewRequest(b *testing.B) {
+	for _, kind := range []string{"form", "json", "get"} {
+		b.Run(kind, func(b *testing.B) {
+			infos := parseRequestTargets(b, kind, 1000)
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := newRequest(ctx, infos[i%len(infos)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkTCPTargets returns count targets checking local listener, which
+// accepts and closes connections, so checks stay cheap
+func benchmarkTCPTargets(b *testing.B, count int) (*Targets, []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	names := make([]string, count)
+	var doc strings.Builder
+	for i := range names {
+		names[i] = fmt.Sprintf("tcp-%d", i)
+		fmt.Fprintf(&doc, "%s: {type: tcp, host: 127.0.0.1, port: %d, interval: 3600000, history: 20}\n", names[i], port)
+	}
+
+	targets, err := ParseTargets([]byte(doc.String()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return targets, names
+}
+
+// BenchmarkRunNow triggers checks of running monitors, the same path
+// scheduled checks take
+func BenchmarkRunNow(b *testing.B) {
+	targets, names := benchmarkTCPTargets(b, 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	targets.StartMonitoring(ctx)
+	defer func() {
+		cancel()
+		targets.Wait()
+	}()
+
+	var next atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			name := names[next.Add(1)%int64(len(names))]
+			if _, ok := targets.RunNow(ctx, name); !ok {
+				b.Error("check of " + name + " wasn't run")
+				return
+			}
+		}
+	})
+}
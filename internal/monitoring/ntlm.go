@@ -0,0 +1,204 @@
+package monitoring
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// NTLM message flags (MS-NLMP 2.2.2.5)
+const (
+	ntlmNegotiateUnicode         = 0x00000001
+	ntlmNegotiateOEM             = 0x00000002
+	ntlmRequestTarget            = 0x00000004
+	ntlmNegotiateNTLM            = 0x00000200
+	ntlmNegotiateAlwaysSign      = 0x00008000
+	ntlmNegotiateExtendedSession = 0x00080000
+	ntlmNegotiateTargetInfo      = 0x00800000
+	ntlmNegotiate128             = 0x20000000
+	ntlmNegotiate56              = 0x80000000
+
+	ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmNegotiateOEM | ntlmRequestTarget | ntlmNegotiateNTLM |
+		ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSession | ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+
+	// ntlmAvTimestamp is id of server's time in target info of challenge
+	ntlmAvTimestamp = 7
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmNegotiateMessage returns the first message of NTLM handshake
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmNegotiateFlags)
+	return msg
+}
+
+// ntlmChallenge is the second message of NTLM handshake sent by server
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 32 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, errors.New("invalid NTLM challenge message")
+	}
+
+	c := &ntlmChallenge{
+		flags:           binary.LittleEndian.Uint32(msg[20:]),
+		serverChallenge: msg[24:32],
+	}
+
+	if len(msg) >= 48 {
+		length := int(binary.LittleEndian.Uint16(msg[40:]))
+		offset := int(binary.LittleEndian.Uint32(msg[44:]))
+		if offset+length > len(msg) {
+			return nil, errors.New("invalid NTLM challenge message, target info out of bounds")
+		}
+		c.targetInfo = msg[offset : offset+length]
+	}
+
+	return c, nil
+}
+
+// timestamp returns server's time from target info, zero when not present
+func (c *ntlmChallenge) timestamp() []byte {
+	info := c.targetInfo
+	for len(info) >= 4 {
+		id := binary.LittleEndian.Uint16(info)
+		length := int(binary.LittleEndian.Uint16(info[2:]))
+		if id == 0 || len(info) < 4+length {
+			break
+		}
+		if id == ntlmAvTimestamp && length == 8 {
+			return info[4:12]
+		}
+		info = info[4+length:]
+	}
+	return nil
+}
+
+// ntlmAuthenticateMessage returns the third message of NTLM handshake with
+// NTLMv2 response to challenge, older LM and NTLMv1 responses aren't sent
+func ntlmAuthenticateMessage(c *ntlmChallenge, domain, username, password string) ([]byte, error) {
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+
+	timestamp := c.timestamp()
+	serverTimestamp := timestamp != nil
+	if !serverTimestamp {
+		timestamp = ntlmFiletime(time.Now())
+	}
+
+	key := ntlmV2Key(domain, username, password)
+	ntResponse := ntlmV2Response(key, c.serverChallenge, clientChallenge, timestamp, c.targetInfo)
+
+	// LMv2 response is left zero when server sent its time (MS-NLMP 3.1.5.1.2)
+	lmResponse := make([]byte, 24)
+	if !serverTimestamp {
+		mac := hmac.New(md5.New, key)
+		mac.Write(c.serverChallenge)
+		mac.Write(clientChallenge)
+		lmResponse = append(mac.Sum(nil), clientChallenge...)
+	}
+
+	encode := ntlmOEM
+	if c.flags&ntlmNegotiateUnicode != 0 {
+		encode = ntlmUnicode
+	}
+
+	fields := [][]byte{lmResponse, ntResponse, encode(domain), encode(username), nil, nil}
+
+	const headerSize = 64
+	msg := make([]byte, headerSize)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+
+	offset := headerSize
+	for i, field := range fields {
+		pos := 12 + i*8
+		binary.LittleEndian.PutUint16(msg[pos:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(msg[pos+2:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(msg[pos+4:], uint32(offset))
+		offset += len(field)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], c.flags&ntlmNegotiateFlags)
+
+	for _, field := range fields {
+		msg = append(msg, field...)
+	}
+
+	return msg, nil
+}
+
+// ntlmV2Key is NTOWFv2 of MS-NLMP 3.3.2
+func ntlmV2Key(domain, username, password string) []byte {
+	h := md4.New()
+	h.Write(ntlmUnicode(password))
+
+	mac := hmac.New(md5.New, h.Sum(nil))
+	mac.Write(ntlmUnicode(strings.ToUpper(username) + domain))
+	return mac.Sum(nil)
+}
+
+// ntlmV2Response is NtChallengeResponse of MS-NLMP 3.3.2, proof of
+// key followed by data it was computed from
+func ntlmV2Response(key, serverChallenge, clientChallenge, timestamp, targetInfo []byte) []byte {
+	var temp bytes.Buffer
+	temp.Write([]byte{1, 1, 0, 0, 0, 0, 0, 0})
+	temp.Write(timestamp)
+	temp.Write(clientChallenge)
+	temp.Write([]byte{0, 0, 0, 0})
+	temp.Write(targetInfo)
+	temp.Write([]byte{0, 0, 0, 0})
+
+	mac := hmac.New(md5.New, key)
+	mac.Write(serverChallenge)
+	mac.Write(temp.Bytes())
+
+	return append(mac.Sum(nil), temp.Bytes()...)
+}
+
+// ntlmFiletime returns time as Windows FILETIME, 100ns intervals since 1601
+func ntlmFiletime(t time.Time) []byte {
+	const epochDiff = 116444736000000000
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(t.UnixNano()/100+epochDiff))
+	return b
+}
+
+func ntlmUnicode(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+func ntlmOEM(s string) []byte {
+	return []byte(s)
+}
+
+// splitNTLMUser splits DOMAIN\user, user principal names (user@domain)
+// are sent whole with empty domain
+func splitNTLMUser(username string) (domain, user string) {
+	if domain, user, ok := strings.Cut(username, `\`); ok {
+		return domain, user
+	}
+	return "", username
+}
@@ -0,0 +1,300 @@
+package monitoring
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func ntlmHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// target info of MS-NLMP 4.2.1 examples, domain and computer name with EOL
+const ntlmTestTargetInfo = "02000c0044006f006d00610069006e00" + "01000c0053006500720076006500720000000000"
+
+// NTLMv2 authentication example of MS-NLMP 4.2.4
+func TestNTLMV2KeyAndResponse(t *testing.T) {
+	key := ntlmV2Key("Domain", "User", "Password")
+	if got := hex.EncodeToString(key); got != "0c868a403bfd7a93a3001ef22ef02e3f" {
+		t.Fatalf("got NTOWFv2 %s", got)
+	}
+
+	serverChallenge := ntlmHex(t, "0123456789abcdef")
+	clientChallenge := ntlmHex(t, "aaaaaaaaaaaaaaaa")
+	timestamp := make([]byte, 8)
+	targetInfo := ntlmHex(t, ntlmTestTargetInfo)
+
+	response := ntlmV2Response(key, serverChallenge, clientChallenge, timestamp, targetInfo)
+	if got := hex.EncodeToString(response[:16]); got != "68cd0ab851e51c96aabc927bebef6a1c" {
+		t.Errorf("got NTProofStr %s", got)
+	}
+
+	temp := "0101000000000000" + "0000000000000000" + "aaaaaaaaaaaaaaaa" + "00000000" + ntlmTestTargetInfo + "00000000"
+	if got := hex.EncodeToString(response[16:]); got != temp {
+		t.Errorf("got blob %s, want %s", got, temp)
+	}
+}
+
+func TestNTLMV2KeyUppercasesOnlyUser(t *testing.T) {
+	if !bytes.Equal(ntlmV2Key("Domain", "user", "Password"), ntlmV2Key("Domain", "USER", "Password")) {
+		t.Error("key depends on case of user name")
+	}
+	if bytes.Equal(ntlmV2Key("domain", "User", "Password"), ntlmV2Key("Domain", "User", "Password")) {
+		t.Error("key doesn't depend on case of domain")
+	}
+	if bytes.Equal(ntlmV2Key("Domain", "User", "password"), ntlmV2Key("Domain", "User", "Password")) {
+		t.Error("key doesn't depend on case of password")
+	}
+}
+
+func TestNTLMNegotiateMessage(t *testing.T) {
+	want := "4e544c4d53535000" + "01000000" + "078288a0" + "0000000000000000" + "0000000000000000"
+	if got := hex.EncodeToString(ntlmNegotiateMessage()); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// ntlmTestChallenge builds challenge message with target info
+func ntlmTestChallenge(flags uint32, targetInfo []byte) []byte {
+	msg := make([]byte, 48)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint32(msg[20:], flags)
+	copy(msg[24:], []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], 48)
+	return append(msg, targetInfo...)
+}
+
+func TestParseNTLMChallenge(t *testing.T) {
+	timestamp := ntlmHex(t, "0090d336b734c301")
+	targetInfo := ntlmHex(t, "02000c0044006f006d00610069006e00"+"07000800"+hex.EncodeToString(timestamp)+"00000000")
+
+	c, err := parseNTLMChallenge(ntlmTestChallenge(ntlmNegotiateUnicode|ntlmNegotiateNTLM, targetInfo))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if c.flags != ntlmNegotiateUnicode|ntlmNegotiateNTLM {
+		t.Errorf("got flags %x", c.flags)
+	}
+	if !bytes.Equal(c.serverChallenge, []byte{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("got server challenge %x", c.serverChallenge)
+	}
+	if !bytes.Equal(c.targetInfo, targetInfo) {
+		t.Errorf("got target info %x", c.targetInfo)
+	}
+	if !bytes.Equal(c.timestamp(), timestamp) {
+		t.Errorf("got timestamp %x, want %x", c.timestamp(), timestamp)
+	}
+
+	// challenge without target info, e.g. of older servers
+	short := ntlmTestChallenge(ntlmNegotiateNTLM, nil)[:32]
+	if c, err := parseNTLMChallenge(short); err != nil || c.targetInfo != nil || c.timestamp() != nil {
+		t.Errorf("got %+v, error %v", c, err)
+	}
+}
+
+func TestParseNTLMChallengeErrors(t *testing.T) {
+	valid := ntlmTestChallenge(ntlmNegotiateUnicode, ntlmHex(t, ntlmTestTargetInfo))
+
+	badSignature := append([]byte{}, valid...)
+	badSignature[0] = 'X'
+	negotiate := append([]byte{}, valid...)
+	negotiate[8] = 1
+	outOfBounds := append([]byte{}, valid...)
+	binary.LittleEndian.PutUint32(outOfBounds[44:], uint32(len(valid)))
+
+	for name, msg := range map[string][]byte{
+		"empty":                      {},
+		"truncated":                  valid[:31],
+		"bad signature":              badSignature,
+		"negotiate message":          negotiate,
+		"target info out of bounds":  outOfBounds,
+		"truncated target info":      valid[:len(valid)-1],
+		"authenticate message bytes": append(append([]byte{}, ntlmSignature...), 3, 0, 0, 0),
+	} {
+		if c, err := parseNTLMChallenge(msg); err == nil {
+			t.Errorf("%s: expected error, got %+v", name, c)
+		}
+	}
+}
+
+func TestNTLMChallengeTimestamp(t *testing.T) {
+	tests := []struct {
+		name       string
+		targetInfo string
+		want       string
+	}{
+		{"no target info", "", ""},
+		{"without timestamp", ntlmTestTargetInfo, ""},
+		{"timestamp first", "07000800" + "0102030405060708" + "00000000", "0102030405060708"},
+		{"after eol", "00000000" + "07000800" + "0102030405060708", ""},
+		{"wrong length", "07000400" + "01020304" + "00000000", ""},
+		{"truncated pair", "07000800" + "010203", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ntlmChallenge{targetInfo: ntlmHex(t, tt.targetInfo)}
+			if got := hex.EncodeToString(c.timestamp()); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// ntlmField returns field of authenticate message by index of its security buffer
+func ntlmField(t *testing.T, msg []byte, i int) []byte {
+	t.Helper()
+	pos := 12 + i*8
+	length := int(binary.LittleEndian.Uint16(msg[pos:]))
+	offset := int(binary.LittleEndian.Uint32(msg[pos+4:]))
+	if binary.LittleEndian.Uint16(msg[pos+2:]) != uint16(length) || offset+length > len(msg) {
+		t.Fatalf("invalid security buffer %d", i)
+	}
+	return msg[offset : offset+length]
+}
+
+func TestNTLMAuthenticateMessage(t *testing.T) {
+	timestamp := "0090d336b734c301"
+	withTimestamp := ntlmHex(t, "07000800"+timestamp+"00000000")
+
+	tests := []struct {
+		name       string
+		flags      uint32
+		targetInfo []byte
+		domain     []byte
+		user       []byte
+	}{
+		{"unicode with server time", ntlmNegotiateUnicode | ntlmNegotiateNTLM | 0x00000010, withTimestamp, []byte("D\x00o\x00m\x00"), []byte("u\x00\x7a\x01\x00\x00")},
+		{"oem without server time", ntlmNegotiateOEM | ntlmNegotiateNTLM, nil, []byte("Dom"), []byte("uź\x00")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseNTLMChallenge(ntlmTestChallenge(tt.flags, tt.targetInfo))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user := "uź\x00"
+			msg, err := ntlmAuthenticateMessage(c, "Dom", user, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 3 {
+				t.Fatalf("got header %x", msg[:12])
+			}
+			if flags := binary.LittleEndian.Uint32(msg[60:]); flags != tt.flags&ntlmNegotiateFlags {
+				t.Errorf("got flags %x, want %x", flags, tt.flags&ntlmNegotiateFlags)
+			}
+			if got := ntlmField(t, msg, 2); !bytes.Equal(got, tt.domain) {
+				t.Errorf("got domain %x, want %x", got, tt.domain)
+			}
+			if got := ntlmField(t, msg, 3); !bytes.Equal(got, tt.user) {
+				t.Errorf("got user %x, want %x", got, tt.user)
+			}
+			if ws, session := ntlmField(t, msg, 4), ntlmField(t, msg, 5); len(ws) != 0 || len(session) != 0 {
+				t.Errorf("got workstation %x, session key %x", ws, session)
+			}
+
+			// proof of NTLMv2 response verifies with key of the credentials
+			key := ntlmV2Key("Dom", user, "secret")
+			nt := ntlmField(t, msg, 1)
+			blob := nt[16:]
+			mac := hmac.New(md5.New, key)
+			mac.Write(c.serverChallenge)
+			mac.Write(blob)
+			if !hmac.Equal(nt[:16], mac.Sum(nil)) {
+				t.Error("NTProofStr doesn't verify")
+			}
+			clientChallenge := blob[16:24]
+			if !bytes.Equal(blob[28:len(blob)-4], c.targetInfo) {
+				t.Errorf("blob carries target info %x, want %x", blob[28:len(blob)-4], c.targetInfo)
+			}
+
+			lm := ntlmField(t, msg, 0)
+			if c.timestamp() != nil {
+				if hex.EncodeToString(blob[8:16]) != timestamp {
+					t.Errorf("blob has time %x, want server time %s", blob[8:16], timestamp)
+				}
+				if !bytes.Equal(lm, make([]byte, 24)) {
+					t.Errorf("LMv2 response isn't zero with server time, got %x", lm)
+				}
+				return
+			}
+
+			mac = hmac.New(md5.New, key)
+			mac.Write(c.serverChallenge)
+			mac.Write(clientChallenge)
+			if !bytes.Equal(lm, append(mac.Sum(nil), clientChallenge...)) {
+				t.Errorf("got LMv2 response %x", lm)
+			}
+		})
+	}
+}
+
+func TestNTLMFiletime(t *testing.T) {
+	tests := []struct {
+		time time.Time
+		want uint64
+	}{
+		{time.Unix(0, 0), 116444736000000000},
+		{time.Unix(1, 100), 116444736010000001},
+		{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 133485408000000000},
+	}
+
+	for _, tt := range tests {
+		if got := binary.LittleEndian.Uint64(ntlmFiletime(tt.time)); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.time, got, tt.want)
+		}
+	}
+}
+
+func TestNTLMUnicode(t *testing.T) {
+	tests := map[string]string{
+		"":     "",
+		"User": "5500730065007200",
+		"ź":    "7a01",
+		"😀":    "3dd800de",
+	}
+
+	for s, want := range tests {
+		if got := hex.EncodeToString(ntlmUnicode(s)); got != want {
+			t.Errorf("%q: got %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestSplitNTLMUser(t *testing.T) {
+	tests := []struct {
+		username string
+		domain   string
+		user     string
+	}{
+		{`CORP\john`, "CORP", "john"},
+		{"john@corp.example.com", "", "john@corp.example.com"},
+		{"john", "", "john"},
+		{`\john`, "", "john"},
+		{`CORP\sub\john`, "CORP", `sub\john`},
+	}
+
+	for _, tt := range tests {
+		domain, user := splitNTLMUser(tt.username)
+		if domain != tt.domain || user != tt.user {
+			t.Errorf("%s: got %q, %q, want %q, %q", tt.username, domain, user, tt.domain, tt.user)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// authorizationOAuth2 is authorization type fetching token with OAuth 2.0
+// client credentials grant
+const authorizationOAuth2 = "oauth2"
+
+const (
+	// oauth2RefreshMargin is how long before expiry token is refreshed, at
+	// most half of its lifetime
+	oauth2RefreshMargin = 30 * time.Second
+	oauth2ResponseLimit = 64 << 10
+)
+
+// oauth2Source fetches access token from token endpoint and caches it until
+// it's about to expire. It's shared by copies of target (e.g. edges), so
+// token is fetched once for all of them.
+type oauth2Source struct {
+	tokenURL     string
+	clientID     string
+	clientSecret secret
+	scopes       []string
+	client       *http.Client
+
+	mu      sync.Mutex
+	token   secret
+	refresh time.Time
+}
+
+func newOAuth2Source(a authorization, timeout time.Duration) *oauth2Source {
+	return &oauth2Source{
+		tokenURL:     a.TokenURL,
+		clientID:     a.ClientID,
+		clientSecret: a.ClientSecret,
+		scopes:       a.Scopes,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: http.DefaultTransport,
+		},
+	}
+}
+
+// header returns value of Authorization header with cached token, token is
+// fetched when there is none or it's about to expire
+func (o *oauth2Source) header(ctx context.Context) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.token.isEmpty() || (!o.refresh.IsZero() && !time.Now().Before(o.refresh)) {
+		if err := o.fetch(ctx); err != nil {
+			return "", err
+		}
+	}
+	return "Bearer " + o.token.reveal(), nil
+}
+
+// invalidate drops cached token rejected by server, token fetched
+// meanwhile by other check is kept
+func (o *oauth2Source) invalidate(header string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.token.isEmpty() && "Bearer "+o.token.reveal() == header {
+		o.token.wipe()
+		o.token = secret{}
+	}
+}
+
+func (o *oauth2Source) fetch(ctx context.Context) error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(o.scopes) > 0 {
+		form.Set("scope", strings.Join(o.scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.New(fmt.Sprintf("oauth2: %s", err))
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// client credentials are form encoded as required by RFC 6749 section 2.3.1
+	req.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.clientSecret.reveal()))
+
+	requested := time.Now()
+	res, err := o.client.Do(req)
+	if err != nil {
+		return errors.New(fmt.Sprintf("oauth2: token request failed: %s", err))
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, oauth2ResponseLimit))
+	if err != nil {
+		return errors.New(fmt.Sprintf("oauth2: token request failed: %s", err))
+	}
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	jsonErr := json.Unmarshal(body, &token)
+	clear(body)
+
+	if res.StatusCode != http.StatusOK {
+		reason := res.Status
+		if token.Error != "" {
+			reason = fmt.Sprintf("%s (%s)", res.Status, strings.TrimSpace(token.Error+" "+token.ErrorDescription))
+		}
+		return errors.New(fmt.Sprintf("oauth2: token endpoint responded %s", reason))
+	}
+	if jsonErr != nil {
+		return errors.New(fmt.Sprintf("oauth2: invalid token response: %s", jsonErr))
+	}
+	if token.AccessToken == "" {
+		return errors.New("oauth2: token response has no access_token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return errors.New(fmt.Sprintf("oauth2: unsupported token type \"%s\"", token.TokenType))
+	}
+
+	o.token.wipe()
+	o.token = newSecret(token.AccessToken)
+	o.refresh = time.Time{}
+	// token without expires_in is used until it's rejected
+	if token.ExpiresIn > 0 {
+		lifetime := time.Duration(token.ExpiresIn) * time.Second
+		o.refresh = requested.Add(lifetime - min(oauth2RefreshMargin, lifetime/2))
+	}
+	return nil
+}
+
+func (o *oauth2Source) wipe() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.token.wipe()
+	o.token = secret{}
+}
+
+// checkOAuth2 validates fields of oauth2 authorization
+func (a authorization) checkOAuth2() error {
+	if a.Username != "" || !a.Password.isEmpty() || !a.Token.isEmpty() || a.Header != "" || !a.Value.isEmpty() {
+		return errors.New("\"username\", \"password\", \"token\", \"header\" and \"value\" are not available for oauth2 authorization")
+	}
+	if a.TokenURL == "" || a.ClientID == "" || a.ClientSecret.isEmpty() {
+		return errors.New("\"token-url\", \"client-id\" and \"client-secret\" are required for oauth2 authorization")
+	}
+
+	u, err := url.Parse(a.TokenURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New(fmt.Sprintf("invalid oauth2 \"token-url\" \"%s\", expected http or https url", a.TokenURL))
+	}
+	return nil
+}
+
+func (a authorization) hasOAuth2Fields() bool {
+	return a.TokenURL != "" || a.ClientID != "" || !a.ClientSecret.isEmpty() || len(a.Scopes) > 0
+}
@@ -0,0 +1,105 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// pacing runs steps of check made of several requests (header matrix
+// combinations or tls server names) one by one, with think time between
+// them like user going through them, within deadline of the whole check
+type pacing struct {
+	// ThinkTime is pause between steps, e.g. 2s
+	ThinkTime string `yaml:"think-time"`
+	// Deadline bounds the whole check, steps which didn't start before it
+	// fail without request, default timeout of every step and think times
+	Deadline string `yaml:"deadline"`
+
+	thinkTime time.Duration
+	deadline  time.Duration
+}
+
+// errPacingDeadline is error of steps which didn't start before deadline
+var errPacingDeadline = errors.New("deadline of check exceeded before step started")
+
+// prepare validates pacing of check with steps, each bounded by timeout
+func (p *pacing) prepare(steps int, timeout time.Duration) error {
+	if p.ThinkTime != "" {
+		d, err := time.ParseDuration(p.ThinkTime)
+		if err != nil || d < 0 {
+			return errors.New(fmt.Sprintf("invalid pacing think time \"%s\", expected duration e.g. 2s or 500ms", p.ThinkTime))
+		}
+		p.thinkTime = d
+	}
+
+	p.deadline = time.Duration(steps)*timeout + time.Duration(steps-1)*p.thinkTime
+	if p.Deadline != "" {
+		d, err := time.ParseDuration(p.Deadline)
+		if err != nil || d <= 0 {
+			return errors.New(fmt.Sprintf("invalid pacing deadline \"%s\", expected positive duration e.g. 30s", p.Deadline))
+		}
+		p.deadline = d
+	}
+
+	return nil
+}
+
+// checkTimeout returns bound of the whole check of target
+func checkTimeout(target *targetInfo) time.Duration {
+	if target.Pacing != nil {
+		return target.Pacing.deadline
+	}
+	return target.timeout
+}
+
+// runSteps runs step for every name and returns their results by name.
+// Steps run at once without pacing, otherwise one by one in order of names.
+func runSteps(ctx context.Context, p *pacing, names []string, step func(ctx context.Context, name string) checkResult) map[string]checkResult {
+	results := make(map[string]checkResult, len(names))
+
+	if p == nil {
+		var (
+			mu sync.Mutex
+			wg sync.WaitGroup
+		)
+		for _, name := range names {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				r := step(ctx, name)
+
+				mu.Lock()
+				results[name] = r
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+		return results
+	}
+
+	for i, name := range names {
+		if i > 0 && p.thinkTime > 0 {
+			timer := time.NewTimer(p.thinkTime)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			r := checkResult{err: err}
+			if errors.Is(err, context.DeadlineExceeded) {
+				r = checkResult{err: errPacingDeadline, status: statusTimeout}
+			}
+			results[name] = r
+			continue
+		}
+		results[name] = step(ctx, name)
+	}
+	return results
+}
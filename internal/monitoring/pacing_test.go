@@ -0,0 +1,147 @@
+package monitoring
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunStepsPaced(t *testing.T) {
+	p := &pacing{ThinkTime: "30ms"}
+	if err := p.prepare(3, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu     sync.Mutex
+		order  []string
+		starts []time.Time
+	)
+	results := runSteps(context.Background(), p, []string{"a", "b", "c"}, func(ctx context.Context, name string) checkResult {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, name)
+		starts = append(starts, time.Now())
+		return checkResult{status: name}
+	})
+
+	if strings.Join(order, ",") != "a,b,c" {
+		t.Errorf("got order %v", order)
+	}
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap < 30*time.Millisecond {
+			t.Errorf("step %d started %s after previous one, want think time 30ms", i, gap)
+		}
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if results[name].status != name {
+			t.Errorf("%s: got result %+v", name, results[name])
+		}
+	}
+}
+
+func TestRunStepsDeadline(t *testing.T) {
+	p := &pacing{ThinkTime: "50ms", Deadline: "80ms"}
+	if err := p.prepare(3, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.deadline)
+	defer cancel()
+
+	var started []string
+	results := runSteps(ctx, p, []string{"a", "b", "c"}, func(ctx context.Context, name string) checkResult {
+		started = append(started, name)
+		return checkResult{}
+	})
+
+	if strings.Join(started, ",") != "a,b" {
+		t.Errorf("got started steps %v, want a,b", started)
+	}
+	r := results["c"]
+	if r.err != errPacingDeadline {
+		t.Fatalf("got error %v, want %v", r.err, errPacingDeadline)
+	}
+	if r.status != statusTimeout {
+		t.Errorf("got status %q, want %q", r.status, statusTimeout)
+	}
+}
+
+func TestRunStepsWithoutPacing(t *testing.T) {
+	// every step waits for all of them, so they have to run at once
+	var wg sync.WaitGroup
+	wg.Add(3)
+	results := runSteps(context.Background(), nil, []string{"a", "b", "c"}, func(ctx context.Context, name string) checkResult {
+		wg.Done()
+		wg.Wait()
+		return checkResult{status: name}
+	})
+	if len(results) != 3 || results["b"].status != "b" {
+		t.Errorf("got results %+v", results)
+	}
+}
+
+func TestPacingPrepare(t *testing.T) {
+	p := &pacing{ThinkTime: "2s"}
+	if err := p.prepare(3, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// 3 steps of 5s and 2 think times
+	if p.deadline != 19*time.Second {
+		t.Errorf("got default deadline %s, want 19s", p.deadline)
+	}
+
+	for _, target := range []string{
+		"{url: https://example.com, pacing: {think-time: 1s}}",
+		"{url: https://example.com, header-matrix: {Accept-Language: [en, de]}, pacing: {think-time: -1s}}",
+		"{url: https://example.com, header-matrix: {Accept-Language: [en, de]}, pacing: {deadline: 0s}}",
+		"{url: https://example.com, tls: {server-names: [a.example.com]}, pacing: {think-time: x}}",
+	} {
+		if _, err := ParseTargets([]byte("target: " + target + "\n")); err == nil || !strings.Contains(err.Error(), "pacing") {
+			t.Errorf("%s: got error %v, want pacing error", target, err)
+		}
+	}
+
+	targets, err := ParseTargets([]byte("target: {url: https://example.com, timeout: 2s, tls: {server-names: [a.example.com, b.example.com]}, pacing: {think-time: 1s}}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := checkTimeout(targets.inner["target"]); got != 5*time.Second {
+		t.Errorf("got timeout of check %s, want 5s", got)
+	}
+}
+
+func TestHeaderMatrixPaced(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		languages []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		languages = append(languages, r.Header.Get("Accept-Language"))
+		mu.Unlock()
+		if r.Header.Get("Accept-Language") == "pl" {
+			time.Sleep(300 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	targets, err := ParseTargets([]byte("target: {url: '" + server.URL + "', timeout: 1s, header-matrix: {Accept-Language: [de, en, pl, xx]}, pacing: {think-time: 10ms, deadline: 200ms}}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := targets.CheckOnce("target")
+	mu.Lock()
+	if strings.Join(languages, ",") != "de,en,pl" {
+		t.Errorf("got requests %v, want de,en,pl", languages)
+	}
+	mu.Unlock()
+	if data.Variants["en"].LastStatus != "200 OK" || data.Variants["pl"].LastStatus != statusTimeout || data.Variants["xx"].LastStatus != statusTimeout {
+		t.Errorf("got statuses en %q, pl %q, xx %q", data.Variants["en"].LastStatus, data.Variants["pl"].LastStatus, data.Variants["xx"].LastStatus)
+	}
+}
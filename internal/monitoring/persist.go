@@ -0,0 +1,136 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/ellezio/zcm/pkg/store"
+)
+
+// persistedState is state of target kept in store besides its history
+type persistedState struct {
+	Data         TargetData
+	Availability []persistedBucket `json:",omitempty"`
+	SLOFine      []persistedBucket `json:",omitempty"`
+	SLOCoarse    []persistedBucket `json:",omitempty"`
+}
+
+type persistedBucket struct {
+	Start    time.Time
+	Checks   int
+	Failures int
+}
+
+// UseStore restores state of targets saved in store, it must be called
+// before StartMonitoring. State is restored only when definition of target
+// didn't change since it was saved, see SaveState.
+func (t *Targets) UseStore(s store.Store) error {
+	records, err := s.Load()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.store = s
+	t.restored = records
+	return err
+}
+
+// SaveState saves state and history of running targets to store given to UseStore
+func (t *Targets) SaveState() error {
+	t.mu.RLock()
+	s := t.store
+	monitors := make([]*monitor, 0, len(t.monitors))
+	for _, m := range t.monitors {
+		monitors = append(monitors, m)
+	}
+	t.mu.RUnlock()
+
+	if s == nil {
+		return nil
+	}
+
+	records := make(map[string]store.Record, len(monitors))
+	for _, m := range monitors {
+		r, err := t.record(m)
+		if err != nil {
+			slog.Warn("saving state of target failed", "target", m.key, "err", err)
+			continue
+		}
+		records[m.key] = r
+	}
+
+	return s.Save(records)
+}
+
+func (t *Targets) record(m *monitor) (store.Record, error) {
+	data, _ := t.GetData(m.key)
+	data.Running = false
+
+	state := persistedState{Data: data}
+	m.availability.mu.Lock()
+	state.Availability = persistBuckets(m.availability.buckets)
+	m.availability.mu.Unlock()
+	m.slo.mu.Lock()
+	state.SLOFine, state.SLOCoarse = persistBuckets(m.slo.fine), persistBuckets(m.slo.coarse)
+	m.slo.mu.Unlock()
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return store.Record{}, err
+	}
+
+	entries := m.history.snapshot()
+	history := make([]store.HistoryEntry, len(entries))
+	for i, e := range entries {
+		history[i] = store.HistoryEntry(e)
+	}
+
+	return store.Record{Fingerprint: m.fingerprint, State: b, History: history}, nil
+}
+
+// restore must be called with t.mu held, record is used at most once,
+// so target changed and changed back by reloads starts from scratch
+func (t *Targets) restore(m *monitor) {
+	r, ok := t.restored[m.key]
+	if !ok {
+		return
+	}
+	delete(t.restored, m.key)
+
+	if r.Fingerprint != m.fingerprint {
+		slog.Info("saved state of target discarded, its definition changed", "target", m.key)
+		return
+	}
+
+	var state persistedState
+	if err := json.Unmarshal(r.State, &state); err != nil {
+		slog.Warn("saved state of target is invalid", "target", m.key, "err", err)
+		return
+	}
+
+	for _, e := range r.History {
+		m.history.add(HistoryEntry(e), m.target.History)
+	}
+	m.availability.buckets = restoreBuckets(state.Availability)
+	m.slo.fine, m.slo.coarse = restoreBuckets(state.SLOFine), restoreBuckets(state.SLOCoarse)
+
+	state.Data.Running = false
+	t.data.Store(m.key, state.Data)
+}
+
+func persistBuckets(buckets []availabilityBucket) []persistedBucket {
+	p := make([]persistedBucket, len(buckets))
+	for i, b := range buckets {
+		p[i] = persistedBucket{Start: b.start, Checks: b.checks, Failures: b.failures}
+	}
+	return p
+}
+
+func restoreBuckets(p []persistedBucket) []availabilityBucket {
+	buckets := make([]availabilityBucket, len(p))
+	for i, b := range p {
+		buckets[i] = availabilityBucket{start: b.Start, checks: b.Checks, failures: b.Failures}
+	}
+	return buckets
+}
@@ -0,0 +1,162 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	checkTypeICMP = "icmp"
+	checkTypeTCP  = "tcp"
+
+	// defaultProbeTimeout is used by icmp and tcp checks when target has no timeout
+	defaultProbeTimeout = time.Second
+)
+
+// checkTCP measures time to establish TCP connection with target's host and port
+func checkTCP(ctx context.Context, target *targetInfo, host string, state *monitorState) checkResult {
+	addr := net.JoinHostPort(host, strconv.Itoa(target.Port))
+
+	release, err := state.limiter.acquire(ctx, addr)
+	if err != nil {
+		return checkResult{err: err}
+	}
+	defer release()
+
+	dialer := &net.Dialer{}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+
+	result := checkResult{responseTime: time.Since(start)}
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	if target.TCPInfo {
+		result.tcp, _ = readTCPInfo(conn)
+	}
+	conn.Close()
+
+	return result
+}
+
+// checkICMP sends ICMP echo request to host and waits for the reply. Unprivileged
+// ping socket is used when system allows it (net.ipv4.ping_group_range on linux),
+// otherwise raw socket which requires CAP_NET_RAW.
+func checkICMP(ctx context.Context, host string, state *monitorState) checkResult {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		addrs, err := state.dns.lookupHost(ctx, host)
+		if err != nil {
+			return checkResult{err: err}
+		}
+		ip = net.ParseIP(addrs[0])
+	}
+
+	v4 := ip.To4() != nil
+	conn, privileged, err := listenICMP(v4)
+	if err != nil {
+		return checkResult{err: errors.New(fmt.Sprintf("error while opening icmp socket, error: %s", err))}
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	var idSeq [4]byte
+	rand.Read(idSeq[:])
+	id, seq := int(binary.BigEndian.Uint16(idSeq[:2])), int(binary.BigEndian.Uint16(idSeq[2:]))
+	payload := []byte("zcm-" + strconv.Itoa(seq))
+
+	var (
+		echoType  icmp.Type = ipv4.ICMPTypeEcho
+		replyType icmp.Type = ipv4.ICMPTypeEchoReply
+		proto               = 1
+	)
+	if !v4 {
+		echoType, replyType, proto = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply, 58
+	}
+
+	msg := icmp.Message{Type: echoType, Body: &icmp.Echo{ID: id, Seq: seq, Data: payload}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return checkResult{err: err}
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	if privileged {
+		dst = &net.IPAddr{IP: ip}
+	}
+
+	start := time.Now()
+	if _, err := conn.WriteTo(b, dst); err != nil {
+		return checkResult{responseTime: time.Since(start), err: err}
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return checkResult{responseTime: time.Since(start), err: err}
+		}
+
+		reply, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || reply.Type != replyType || !sameIP(peer, ip) {
+			continue
+		}
+
+		// kernel rewrites id of unprivileged ping sockets, so reply is matched by seq and payload
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || echo.Seq != seq || !bytes.Equal(echo.Data, payload) || (privileged && echo.ID != id) {
+			continue
+		}
+
+		return checkResult{responseTime: time.Since(start)}
+	}
+}
+
+func listenICMP(v4 bool) (*icmp.PacketConn, bool, error) {
+	network, address, rawNetwork := "udp4", "0.0.0.0", "ip4:icmp"
+	if !v4 {
+		network, address, rawNetwork = "udp6", "::", "ip6:ipv6-icmp"
+	}
+
+	conn, err := icmp.ListenPacket(network, address)
+	if err == nil {
+		return conn, false, nil
+	}
+
+	conn, rawErr := icmp.ListenPacket(rawNetwork, address)
+	if rawErr != nil {
+		return nil, false, errors.Join(err, rawErr)
+	}
+	return conn, true, nil
+}
+
+func sameIP(addr net.Addr, ip net.IP) bool {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.Equal(ip)
+	case *net.IPAddr:
+		return a.IP.Equal(ip)
+	}
+	return false
+}
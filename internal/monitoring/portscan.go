@@ -0,0 +1,135 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	checkTypePortScan = "portscan"
+
+	defaultPortTimeout = 1000
+	portScanWorkers    = 64
+)
+
+// parsePorts parses comma separated ports and port ranges, e.g. 22,80,8000-8100
+func parsePorts(spec string) ([]int, error) {
+	var ports []int
+	seen := map[int]bool{}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid port \"%s\"", part))
+		}
+
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid port range \"%s\"", part))
+			}
+		}
+
+		if first < 1 || last > 65535 || first > last {
+			return nil, errors.New(fmt.Sprintf("port \"%s\" out of range 1-65535", part))
+		}
+
+		for p := first; p <= last; p++ {
+			if !seen[p] {
+				seen[p] = true
+				ports = append(ports, p)
+			}
+		}
+	}
+
+	slices.Sort(ports)
+	return ports, nil
+}
+
+func formatPorts(ports []int) string {
+	s := make([]string, len(ports))
+	for i, p := range ports {
+		s[i] = strconv.Itoa(p)
+	}
+	return strings.Join(s, ",")
+}
+
+// checkPortScan connects to every configured port of target's host
+// and compares set of open ports with expected one
+func checkPortScan(ctx context.Context, target *targetInfo) checkResult {
+	timeout := time.Millisecond * time.Duration(target.PortTimeout)
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		open []int
+		jobs = make(chan int)
+	)
+
+	start := time.Now()
+	for i := 0; i < min(portScanWorkers, len(target.scanPorts)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for port := range jobs {
+				conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(target.Host, strconv.Itoa(port)))
+				if err != nil {
+					continue
+				}
+				conn.Close()
+
+				mu.Lock()
+				open = append(open, port)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, port := range target.scanPorts {
+		jobs <- port
+	}
+	close(jobs)
+	wg.Wait()
+
+	result := checkResult{responseTime: time.Since(start)}
+	if err := ctx.Err(); err != nil {
+		result.err = err
+		return result
+	}
+
+	slices.Sort(open)
+	result.openPorts = open
+
+	for _, p := range open {
+		if !slices.Contains(target.expectedPorts, p) {
+			result.addedPorts = append(result.addedPorts, p)
+		}
+	}
+	for _, p := range target.expectedPorts {
+		if !slices.Contains(open, p) {
+			result.removedPorts = append(result.removedPorts, p)
+		}
+	}
+
+	if len(result.addedPorts) > 0 || len(result.removedPorts) > 0 {
+		result.assertErr = errors.New(fmt.Sprintf("open ports differ from expected, added: [%s], removed: [%s]",
+			formatPorts(result.addedPorts), formatPorts(result.removedPorts)))
+	}
+
+	return result
+}
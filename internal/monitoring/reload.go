@@ -0,0 +1,224 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const reloadDebounce = 500 * time.Millisecond
+
+// Reload reads targets file again and applies changes to running monitors,
+// removed targets are stopped, added are started and changed are restarted
+// with fresh state. On error previous configuration is kept.
+func (t *Targets) Reload() error {
+	if t.path == "" {
+		return errors.New("targets were not loaded from file")
+	}
+
+	t.reloadMu.Lock()
+	defer t.reloadMu.Unlock()
+
+	tm, err := readTargets(t.path, t.env)
+	if err != nil {
+		return err
+	}
+
+	if err := checkAndPrepareTargets(&tm); err != nil {
+		wipeTargets(tm)
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// targets added at runtime are kept unless file defines target of the same name
+	merged := make(targetsMetadata, len(tm)+len(t.runtime))
+	for name, target := range tm {
+		merged[name] = target
+	}
+	for name := range t.runtime {
+		if _, ok := tm[name]; ok {
+			slog.Warn("target added at runtime is replaced by target of targets file", "target", name)
+			continue
+		}
+		merged[name] = t.inner[name]
+	}
+
+	fp, err := fingerprint(merged)
+	if err != nil {
+		wipeTargets(tm)
+		return err
+	}
+
+	t.loaded = true
+	if fp == t.fingerprint {
+		wipeTargets(tm)
+		return nil
+	}
+
+	var added, removed, changed int
+
+	for name, old := range t.inner {
+		if _, ok := merged[name]; !ok {
+			t.stopMonitor(name)
+			old.wipeSecrets()
+			removed++
+		}
+	}
+
+	for name, target := range tm {
+		old, ok := t.inner[name]
+		if ok && sameTarget(old, target) {
+			// keep running monitor along with its state
+			target.wipeSecrets()
+			tm[name] = old
+			continue
+		}
+
+		if ok {
+			t.stopMonitor(name)
+			old.wipeSecrets()
+			changed++
+		} else {
+			added++
+		}
+
+		if t.running {
+			t.startMonitor(name, target)
+		}
+	}
+
+	for name := range t.runtime {
+		if _, ok := tm[name]; ok {
+			delete(t.runtime, name)
+		}
+	}
+	for name, target := range tm {
+		merged[name] = target
+	}
+
+	t.inner = merged
+	t.fingerprint = fp
+
+	slog.Info("targets reloaded", "added", added, "removed", removed, "changed", changed, "fingerprint", fp)
+	return nil
+}
+
+func sameTarget(a, b *targetInfo) bool {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(ab, bb) && sameSecrets(a, b)
+}
+
+// ConfigFiles returns targets file and its environment overlay, if any
+func (t *Targets) ConfigFiles() []string {
+	files := []string{t.path}
+	if t.env != "" {
+		files = append(files, overlayPath(t.path, t.env))
+	}
+	return files
+}
+
+// WatchConfig reloads targets whenever targets file or its environment overlay changes.
+// Parent directories are watched, so files replaced by editors or ConfigMap updates are picked up.
+// Watching stops with context given to StartMonitoring.
+func (t *Targets) WatchConfig() error {
+	if t.path == "" {
+		return errors.New("targets were not loaded from file")
+	}
+
+	files := t.ConfigFiles()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	watched := map[string]bool{}
+	dirs := map[string]bool{}
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			watcher.Close()
+			return err
+		}
+		watched[abs] = true
+
+		dir := filepath.Dir(abs)
+		if !dirs[dir] {
+			if err := watcher.Add(dir); err != nil {
+				watcher.Close()
+				return err
+			}
+			dirs[dir] = true
+		}
+	}
+
+	reload := func() {
+		if err := t.Reload(); err != nil {
+			slog.Error("targets reload failed, keeping previous configuration", "err", err)
+		}
+	}
+
+	t.mu.RLock()
+	ctx := t.ctx
+	t.mu.RUnlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var timer *time.Timer
+		for {
+			select {
+			case <-ctx.Done():
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				// kubernetes swaps ..data symlink when ConfigMap is updated
+				if !watched[filepath.Clean(event.Name)] && filepath.Base(event.Name) != "..data" {
+					continue
+				}
+
+				// editors emit several events per save
+				if timer == nil {
+					timer = time.AfterFunc(reloadDebounce, reload)
+				} else {
+					timer.Reset(reloadDebounce)
+				}
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("targets watcher error", "err", err)
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	checkTypeRobots = "robots"
+
+	// robotsSizeLimit is size of robots.txt crawlers are required to parse
+	// (RFC 9309), rules after it may be ignored
+	robotsSizeLimit = 500 << 10
+)
+
+// robotsResult summarizes robots.txt fetched by robots check
+type robotsResult struct {
+	// sitemaps is number of sitemaps listed in robots.txt
+	sitemaps int
+	// disallowAll is set when rules for all crawlers disallow whole site
+	disallowAll bool
+}
+
+// fetchDocument requests target's url and reads up to limit bytes of body,
+// truncated is set when body is longer, body is nil on error status
+func fetchDocument(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState, limit int) (result checkResult, body []byte, truncated bool) {
+	req, err := newRequest(ctx, target)
+	if err != nil {
+		return checkResult{err: err}, nil, false
+	}
+	return fetchResponse(ctx, client, req, state, limit)
+}
+
+// fetchResponse sends req and reads up to limit bytes of body like fetchDocument
+func fetchResponse(ctx context.Context, client *http.Client, req *http.Request, state *monitorState, limit int) (result checkResult, body []byte, truncated bool) {
+	req = state.stats.instrument(req)
+	req, timing := traceTiming(req)
+
+	release, err := state.limiter.acquire(ctx, hostKey(req.URL))
+	if err != nil {
+		return checkResult{err: err}, nil, false
+	}
+	defer release()
+
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return checkResult{responseTime: time.Since(start), timing: timing.finish(), err: err}, nil, false
+	}
+	defer res.Body.Close()
+
+	body, err = io.ReadAll(io.LimitReader(bodyReader{r: res.Body}, int64(limit)+1))
+
+	result = checkResult{responseTime: time.Since(start), timing: timing.finish(), responseSize: int64(len(body))}
+	result.status = res.Status
+	result.statusCode = res.StatusCode
+
+	if err != nil {
+		result.err = err
+		return result, nil, false
+	}
+	if res.StatusCode >= 300 {
+		return result, nil, false
+	}
+
+	if len(body) > limit {
+		return result, body[:limit], true
+	}
+	return result, body, false
+}
+
+// checkRobots fetches robots.txt and validates its syntax, check fails
+// when any line is invalid
+func checkRobots(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState) checkResult {
+	result, body, truncated := fetchDocument(ctx, client, target, state, robotsSizeLimit)
+	if body == nil {
+		return result
+	}
+
+	var syntaxErrors []string
+	if truncated {
+		syntaxErrors = append(syntaxErrors, fmt.Sprintf("file exceeds %d bytes, crawlers may ignore the rest", robotsSizeLimit))
+	}
+	result.robots, syntaxErrors = parseRobots(string(body), syntaxErrors)
+
+	result.syntaxErrors = len(syntaxErrors)
+	if len(syntaxErrors) > 0 {
+		result.assertErr = errors.New(fmt.Sprintf("%d syntax errors in robots.txt, first %s", len(syntaxErrors), syntaxErrors[0]))
+	}
+
+	return result
+}
+
+// parseRobots validates robots.txt line by line and appends description
+// of every invalid line to syntaxErrors, unknown fields are valid as
+// crawlers ignore them
+func parseRobots(body string, syntaxErrors []string) (robotsResult, []string) {
+	var (
+		result robotsResult
+
+		// inGroup is set after user-agent line, rules are valid only in group
+		inGroup bool
+		// groupRules is set once current group has rules, next user-agent starts new group
+		groupRules bool
+		// allAgents is set when current group applies to every crawler
+		allAgents bool
+	)
+
+	for i, line := range strings.Split(body, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		invalid := func(reason string) {
+			syntaxErrors = append(syntaxErrors, fmt.Sprintf("line %d: %s", i+1, reason))
+		}
+
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			invalid("missing colon after field name")
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			if groupRules || !inGroup {
+				inGroup, groupRules, allAgents = true, false, false
+			}
+			if value == "" {
+				invalid("empty user-agent")
+			}
+			if value == "*" {
+				allAgents = true
+			}
+		case "allow", "disallow":
+			if !inGroup {
+				invalid(fmt.Sprintf("%s rule before any user-agent", field))
+				continue
+			}
+			groupRules = true
+			if value != "" && !strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "*") {
+				invalid(fmt.Sprintf("%s path \"%s\" doesn't start with /", field, value))
+			}
+			if allAgents && field == "disallow" && value == "/" {
+				result.disallowAll = true
+			}
+		case "crawl-delay":
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				invalid(fmt.Sprintf("invalid crawl-delay \"%s\"", value))
+			}
+		case "sitemap":
+			u, err := url.Parse(value)
+			if err != nil || !u.IsAbs() {
+				invalid(fmt.Sprintf("sitemap \"%s\" is not absolute url", value))
+				continue
+			}
+			result.sitemaps++
+		}
+	}
+
+	return result, syntaxErrors
+}
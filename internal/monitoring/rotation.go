@@ -0,0 +1,89 @@
+package monitoring
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type targetUrl struct {
+	Name   string `yaml:"name"`
+	Url    string `yaml:"url"`
+	Weight int    `yaml:"weight"`
+}
+
+// rotation keeps last results of target's urls and picks url for next check
+type rotation struct {
+	current map[string]int
+	states  map[string]*monitorState
+	results map[string]checkResult
+}
+
+// checkRotation checks one of target's urls picked by smooth weighted round-robin,
+// urls with equal weights are checked in turns. Result of the worst url among
+// last results of all urls is used as target's result.
+func checkRotation(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState) checkResult {
+	if state.rotation == nil {
+		state.rotation = &rotation{
+			current: map[string]int{},
+			states:  map[string]*monitorState{},
+			results: map[string]checkResult{},
+		}
+	}
+	r := state.rotation
+
+	picked, total := target.Urls[0], 0
+	for i, u := range target.Urls {
+		r.current[u.Name] += u.Weight
+		total += u.Weight
+
+		if i == 0 || r.current[u.Name] > r.current[picked.Name] {
+			picked = u
+		}
+	}
+	r.current[picked.Name] -= total
+
+	// each url keeps its own validators
+	urlState, ok := r.states[picked.Name]
+	if !ok {
+		urlState = &monitorState{limiter: state.limiter, stats: state.stats, dns: state.dns}
+		r.states[picked.Name] = urlState
+	}
+
+	urlTarget := *target
+	urlTarget.Url = picked.Url
+	urlTarget.Urls = nil
+
+	result := runSingleCheck(ctx, client, &urlTarget, urlState)
+	result.finished = time.Now()
+	r.results[picked.Name] = result
+
+	var (
+		worst     string
+		worstRes  checkResult
+		isChecked bool
+		variants  = make(map[string]checkResult, len(r.results))
+		failing   int
+	)
+	for _, u := range target.Urls {
+		res, ok := r.results[u.Name]
+		if !ok {
+			continue
+		}
+		variants[u.Name] = res
+
+		if res.failed() {
+			failing++
+		}
+		if !isChecked || isWorse(res, worstRes) {
+			worst, worstRes, isChecked = u.Name, res, true
+		}
+	}
+
+	combined := worstRes
+	combined.variants = variants
+	combined.worstVariant = worst
+	combined.failingVariants = failing
+
+	return combined
+}
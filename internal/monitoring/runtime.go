@@ -0,0 +1,223 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrTargetExists is returned when added target's name is already used
+	ErrTargetExists = errors.New("target already exists")
+	// ErrTargetNotFound is returned for unknown target
+	ErrTargetNotFound = errors.New("target not found")
+	// ErrFileTarget is returned when target defined in targets file
+	// would be changed at runtime
+	ErrFileTarget = errors.New("target is defined in targets file")
+)
+
+// AddTarget adds target at runtime from yaml (or json) document with
+// single target in format of targets file, e.g. {"api": {"url": "..."}}.
+// It returns name of the target. Targets added at runtime are kept on
+// reload of targets file unless the file defines target of the same name.
+func (t *Targets) AddTarget(doc []byte) (string, error) {
+	tm := targetsMetadata{}
+	if err := unmarshalRuntime(doc, &tm); err != nil {
+		return "", err
+	}
+	if len(tm) != 1 {
+		wipeTargets(tm)
+		return "", errors.New(fmt.Sprintf("expected single target, got %d", len(tm)))
+	}
+
+	for name, target := range tm {
+		if _, err := t.putTarget(name, target, false); err != nil {
+			target.wipeSecrets()
+			return "", err
+		}
+		return name, nil
+	}
+	return "", nil
+}
+
+// PutTarget adds or replaces target added at runtime from yaml (or json)
+// definition of the target, it returns true when target was created
+func (t *Targets) PutTarget(name string, definition []byte) (bool, error) {
+	target := &targetInfo{}
+	if err := unmarshalRuntime(definition, target); err != nil {
+		return false, err
+	}
+
+	created, err := t.putTarget(name, target, true)
+	if err != nil {
+		target.wipeSecrets()
+	}
+	return created, err
+}
+
+func (t *Targets) putTarget(name string, target *targetInfo, replace bool) (bool, error) {
+	if strings.TrimSpace(name) == "" || strings.ContainsAny(name, "[]\"") {
+		return false, errors.New(fmt.Sprintf("invalid target name \"%s\"", name))
+	}
+	if err := checkRuntimeTarget(name, target); err != nil {
+		return false, err
+	}
+	if err := checkAndPrepareTarget(name, target); err != nil {
+		return false, err
+	}
+
+	t.reloadMu.Lock()
+	defer t.reloadMu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	old, exists := t.inner[name]
+	switch {
+	case exists && !t.runtime[name]:
+		return false, ErrFileTarget
+	case exists && !replace:
+		return false, ErrTargetExists
+	case exists && sameTarget(old, target):
+		target.wipeSecrets()
+		return false, nil
+	}
+
+	if exists {
+		t.stopMonitor(name)
+		old.wipeSecrets()
+	}
+
+	inner := make(targetsMetadata, len(t.inner)+1)
+	for k, v := range t.inner {
+		inner[k] = v
+	}
+	inner[name] = target
+
+	fp, err := fingerprint(inner)
+	if err != nil {
+		return false, err
+	}
+
+	if t.runtime == nil {
+		t.runtime = map[string]bool{}
+	}
+	t.runtime[name] = true
+	t.inner = inner
+	t.fingerprint = fp
+
+	if t.running {
+		t.startMonitor(name, target)
+	}
+
+	slog.Info("target set at runtime", "target", name, "created", !exists, "fingerprint", fp)
+	return !exists, nil
+}
+
+// unmarshalRuntime decodes target added at runtime, values substituted by
+// content of files of agent host are rejected, they could be sent to any host
+func unmarshalRuntime(data []byte, out interface{}) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc.Kind == 0 {
+		return nil
+	}
+	if err := decryptSecrets(&doc); err != nil {
+		return err
+	}
+	if err := checkRuntimeValues(&doc); err != nil {
+		return err
+	}
+	return doc.Decode(out)
+}
+
+func checkRuntimeValues(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && fileRegexp.MatchString(node.Value) {
+		return errors.New("{file:...} substitution is not allowed in targets added at runtime")
+	}
+	for _, n := range node.Content {
+		if err := checkRuntimeValues(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRuntimeTarget rejects parts of target which would let caller of admin
+// API run commands, read or write files of agent host, they're allowed only
+// in targets file
+func checkRuntimeTarget(k string, v *targetInfo) error {
+	if v.Type == checkTypeExec {
+		return errors.New(fmt.Sprintf("%s: exec targets can't be added at runtime", k))
+	}
+
+	files := [][2]string{
+		{"authorization.password-file", v.Authorization.PasswordFile},
+		{"authorization.token-file", v.Authorization.TokenFile},
+		{"proxy-authorization.password-file", v.ProxyAuthorization.PasswordFile},
+	}
+	if v.Golden != nil {
+		files = append(files, [2]string{"golden.file", v.Golden.File})
+	}
+	if v.TLS != nil {
+		files = append(files, [2]string{"tls.ca-file", v.TLS.CAFile}, [2]string{"tls.cert-file", v.TLS.CertFile}, [2]string{"tls.key-file", v.TLS.KeyFile})
+	}
+	for _, f := range files {
+		if f[1] != "" {
+			return errors.New(fmt.Sprintf("%s: \"%s\" can't be set in targets added at runtime", k, f[0]))
+		}
+	}
+
+	return nil
+}
+
+// RemoveTarget stops and removes target added at runtime
+func (t *Targets) RemoveTarget(name string) error {
+	t.reloadMu.Lock()
+	defer t.reloadMu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	target, ok := t.inner[name]
+	switch {
+	case !ok:
+		return ErrTargetNotFound
+	case !t.runtime[name]:
+		return ErrFileTarget
+	}
+
+	inner := make(targetsMetadata, len(t.inner))
+	for k, v := range t.inner {
+		if k != name {
+			inner[k] = v
+		}
+	}
+
+	fp, err := fingerprint(inner)
+	if err != nil {
+		return err
+	}
+
+	t.stopMonitor(name)
+	target.wipeSecrets()
+	delete(t.runtime, name)
+	t.inner = inner
+	t.fingerprint = fp
+
+	slog.Info("target removed at runtime", "target", name, "fingerprint", fp)
+	return nil
+}
+
+// IsRuntime reports whether target was added at runtime, not by targets file
+func (t *Targets) IsRuntime(name string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.runtime[name]
+}
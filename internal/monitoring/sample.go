@@ -0,0 +1,50 @@
+package monitoring
+
+import "time"
+
+// SampleStats aggregates executions of target's check reported as one sample
+type SampleStats struct {
+	Size     int
+	Failures int
+
+	MinResponseTime time.Duration
+	AvgResponseTime time.Duration
+	MaxResponseTime time.Duration
+}
+
+// sampler collects results of checks until target's sample size is reached
+type sampler struct {
+	results []checkResult
+}
+
+// add records result and returns combined result with sample stats once
+// sample is complete. Combined result is the last failed one or the last one
+// when none failed, with response time averaged over the sample.
+func (s *sampler) add(result checkResult, size int) (checkResult, SampleStats, bool) {
+	s.results = append(s.results, result)
+	if len(s.results) < size {
+		return checkResult{}, SampleStats{}, false
+	}
+
+	stats := SampleStats{Size: len(s.results)}
+	combined := s.results[len(s.results)-1]
+
+	var total time.Duration
+	for i, r := range s.results {
+		if i == 0 || r.responseTime < stats.MinResponseTime {
+			stats.MinResponseTime = r.responseTime
+		}
+		stats.MaxResponseTime = max(stats.MaxResponseTime, r.responseTime)
+		total += r.responseTime
+
+		if r.failed() {
+			stats.Failures++
+			combined = r
+		}
+	}
+	stats.AvgResponseTime = total / time.Duration(len(s.results))
+	combined.responseTime = stats.AvgResponseTime
+
+	s.results = s.results[:0]
+	return combined, stats, true
+}
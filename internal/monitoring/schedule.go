@@ -0,0 +1,97 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"time"
+)
+
+// prepareSchedule validates cron schedule, jitter and start offset of
+// target k, the latter de-synchronize checks of targets with the same interval
+func prepareSchedule(k string, v *targetInfo) error {
+	interval := time.Millisecond * time.Duration(v.Interval)
+
+	if v.Schedule != "" {
+		cron, err := parseCron(v.Schedule)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+		if cron.next(time.Now()).IsZero() {
+			return errors.New(fmt.Sprintf("%s: schedule \"%s\" never matches", k, v.Schedule))
+		}
+		v.cron = cron
+
+		switch {
+		case v.StartOffset != "":
+			return errors.New(fmt.Sprintf("%s: \"start-offset\" can't be combined with schedule", k))
+		case v.AdaptiveInterval != nil:
+			return errors.New(fmt.Sprintf("%s: \"adaptive-interval\" can't be combined with schedule", k))
+		case v.CircuitBreaker != nil:
+			return errors.New(fmt.Sprintf("%s: \"circuit-breaker\" can't be combined with schedule", k))
+		}
+
+		// scheduled checks can be a minute apart, longer jitter would skip them
+		interval = time.Minute
+	}
+
+	if v.Jitter != "" {
+		jitter, err := time.ParseDuration(v.Jitter)
+		if err != nil || jitter <= 0 || jitter > interval {
+			return errors.New(fmt.Sprintf("%s: invalid jitter \"%s\", expected positive duration not longer than interval e.g. 500ms or 2s", k, v.Jitter))
+		}
+		v.jitter = jitter
+	}
+
+	switch v.StartOffset {
+	case "":
+	case "auto":
+		v.startOffset = autoStartOffset(k, interval)
+	default:
+		offset, err := time.ParseDuration(v.StartOffset)
+		if err != nil || offset < 0 {
+			return errors.New(fmt.Sprintf("%s: invalid start offset \"%s\", expected auto or duration e.g. 1500ms or 5s", k, v.StartOffset))
+		}
+		v.startOffset = offset
+	}
+
+	return nil
+}
+
+// autoStartOffset spreads first checks of targets over interval by hash of
+// target's name, so the offset is the same after restart or reload
+func autoStartOffset(name string, interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+// firstDelay returns delay of the first check after start of monitoring
+func (t *targetInfo) firstDelay(now time.Time) time.Duration {
+	if t.cron != nil {
+		return untilScheduled(t.cron, now)
+	}
+	return t.startOffset
+}
+
+// untilScheduled returns delay before the next scheduled check, schedule
+// which doesn't match within years is checked again after a day
+func untilScheduled(cron *cronSchedule, now time.Time) time.Duration {
+	next := cron.next(now)
+	if next.IsZero() {
+		return 24 * time.Hour
+	}
+	return next.Sub(now)
+}
+
+// withJitter adds random delay up to target's jitter to interval
+func (t *targetInfo) withJitter(interval time.Duration) time.Duration {
+	if t.jitter <= 0 {
+		return interval
+	}
+	return interval + rand.N(t.jitter)
+}
@@ -0,0 +1,98 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// maxScriptSteps bounds execution of script, so endless loop can't stall monitor
+const maxScriptSteps = 1_000_000
+
+// scriptPredeclared are modules available to scripts besides Starlark builtins
+var scriptPredeclared = starlark.StringDict{
+	"json": json.Module,
+}
+
+// compileScript executes top level of target's Starlark script and returns
+// its check function, which receives response and tells whether it passed
+func compileScript(name, src string) (starlark.Callable, error) {
+	thread := &starlark.Thread{Name: name}
+	thread.SetMaxExecutionSteps(maxScriptSteps)
+
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, name, src, scriptPredeclared)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error while loading script, error: %s", scriptErrorMessage(err)))
+	}
+	globals.Freeze()
+
+	check, ok := globals["check"].(starlark.Callable)
+	if !ok {
+		return nil, errors.New("script must define check(response) function")
+	}
+
+	return check, nil
+}
+
+// runScript calls target's check function with response, check passes when
+// function returns None or True, False or string (used as message) fails it,
+// as does error raised by fail()
+func runScript(ctx context.Context, target *targetInfo, res *http.Response, body []byte, result checkResult) error {
+	thread := &starlark.Thread{Name: "check"}
+	thread.SetMaxExecutionSteps(maxScriptSteps)
+
+	stop := context.AfterFunc(ctx, func() { thread.Cancel(ctx.Err().Error()) })
+	defer stop()
+
+	headers := starlark.NewDict(len(res.Header))
+	for name, values := range res.Header {
+		headers.SetKey(starlark.String(strings.ToLower(name)), starlark.String(strings.Join(values, ", ")))
+	}
+
+	response := starlarkstruct.FromStringDict(starlark.String("response"), starlark.StringDict{
+		"status_code":      starlark.MakeInt(result.statusCode),
+		"status":           starlark.String(result.status),
+		"headers":          headers,
+		"body":             starlark.String(body),
+		"response_time_ms": starlark.MakeInt64(result.responseTime.Milliseconds()),
+	})
+	response.Freeze()
+
+	value, err := starlark.Call(thread, target.scriptCheck, starlark.Tuple{response}, nil)
+	if err != nil {
+		return errors.New(fmt.Sprintf("script: %s", scriptErrorMessage(err)))
+	}
+
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil
+	case starlark.Bool:
+		if v {
+			return nil
+		}
+		return errors.New("script: check returned False")
+	case starlark.String:
+		if v == "" {
+			return nil
+		}
+		return errors.New(fmt.Sprintf("script: %s", string(v)))
+	}
+
+	return errors.New(fmt.Sprintf("script: check returned %s, expected None, bool or string", value.Type()))
+}
+
+// scriptErrorMessage strips Starlark backtrace from error
+func scriptErrorMessage(err error) string {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return evalErr.Msg
+	}
+	return err.Error()
+}
@@ -0,0 +1,245 @@
+package monitoring
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+const ageArmorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+
+// sopsValueRegexp matches value encrypted by sops, e.g.
+// ENC[AES256_GCM,data:...,iv:...,tag:...,type:str]
+var sopsValueRegexp = regexp.MustCompile(`^ENC\[AES256_GCM,data:([^,]*),iv:([^,]+),tag:([^,]+),type:([a-z]+)\]$`)
+
+type sopsMetadata struct {
+	Age []struct {
+		Recipient string `yaml:"recipient"`
+		Enc       string `yaml:"enc"`
+	} `yaml:"age"`
+}
+
+// unmarshalDecrypted decodes yaml document into out after decrypting its secrets,
+// which are either whole document encrypted by sops with age or
+// separate values armored by age, see decryptSecrets
+func unmarshalDecrypted(data []byte, out interface{}) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	// empty document
+	if doc.Kind == 0 {
+		return nil
+	}
+
+	if err := decryptSecrets(&doc); err != nil {
+		return err
+	}
+
+	return doc.Decode(out)
+}
+
+// decryptSecrets replaces encrypted values of document with their plaintext.
+// Age identities are read from SOPS_AGE_KEY, SOPS_AGE_KEY_FILE or sops'
+// default keys file, only when document contains encrypted values.
+// Values of sops document are authenticated one by one, sops' MAC of whole
+// document isn't verified.
+func decryptSecrets(doc *yaml.Node) error {
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	d := &decrypter{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "sops" {
+			continue
+		}
+
+		var meta sopsMetadata
+		if err := root.Content[i+1].Decode(&meta); err != nil {
+			return errors.New(fmt.Sprintf("invalid sops metadata, error: %s", err))
+		}
+
+		key, err := d.sopsDataKey(meta)
+		if err != nil {
+			return err
+		}
+		d.dataKey = key
+
+		root.Content = append(root.Content[:i], root.Content[i+2:]...)
+		break
+	}
+
+	return d.walk(root, nil)
+}
+
+type decrypter struct {
+	identities []age.Identity
+	// dataKey decrypts values of sops document, nil for other documents
+	dataKey []byte
+}
+
+func (d *decrypter) walk(node *yaml.Node, path []string) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyPath := append(append([]string{}, path...), node.Content[i].Value)
+			if err := d.walk(node.Content[i+1], keyPath); err != nil {
+				return err
+			}
+		}
+
+	case yaml.SequenceNode:
+		// sops doesn't add index of item to path
+		for _, item := range node.Content {
+			if err := d.walk(item, path); err != nil {
+				return err
+			}
+		}
+
+	case yaml.ScalarNode:
+		if strings.HasPrefix(node.Value, "ENC[") {
+			return d.decryptSopsValue(node, path)
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(node.Value), ageArmorHeader) {
+			plaintext, err := d.decryptAge(node.Value)
+			if err != nil {
+				return errors.New(fmt.Sprintf("%s: error while decrypting age encrypted value, error: %s", strings.Join(path, "."), err))
+			}
+			node.Value = strings.TrimSuffix(string(plaintext), "\n")
+			node.Tag = "!!str"
+			node.Style = 0
+		}
+	}
+
+	return nil
+}
+
+func (d *decrypter) decryptSopsValue(node *yaml.Node, path []string) error {
+	name := strings.Join(path, ".")
+	if d.dataKey == nil {
+		return errors.New(fmt.Sprintf("%s: sops encrypted value found in document without sops metadata", name))
+	}
+
+	m := sopsValueRegexp.FindStringSubmatch(node.Value)
+	if m == nil {
+		return errors.New(fmt.Sprintf("%s: invalid sops encrypted value", name))
+	}
+
+	var parts [3][]byte
+	for i := range parts {
+		b, err := base64.StdEncoding.DecodeString(m[i+1])
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s: invalid sops encrypted value, error: %s", name, err))
+		}
+		parts[i] = b
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+
+	block, err := aes.NewCipher(d.dataKey)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return err
+	}
+
+	// value is bound to its path, e.g. "some-name:authorization:password:"
+	plaintext, err := gcm.Open(nil, iv, append(data, tag...), []byte(strings.Join(path, ":")+":"))
+	if err != nil {
+		return errors.New(fmt.Sprintf("%s: error while decrypting sops value, error: %s", name, err))
+	}
+
+	node.Value = string(plaintext)
+	node.Style = 0
+	switch m[4] {
+	case "int":
+		node.Tag = "!!int"
+	case "float":
+		node.Tag = "!!float"
+	case "bool":
+		node.Tag = "!!bool"
+	default:
+		node.Tag = "!!str"
+	}
+
+	return nil
+}
+
+// sopsDataKey decrypts sops data key with one of available age identities
+func (d *decrypter) sopsDataKey(meta sopsMetadata) ([]byte, error) {
+	if len(meta.Age) == 0 {
+		return nil, errors.New("sops document isn't encrypted for age, other key types are not supported")
+	}
+
+	var errs []error
+	for _, stanza := range meta.Age {
+		key, err := d.decryptAge(stanza.Enc)
+		if err == nil {
+			return key, nil
+		}
+		errs = append(errs, errors.New(fmt.Sprintf("%s: %s", stanza.Recipient, err)))
+	}
+
+	return nil, errors.New(fmt.Sprintf("error while decrypting sops data key, error: %s", errors.Join(errs...)))
+}
+
+func (d *decrypter) decryptAge(armored string) ([]byte, error) {
+	if d.identities == nil {
+		identities, err := loadAgeIdentities()
+		if err != nil {
+			return nil, err
+		}
+		d.identities = identities
+	}
+
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(strings.TrimSpace(armored))), d.identities...)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+// loadAgeIdentities reads age identities the same way as sops does
+func loadAgeIdentities() ([]age.Identity, error) {
+	if key := os.Getenv("SOPS_AGE_KEY"); key != "" {
+		return age.ParseIdentities(strings.NewReader(key))
+	}
+
+	path := os.Getenv("SOPS_AGE_KEY_FILE")
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, errors.New("age key not found, set SOPS_AGE_KEY or SOPS_AGE_KEY_FILE")
+		}
+		path = filepath.Join(dir, "sops", "age", "keys.txt")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error while reading age key file, set SOPS_AGE_KEY or SOPS_AGE_KEY_FILE, error: %s", err))
+	}
+
+	return age.ParseIdentities(bytes.NewReader(data))
+}
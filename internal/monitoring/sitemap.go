@@ -0,0 +1,169 @@
+package monitoring
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	checkTypeSitemap = "sitemap"
+
+	// sitemapSizeLimit and sitemapEntryLimit are limits of single sitemap
+	// set by sitemaps protocol, sitemap is truncated by crawlers beyond them
+	sitemapSizeLimit  = 50 << 20
+	sitemapEntryLimit = 50000
+)
+
+// sitemapLastmodFormats are W3C datetime formats allowed in lastmod
+var sitemapLastmodFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	time.DateOnly,
+	"2006-01",
+	"2006",
+}
+
+// sitemapResult summarizes sitemap fetched by sitemap check
+type sitemapResult struct {
+	// entries is number of urls of sitemap or sitemaps of sitemap index
+	entries int
+	// lastmod is the most recent lastmod of entries, zero when none has it
+	lastmod          time.Time
+	daysSinceLastmod int
+}
+
+type sitemapDocument struct {
+	XMLName  xml.Name
+	Urls     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	Lastmod string `xml:"lastmod"`
+}
+
+// checkSitemap fetches sitemap or sitemap index and validates it, check
+// fails when it is invalid or, with max-days-since-lastmod, when none
+// of its entries was modified recently enough
+func checkSitemap(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState) checkResult {
+	result, body, truncated := fetchDocument(ctx, client, target, state, sitemapSizeLimit)
+	if body == nil {
+		return result
+	}
+
+	// sitemaps are commonly served gzipped as files (sitemap.xml.gz)
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) && !truncated {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err == nil {
+			body, err = io.ReadAll(io.LimitReader(zr, sitemapSizeLimit+1))
+		}
+		if err != nil {
+			result.err = errors.New(fmt.Sprintf("error while decompressing sitemap, error: %s", err))
+			return result
+		}
+		truncated = len(body) > sitemapSizeLimit
+	}
+
+	var syntaxErrors []string
+	if truncated {
+		syntaxErrors = append(syntaxErrors, fmt.Sprintf("sitemap exceeds %d bytes", sitemapSizeLimit))
+	} else {
+		result.sitemap, syntaxErrors = parseSitemap(body)
+	}
+
+	result.syntaxErrors = len(syntaxErrors)
+	if len(syntaxErrors) > 0 {
+		result.assertErr = errors.New(fmt.Sprintf("%d errors in sitemap, first %s", len(syntaxErrors), syntaxErrors[0]))
+		return result
+	}
+
+	if target.MaxDaysSinceLastmod > 0 {
+		if result.sitemap.lastmod.IsZero() {
+			result.assertErr = errors.New("sitemap entries have no lastmod")
+		} else if result.sitemap.daysSinceLastmod > target.MaxDaysSinceLastmod {
+			result.assertErr = errors.New(fmt.Sprintf("sitemap was last modified %d days ago (%s), expected at most %d",
+				result.sitemap.daysSinceLastmod, result.sitemap.lastmod.Format(time.DateOnly), target.MaxDaysSinceLastmod))
+		}
+	}
+
+	return result
+}
+
+// parseSitemap validates urlset or sitemapindex document and returns
+// description of every error found
+func parseSitemap(body []byte) (sitemapResult, []string) {
+	var (
+		result       sitemapResult
+		doc          sitemapDocument
+		syntaxErrors []string
+	)
+
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return result, []string{fmt.Sprintf("invalid xml, %s", err)}
+	}
+
+	entries := doc.Urls
+	switch doc.XMLName.Local {
+	case "urlset":
+		if len(doc.Sitemaps) > 0 {
+			syntaxErrors = append(syntaxErrors, "urlset contains sitemap elements")
+		}
+	case "sitemapindex":
+		if len(doc.Urls) > 0 {
+			syntaxErrors = append(syntaxErrors, "sitemapindex contains url elements")
+		}
+		entries = doc.Sitemaps
+	default:
+		return result, []string{fmt.Sprintf("unexpected root element <%s>, expected <urlset> or <sitemapindex>", doc.XMLName.Local)}
+	}
+
+	result.entries = len(entries)
+	if len(entries) > sitemapEntryLimit {
+		syntaxErrors = append(syntaxErrors, fmt.Sprintf("%d entries exceed limit of %d", len(entries), sitemapEntryLimit))
+	}
+
+	for i, e := range entries {
+		loc := strings.TrimSpace(e.Loc)
+		if u, err := url.Parse(loc); loc == "" || err != nil || !u.IsAbs() {
+			syntaxErrors = append(syntaxErrors, fmt.Sprintf("entry %d: loc \"%s\" is not absolute url", i+1, loc))
+		}
+
+		if e.Lastmod == "" {
+			continue
+		}
+		lastmod, err := parseLastmod(strings.TrimSpace(e.Lastmod))
+		if err != nil {
+			syntaxErrors = append(syntaxErrors, fmt.Sprintf("entry %d: %s", i+1, err))
+			continue
+		}
+		if lastmod.After(result.lastmod) {
+			result.lastmod = lastmod
+		}
+	}
+
+	if !result.lastmod.IsZero() {
+		result.daysSinceLastmod = int(math.Floor(time.Since(result.lastmod).Hours() / 24))
+	}
+
+	return result, syntaxErrors
+}
+
+func parseLastmod(s string) (time.Time, error) {
+	for _, layout := range sitemapLastmodFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("invalid lastmod \"%s\", expected W3C datetime e.g. 2024-05-01", s))
+}
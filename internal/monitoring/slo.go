@@ -0,0 +1,168 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSLOWindow = 30 * 24 * time.Hour
+	// checks are counted in minute buckets over last sloFineSpan, so short
+	// burn rate windows are precise, and in hour buckets over SLO window
+	sloFineBucket   = time.Minute
+	sloFineSpan     = 6 * time.Hour
+	sloCoarseBucket = time.Hour
+)
+
+type slo struct {
+	// Objective is percentage of checks which must be good, e.g. 99.9
+	Objective float64 `yaml:"objective"`
+	// Latency is response time in milliseconds, slower checks are bad
+	// even when they passed, 0 counts only failed checks as bad
+	Latency int `yaml:"latency"`
+	// Window is error budget window, default 720h (30 days)
+	Window string `yaml:"window"`
+
+	window time.Duration
+}
+
+func (s *slo) prepare() error {
+	if s.Objective <= 0 || s.Objective >= 100 {
+		return errors.New(fmt.Sprintf("\"objective\" of slo must be percentage between 0 and 100 exclusive, got %g", s.Objective))
+	}
+	if s.Latency < 0 {
+		return errors.New("\"latency\" of slo can't be negative")
+	}
+
+	s.window = defaultSLOWindow
+	if s.Window != "" {
+		window, err := time.ParseDuration(s.Window)
+		if err != nil || window < sloCoarseBucket {
+			return errors.New(fmt.Sprintf("invalid slo window \"%s\", expected duration of at least 1h e.g. 168h or 720h", s.Window))
+		}
+		s.window = window
+	}
+	return nil
+}
+
+// bad reports whether check counts against error budget
+func (s *slo) bad(result checkResult) bool {
+	return result.failed() || (s.Latency > 0 && result.responseTime > time.Duration(s.Latency)*time.Millisecond)
+}
+
+// sloWindow counts checks and bad checks of target in time buckets
+type sloWindow struct {
+	mu     sync.Mutex
+	fine   []availabilityBucket
+	coarse []availabilityBucket
+}
+
+func (w *sloWindow) add(now time.Time, bad bool, window time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.fine = addToBucket(w.fine, now, sloFineBucket, min(sloFineSpan, window), bad)
+	w.coarse = addToBucket(w.coarse, now, sloCoarseBucket, window, bad)
+}
+
+// count returns number of checks and bad checks within span, spans longer
+// than sloFineSpan are counted in whole hours
+func (w *sloWindow) count(now time.Time, span time.Duration) (checks, bad int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if span <= sloFineSpan {
+		return countBuckets(w.fine, now, sloFineBucket, span)
+	}
+	return countBuckets(w.coarse, now, sloCoarseBucket, span)
+}
+
+// addToBucket counts check in bucket of given size and drops buckets
+// which slid out of span
+func addToBucket(buckets []availabilityBucket, now time.Time, size, span time.Duration, failed bool) []availabilityBucket {
+	start := now.Truncate(size)
+	if n := len(buckets); n == 0 || !buckets[n-1].start.Equal(start) {
+		buckets = append(buckets, availabilityBucket{start: start})
+	}
+
+	b := &buckets[len(buckets)-1]
+	b.checks++
+	if failed {
+		b.failures++
+	}
+
+	i := 0
+	for i < len(buckets) && !buckets[i].start.Add(size).After(now.Add(-span)) {
+		i++
+	}
+	return append(buckets[:0], buckets[i:]...)
+}
+
+func countBuckets(buckets []availabilityBucket, now time.Time, size, span time.Duration) (checks, failures int) {
+	for _, b := range buckets {
+		if b.start.Add(size).After(now.Add(-span)) {
+			checks += b.checks
+			failures += b.failures
+		}
+	}
+	return checks, failures
+}
+
+// SLOStatus is compliance of target with its SLO over SLO window
+type SLOStatus struct {
+	// Compliance is percentage of good checks
+	Compliance float64
+	// ErrorBudget is percentage of error budget left, negative when exhausted
+	ErrorBudget float64
+}
+
+// SLO returns compliance and remaining error budget of running target with
+// slo, false when target has no slo or no check finished within its window
+func (t *Targets) SLO(key string) (SLOStatus, bool) {
+	m, ok := t.sloMonitor(key)
+	if !ok {
+		return SLOStatus{}, false
+	}
+
+	checks, bad := m.slo.count(time.Now(), m.target.SLO.window)
+	if checks == 0 {
+		return SLOStatus{}, false
+	}
+
+	badShare := float64(bad) / float64(checks)
+	return SLOStatus{
+		Compliance:  100 * (1 - badShare),
+		ErrorBudget: 100 * (1 - badShare/(1-m.target.SLO.Objective/100)),
+	}, true
+}
+
+// BurnRate returns how fast target burns its error budget within last
+// window, 1 exhausts the budget exactly at the end of SLO window
+func (t *Targets) BurnRate(key string, window time.Duration) (float64, error) {
+	m, ok := t.sloMonitor(key)
+	if !ok {
+		return 0, errors.New("burn rate is available only for targets with slo")
+	}
+	if window < sloFineBucket || window > m.target.SLO.window {
+		return 0, errors.New(fmt.Sprintf("burn rate window must be between 1m and slo window (%s)", m.target.SLO.window))
+	}
+
+	checks, bad := m.slo.count(time.Now(), window)
+	if checks == 0 {
+		return 0, errors.New("no checks within burn rate window")
+	}
+	return float64(bad) / float64(checks) / (1 - m.target.SLO.Objective/100), nil
+}
+
+func (t *Targets) sloMonitor(key string) (*monitor, bool) {
+	t.mu.RLock()
+	m, ok := t.monitors[key]
+	t.mu.RUnlock()
+
+	if !ok || m.target.SLO == nil {
+		return nil, false
+	}
+	return m, true
+}
@@ -0,0 +1,110 @@
+package monitoring
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+type sniMonitor struct {
+	// target is copy of monitored target with server name in url
+	target *targetInfo
+	client *http.Client
+	state  *monitorState
+}
+
+// checkServerNames requests target's url with every server name used as SNI
+// and Host header, while connecting to host of target's url, to verify that
+// TLS termination serves right certificate and response for each tenant.
+// Result of the worst server name is used as target's result.
+func checkServerNames(ctx context.Context, target *targetInfo, state *monitorState) checkResult {
+	u, err := url.Parse(target.Url)
+	if err != nil {
+		return checkResult{err: err}
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	if state.serverNames == nil {
+		state.serverNames = map[string]*sniMonitor{}
+	}
+
+	for _, name := range target.TLS.ServerNames {
+		if _, ok := state.serverNames[name]; !ok {
+			state.serverNames[name] = newSNIMonitor(addr, name, u, target, state)
+		}
+	}
+
+	results := runSteps(ctx, target.Pacing, target.TLS.ServerNames, func(ctx context.Context, name string) checkResult {
+		sm := state.serverNames[name]
+		return runSingleCheck(ctx, sm.client, sm.target, sm.state)
+	})
+
+	var (
+		worst     string
+		worstRes  checkResult
+		isChecked bool
+	)
+	certificates := map[string]bool{}
+	for _, name := range target.TLS.ServerNames {
+		r := results[name]
+		if !isChecked || isWorse(r, worstRes) {
+			worst, worstRes, isChecked = name, r, true
+		}
+		if r.tlsCertificate != "" {
+			certificates[r.tlsCertificate] = true
+		}
+	}
+
+	result := worstRes
+	result.variants = results
+	result.worstVariant = worst
+	result.distinctCertificates = len(certificates)
+
+	for _, r := range results {
+		if r.failed() {
+			result.failingVariants++
+		}
+	}
+
+	return result
+}
+
+func newSNIMonitor(addr, name string, u *url.URL, target *targetInfo, parent *monitorState) *sniMonitor {
+	su := *u
+	su.Host = name
+	if u.Port() != "" {
+		su.Host = net.JoinHostPort(name, u.Port())
+	}
+
+	variant := *target
+	variant.Url = su.String()
+
+	return &sniMonitor{
+		target: &variant,
+		client: &http.Client{
+			Timeout:   target.timeout,
+			Transport: parent.stats.newTransport(addr, nil, target),
+		},
+		state: &monitorState{limiter: parent.limiter, stats: parent.stats},
+	}
+}
+
+// certificateFingerprint returns sha256 fingerprint of leaf certificate served
+// in connection as hex string, empty when server didn't send any
+func certificateFingerprint(state *tls.ConnectionState) string {
+	if len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	hash := sha256.Sum256(state.PeerCertificates[0].Raw)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,194 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// defaultMaxSubresources is number of subresources fetched by default
+const defaultMaxSubresources = 10
+
+// subresources approximates page health check without browser, critical
+// subresources (stylesheets and scripts) of the same origin referenced
+// by HTML response are fetched after the page
+type subresources struct {
+	// Max is maximum number of fetched subresources, default 10
+	Max int `yaml:"max"`
+	// FailOnBroken fails check when any subresource is broken
+	FailOnBroken bool `yaml:"fail-on-broken"`
+}
+
+// subresourceResult summarizes subresources fetched by check
+type subresourceResult struct {
+	count  int
+	broken int
+	// slowest is url of subresource with the longest response time
+	slowest     string
+	slowestTime time.Duration
+	// firstBroken describes first broken subresource in page order
+	firstBroken string
+}
+
+// checkSubresources fetches subresources referenced by HTML page, page url
+// is url of final response, so relative references resolve like in browser
+func checkSubresources(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState, page *url.URL, body []byte) subresourceResult {
+	urls := subresourceUrls(page, body, target.Subresources.Max)
+
+	type fetched struct {
+		responseTime time.Duration
+		err          error
+	}
+
+	var (
+		wg      sync.WaitGroup
+		results = make([]fetched, len(urls))
+	)
+	for i, u := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := fetchSubresource(ctx, client, target, state, u)
+			results[i] = fetched{responseTime: time.Since(start), err: err}
+		}()
+	}
+	wg.Wait()
+
+	sr := subresourceResult{count: len(urls)}
+	for i, r := range results {
+		if r.err != nil {
+			sr.broken++
+			if sr.firstBroken == "" {
+				sr.firstBroken = fmt.Sprintf("%s: %s", urls[i], r.err)
+			}
+		}
+		if r.responseTime > sr.slowestTime {
+			sr.slowest, sr.slowestTime = urls[i], r.responseTime
+		}
+	}
+
+	return sr
+}
+
+func fetchSubresource(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState, u string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := setAuthorization(ctx, req, target); err != nil {
+		return err
+	}
+	for k, v := range target.Headers {
+		req.Header.Set(k, v)
+	}
+	req = state.stats.instrument(req)
+
+	release, err := state.limiter.acquire(ctx, hostKey(req.URL))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if _, err := io.Copy(io.Discard, res.Body); err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 400 {
+		return errors.New(fmt.Sprintf("unexpected status %s", res.Status))
+	}
+	return nil
+}
+
+// subresourceUrls returns absolute urls of stylesheets and scripts of page's
+// origin in order they are referenced, without duplicates, up to max
+func subresourceUrls(page *url.URL, body []byte, max int) []string {
+	var (
+		urls []string
+		seen = map[string]bool{}
+	)
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for len(urls) < max {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		name, hasAttr := z.TagName()
+		if !hasAttr {
+			continue
+		}
+
+		attrs := map[string]string{}
+		for {
+			key, value, more := z.TagAttr()
+			attrs[string(key)] = string(value)
+			if !more {
+				break
+			}
+		}
+
+		var ref string
+		switch string(name) {
+		case "script":
+			ref = attrs["src"]
+		case "link":
+			if isStylesheet(attrs["rel"]) {
+				ref = attrs["href"]
+			}
+		}
+		if ref == "" {
+			continue
+		}
+
+		u, err := page.Parse(strings.TrimSpace(ref))
+		if err != nil || u.Scheme != page.Scheme || u.Host != page.Host {
+			continue
+		}
+		u.Fragment = ""
+
+		if s := u.String(); !seen[s] {
+			seen[s] = true
+			urls = append(urls, s)
+		}
+	}
+
+	return urls
+}
+
+func isStylesheet(rel string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, "stylesheet") {
+			return true
+		}
+	}
+	return false
+}
+
+// isHTML reports whether response declares HTML content type
+func isHTML(res *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
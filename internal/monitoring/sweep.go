@@ -0,0 +1,170 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+)
+
+const (
+	// maxSweepHosts caps number of hosts generated from subnet, e.g. /20 for IPv4
+	maxSweepHosts = 4096
+	sweepWorkers  = 64
+)
+
+// sweepHosts generates addresses of hosts in subnet, without network
+// and broadcast address of IPv4 subnets, followed by included addresses
+// and subnets. Excluded addresses and subnets are left out.
+func sweepHosts(subnet string, include, exclude []string) ([]string, error) {
+	prefixes := []string{subnet}
+	prefixes = append(prefixes, include...)
+
+	var excluded []netip.Prefix
+	for _, e := range exclude {
+		p, err := parsePrefix(e)
+		if err != nil {
+			return nil, err
+		}
+		excluded = append(excluded, p)
+	}
+
+	var hosts []string
+	seen := map[netip.Addr]bool{}
+	for _, s := range prefixes {
+		p, err := parsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+
+		first, last := p.Addr(), lastAddr(p)
+		// network and broadcast addresses are not hosts
+		if p.Addr().Is4() && p.Bits() < 31 {
+			first, last = first.Next(), last.Prev()
+		}
+
+		for addr := first; addr.IsValid() && addr.Compare(last) <= 0; addr = addr.Next() {
+			if seen[addr] || slices.ContainsFunc(excluded, func(e netip.Prefix) bool { return e.Contains(addr) }) {
+				continue
+			}
+			seen[addr] = true
+
+			hosts = append(hosts, addr.String())
+			if len(hosts) > maxSweepHosts {
+				return nil, errors.New(fmt.Sprintf("subnet sweep exceeds %d hosts", maxSweepHosts))
+			}
+		}
+	}
+
+	if len(hosts) == 0 {
+		return nil, errors.New("subnet sweep doesn't contain any host")
+	}
+
+	return hosts, nil
+}
+
+// parsePrefix parses subnet in CIDR notation or single address
+func parsePrefix(s string) (netip.Prefix, error) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, errors.New(fmt.Sprintf("\"%s\" is neither subnet nor IP address", s))
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// checkSweep runs target's icmp or tcp check against every host generated
+// from target's subnet, results of hosts are reported as variants and
+// result of the worst host is used as target's result
+func checkSweep(ctx context.Context, target *targetInfo, state *monitorState) checkResult {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]checkResult, len(target.sweepHosts))
+		jobs    = make(chan string)
+	)
+
+	for i := 0; i < min(sweepWorkers, len(target.sweepHosts)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for host := range jobs {
+				r := probeHost(ctx, target, host, state)
+
+				mu.Lock()
+				results[host] = r
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, host := range target.sweepHosts {
+		jobs <- host
+	}
+	close(jobs)
+	wg.Wait()
+
+	var (
+		worst     string
+		worstRes  checkResult
+		isChecked bool
+	)
+	for _, host := range target.sweepHosts {
+		if r := results[host]; !isChecked || isWorse(r, worstRes) {
+			worst, worstRes, isChecked = host, r, true
+		}
+	}
+
+	result := worstRes
+	result.variants = results
+	result.worstVariant = worst
+
+	for _, r := range results {
+		if r.failed() {
+			result.failingVariants++
+		}
+	}
+
+	return result
+}
+
+func probeHost(ctx context.Context, target *targetInfo, host string, state *monitorState) checkResult {
+	ctx, cancel := context.WithTimeout(ctx, target.timeout)
+	defer cancel()
+
+	var result checkResult
+	if target.Type == checkTypeTCP {
+		result = checkTCP(ctx, target, host, state)
+	} else {
+		result = checkICMP(ctx, host, state)
+	}
+
+	markTimeout(&result)
+	return result
+}
+
+// SweepHosts returns hosts generated from subnet of target,
+// e.g. for low-level discovery of hosts
+func (t *Targets) SweepHosts(key string) ([]string, bool) {
+	target, ok := t.target(key)
+	if !ok || target.Subnet == "" {
+		return nil, false
+	}
+
+	return slices.Clone(target.sweepHosts), true
+}
@@ -2,151 +2,1197 @@ package monitoring
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ellezio/zcm/pkg/store"
+	"go.starlark.net/starlark"
+	"golang.org/x/net/http/httpguts"
 	"gopkg.in/yaml.v3"
 )
 
 type targetsMetadata map[string]*targetInfo
 
 type targetInfo struct {
+	Type          string            `yaml:"type"`
 	Url           string            `yaml:"url"`
+	Urls          []targetUrl       `yaml:"urls"`
 	Authorization authorization     `yaml:"authorization"`
 	Interval      int               `yaml:"interval"`
+	SampleSize    int               `yaml:"sample-size"`
+	History       int               `yaml:"history"`
+	Timeout       string            `yaml:"timeout"`
 	Method        string            `yaml:"method"`
 	FormData      map[string]string `yaml:"form-data"`
 	Json          string            `yaml:"json"`
+	Headers       map[string]string `yaml:"headers"`
+	Labels        map[string]string `yaml:"labels"`
+	EventTimeout  int               `yaml:"event-timeout"`
+
+	// Jitter is maximum random delay added to every interval
+	Jitter string `yaml:"jitter"`
+	// StartOffset delays the first check, "auto" derives it from name
+	StartOffset string `yaml:"start-offset"`
+	// Schedule is cron expression of checks, it replaces interval
+	Schedule string `yaml:"schedule"`
+
+	// Range is single byte range requested by check, e.g. bytes=0-1023
+	Range string `yaml:"range"`
+
+	CacheValidation bool `yaml:"cache-validation"`
+	CacheStatus     bool `yaml:"cache-status"`
+	StaleAfter      int  `yaml:"stale-after"`
+
+	Edges        []string `yaml:"edges"`
+	ResolveEdges bool     `yaml:"resolve-edges"`
+
+	ExpectBodyContains string `yaml:"expect-body-contains"`
+	ExpectBodyRegex    string `yaml:"expect-body-regex"`
+	BodyMemoryBudget   int    `yaml:"body-memory-budget"`
+
+	// Accept are media types sent in Accept header, response must be
+	// one of them unless ExpectContentType is given
+	Accept            []string `yaml:"accept"`
+	ExpectContentType []string `yaml:"expect-content-type"`
+
+	// HeaderMatrix are values of headers, check runs with every combination
+	HeaderMatrix map[string]headerValues `yaml:"header-matrix"`
+
+	// MaxResponseHeaderBytes limits size of response headers, 0 is
+	// default limit of transport (1 MiB)
+	MaxResponseHeaderBytes int `yaml:"max-response-header-bytes"`
+
+	// BodyError is fail (default) or ignore, whether body read error fails check
+	BodyError string `yaml:"body-error"`
+
+	Extract map[string]string `yaml:"extract"`
+
+	// Script is Starlark source defining check(response) function
+	Script string `yaml:"script"`
+
+	Golden *golden `yaml:"golden"`
+
+	Pacing *pacing `yaml:"pacing"`
+
+	Subresources *subresources `yaml:"subresources"`
+
+	TLS *targetTLS `yaml:"tls"`
+
+	// Proxy is url of proxy requests are sent through, "direct" bypasses
+	// proxy set by environment variables
+	Proxy              string             `yaml:"proxy"`
+	ProxyAuthorization proxyAuthorization `yaml:"proxy-authorization"`
+
+	BypassDNSCache bool `yaml:"bypass-dns-cache"`
+	TCPInfo        bool `yaml:"tcp-info"`
+
+	AdaptiveInterval *adaptiveInterval `yaml:"adaptive-interval"`
+	CircuitBreaker   *circuitBreaker   `yaml:"circuit-breaker"`
+
+	Apdex              *apdex `yaml:"apdex"`
+	AvailabilityWindow string `yaml:"availability-window"`
+	SLO                *slo   `yaml:"slo"`
+
+	ExpectFailure *expectFailure `yaml:"expect-failure"`
+	ExpectStatus  []string       `yaml:"expect-status"`
+
+	Host         string `yaml:"host"`
+	Ports        string `yaml:"ports"`
+	ExpectedOpen string `yaml:"expected-open"`
+	PortTimeout  int    `yaml:"port-timeout"`
+
+	Port    int      `yaml:"port"`
+	Subnet  string   `yaml:"subnet"`
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+
+	Blacklists []string `yaml:"blacklists"`
+
+	Domain             string `yaml:"domain"`
+	RDAPServer         string `yaml:"rdap-server"`
+	MinDaysUntilExpiry int    `yaml:"min-days-until-expiry"`
+
+	// Command is program and its arguments run by exec check, without shell
+	Command         []string `yaml:"command"`
+	ExpectExitCodes []int    `yaml:"expect-exit-codes"`
+
+	MaxDaysSinceLastmod int `yaml:"max-days-since-lastmod"`
+
+	timeout            time.Duration
+	availabilityWindow time.Duration
+	jitter             time.Duration
+	startOffset        time.Duration
+	cron               *cronSchedule
+	expectStatus       []statusRange
+	contentTypes       []mediaRange
+	extractPaths       map[string][]jsonPathStep
+	bodyRegexp         *regexp.Regexp
+	scriptCheck        starlark.Callable
+	tlsConfig          *tls.Config
+	proxy              func(*http.Request) (*url.URL, error)
+	ntlmProxy          *ntlmProxy
+	byteRange          *byteRange
+	requestBody        []byte
+	contentType        string
+	authHeader         secret
+	authHeaderName     string
+	oauth2             *oauth2Source
+	sweepHosts         []string
+	matrixVariants     []matrixVariant
+	scanPorts          []int
+	expectedPorts      []int
+}
+
+type adaptiveInterval struct {
+	MinInterval          int `yaml:"min-interval"`
+	DegradedResponseTime int `yaml:"degraded-response-time"`
 }
 
 type authorization struct {
 	Type     string `yaml:"type"`
 	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	Token    string `yaml:"token"`
+	Password secret `yaml:"password"`
+	Token    secret `yaml:"token"`
+	// PasswordFile and TokenFile are read instead of inline secrets,
+	// e.g. from Docker or Kubernetes secrets
+	PasswordFile string `yaml:"password-file"`
+	TokenFile    string `yaml:"token-file"`
+
+	// apikey sends Value in Header
+	Header string `yaml:"header"`
+	Value  secret `yaml:"value"`
+
+	// oauth2 client credentials grant
+	TokenURL     string   `yaml:"token-url"`
+	ClientID     string   `yaml:"client-id"`
+	ClientSecret secret   `yaml:"client-secret"`
+	Scopes       []string `yaml:"scopes"`
 }
 
-type targetData struct {
-	Start   time.Time
-	Running bool
+type TargetData struct {
+	Start     time.Time
+	Running   bool
+	LastCheck time.Time
+	// Interval is delay before next check, differs from target's interval in adaptive mode
+	Interval time.Duration
+
+	// Sample aggregates checks reported by last sample, zero unless target is sampled
+	Sample SampleStats
+
+	// Apdex is score between 0 and 1 over target's apdex window, zero without apdex
+	Apdex float64
+
+	// Breaker is state of target's circuit breaker (closed, open or half-open),
+	// empty without circuit breaker
+	Breaker string
+
+	// counters since target was started
+	Checks   int64
+	Failures int64
+	Errors   int64
+	// FailedStreak is number of consecutive failed checks, reset by successful one
+	FailedStreak int64
+	// FailingSince is time of the first check of current failed streak
+	FailingSince time.Time
+
+	// LastFailed is set when last check failed due to error, status or assertion
+	LastFailed bool
+	// LastFailure describes why last check failed, empty when it succeeded
+	LastFailure string
+	// LastError is error of last check which got no (complete) response,
+	// e.g. refused connection or DNS failure, empty when it got response
+	LastError string
 
 	LastResponseTime time.Duration
 	LastStatus       string
 	LastStatusCode   int
+
+	LastTimeToFirstEvent time.Duration
+	LastEventReceived    bool
+
+	LastCacheValid      bool
+	LastValidatorStable bool
+
+	LastBodyMatch bool
+
+	// LastGoldenSimilarity is similarity of response to golden response, from 0 to 1
+	LastGoldenSimilarity float64
+	LastGoldenDiffs      []string
+
+	// LastExtracted holds values extracted from json body by name
+	LastExtracted map[string]interface{}
+
+	// LastCacheStatus is normalized cache status (hit, miss, stale, bypass),
+	// empty when response didn't carry cache headers
+	LastCacheStatus string
+	LastCacheAge    int
+
+	LastExpectedFailure bool
+
+	LastOpenPorts    []int
+	LastAddedPorts   []int
+	LastRemovedPorts []int
+
+	LastListed bool
+
+	LastDomainExpiry    time.Time
+	LastDaysUntilExpiry int
+
+	// LastExitCode is exit code of exec check's command, -1 when it didn't exit,
+	// LastOutput its trimmed standard output, number when it's numeric
+	LastExitCode int
+	LastOutput   interface{}
+
+	// LastTLSVersion (e.g. 1.3) and LastTLSCipher are negotiated by last https check
+	LastTLSVersion string
+	LastTLSCipher  string
+	// LastTLSCertificate is sha256 fingerprint of certificate served to last https check
+	LastTLSCertificate string
+
+	LastTCPRTT         time.Duration
+	LastTCPRTTVar      time.Duration
+	LastTCPRetransmits uint32
+
+	// LastSubresources is number of subresources fetched after HTML page,
+	// LastBrokenSubresources of them failed or returned error status
+	LastSubresources           int
+	LastBrokenSubresources     int
+	LastSlowestSubresource     string
+	LastSlowestSubresourceTime time.Duration
+
+	// LastSyntaxErrors is number of errors found in robots.txt or sitemap,
+	// LastSitemaps is number of sitemaps listed in robots.txt
+	LastSyntaxErrors int
+	LastSitemaps     int
+	LastDisallowAll  bool
+
+	// LastLastmod is the most recent lastmod of sitemap's entries
+	LastSitemapEntries   int
+	LastLastmod          time.Time
+	LastDaysSinceLastmod int
+
+	// LastDNSTime and others are durations of phases of last request,
+	// zero when phase didn't happen, e.g. connect of reused connection
+	LastDNSTime      time.Duration
+	LastConnectTime  time.Duration
+	LastTLSTime      time.Duration
+	LastTTFB         time.Duration
+	LastDownloadTime time.Duration
+
+	// LastResponseSize is number of body bytes read in last check
+	LastResponseSize int64
+	// LastContentType is Content-Type header of last response
+	LastContentType string
+	// LastBodyError is error of reading body of last response, also when
+	// target ignores it
+	LastBodyError string
+
+	// LastRangeValid is set when server answered range request with
+	// matching Content-Range and partial body, LastContentRange is its Content-Range
+	LastRangeValid   bool
+	LastContentRange string
+
+	// LastHeadersTooLarge is set when response headers of last check
+	// exceeded target's max-response-header-bytes
+	LastHeadersTooLarge bool
+
+	// LastProductVendor and LastProductVersion identify WinRM service
+	LastProductVendor  string
+	LastProductVersion string
+
+	Variants        map[string]TargetData
+	WorstVariant    string
+	FailingVariants int
+	// DistinctCertificates is number of different certificates served to server names
+	DistinctCertificates int
+}
+
+func LoadTargets(path string, env string) (*Targets, error) {
+	tm, err := readTargets(path, env)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := newTargets(tm)
+	if err != nil {
+		return nil, err
+	}
+
+	t.path = path
+	t.env = env
+	return t, nil
+}
+
+// WaitForTargets returns targets without any target, which are loaded
+// from targets file by Reload once it exists, see Loaded
+func WaitForTargets(path string, env string) *Targets {
+	fp, _ := fingerprint(targetsMetadata{})
+	return &Targets{inner: targetsMetadata{}, fingerprint: fp, stats: newTransportStats(), path: path, env: env}
 }
 
-func LoadTargets(path string) (*Targets, error) {
+func readTargets(path string, env string) (targetsMetadata, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Error while reading file, error: %s", err))
 	}
 
 	tm := targetsMetadata{}
-	if err := yaml.Unmarshal(data, &tm); err != nil {
+	if err := unmarshalDecrypted(data, &tm); err != nil {
+		return nil, err
+	}
+
+	if env != "" {
+		if err := applyEnvOverlay(&tm, overlayPath(path, env)); err != nil {
+			return nil, err
+		}
+	}
+
+	return tm, nil
+}
+
+// ParseTargets creates targets from monitoring targets yaml document
+func ParseTargets(data []byte) (*Targets, error) {
+	tm := targetsMetadata{}
+	if err := unmarshalDecrypted(data, &tm); err != nil {
 		return nil, err
 	}
 
+	return newTargets(tm)
+}
+
+func newTargets(tm targetsMetadata) (*Targets, error) {
 	if err := checkAndPrepareTargets(&tm); err != nil {
 		return nil, err
 	}
 
-	t := &Targets{inner: tm}
+	fp, err := fingerprint(tm)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Targets{inner: tm, fingerprint: fp, stats: newTransportStats(), loaded: true}
 	return t, nil
 }
 
+// fingerprint returns hash of effective targets configuration,
+// it is computed after applying overlays and environment variables
+func fingerprint(tm targetsMetadata) (string, error) {
+	// json encodes map keys in sorted order which makes output deterministic
+	b, err := json.Marshal(tm)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write(b)
+
+	// secrets are redacted in json, so they are hashed separately
+	names := make([]string, 0, len(tm))
+	for name := range tm {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		for _, s := range tm[name].secrets() {
+			value := s.reveal()
+			fmt.Fprintf(h, "%d:%s", len(value), value)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// overlayPath returns path of environment overlay for targets file,
+// e.g. monitoring-targets.yml with env prod gives monitoring-targets.prod.yml
+func overlayPath(path string, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+func applyEnvOverlay(targetsMetadata *targetsMetadata, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error while reading environment overlay, error: %s", err))
+	}
+
+	overlay := map[string]yaml.Node{}
+	if err := unmarshalDecrypted(data, &overlay); err != nil {
+		return err
+	}
+
+	for k, node := range overlay {
+		// null removes target in given environment
+		if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+			delete(*targetsMetadata, k)
+			continue
+		}
+
+		target, ok := (*targetsMetadata)[k]
+		if !ok {
+			target = &targetInfo{}
+			(*targetsMetadata)[k] = target
+		}
+
+		if err := node.Decode(target); err != nil {
+			return errors.New(fmt.Sprintf("%s: error while applying environment overlay, error: %s", k, err))
+		}
+	}
+
+	return nil
+}
+
+const (
+	checkTypeHTTP = "http"
+	checkTypeSSE  = "sse"
+
+	defaultTimeout = 10 * time.Minute
+)
+
+// checkAndPrepareTargets checks targets in order of their names, so the
+// first invalid target reported is always the same
 func checkAndPrepareTargets(targetsMetadata *targetsMetadata) error {
-	for k, v := range *targetsMetadata {
-		if v.Interval == 0 {
-			v.Interval = 10000
+	names := make([]string, 0, len(*targetsMetadata))
+	for name := range *targetsMetadata {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if err := checkAndPrepareTarget(name, (*targetsMetadata)[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkAndPrepareTarget validates target k, fills in defaults and
+// precomputes its unexported fields
+func checkAndPrepareTarget(k string, v *targetInfo) error {
+	if v.Interval == 0 {
+		v.Interval = 10000
+	}
+
+	if v.StaleAfter == 0 {
+		v.StaleAfter = max(3*v.Interval, 60000)
+		if v.Schedule != "" {
+			v.StaleAfter = 60000
+		}
+	}
+
+	if v.SampleSize < 0 {
+		return errors.New(fmt.Sprintf("%s: \"sample-size\" can't be negative", k))
+	}
+
+	if v.History == 0 {
+		v.History = defaultHistorySize
+	} else if v.History < 0 {
+		return errors.New(fmt.Sprintf("%s: \"history\" can't be negative", k))
+	}
+
+	v.availabilityWindow = defaultAvailabilityWindow
+	if v.AvailabilityWindow != "" {
+		window, err := time.ParseDuration(v.AvailabilityWindow)
+		if err != nil || window < time.Minute {
+			return errors.New(fmt.Sprintf("%s: invalid availability window \"%s\", expected duration of at least 1m e.g. 1h or 24h", k, v.AvailabilityWindow))
+		}
+		v.availabilityWindow = window
+	}
+
+	if err := prepareSchedule(k, v); err != nil {
+		return err
+	}
+
+	v.timeout = defaultTimeout
+	if v.Timeout != "" {
+		timeout, err := time.ParseDuration(v.Timeout)
+		if err != nil || timeout <= 0 {
+			return errors.New(fmt.Sprintf("%s: invalid timeout \"%s\", expected positive duration e.g. 5s or 1500ms", k, v.Timeout))
+		}
+		v.timeout = timeout
+	}
+
+	switch v.Type {
+	case "", checkTypeHTTP:
+		v.Type = checkTypeHTTP
+	case checkTypeSSE:
+		if v.EventTimeout == 0 {
+			v.EventTimeout = 10000
+		}
+
+		if v.CacheValidation || v.CacheStatus {
+			return errors.New(fmt.Sprintf("%s: cache validation and cache status are not available for sse check", k))
+		}
+	case checkTypePortScan:
+		if v.Host == "" || v.Ports == "" {
+			return errors.New(fmt.Sprintf("%s: fields \"host\" and \"ports\" are required for portscan check", k))
 		}
 
-		if v.Url == "" {
-			return errors.New(fmt.Sprintf("%s: field url not specifaied", k))
+		if v.Url != "" || len(v.Urls) > 0 || len(v.Edges) > 0 || v.ResolveEdges {
+			return errors.New(fmt.Sprintf("%s: portscan check scans host, url and edges are not available", k))
 		}
 
-		if v.Method == "" {
-			v.Method = http.MethodGet
-		} else {
-			v.Method = strings.ToUpper(v.Method)
-			if !isHTTPMethodSupported(v.Method) {
-				return errors.New(fmt.Sprintf("%s: http method %s not supported", k, v.Method))
+		var err error
+		if v.scanPorts, err = parsePorts(v.Ports); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+		if v.expectedPorts, err = parsePorts(v.ExpectedOpen); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+
+		for _, p := range v.expectedPorts {
+			if !slices.Contains(v.scanPorts, p) {
+				return errors.New(fmt.Sprintf("%s: expected open port %d is not scanned", k, p))
 			}
 		}
 
-		if v.Method == http.MethodPost {
-			if v.Json == "" && v.FormData == nil {
-				return errors.New(fmt.Sprintf("%s: when http method is POST field \"json\" or \"form-data\" is required", k))
+		if v.PortTimeout == 0 {
+			v.PortTimeout = defaultPortTimeout
+		}
+	case checkTypeICMP, checkTypeTCP:
+		if (v.Host == "") == (v.Subnet == "") {
+			return errors.New(fmt.Sprintf("%s: one of fields \"host\" and \"subnet\" is required for %s check", k, v.Type))
+		}
+
+		if v.Url != "" || len(v.Urls) > 0 || len(v.Edges) > 0 || v.ResolveEdges {
+			return errors.New(fmt.Sprintf("%s: %s check probes host, url and edges are not available", k, v.Type))
+		}
+
+		if v.Type == checkTypeTCP && (v.Port < 1 || v.Port > 65535) {
+			return errors.New(fmt.Sprintf("%s: field \"port\" between 1 and 65535 is required for tcp check", k))
+		}
+
+		if v.Timeout == "" {
+			v.timeout = defaultProbeTimeout
+		}
+
+		if v.Subnet != "" {
+			var err error
+			if v.sweepHosts, err = sweepHosts(v.Subnet, v.Include, v.Exclude); err != nil {
+				return errors.New(fmt.Sprintf("%s: %s", k, err))
 			}
+		} else if len(v.Include) > 0 || len(v.Exclude) > 0 {
+			return errors.New(fmt.Sprintf("%s: \"include\" and \"exclude\" are available only with \"subnet\"", k))
+		}
+	case checkTypeDNSBL:
+		if v.Host == "" || len(v.Blacklists) == 0 {
+			return errors.New(fmt.Sprintf("%s: fields \"host\" and \"blacklists\" are required for dnsbl check", k))
+		}
 
-			if v.Json != "" && v.FormData != nil {
-				return errors.New(fmt.Sprintf("%s: field \"json\" and \"form-data\" cannot be filled together", k))
+		if v.Url != "" || len(v.Urls) > 0 || len(v.Edges) > 0 || v.ResolveEdges {
+			return errors.New(fmt.Sprintf("%s: dnsbl check queries host, url and edges are not available", k))
+		}
+
+		for i, zone := range v.Blacklists {
+			if zone == "" || slices.Contains(v.Blacklists[:i], zone) {
+				return errors.New(fmt.Sprintf("%s: blacklist \"%s\" is empty or not unique", k, zone))
 			}
+		}
+	case checkTypeDomain:
+		if v.Domain == "" {
+			return errors.New(fmt.Sprintf("%s: field \"domain\" is required for domain check", k))
+		}
 
-			if v.Json != "" {
-				buf := &bytes.Buffer{}
-				if err := json.Compact(buf, []byte(v.Json)); err != nil {
-					return errors.New(fmt.Sprintf("%s: error while parsing json data, error: %s", k, err))
-				}
-				v.Json = buf.String()
+		if v.Url != "" || len(v.Urls) > 0 || len(v.Edges) > 0 || v.ResolveEdges {
+			return errors.New(fmt.Sprintf("%s: domain check queries rdap server, url and edges are not available", k))
+		}
+
+		if v.RDAPServer == "" {
+			v.RDAPServer = defaultRDAPServer
+		}
+
+		if v.MinDaysUntilExpiry < 0 {
+			return errors.New(fmt.Sprintf("%s: \"min-days-until-expiry\" can't be negative", k))
+		}
+	case checkTypeExec:
+		if len(v.Command) == 0 || v.Command[0] == "" {
+			return errors.New(fmt.Sprintf("%s: field \"command\" is required for exec check", k))
+		}
+
+		if v.Url != "" || len(v.Urls) > 0 || len(v.Edges) > 0 || v.ResolveEdges {
+			return errors.New(fmt.Sprintf("%s: exec check runs command, url and edges are not available", k))
+		}
+
+		for i := range v.Command {
+			if err := replaceWithEnvVar(&v.Command[i]); err != nil {
+				return errors.New(fmt.Sprintf("%s: %s", k, err))
 			}
 		}
 
-		if v.Authorization != (authorization{}) {
-			if v.Authorization.Type == "" {
-				return errors.New(fmt.Sprintf("%s: field \"type\" is required for authorization", k))
+		if len(v.ExpectExitCodes) == 0 {
+			v.ExpectExitCodes = []int{0}
+		}
+
+		if v.Timeout == "" {
+			v.timeout = defaultExecTimeout
+		}
+	case checkTypeRobots, checkTypeSitemap:
+		if v.Method != "" && !strings.EqualFold(v.Method, http.MethodGet) {
+			return errors.New(fmt.Sprintf("%s: %s check fetches url with GET, method %s not available", k, v.Type, v.Method))
+		}
+
+		if v.MaxDaysSinceLastmod < 0 {
+			return errors.New(fmt.Sprintf("%s: \"max-days-since-lastmod\" can't be negative", k))
+		}
+		if v.Type == checkTypeRobots && v.MaxDaysSinceLastmod > 0 {
+			return errors.New(fmt.Sprintf("%s: \"max-days-since-lastmod\" is available only for sitemap check", k))
+		}
+	case checkTypeWinRM:
+		if v.Method != "" || v.Json != "" || v.FormData != nil {
+			return errors.New(fmt.Sprintf("%s: winrm check sends Identify request, \"method\", \"json\" and \"form-data\" are not available", k))
+		}
+
+		if v.ExpectBodyContains != "" || v.ExpectBodyRegex != "" {
+			return errors.New(fmt.Sprintf("%s: body assertions are not available for winrm check", k))
+		}
+	default:
+		return errors.New(fmt.Sprintf("%s: check type %s not supported", k, v.Type))
+	}
+
+	if v.Url == "" && len(v.Urls) == 0 && v.Type != checkTypePortScan && v.Type != checkTypeDNSBL && v.Type != checkTypeDomain &&
+		v.Type != checkTypeICMP && v.Type != checkTypeTCP && v.Type != checkTypeExec {
+		return errors.New(fmt.Sprintf("%s: field url not specifaied", k))
+	}
+
+	if len(v.Urls) > 0 {
+		if v.Url != "" {
+			return errors.New(fmt.Sprintf("%s: field \"url\" and \"urls\" cannot be filled together", k))
+		}
+
+		if len(v.Edges) > 0 || v.ResolveEdges {
+			return errors.New(fmt.Sprintf("%s: edges are not available along with \"urls\"", k))
+		}
+
+		names := map[string]bool{}
+		for i := range v.Urls {
+			u := &v.Urls[i]
+			if u.Url == "" {
+				return errors.New(fmt.Sprintf("%s: url %d not specified", k, i+1))
 			}
 
-			if v.Authorization.Token != "" && (v.Authorization.Username != "" || v.Authorization.Password != "") {
-				return errors.New(fmt.Sprintf("%s: \"token\" cannot be filled along with \"username\" and \"password\"", k))
+			if u.Name == "" {
+				u.Name = u.Url
+			}
+			if names[u.Name] {
+				return errors.New(fmt.Sprintf("%s: url name \"%s\" is not unique", k, u.Name))
+			}
+			names[u.Name] = true
+
+			if u.Weight < 0 {
+				return errors.New(fmt.Sprintf("%s: weight of url \"%s\" can't be negative", k, u.Name))
+			}
+			if u.Weight == 0 {
+				u.Weight = 1
 			}
 
-			if v.Authorization.Token == "" && (v.Authorization.Username == "" || v.Authorization.Password == "") {
-				return errors.New(fmt.Sprintf("%s: token or username and password is required for authorization", k))
+			if err := replaceWithEnvVar(&u.Url); err != nil {
+				return errors.New(fmt.Sprintf("%s: %s", k, err))
 			}
 		}
+	}
 
-		if err := replaceWithEnvVar(&v.Url); err != nil {
-			return err
+	if v.Method == "" {
+		v.Method = http.MethodGet
+	} else {
+		v.Method = strings.ToUpper(v.Method)
+		if !isHTTPMethodSupported(v.Method) {
+			return errors.New(fmt.Sprintf("%s: http method %s not supported", k, v.Method))
 		}
+	}
 
-		if err := replaceWithEnvVar(&v.Authorization.Token); err != nil {
-			return err
+	if v.Method == http.MethodPost && v.Json == "" && v.FormData == nil {
+		return errors.New(fmt.Sprintf("%s: when http method is POST field \"json\" or \"form-data\" is required", k))
+	}
+
+	if !methodAllowsBody(v.Method) && (v.Json != "" || v.FormData != nil) {
+		return errors.New(fmt.Sprintf("%s: fields \"json\" and \"form-data\" are available only with POST, PUT and PATCH methods", k))
+	}
+
+	if v.Method == http.MethodHead && (v.ExpectBodyContains != "" || v.ExpectBodyRegex != "") {
+		return errors.New(fmt.Sprintf("%s: body assertions are not available with HEAD method", k))
+	}
+
+	if methodAllowsBody(v.Method) {
+		if v.Json != "" && v.FormData != nil {
+			return errors.New(fmt.Sprintf("%s: field \"json\" and \"form-data\" cannot be filled together", k))
 		}
 
-		if err := replaceWithEnvVar(&v.Authorization.Password); err != nil {
-			return err
+		if v.Json != "" {
+			buf := &bytes.Buffer{}
+			if err := json.Compact(buf, []byte(v.Json)); err != nil {
+				return errors.New(fmt.Sprintf("%s: error while parsing json data, error: %s", k, err))
+			}
+			v.Json = buf.String()
 		}
+	}
 
-		if err := replaceWithEnvVar(&v.Authorization.Username); err != nil {
-			return err
+	if v.ExpectBodyContains != "" || v.ExpectBodyRegex != "" {
+		if v.Type == checkTypeSSE {
+			return errors.New(fmt.Sprintf("%s: body assertions are not available for sse check", k))
 		}
 
-		if err := replaceWithEnvVar(&v.Authorization.Type); err != nil {
-			return err
+		if v.BodyMemoryBudget == 0 {
+			v.BodyMemoryBudget = defaultBodyMemoryBudget
+		}
+
+		if len(v.ExpectBodyContains) >= v.BodyMemoryBudget {
+			return errors.New(fmt.Sprintf("%s: \"expect-body-contains\" must be shorter than body memory budget (%d bytes)", k, v.BodyMemoryBudget))
+		}
+
+		if v.ExpectBodyRegex != "" {
+			re, err := regexp.Compile(v.ExpectBodyRegex)
+			if err != nil {
+				return errors.New(fmt.Sprintf("%s: error while compiling \"expect-body-regex\", error: %s", k, err))
+			}
+			v.bodyRegexp = re
 		}
 	}
 
+	if len(v.Extract) > 0 {
+		if v.Type != checkTypeHTTP || v.Method == http.MethodHead {
+			return errors.New(fmt.Sprintf("%s: \"extract\" is available only for http check with response body", k))
+		}
+
+		v.extractPaths = make(map[string][]jsonPathStep, len(v.Extract))
+		for name, path := range v.Extract {
+			if !extractNameRegexp.MatchString(name) {
+				return errors.New(fmt.Sprintf("%s: invalid extract name \"%s\"", k, name))
+			}
+
+			steps, err := parseJSONPath(path)
+			if err != nil {
+				return errors.New(fmt.Sprintf("%s: extract %s: %s", k, name, err))
+			}
+			v.extractPaths[name] = steps
+		}
+	}
+
+	if v.Script != "" {
+		if v.Type != checkTypeHTTP {
+			return errors.New(fmt.Sprintf("%s: \"script\" is available only for http check", k))
+		}
+
+		check, err := compileScript(k, v.Script)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+		v.scriptCheck = check
+	}
+
+	if v.TLS != nil {
+		if v.Type != checkTypeHTTP && v.Type != checkTypeWinRM {
+			return errors.New(fmt.Sprintf("%s: \"tls\" is available only for http and winrm checks", k))
+		}
+
+		config, err := v.TLS.clientConfig()
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+		v.tlsConfig = config
+
+		if len(v.TLS.ServerNames) > 0 {
+			if !strings.HasPrefix(v.Url, "https://") {
+				return errors.New(fmt.Sprintf("%s: tls \"server-names\" require https url", k))
+			}
+			if len(v.Urls) > 0 || len(v.Edges) > 0 || v.ResolveEdges {
+				return errors.New(fmt.Sprintf("%s: tls \"server-names\" are not available along with \"urls\" and edges", k))
+			}
+		}
+	}
+
+	if v.Proxy != "" {
+		switch v.Type {
+		case checkTypeHTTP, checkTypeSSE, checkTypeDomain, checkTypeRobots, checkTypeSitemap, checkTypeWinRM:
+		default:
+			return errors.New(fmt.Sprintf("%s: \"proxy\" is not available for %s check", k, v.Type))
+		}
+
+		if len(v.Edges) > 0 || v.ResolveEdges || (v.TLS != nil && len(v.TLS.ServerNames) > 0) {
+			return errors.New(fmt.Sprintf("%s: \"proxy\" is not available along with edges and tls \"server-names\", they connect to addresses directly", k))
+		}
+
+		if err := replaceWithEnvVar(&v.Proxy); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+	}
+
+	if v.Range != "" {
+		if v.Type != checkTypeHTTP || v.Method != http.MethodGet {
+			return errors.New(fmt.Sprintf("%s: \"range\" is available only for http check with GET method", k))
+		}
+
+		if v.CacheValidation {
+			return errors.New(fmt.Sprintf("%s: \"range\" cannot be combined with cache validation", k))
+		}
+
+		r, err := parseByteRange(v.Range)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+		v.byteRange = &r
+	}
+
+	if v.MaxResponseHeaderBytes != 0 {
+		switch v.Type {
+		case checkTypeHTTP, checkTypeSSE, checkTypeRobots, checkTypeSitemap, checkTypeWinRM:
+		default:
+			return errors.New(fmt.Sprintf("%s: \"max-response-header-bytes\" is not available for %s check", k, v.Type))
+		}
+
+		if v.MaxResponseHeaderBytes < 0 {
+			return errors.New(fmt.Sprintf("%s: \"max-response-header-bytes\" can't be negative", k))
+		}
+	}
+
+	if v.BodyError != "" {
+		switch v.Type {
+		case checkTypeHTTP, checkTypeRobots, checkTypeSitemap, checkTypeWinRM:
+		default:
+			return errors.New(fmt.Sprintf("%s: \"body-error\" is not available for %s check", k, v.Type))
+		}
+
+		if v.BodyError != bodyErrorFail && v.BodyError != bodyErrorIgnore {
+			return errors.New(fmt.Sprintf("%s: invalid body-error \"%s\", available: fail, ignore", k, v.BodyError))
+		}
+	}
+
+	proxy, err := proxyFunc(v.Proxy)
+	if err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", k, err))
+	}
+	v.proxy = proxy
+
+	if err := loadSecretFile(&v.ProxyAuthorization.Password, v.ProxyAuthorization.PasswordFile, "password"); err != nil {
+		return errors.New(fmt.Sprintf("%s: proxy authorization %s", k, err))
+	}
+
+	if a := &v.ProxyAuthorization; a.Type != "" || a.Username != "" || !a.Password.isEmpty() {
+		if !strings.EqualFold(a.Type, proxyAuthNTLM) {
+			return errors.New(fmt.Sprintf("%s: proxy authorization type %s not supported, available: NTLM, Basic credentials are given in proxy url", k, a.Type))
+		}
+
+		if v.Proxy == "" || v.Proxy == proxyDirect {
+			return errors.New(fmt.Sprintf("%s: proxy authorization requires \"proxy\" url", k))
+		}
+
+		if err := replaceWithEnvVar(&a.Username); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+		if err := replaceSecretWithEnvVar(&a.Password); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+		if a.Username == "" || a.Password.isEmpty() {
+			return errors.New(fmt.Sprintf("%s: username and password are required for proxy authorization", k))
+		}
+
+		if v.ntlmProxy, err = newNTLMProxy(v.Proxy, *a); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+		v.proxy = nil
+	}
+
+	if v.Golden != nil {
+		if v.Type != checkTypeHTTP || v.Method == http.MethodHead {
+			return errors.New(fmt.Sprintf("%s: \"golden\" is available only for http check with response body", k))
+		}
+
+		if err := v.Golden.prepare(); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+	}
+
+	if sr := v.Subresources; sr != nil {
+		if v.Type != checkTypeHTTP || v.Method == http.MethodHead {
+			return errors.New(fmt.Sprintf("%s: \"subresources\" are available only for http check with response body", k))
+		}
+
+		if sr.Max == 0 {
+			sr.Max = defaultMaxSubresources
+		} else if sr.Max < 0 {
+			return errors.New(fmt.Sprintf("%s: \"max\" of subresources must be positive", k))
+		}
+	}
+
+	if a := v.AdaptiveInterval; a != nil {
+		if a.MinInterval <= 0 || a.MinInterval > v.Interval {
+			return errors.New(fmt.Sprintf("%s: \"min-interval\" of adaptive interval must be between 1 and interval (%d)", k, v.Interval))
+		}
+
+		if a.DegradedResponseTime < 0 {
+			return errors.New(fmt.Sprintf("%s: \"degraded-response-time\" can't be negative", k))
+		}
+	}
+
+	if b := v.CircuitBreaker; b != nil {
+		if b.Failures == 0 {
+			b.Failures = defaultBreakerFailures
+		} else if b.Failures < 0 {
+			return errors.New(fmt.Sprintf("%s: \"failures\" of circuit breaker must be positive", k))
+		}
+
+		if b.OpenInterval == 0 {
+			b.OpenInterval = max(6*v.Interval, minBreakerOpenInterval)
+		} else if b.OpenInterval < v.Interval {
+			return errors.New(fmt.Sprintf("%s: \"open-interval\" of circuit breaker can't be shorter than interval (%d)", k, v.Interval))
+		}
+	}
+
+	if a := v.Apdex; a != nil {
+		if a.Satisfied <= 0 {
+			return errors.New(fmt.Sprintf("%s: \"satisfied\" of apdex must be positive", k))
+		}
+
+		if a.Tolerating == 0 {
+			a.Tolerating = 4 * a.Satisfied
+		} else if a.Tolerating < a.Satisfied {
+			return errors.New(fmt.Sprintf("%s: \"tolerating\" of apdex can't be lower than \"satisfied\"", k))
+		}
+
+		if a.Window == 0 {
+			a.Window = defaultApdexWindow
+		} else if a.Window < 0 {
+			return errors.New(fmt.Sprintf("%s: \"window\" of apdex can't be negative", k))
+		}
+	}
+
+	if v.SLO != nil {
+		if err := v.SLO.prepare(); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+	}
+
+	if e := v.ExpectFailure; e != nil {
+		if len(e.StatusCodes) == 0 && e.Error == "" {
+			return errors.New(fmt.Sprintf("%s: \"status-codes\" or \"error\" is required for expect-failure", k))
+		}
+
+		if e.Error != "" && !isExpectErrorSupported(e.Error) {
+			return errors.New(fmt.Sprintf("%s: expected error %s not supported", k, e.Error))
+		}
+
+		if v.CacheValidation || v.ExpectBodyContains != "" || v.ExpectBodyRegex != "" || v.Script != "" || v.Golden != nil {
+			return errors.New(fmt.Sprintf("%s: expect-failure cannot be combined with cache validation, body assertions, script or golden", k))
+		}
+	}
+
+	if len(v.ExpectStatus) > 0 {
+		if v.Type != checkTypeHTTP {
+			return errors.New(fmt.Sprintf("%s: \"expect-status\" is available only for http check", k))
+		}
+
+		if v.ExpectFailure != nil {
+			return errors.New(fmt.Sprintf("%s: \"expect-status\" cannot be combined with expect-failure", k))
+		}
+
+		var err error
+		if v.expectStatus, err = parseExpectStatus(v.ExpectStatus); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+	}
+
+	if len(v.Accept) > 0 || len(v.ExpectContentType) > 0 {
+		if v.Type != checkTypeHTTP {
+			return errors.New(fmt.Sprintf("%s: \"accept\" and \"expect-content-type\" are available only for http check", k))
+		}
+
+		for name := range v.Headers {
+			if len(v.Accept) > 0 && strings.EqualFold(name, "Accept") {
+				return errors.New(fmt.Sprintf("%s: \"accept\" cannot be combined with Accept header", k))
+			}
+		}
+
+		expected := v.ExpectContentType
+		if len(expected) == 0 {
+			expected = v.Accept
+		}
+
+		var err error
+		if _, err = parseMediaRanges(v.Accept); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+		if v.contentTypes, err = parseMediaRanges(expected); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+	}
+
+	if len(v.HeaderMatrix) > 0 {
+		if v.Type != checkTypeHTTP {
+			return errors.New(fmt.Sprintf("%s: \"header-matrix\" is available only for http check", k))
+		}
+		if len(v.Urls) > 0 || len(v.Edges) > 0 || v.ResolveEdges || (v.TLS != nil && len(v.TLS.ServerNames) > 0) {
+			return errors.New(fmt.Sprintf("%s: \"header-matrix\" is not available along with \"urls\", edges and tls \"server-names\"", k))
+		}
+
+		var err error
+		if v.matrixVariants, err = prepareHeaderMatrix(v); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+	}
+
+	if v.Pacing != nil {
+		steps := len(v.matrixVariants)
+		if v.TLS != nil && len(v.TLS.ServerNames) > 0 {
+			steps = len(v.TLS.ServerNames)
+		}
+		if steps == 0 {
+			return errors.New(fmt.Sprintf("%s: \"pacing\" is available only along with \"header-matrix\" or tls \"server-names\"", k))
+		}
+		if err := v.Pacing.prepare(steps, v.timeout); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+	}
+
+	for _, edge := range v.Edges {
+		if net.ParseIP(edge) == nil {
+			return errors.New(fmt.Sprintf("%s: edge \"%s\" is not valid IP address", k, edge))
+		}
+	}
+
+	if err := loadSecretFile(&v.Authorization.Password, v.Authorization.PasswordFile, "password"); err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", k, err))
+	}
+	if err := loadSecretFile(&v.Authorization.Token, v.Authorization.TokenFile, "token"); err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", k, err))
+	}
+
+	if strings.EqualFold(v.Authorization.Type, authorizationOAuth2) {
+		if v.Type != checkTypeHTTP {
+			return errors.New(fmt.Sprintf("%s: oauth2 authorization is available only for http check", k))
+		}
+
+		for _, field := range []*string{&v.Authorization.TokenURL, &v.Authorization.ClientID} {
+			if err := replaceWithEnvVar(field); err != nil {
+				return errors.New(fmt.Sprintf("%s: %s", k, err))
+			}
+		}
+		if err := replaceSecretWithEnvVar(&v.Authorization.ClientSecret); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+
+		if err := v.Authorization.checkOAuth2(); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+	} else if strings.EqualFold(v.Authorization.Type, authorizationAPIKey) {
+		if err := replaceWithEnvVar(&v.Authorization.Header); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+		if err := replaceSecretWithEnvVar(&v.Authorization.Value); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+
+		if err := v.Authorization.checkAPIKey(v.Headers); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+	} else if v.Authorization.Header != "" || !v.Authorization.Value.isEmpty() {
+		return errors.New(fmt.Sprintf("%s: \"header\" and \"value\" are available only for apikey authorization", k))
+	} else if v.Authorization.hasOAuth2Fields() {
+		return errors.New(fmt.Sprintf("%s: \"token-url\", \"client-id\", \"client-secret\" and \"scopes\" are available only for oauth2 authorization", k))
+	} else if v.Authorization.Type != "" || v.Authorization.Username != "" || !v.Authorization.Password.isEmpty() || !v.Authorization.Token.isEmpty() {
+		if v.Authorization.Type == "" {
+			return errors.New(fmt.Sprintf("%s: field \"type\" is required for authorization", k))
+		}
+
+		if !v.Authorization.Token.isEmpty() && (v.Authorization.Username != "" || !v.Authorization.Password.isEmpty()) {
+			return errors.New(fmt.Sprintf("%s: \"token\" cannot be filled along with \"username\" and \"password\"", k))
+		}
+
+		if v.Authorization.Token.isEmpty() && (v.Authorization.Username == "" || v.Authorization.Password.isEmpty()) {
+			return errors.New(fmt.Sprintf("%s: token or username and password is required for authorization", k))
+		}
+	}
+
+	for name, value := range v.Headers {
+		if err := replaceWithEnvVar(&value); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+		if !httpguts.ValidHeaderFieldName(name) {
+			return errors.New(fmt.Sprintf("%s: invalid header name \"%s\"", k, name))
+		}
+		// otherwise every check would fail while sending request
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return errors.New(fmt.Sprintf("%s: value of header \"%s\" contains invalid characters, e.g. new line", k, name))
+		}
+		v.Headers[name] = value
+	}
+
+	for name, value := range v.Labels {
+		if !labelNameRegexp.MatchString(name) {
+			return errors.New(fmt.Sprintf("%s: invalid label name \"%s\"", k, name))
+		}
+
+		if err := replaceWithEnvVar(&value); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", k, err))
+		}
+		v.Labels[name] = value
+	}
+
+	if err := replaceWithEnvVar(&v.Url); err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", k, err))
+	}
+
+	if err := replaceSecretWithEnvVar(&v.Authorization.Token); err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", k, err))
+	}
+
+	if err := replaceSecretWithEnvVar(&v.Authorization.Password); err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", k, err))
+	}
+
+	if err := replaceWithEnvVar(&v.Authorization.Username); err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", k, err))
+	}
+
+	if err := replaceWithEnvVar(&v.Authorization.Type); err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", k, err))
+	}
+
+	if err := v.prepareRequest(); err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", k, err))
+	}
+
 	return nil
 }
 
+var labelNameRegexp = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
 func isHTTPMethodSupported(method string) bool {
-	return method == http.MethodGet || method == http.MethodPost
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// methodAllowsBody reports whether json or form data can be sent with method
+func methodAllowsBody(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
 }
 
+var envVarRegexp = regexp.MustCompile("{env:([a-zA-Z_]{1}[a-zA-Z_0-9]*)}")
+
+var fileRegexp = regexp.MustCompile("{file:([^{}]+)}")
+
+// replaceWithEnvVar replaces {env:NAME} with value of environment variable
+// and {file:path} with content of file, e.g. secret mounted by Kubernetes
 func replaceWithEnvVar(value *string) error {
-	reg := regexp.MustCompile("{env:([a-zA-Z_]{1}[a-zA-Z_0-9]*)}")
-	matches := reg.FindAllStringSubmatch(*value, -1)
+	matches := envVarRegexp.FindAllStringSubmatch(*value, -1)
 	for _, matched := range matches {
 		envVal := os.Getenv(matched[1])
 		if envVal == "" {
@@ -155,116 +1201,177 @@ func replaceWithEnvVar(value *string) error {
 		*value = strings.ReplaceAll(*value, matched[0], envVal)
 	}
 
+	matches = fileRegexp.FindAllStringSubmatch(*value, -1)
+	for _, matched := range matches {
+		fileVal, err := readSecretFile(matched[1])
+		if err != nil {
+			return err
+		}
+		*value = strings.ReplaceAll(*value, matched[0], fileVal)
+	}
+
 	return nil
 }
 
 type Targets struct {
-	inner targetsMetadata
-	data  sync.Map
+	// path and env of targets file, empty when targets were parsed from memory
+	path string
+	env  string
+
+	data    sync.Map
+	limiter *hostLimiter
+	stats   *transportStats
+	dns     *dnsCache
+
+	eventHandler func(Event)
+	downAfter    int
+
+	// mu guards fields below, they are replaced on reload
+	mu          sync.RWMutex
+	inner       targetsMetadata
+	fingerprint string
+	monitors    map[string]*monitor
+	running     bool
+	// loaded is false until targets file is read, see WaitForTargets
+	loaded bool
+	// ctx is parent of monitors' contexts, given to StartMonitoring
+	ctx context.Context
+	// runtime are names of targets added at runtime, see AddTarget
+	runtime map[string]bool
+	// store keeps state of targets, restored are its records not yet
+	// restored by monitors, see UseStore
+	store    store.Store
+	restored map[string]store.Record
+
+	// loops counts running check loops, see Wait
+	loops sync.WaitGroup
+
+	reloadMu sync.Mutex
 }
 
-func (t *Targets) StartMonitoring() {
-	var wg sync.WaitGroup
+// Loaded reports whether targets file was read, targets returned by
+// WaitForTargets are loaded by the first successful Reload
+func (t *Targets) Loaded() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 
-	for name, target := range t.inner {
-		t.data.Store(name, targetData{})
-		wg.Add(1)
+	return t.loaded
+}
 
-		go func(key string) {
-			defer wg.Done()
+func (t *Targets) Fingerprint() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 
-			client := http.Client{
-				Timeout: time.Minute * 10,
-			}
+	return t.fingerprint
+}
 
-			for {
-				var (
-					body        io.Reader
-					contentType string
-				)
-
-				if target.Method == http.MethodPost {
-					if target.FormData != nil {
-						contentType = "application/x-www-form-urlencoded"
-
-						values := url.Values{}
-						for k, v := range target.FormData {
-							values.Add(k, v)
-						}
-						body = bytes.NewBuffer([]byte(values.Encode()))
-					} else if target.Json != "" {
-						contentType = "application/json"
-						body = bytes.NewBufferString(target.Json)
-					}
-
-				}
-
-				req, _ := http.NewRequest(
-					target.Method,
-					target.Url,
-					body,
-				)
-
-				if contentType != "" {
-					req.Header.Set("Content-Type", contentType+"; charset=utf-8")
-				}
-
-				if target.Authorization.Type != "" {
-					token := target.Authorization.Token
-					if token == "" {
-						auth := target.Authorization.Username + ":" + target.Authorization.Password
-						token = base64.StdEncoding.EncodeToString([]byte(auth))
-					}
-					req.Header.Set("Authorization", target.Authorization.Type+" "+token)
-				}
-
-				if data, ok := t.GetData(key); ok {
-					data.Start = time.Now()
-					data.Running = true
-					t.data.Store(key, data)
-				}
-
-				res, reqErr := client.Do(req)
-
-				var deltaTime time.Duration
-
-				if data, ok := t.GetData(key); ok {
-					deltaTime = time.Since(data.Start)
-					data.LastResponseTime = deltaTime
-					data.Running = false
-
-					if res != nil {
-						data.LastStatus = res.Status
-						data.LastStatusCode = res.StatusCode
-					} else if reqErr != nil {
-						data.LastStatus = ""
-						data.LastStatusCode = 0
-					}
-
-					t.data.Store(key, data)
-				}
-
-				if reqErr != nil {
-					log.Println("request error: ", reqErr)
-				} else {
-					_, _ = io.ReadAll(res.Body)
-					res.Body.Close()
-				}
-
-				time.Sleep(time.Millisecond * time.Duration(target.Interval))
-			}
-		}(name)
+// Names returns sorted names of targets
+func (t *Targets) Names() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	names := make([]string, 0, len(t.inner))
+	for name := range t.inner {
+		names = append(names, name)
 	}
+	slices.Sort(names)
 
-	wg.Wait()
+	return names
 }
 
-func (t *Targets) GetData(key string) (targetData, bool) {
+func (t *Targets) target(key string) (*targetInfo, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	target, ok := t.inner[key]
+	return target, ok
+}
+
+func (t *Targets) TransportStats() TransportStats {
+	return t.stats.snapshot()
+}
+
+// LimitHostConcurrency caps number of simultaneous requests to the same host
+// across all targets, must be called before StartMonitoring
+func (t *Targets) LimitHostConcurrency(limit int) {
+	if limit > 0 {
+		t.limiter = newHostLimiter(limit)
+	}
+}
+
+// CacheDNS enables caching of resolved addresses for TTL of DNS answers
+// clamped to minTTL and maxTTL, must be called before StartMonitoring
+func (t *Targets) CacheDNS(minTTL, maxTTL time.Duration) {
+	t.dns = newDNSCache(minTTL, maxTTL)
+}
+
+func (t *Targets) DNSStats() DNSStats {
+	return t.dns.stats()
+}
+
+func (t *Targets) GetData(key string) (TargetData, bool) {
 	if s, ok := t.data.Load(key); ok {
-		if data, ok := s.(targetData); ok {
+		if data, ok := s.(TargetData); ok {
 			return data, true
 		}
 	}
 
-	return targetData{}, false
+	return TargetData{}, false
+}
+
+func (t *Targets) Labels(key string) (map[string]string, bool) {
+	target, ok := t.target(key)
+	if !ok {
+		return nil, false
+	}
+
+	labels := make(map[string]string, len(target.Labels))
+	for k, v := range target.Labels {
+		labels[k] = v
+	}
+
+	return labels, true
+}
+
+// Type returns check type of target, e.g. http or tcp
+func (t *Targets) Type(key string) (string, bool) {
+	target, ok := t.target(key)
+	if !ok {
+		return "", false
+	}
+
+	return target.Type, true
+}
+
+// IsStale reports whether target's data wasn't refreshed within stale-after,
+// e.g. when check loop is stuck
+func (t *Targets) IsStale(key string) (bool, bool) {
+	target, ok := t.target(key)
+	if !ok {
+		return false, false
+	}
+
+	data, ok := t.GetData(key)
+	if !ok {
+		return false, false
+	}
+
+	last := data.LastCheck
+	if last.IsZero() {
+		last = data.Start
+	}
+
+	staleAfter := time.Millisecond * time.Duration(target.StaleAfter)
+	if target.cron != nil {
+		// scheduled target is stale when scheduled check doesn't complete in time
+		if last.IsZero() {
+			last = t.monitorStart(key)
+		}
+		return !last.IsZero() && time.Since(target.cron.next(last)) > staleAfter, true
+	}
+
+	if last.IsZero() {
+		return true, true
+	}
+	return time.Since(last) > staleAfter, true
 }
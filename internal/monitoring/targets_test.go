@@ -0,0 +1,24 @@
+package monitoring
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func BenchmarkParseTargets10k(b *testing.B) {
+	var doc strings.Builder
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&doc, "target-%d:\n  url: https://host-%d.example.com/health\n  interval: 60000\n  history: 20\n  headers: {X-Request-Id: zcm}\n  expect-status: [2xx]\n  labels: {team: team-%d}\n", i, i, i%10)
+	}
+	data := []byte(doc.String())
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseTargets(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package monitoring
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// tcpInfo is socket-level state of connection used by check
+type tcpInfo struct {
+	rtt         time.Duration
+	rttVar      time.Duration
+	retransmits uint32
+}
+
+// captureConn stores connection used by request to conn
+func captureConn(req *http.Request, conn *net.Conn) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			*conn = info.Conn
+		},
+	}
+
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// rawConn unwraps TLS and tracking layers of connection
+func rawConn(c net.Conn) net.Conn {
+	for {
+		switch v := c.(type) {
+		case *tls.Conn:
+			c = v.NetConn()
+		case *trackedConn:
+			c = v.Conn
+		default:
+			return c
+		}
+	}
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package monitoring
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func readTCPInfo(c net.Conn) (tcpInfo, bool) {
+	tc, ok := rawConn(c).(*net.TCPConn)
+	if !ok {
+		return tcpInfo{}, false
+	}
+
+	sc, err := tc.SyscallConn()
+	if err != nil {
+		return tcpInfo{}, false
+	}
+
+	var (
+		info    *unix.TCPInfo
+		infoErr error
+	)
+	err = sc.Control(func(fd uintptr) {
+		info, infoErr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	if err != nil || infoErr != nil {
+		return tcpInfo{}, false
+	}
+
+	return tcpInfo{
+		rtt:         time.Duration(info.Rtt) * time.Microsecond,
+		rttVar:      time.Duration(info.Rttvar) * time.Microsecond,
+		retransmits: info.Total_retrans,
+	}, true
+}
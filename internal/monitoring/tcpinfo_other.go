@@ -0,0 +1,10 @@
+//go:build !linux
+
+package monitoring
+
+import "net"
+
+// TCP_INFO is read only on linux
+func readTCPInfo(c net.Conn) (tcpInfo, bool) {
+	return tcpInfo{}, false
+}
@@ -0,0 +1,109 @@
+package monitoring
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// requestTiming is duration of phases of request, phases which didn't
+// happen (e.g. DNS lookup and connect of reused connection) are zero
+type requestTiming struct {
+	dns     time.Duration
+	connect time.Duration
+	tls     time.Duration
+	// ttfb is time from request sent to first byte of response, time
+	// server spends processing the request
+	ttfb time.Duration
+	// download is time from first byte of response to end of its body
+	download time.Duration
+}
+
+// timingTrace measures phases of request, hooks can be called from
+// transport's dialing goroutine so they are synchronized
+type timingTrace struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	timing       requestTiming
+}
+
+// traceTiming attaches trace to request which measures its phases,
+// see timingTrace.finish
+func traceTiming(req *http.Request) (*http.Request, *timingTrace) {
+	t := &timingTrace{}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mark(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.measure(&t.dnsStart, &t.timing.dns)
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			// the first of parallel attempts (happy eyeballs) starts connecting
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err != nil {
+				return
+			}
+			t.measure(&t.connectStart, &t.timing.connect)
+
+			// connection of redirected request is measured from its own start
+			t.mu.Lock()
+			t.connectStart = time.Time{}
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mark(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.measure(&t.tlsStart, &t.timing.tls)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mark(&t.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			t.mark(&t.firstByte)
+			t.measure(&t.wroteRequest, &t.timing.ttfb)
+		},
+	}
+
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), t
+}
+
+func (t *timingTrace) mark(at *time.Time) {
+	t.mu.Lock()
+	*at = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *timingTrace) measure(start *time.Time, d *time.Duration) {
+	t.mu.Lock()
+	if !start.IsZero() {
+		*d = time.Since(*start)
+	}
+	t.mu.Unlock()
+}
+
+// finish returns timing of request whose body was read until now
+func (t *timingTrace) finish() requestTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timing := t.timing
+	if !t.firstByte.IsZero() {
+		timing.download = time.Since(t.firstByte)
+	}
+	return timing
+}
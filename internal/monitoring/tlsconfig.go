@@ -0,0 +1,201 @@
+package monitoring
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// targetTLS constrains TLS connections of http checks, e.g. to verify
+// compliance of servers (no TLS 1.0/1.1, only AEAD cipher suites)
+type targetTLS struct {
+	// MinVersion and MaxVersion are 1.0, 1.1, 1.2 or 1.3
+	MinVersion string `yaml:"min-version"`
+	MaxVersion string `yaml:"max-version"`
+	// CipherSuites are IANA names of allowed cipher suites, including TLS 1.3 ones
+	CipherSuites []string `yaml:"cipher-suites"`
+	// Curves are allowed key exchange groups, e.g. X25519 or P-256
+	Curves []string `yaml:"curves"`
+	// Pins are base64 encoded sha256 hashes of SubjectPublicKeyInfo, one of
+	// certificates served in chain must match one of them
+	Pins []string `yaml:"pins"`
+	// ServerNames are requested one by one as SNI and Host on the same endpoint,
+	// e.g. to verify certificates of tenants of shared TLS termination
+	ServerNames []string `yaml:"server-names"`
+	// InsecureSkipVerify accepts any certificate, e.g. self-signed ones of
+	// dev and staging environments, pins and other constraints still apply
+	InsecureSkipVerify bool `yaml:"insecure-skip-verify"`
+	// CAFile replaces system roots with PEM encoded certificates, e.g. of private CA
+	CAFile string `yaml:"ca-file"`
+	// CertFile and KeyFile are PEM encoded client certificate and its key for mTLS
+	CertFile string `yaml:"cert-file"`
+	KeyFile  string `yaml:"key-file"`
+
+	cipherSuites []uint16
+	pins         [][]byte
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P-256":  tls.CurveP256,
+	"P-384":  tls.CurveP384,
+	"P-521":  tls.CurveP521,
+}
+
+// clientConfig returns TLS configuration of target's http client
+func (t *targetTLS) clientConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+	for _, v := range []struct {
+		name  string
+		value string
+		dst   *uint16
+	}{
+		{"min-version", t.MinVersion, &config.MinVersion},
+		{"max-version", t.MaxVersion, &config.MaxVersion},
+	} {
+		if v.value == "" {
+			continue
+		}
+
+		version, ok := tlsVersions[v.value]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("invalid tls \"%s\" \"%s\", available: 1.0, 1.1, 1.2, 1.3", v.name, v.value))
+		}
+		*v.dst = version
+	}
+
+	if config.MinVersion != 0 && config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		return nil, errors.New("tls \"min-version\" is greater than \"max-version\"")
+	}
+
+	t.cipherSuites = nil
+	if len(t.CipherSuites) > 0 {
+		suites := map[string]uint16{}
+		for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[s.Name] = s.ID
+		}
+
+		for _, name := range t.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("unknown tls cipher suite \"%s\"", name))
+			}
+			t.cipherSuites = append(t.cipherSuites, id)
+		}
+		// TLS 1.3 suites can't be configured, they are verified after handshake instead
+		config.CipherSuites = t.cipherSuites
+	}
+
+	for _, name := range t.Curves {
+		curve, ok := tlsCurves[name]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("unknown tls curve \"%s\", available: X25519, P-256, P-384, P-521", name))
+		}
+		config.CurvePreferences = append(config.CurvePreferences, curve)
+	}
+
+	seen := map[string]bool{}
+	for _, name := range t.ServerNames {
+		if name == "" || strings.ContainsAny(name, ":/") || seen[name] {
+			return nil, errors.New(fmt.Sprintf("invalid tls server name \"%s\"", name))
+		}
+		seen[name] = true
+	}
+
+	if t.CAFile != "" {
+		pool, err := loadCAFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, errors.New("tls \"cert-file\" and \"key-file\" must be set together")
+	}
+	if t.CertFile != "" {
+		kp, err := newClientKeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = kp.getClientCertificate
+	}
+
+	t.pins = nil
+	for _, pin := range t.Pins {
+		hash, ok := parsePin(pin)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("invalid tls pin \"%s\", expected base64 encoded sha256 hash of public key", pin))
+		}
+		t.pins = append(t.pins, hash)
+	}
+
+	return config, nil
+}
+
+// verifyConnection fails check when negotiated cipher suite is outside the allowed
+// set or when none of served certificates matches pinned public keys
+func (t *targetTLS) verifyConnection(state *tls.ConnectionState) error {
+	if len(t.cipherSuites) > 0 && !slices.Contains(t.cipherSuites, state.CipherSuite) {
+		return errors.New(fmt.Sprintf("negotiated cipher suite %s is not allowed, allowed: %s",
+			tls.CipherSuiteName(state.CipherSuite), strings.Join(t.CipherSuites, ", ")))
+	}
+
+	if !t.matchesPins(state) {
+		leaf := sha256.Sum256(state.PeerCertificates[0].RawSubjectPublicKeyInfo)
+		return errors.New(fmt.Sprintf("none of served certificates matches pinned public keys, served certificate %s has pin sha256//%s",
+			state.PeerCertificates[0].Subject, base64.StdEncoding.EncodeToString(leaf[:])))
+	}
+
+	return nil
+}
+
+// matchesPins reports whether one of served certificates matches one
+// of pins, it always does when target has no pins
+func (t *targetTLS) matchesPins(state *tls.ConnectionState) bool {
+	if len(t.pins) == 0 || len(state.PeerCertificates) == 0 {
+		return true
+	}
+
+	for _, cert := range state.PeerCertificates {
+		hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if slices.ContainsFunc(t.pins, func(pin []byte) bool { return bytes.Equal(pin, hash[:]) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePin decodes pin given as plain base64 or prefixed with sha256//
+// as used by curl or sha256/ as used by HPKP
+func parsePin(pin string) ([]byte, bool) {
+	for _, encoded := range []string{pin, strings.TrimPrefix(pin, "sha256//"), strings.TrimPrefix(pin, "sha256/")} {
+		if hash, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(hash) == sha256.Size {
+			return hash, true
+		}
+	}
+	return nil, false
+}
+
+// tlsVersionName returns version as used in configuration, e.g. 1.3
+func tlsVersionName(version uint16) string {
+	for name, v := range tlsVersions {
+		if v == version {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,247 @@
+package monitoring
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+type TransportStats struct {
+	// open and idle connections by dialed address (host:port)
+	OpenConns map[string]int
+	IdleConns map[string]int
+
+	Handshakes int64
+	// HandshakeRate is average number of TLS handshakes per second over last minute
+	HandshakeRate float64
+}
+
+// transportStats collects self-metrics of connections made by checks
+type transportStats struct {
+	mu         sync.Mutex
+	open       map[string]int
+	idle       map[string]int
+	handshakes int64
+	rate       *rateCounter
+}
+
+func newTransportStats() *transportStats {
+	return &transportStats{
+		open: map[string]int{},
+		idle: map[string]int{},
+		rate: newRateCounter(time.Minute),
+	}
+}
+
+func (s *transportStats) snapshot() TransportStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := TransportStats{
+		OpenConns:     make(map[string]int, len(s.open)),
+		IdleConns:     make(map[string]int, len(s.idle)),
+		Handshakes:    s.handshakes,
+		HandshakeRate: s.rate.perSecond(time.Now()),
+	}
+
+	for k, v := range s.open {
+		stats.OpenConns[k] = v
+	}
+	for k, v := range s.idle {
+		stats.IdleConns[k] = v
+	}
+
+	return stats
+}
+
+// newTransport returns transport of target which reports its connections,
+// when fixedAddr is set all connections are made to it instead of requested
+// address bypassing proxies, otherwise hosts are resolved through dns cache
+// if it is not nil and requests are sent through target's proxy
+func (s *transportStats) newTransport(fixedAddr string, dns *dnsCache, target *targetInfo) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	var (
+		proxy func(*http.Request) (*url.URL, error)
+		ntlm  *ntlmProxy
+	)
+	if fixedAddr == "" {
+		proxy, ntlm = target.proxy, target.ntlmProxy
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.MaxResponseHeaderBytes = int64(target.MaxResponseHeaderBytes)
+	if target.tlsConfig != nil {
+		transport.TLSClientConfig = target.tlsConfig.Clone()
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var (
+			conn net.Conn
+			err  error
+		)
+
+		dial := dialer.DialContext
+		if dns != nil {
+			dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dns.dialContext(ctx, dialer, network, addr)
+			}
+		}
+
+		switch {
+		case fixedAddr != "":
+			addr = fixedAddr
+			conn, err = dialer.DialContext(ctx, network, addr)
+		case ntlm != nil:
+			conn, err = ntlm.dial(ctx, dial, addr)
+		default:
+			conn, err = dial(ctx, network, addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		s.open[addr]++
+		s.mu.Unlock()
+
+		return &trackedConn{Conn: conn, addr: addr, stats: s}, nil
+	}
+
+	return transport
+}
+
+// instrument attaches trace to request which reports connection reuse and TLS handshakes
+func (s *transportStats) instrument(req *http.Request) *http.Request {
+	var conn *trackedConn
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c := info.Conn
+			if tc, ok := c.(*tls.Conn); ok {
+				c = tc.NetConn()
+			}
+
+			if tc, ok := c.(*trackedConn); ok {
+				conn = tc
+				tc.setIdle(false)
+			}
+		},
+		PutIdleConn: func(err error) {
+			if err == nil && conn != nil {
+				conn.setIdle(true)
+			}
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			s.mu.Lock()
+			s.handshakes++
+			s.rate.add(time.Now())
+			s.mu.Unlock()
+		},
+	}
+
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+type trackedConn struct {
+	net.Conn
+	addr  string
+	stats *transportStats
+
+	mu     sync.Mutex
+	idle   bool
+	closed bool
+}
+
+func (c *trackedConn) setIdle(idle bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || c.idle == idle {
+		return
+	}
+	c.idle = idle
+
+	c.stats.mu.Lock()
+	if idle {
+		c.stats.idle[c.addr]++
+	} else {
+		c.stats.decrement(c.stats.idle, c.addr)
+	}
+	c.stats.mu.Unlock()
+}
+
+func (c *trackedConn) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+
+		c.stats.mu.Lock()
+		c.stats.decrement(c.stats.open, c.addr)
+		if c.idle {
+			c.stats.decrement(c.stats.idle, c.addr)
+		}
+		c.stats.mu.Unlock()
+	}
+	c.mu.Unlock()
+
+	return c.Conn.Close()
+}
+
+func (s *transportStats) decrement(m map[string]int, addr string) {
+	m[addr]--
+	if m[addr] <= 0 {
+		delete(m, addr)
+	}
+}
+
+// rateCounter counts events in one second buckets over window
+type rateCounter struct {
+	window  time.Duration
+	buckets []int64
+	last    int64
+}
+
+func newRateCounter(window time.Duration) *rateCounter {
+	return &rateCounter{
+		window:  window,
+		buckets: make([]int64, int(window/time.Second)),
+	}
+}
+
+func (r *rateCounter) advance(now time.Time) {
+	sec := now.Unix()
+	if r.last == 0 {
+		r.last = sec
+	}
+
+	n := int64(len(r.buckets))
+	for s := r.last + 1; s <= sec && s <= r.last+n; s++ {
+		r.buckets[s%n] = 0
+	}
+	r.last = sec
+}
+
+func (r *rateCounter) add(now time.Time) {
+	r.advance(now)
+	r.buckets[now.Unix()%int64(len(r.buckets))]++
+}
+
+func (r *rateCounter) perSecond(now time.Time) float64 {
+	r.advance(now)
+
+	var sum int64
+	for _, b := range r.buckets {
+		sum += b
+	}
+
+	return float64(sum) / r.window.Seconds()
+}
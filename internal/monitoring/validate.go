@@ -0,0 +1,161 @@
+package monitoring
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidateTargets loads targets file and its environment overlay like
+// LoadTargets, but instead of stopping at the first error it reports every
+// invalid target, including fields which are unknown and would be ignored
+// otherwise. It returns number of targets and found errors.
+func ValidateTargets(path string, env string) (int, []error) {
+	files := []string{path}
+	if env != "" {
+		files = append(files, overlayPath(path, env))
+	}
+
+	var errs []error
+	for _, file := range files {
+		// errors while reading are reported by readTargets below
+		if data, err := os.ReadFile(file); err == nil {
+			errs = append(errs, unknownTargetFields(file, data)...)
+		}
+	}
+
+	tm, err := readTargets(path, env)
+	if err != nil {
+		return 0, append(errs, err)
+	}
+
+	names := make([]string, 0, len(tm))
+	for name := range tm {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if err := checkAndPrepareTarget(name, tm[name]); err != nil {
+			errs = append(errs, err)
+		}
+		tm[name].wipeSecrets()
+	}
+
+	return len(tm), errs
+}
+
+// unknownTargetFields reports fields of targets document which don't
+// exist, e.g. misspelled ones, with line where they are
+func unknownTargetFields(file string, data []byte) []error {
+	targets := map[string]yaml.Node{}
+	if err := yaml.Unmarshal(data, &targets); err != nil {
+		// syntax errors are reported while reading targets
+		return nil
+	}
+
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		// metadata of sops encrypted document
+		if name != "sops" {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var errs []error
+	for _, name := range names {
+		node := targets[name]
+		for _, field := range unknownFields(&node, reflect.TypeOf(targetInfo{}), "") {
+			errs = append(errs, errors.New(fmt.Sprintf("%s: unknown field \"%s\" at %s:%d", name, field.path, file, field.line)))
+		}
+	}
+	return errs
+}
+
+type unknownField struct {
+	path string
+	line int
+}
+
+var yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// unknownFields walks node along typ and returns keys of mappings which
+// don't match yaml tag of any field of struct they are decoded to,
+// mismatched kinds of values are left to decoding
+func unknownFields(node *yaml.Node, typ reflect.Type, path string) []unknownField {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	// types decoding themselves accept whatever they decide to
+	ptr := reflect.PointerTo(typ)
+	if ptr.Implements(yamlUnmarshalerType) || ptr.Implements(textUnmarshalerType) {
+		return nil
+	}
+
+	var fields []unknownField
+	switch typ.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		known := map[string]reflect.Type{}
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if f.IsExported() && name != "" && name != "-" {
+				known[name] = f.Type
+			}
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fieldPath := joinFieldPath(path, key.Value)
+
+			fieldType, ok := known[key.Value]
+			if !ok {
+				fields = append(fields, unknownField{path: fieldPath, line: key.Line})
+				continue
+			}
+			fields = append(fields, unknownFields(value, fieldType, fieldPath)...)
+		}
+
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for i, item := range node.Content {
+			fields = append(fields, unknownFields(item, typ.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			fields = append(fields, unknownFields(node.Content[i+1], typ.Elem(), joinFieldPath(path, node.Content[i].Value))...)
+		}
+	}
+
+	return fields
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,61 @@
+package monitoring
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// errors of request parts prepared at load time are reported by validate
+// instead of failing every check
+func TestValidateTargetsPreparedRequest(t *testing.T) {
+	t.Setenv("ZCM_TEST_TOKEN", "line\nbreak")
+	t.Setenv("ZCM_TEST_HEADER", "a\r\nX-Injected: 1")
+
+	secretFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(secretFile, []byte("first\nsecond\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		err    string
+	}{
+		{"invalid json body", "{url: https://example.com, method: POST, json: '{\"a\": }'}", "json"},
+		{"token with new line", "{url: https://example.com, authorization: {type: Bearer, token: '{env:ZCM_TEST_TOKEN}'}}", "authorization contains characters invalid in header"},
+		{"token file with new line", "{url: https://example.com, authorization: {type: Bearer, token-file: " + secretFile + "}}", "authorization contains characters invalid in header"},
+		{"password with new line", "{url: https://example.com, authorization: {type: Basic, username: zcm, password: '{env:ZCM_TEST_TOKEN}'}}", ""},
+		{"type with space and new line", "{url: https://example.com, authorization: {type: \"Bearer\\n\", token: abc}}", "authorization contains characters invalid in header"},
+		{"apikey with new line", "{url: https://example.com, authorization: {type: apikey, value: '{env:ZCM_TEST_TOKEN}'}}", "authorization contains characters invalid in header"},
+		{"missing env variable of token", "{url: https://example.com, authorization: {type: Bearer, token: '{env:ZCM_TEST_MISSING}'}}", "ZCM_TEST_MISSING"},
+		{"header value with new line", "{url: https://example.com, headers: {X-Test: '{env:ZCM_TEST_HEADER}'}}", "value of header \"X-Test\" contains invalid characters"},
+		{"invalid header name", "{url: https://example.com, headers: {'X Test': a}}", "invalid header name \"X Test\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "targets.yml")
+			if err := os.WriteFile(path, []byte("target: "+tt.target+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			count, errs := ValidateTargets(path, "")
+			if tt.err == "" {
+				// basic credentials are encoded, so they can't break the header
+				if len(errs) != 0 {
+					t.Errorf("unexpected errors %v", errs)
+				}
+				return
+			}
+
+			if count != 1 || len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.err) {
+				t.Fatalf("got %d targets, errors %v, want error containing %q", count, errs, tt.err)
+			}
+			if strings.Contains(errs[0].Error(), "break") || strings.Contains(errs[0].Error(), "second") {
+				t.Errorf("error reveals secret: %s", errs[0])
+			}
+		})
+	}
+}
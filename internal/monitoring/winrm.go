@@ -0,0 +1,74 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	checkTypeWinRM = "winrm"
+
+	// winrmSizeLimit is size of read Identify response, it has few hundred bytes
+	winrmSizeLimit = 64 << 10
+
+	winrmIdentifyRequest = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" ` +
+		`xmlns:wsmid="http://schemas.dmtf.org/wbem/wsman/identity/1/wsmanidentity.xsd">` +
+		`<s:Header/><s:Body><wsmid:Identify/></s:Body></s:Envelope>`
+)
+
+// winrmResult is identity of WS-Management service reported by winrm check
+type winrmResult struct {
+	productVendor  string
+	productVersion string
+}
+
+type winrmEnvelope struct {
+	Body struct {
+		IdentifyResponse *struct {
+			ProductVendor  string `xml:"ProductVendor"`
+			ProductVersion string `xml:"ProductVersion"`
+		} `xml:"IdentifyResponse"`
+	} `xml:"Body"`
+}
+
+// checkWinRM sends WS-Management Identify request to target's url, which
+// WinRM answers without authentication, check fails unless response
+// identifies the service
+func checkWinRM(ctx context.Context, client *http.Client, target *targetInfo, state *monitorState) checkResult {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.Url, bytes.NewReader([]byte(winrmIdentifyRequest)))
+	if err != nil {
+		return checkResult{err: err}
+	}
+
+	req.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	req.Header.Set("WSMANIDENTIFY", "unauthenticated")
+	if err := setAuthorization(ctx, req, target); err != nil {
+		return checkResult{err: err}
+	}
+	for k, v := range target.Headers {
+		req.Header.Set(k, v)
+	}
+
+	result, body, _ := fetchResponse(ctx, client, req, state, winrmSizeLimit)
+	if body == nil {
+		return result
+	}
+
+	var envelope winrmEnvelope
+	if err := xml.Unmarshal(body, &envelope); err != nil || envelope.Body.IdentifyResponse == nil {
+		result.assertErr = errors.New("response is not WS-Management Identify response")
+		return result
+	}
+
+	identity := envelope.Body.IdentifyResponse
+	result.winrm = winrmResult{
+		productVendor:  strings.TrimSpace(identity.ProductVendor),
+		productVersion: strings.TrimSpace(identity.ProductVersion),
+	}
+
+	return result
+}
@@ -0,0 +1,221 @@
+// Package siem sends events of targets to SIEM as syslog messages
+// (RFC 5424) or JSON lines over UDP or TCP.
+package siem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ellezio/zcm/internal/monitoring"
+	"github.com/ellezio/zcm/internal/syslog"
+)
+
+const (
+	FormatSyslog = "syslog"
+	FormatJSON   = "json"
+
+	// queueSize is number of events waiting for delivery, newer events
+	// are dropped when SIEM can't keep up
+	queueSize = 1024
+
+	dialTimeout  = 10 * time.Second
+	writeTimeout = 10 * time.Second
+
+	// facilityLocal0 is syslog facility of messages
+	facilityLocal0 = 16
+)
+
+// syslog severities of event types
+var severities = map[string]int{
+	monitoring.EventPinMismatch: syslog.SeverityCritical,
+	monitoring.EventDown:        syslog.SeverityError,
+	monitoring.EventAuthFailure: syslog.SeverityWarning,
+	monitoring.EventUp:          syslog.SeverityNotice,
+}
+
+// Sender delivers events to SIEM in order, see Run
+type Sender struct {
+	network  string
+	address  string
+	format   string
+	hostname string
+	events   map[string]bool
+
+	queue chan monitoring.Event
+}
+
+// NewSender returns sender to address given as udp://host:port or
+// tcp://host:port, events lists types of sent events, all when empty
+func NewSender(address, format, hostname string, events []string) (*Sender, error) {
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Port() == "" {
+		return nil, errors.New(fmt.Sprintf("invalid siem address \"%s\", expected udp://host:port or tcp://host:port", address))
+	}
+
+	if format == "" {
+		format = FormatSyslog
+	}
+	if format != FormatSyslog && format != FormatJSON {
+		return nil, errors.New(fmt.Sprintf("siem format %s not supported, available: syslog, json", format))
+	}
+
+	s := &Sender{
+		network:  u.Scheme,
+		address:  u.Host,
+		format:   format,
+		hostname: hostname,
+		queue:    make(chan monitoring.Event, queueSize),
+	}
+
+	if len(events) > 0 {
+		s.events = map[string]bool{}
+		for _, e := range events {
+			if _, ok := severities[e]; !ok {
+				return nil, errors.New(fmt.Sprintf("siem event %s not supported, available: down, up, auth-failure, pin-mismatch", e))
+			}
+			s.events[e] = true
+		}
+	}
+
+	return s, nil
+}
+
+// Send queues event for delivery without blocking
+func (s *Sender) Send(e monitoring.Event) {
+	if s.events != nil && !s.events[e.Type] {
+		return
+	}
+
+	select {
+	case s.queue <- e:
+	default:
+		slog.Warn("siem queue is full, event dropped", "target", e.Target, "event", e.Type)
+	}
+}
+
+// Run delivers queued events until ctx is cancelled, connection is
+// reopened after failed write and the event is retried once
+func (s *Sender) Run(ctx context.Context) {
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-s.queue:
+			msg := s.encode(e)
+
+			for attempt := 0; attempt < 2; attempt++ {
+				if conn == nil {
+					var err error
+					dialer := net.Dialer{Timeout: dialTimeout}
+					if conn, err = dialer.DialContext(ctx, s.network, s.address); err != nil {
+						slog.Warn("connecting to siem failed, event dropped", "address", s.address, "target", e.Target, "event", e.Type, "err", err)
+						break
+					}
+				}
+
+				conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+				if _, err := conn.Write(msg); err != nil {
+					conn.Close()
+					conn = nil
+					if attempt == 1 {
+						slog.Warn("sending event to siem failed, event dropped", "address", s.address, "target", e.Target, "event", e.Type, "err", err)
+					}
+					continue
+				}
+				break
+			}
+		}
+	}
+}
+
+// encode formats event as message of sender's format with framing
+// of sender's network, TCP messages are newline delimited JSON or
+// octet counted syslog (RFC 6587)
+func (s *Sender) encode(e monitoring.Event) []byte {
+	if s.format == FormatJSON {
+		b, _ := json.Marshal(jsonEvent{
+			Time:       e.Time.UTC().Format(time.RFC3339Nano),
+			Event:      e.Type,
+			Severity:   severityNames[severities[e.Type]],
+			Host:       s.hostname,
+			Target:     e.Target,
+			Address:    e.Address,
+			StatusCode: e.StatusCode,
+			Reason:     e.Reason,
+			Labels:     e.Labels,
+		})
+		return append(b, '\n')
+	}
+
+	msg := s.syslogMessage(e)
+	if s.network == "tcp" {
+		return append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	return msg
+}
+
+var severityNames = map[int]string{
+	syslog.SeverityCritical: "critical",
+	syslog.SeverityError:    "error",
+	syslog.SeverityWarning:  "warning",
+	syslog.SeverityNotice:   "notice",
+}
+
+type jsonEvent struct {
+	Time       string            `json:"time"`
+	Event      string            `json:"event"`
+	Severity   string            `json:"severity"`
+	Host       string            `json:"host"`
+	Target     string            `json:"target"`
+	Address    string            `json:"address,omitempty"`
+	StatusCode int               `json:"statusCode,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// syslogMessage formats event as RFC 5424 message with event type as
+// MSGID and event's fields as structured data
+func (s *Sender) syslogMessage(e monitoring.Event) []byte {
+	params := []syslog.Param{
+		{Name: "target", Value: e.Target},
+		{Name: "address", Value: e.Address},
+	}
+	if e.StatusCode != 0 {
+		params = append(params, syslog.Param{Name: "statusCode", Value: strconv.Itoa(e.StatusCode)})
+	}
+	params = append(params, syslog.SortedParams("label.", e.Labels)...)
+
+	text := fmt.Sprintf("target %s is %s", e.Target, e.Type)
+	switch e.Type {
+	case monitoring.EventAuthFailure, monitoring.EventPinMismatch:
+		text = fmt.Sprintf("%s at target %s", e.Type, e.Target)
+	}
+	if e.Reason != "" {
+		text += ": " + e.Reason
+	}
+
+	return syslog.Message{
+		Facility: facilityLocal0,
+		Severity: severities[e.Type],
+		Time:     e.Time,
+		Hostname: s.hostname,
+		AppName:  "zcm",
+		MsgID:    e.Type,
+		Params:   params,
+		Text:     text,
+	}.Bytes()
+}
@@ -0,0 +1,109 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Handler is slog handler which sends records to syslog, message text
+// is record's message and attributes are structured data parameters,
+// attributes of groups are named with group prefix, e.g. group.key
+type Handler struct {
+	w        *Writer
+	level    slog.Leveler
+	facility int
+	hostname string
+	appName  string
+
+	// attrs are parameters added by WithAttrs, prefix is prefix of groups
+	attrs  []Param
+	prefix string
+}
+
+func NewHandler(w *Writer, level slog.Leveler, facility int, hostname, appName string) *Handler {
+	return &Handler{w: w, level: level, facility: facility, hostname: hostname, appName: appName}
+}
+
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle sends record, when syslog can't be reached record is written
+// to stderr, so it isn't lost
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	params := slices.Clone(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		params = appendAttr(params, h.prefix, a)
+		return true
+	})
+
+	msg := Message{
+		Facility: h.facility,
+		Severity: severity(r.Level),
+		Time:     r.Time,
+		Hostname: h.hostname,
+		AppName:  h.appName,
+		Params:   params,
+		Text:     r.Message,
+	}.Bytes()
+
+	if err := h.w.Write(msg); err != nil {
+		fmt.Fprintf(os.Stderr, "%s (syslog unavailable: %s)\n", msg, err)
+	}
+	return nil
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = slices.Clone(h.attrs)
+	for _, a := range attrs {
+		c.attrs = appendAttr(c.attrs, h.prefix, a)
+	}
+	return &c
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix = h.prefix + name + "."
+	return &c
+}
+
+func appendAttr(params []Param, prefix string, a slog.Attr) []Param {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return params
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			params = appendAttr(params, groupPrefix, ga)
+		}
+		return params
+	}
+
+	return append(params, Param{Name: prefix + a.Key, Value: strings.TrimSpace(a.Value.String())})
+}
+
+// severity maps slog level to syslog severity
+func severity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return SeverityError
+	case level >= slog.LevelWarn:
+		return SeverityWarning
+	case level >= slog.LevelInfo:
+		return SeverityInfo
+	}
+	return SeverityDebug
+}
@@ -0,0 +1,237 @@
+// Package syslog writes RFC 5424 syslog messages over UDP, TCP or unix
+// socket and provides slog handler logging through it.
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SeverityCritical and others are syslog severities used by zcm
+	SeverityCritical = 2
+	SeverityError    = 3
+	SeverityWarning  = 4
+	SeverityNotice   = 5
+	SeverityInfo     = 6
+	SeverityDebug    = 7
+
+	// SDID is id of zcm's structured data element, 32473 is enterprise
+	// number reserved for documentation (RFC 5612)
+	SDID = "zcm@32473"
+
+	dialTimeout  = 5 * time.Second
+	writeTimeout = 5 * time.Second
+	// redialDelay is how long messages fail immediately after failed
+	// connection attempt, so unreachable syslog doesn't delay every message
+	redialDelay = 10 * time.Second
+
+	// maxParamName is maximum length of structured data parameter name
+	maxParamName = 32
+)
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ParseFacility returns code of facility given by name, e.g. daemon or local0
+func ParseFacility(name string) (int, error) {
+	facility, ok := facilities[name]
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("unknown syslog facility \"%s\", expected e.g. daemon, user or local0-local7", name))
+	}
+	return facility, nil
+}
+
+// Message is syslog message with single structured data element
+type Message struct {
+	Facility int
+	Severity int
+	Time     time.Time
+	Hostname string
+	AppName  string
+	// MsgID identifies type of message, e.g. event type
+	MsgID string
+	// Params are parameters of SDID element in order they are written,
+	// parameters with empty values are left out
+	Params []Param
+	Text   string
+}
+
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Bytes formats message as RFC 5424 message
+func (m Message) Bytes() []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d %s ", m.Facility*8+m.Severity, m.Time.UTC().Format(time.RFC3339Nano),
+		nilValue(m.Hostname), nilValue(m.AppName), os.Getpid(), nilValue(m.MsgID))
+
+	// structured data is nil value when there are no parameters
+	var sd strings.Builder
+	for _, p := range m.Params {
+		if p.Value != "" {
+			fmt.Fprintf(&sd, " %s=\"%s\"", paramName(p.Name), sdEscaper.Replace(p.Value))
+		}
+	}
+	if sd.Len() > 0 {
+		b.WriteString("[" + SDID + sd.String() + "]")
+	} else {
+		b.WriteString("-")
+	}
+
+	if m.Text != "" {
+		b.WriteString(" " + strings.ReplaceAll(m.Text, "\n", " "))
+	}
+
+	return b.Bytes()
+}
+
+// SortedParams returns parameters of map sorted by name, names are prefixed
+func SortedParams(prefix string, values map[string]string) []Param {
+	params := make([]Param, 0, len(values))
+	for name, value := range values {
+		params = append(params, Param{Name: prefix + name, Value: value})
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return params
+}
+
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, " ", "_")
+}
+
+// paramName replaces characters not allowed in parameter names
+// and truncates name to allowed length
+func paramName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > maxParamName {
+		name = name[:maxParamName]
+	}
+	return name
+}
+
+// sdEscaper escapes characters which are special in structured data values
+var sdEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// Writer sends messages to syslog server, it is safe for concurrent use
+type Writer struct {
+	network string
+	address string
+
+	mu   sync.Mutex
+	conn net.Conn
+	// dialErr is error of last connection attempt, returned until redialAt
+	dialErr  error
+	redialAt time.Time
+}
+
+// NewWriter returns writer to address given as udp://host:port,
+// tcp://host:port or unix:///path (e.g. unix:///dev/log)
+func NewWriter(address string) (*Writer, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid syslog address \"%s\"", address))
+	}
+
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Port() == "" {
+			return nil, errors.New(fmt.Sprintf("invalid syslog address \"%s\", port is required", address))
+		}
+		return &Writer{network: u.Scheme, address: u.Host}, nil
+	case "unix":
+		if u.Path == "" {
+			return nil, errors.New(fmt.Sprintf("invalid syslog address \"%s\", socket path is required", address))
+		}
+		return &Writer{network: "unix", address: u.Path}, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("invalid syslog address \"%s\", expected udp://host:port, tcp://host:port or unix:///path", address))
+}
+
+// Write sends message, connection is reopened after failed write and
+// the message is retried once. TCP messages are octet counted (RFC 6587),
+// messages sent to unix stream socket are terminated with newline.
+func (w *Writer) Write(msg []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if time.Now().Before(w.redialAt) {
+				return w.dialErr
+			}
+			if w.conn, err = w.dial(); err != nil {
+				w.dialErr, w.redialAt = err, time.Now().Add(redialDelay)
+				return err
+			}
+		}
+
+		framed := msg
+		switch w.conn.LocalAddr().Network() {
+		case "tcp":
+			framed = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		case "unix":
+			framed = append(msg[:len(msg):len(msg)], '\n')
+		}
+
+		w.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err = w.conn.Write(framed); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	return err
+}
+
+// dial connects to syslog, unix sockets are tried as datagram
+// socket first, as /dev/log usually is, then as stream socket
+func (w *Writer) dial() (net.Conn, error) {
+	if w.network == "unix" {
+		conn, err := net.DialTimeout("unixgram", w.address, dialTimeout)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return net.DialTimeout(w.network, w.address, dialTimeout)
+}
+
+// Close closes connection to syslog
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
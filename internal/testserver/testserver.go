@@ -0,0 +1,184 @@
+package testserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Username = "zcm"
+	Password = "zcm-passwd"
+	Token    = "zcm-token"
+
+	Marker = "zcm-end-of-body"
+
+	DomainExpiryDays = 90
+	QueueDepth       = 42
+)
+
+type Options struct {
+	// Logf is used to log handled requests, nil disables logging
+	Logf func(format string, args ...interface{})
+	// Delay is applied to requests handled by root endpoint
+	Delay time.Duration
+}
+
+// NewHandler returns handler serving endpoints used to exercise zcm checks
+//   - /             waits Delay and responds 200
+//   - /events       server-sent events stream sending first event after 500ms
+//   - /cached       content with ETag and Last-Modified validators
+//   - /json         requires POST with application/json body
+//   - /form         requires POST with form data containing key=val
+//   - /headers      requires X-Zcm-Test header
+//   - /auth/basic   requires Basic authorization with Username and Password
+//   - /auth/token   requires Bearer authorization with Token
+//   - /auth/apikey  requires X-API-Key header with Token
+//   - /oauth/token  OAuth 2.0 token endpoint issuing Token for client
+//     credentials grant of client Username with secret Password
+//   - /large        streams ?size= bytes (default 1MiB) followed by Marker
+//   - /stats        json document with stats.queue.depth equal to QueueDepth
+//   - /rdap/domain/ RDAP domain object expiring DomainExpiryDays from now
+func NewHandler(opts Options) http.Handler {
+	logf := opts.Logf
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		logf("start")
+		if opts.Delay > 0 {
+			logf("wait %s", opts.Delay)
+			time.Sleep(opts.Delay)
+		}
+		logf("end")
+	})
+
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		logf("events start")
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, ": keep-alive\n\n")
+		w.(http.Flusher).Flush()
+
+		logf("wait 500ms")
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		fmt.Fprint(w, "event: ping\ndata: {}\n\n")
+		w.(http.Flusher).Flush()
+		logf("events end")
+	})
+
+	modTime := time.Now()
+	mux.HandleFunc("/cached", func(w http.ResponseWriter, r *http.Request) {
+		logf("cached %s", r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "cached.txt", modTime, strings.NewReader("cached content"))
+	})
+
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		logf("json")
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || mediaType != "application/json" || !json.Valid(body) {
+			http.Error(w, "expected POST with json body", http.StatusBadRequest)
+		}
+	})
+
+	mux.HandleFunc("/form", func(w http.ResponseWriter, r *http.Request) {
+		logf("form")
+		if r.Method != http.MethodPost || r.PostFormValue("key") != "val" {
+			http.Error(w, "expected POST with form data key=val", http.StatusBadRequest)
+		}
+	})
+
+	mux.HandleFunc("/headers", func(w http.ResponseWriter, r *http.Request) {
+		logf("headers")
+		if r.Header.Get("X-Zcm-Test") == "" {
+			http.Error(w, "expected X-Zcm-Test header", http.StatusBadRequest)
+		}
+	})
+
+	mux.HandleFunc("/auth/basic", func(w http.ResponseWriter, r *http.Request) {
+		logf("auth basic")
+		if u, p, ok := r.BasicAuth(); !ok || u != Username || p != Password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="zcm"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+
+	mux.HandleFunc("/auth/token", func(w http.ResponseWriter, r *http.Request) {
+		logf("auth token")
+		if r.Header.Get("Authorization") != "Bearer "+Token {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+
+	mux.HandleFunc("/auth/apikey", func(w http.ResponseWriter, r *http.Request) {
+		logf("auth apikey")
+		if r.Header.Get("X-API-Key") != Token || r.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		logf("oauth token")
+		w.Header().Set("Content-Type", "application/json")
+		if id, secret, ok := r.BasicAuth(); !ok || id != Username || secret != Password {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": "invalid_client"}`)
+			return
+		}
+		if r.Method != http.MethodPost || r.PostFormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "unsupported_grant_type"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token": %q, "token_type": "Bearer", "expires_in": 3600}`, Token)
+	})
+
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		logf("large")
+		size, err := strconv.Atoi(r.URL.Query().Get("size"))
+		if err != nil {
+			size = 1 << 20
+		}
+
+		chunk := bytes.Repeat([]byte("."), 32*1024)
+		for size > 0 {
+			n := min(size, len(chunk))
+			if _, err := w.Write(chunk[:n]); err != nil {
+				return
+			}
+			size -= n
+		}
+		fmt.Fprint(w, Marker)
+	})
+
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		logf("stats")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"stats": {"queue": {"depth": %d}}, "workers": [{"name": "w1"}]}`, QueueDepth)
+	})
+
+	mux.HandleFunc("/rdap/domain/", func(w http.ResponseWriter, r *http.Request) {
+		logf("rdap %s", strings.TrimPrefix(r.URL.Path, "/rdap/domain/"))
+		expiry := time.Now().Add(DomainExpiryDays*24*time.Hour + time.Hour).UTC()
+
+		w.Header().Set("Content-Type", "application/rdap+json")
+		fmt.Fprintf(w, `{"objectClassName": "domain", "events": [{"eventAction": "expiration", "eventDate": "%s"}]}`, expiry.Format(time.RFC3339))
+	})
+
+	return mux
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileVersion is version of file format, file of other version is ignored
+const fileVersion = 1
+
+type fileContent struct {
+	Version int               `json:"version"`
+	Targets map[string]Record `json:"targets"`
+}
+
+type file struct {
+	mu   sync.Mutex
+	path string
+}
+
+// OpenFile returns store keeping records in JSON file. File is replaced
+// atomically on every save, so it's never left half written.
+func OpenFile(path string) (Store, error) {
+	dir := filepath.Dir(path)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, errors.New(fmt.Sprintf("storage directory %s doesn't exist", dir))
+	}
+	return &file{path: path}, nil
+}
+
+func (f *file) Load() (map[string]Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]Record{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var content fileContent
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %s", f.path, err))
+	}
+	if content.Version != fileVersion {
+		return nil, errors.New(fmt.Sprintf("%s: unsupported version %d", f.path, content.Version))
+	}
+	if content.Targets == nil {
+		content.Targets = map[string]Record{}
+	}
+	return content.Targets, nil
+}
+
+func (f *file) Save(records map[string]Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := json.Marshal(fileContent{Version: fileVersion, Targets: records})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), "."+filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func (f *file) Close() error {
+	return nil
+}
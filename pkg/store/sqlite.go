@@ -0,0 +1,150 @@
+//go:build cgo
+
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS targets (
+	name        TEXT PRIMARY KEY,
+	fingerprint TEXT NOT NULL,
+	state       BLOB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS history (
+	target        TEXT NOT NULL,
+	time          INTEGER NOT NULL,
+	response_time INTEGER NOT NULL,
+	failed        INTEGER NOT NULL,
+	error         INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS history_target ON history (target, time);
+`
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLite returns store keeping records in SQLite database, history
+// is kept in its own table, so it can be queried directly, e.g. with
+// SELECT target, avg(response_time) / 1e6 FROM history GROUP BY target
+func OpenSQLite(path string) (Store, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	// single connection serializes writes of agent
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, errors.New(fmt.Sprintf("%s: %s", path, err))
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) Load() (map[string]Record, error) {
+	records := map[string]Record{}
+
+	rows, err := s.db.Query("SELECT name, fingerprint, state FROM targets")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var (
+			name string
+			r    Record
+		)
+		if err := rows.Scan(&name, &r.Fingerprint, &r.State); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		records[name] = r
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query("SELECT target, time, response_time, failed, error FROM history ORDER BY target, time, rowid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			name         string
+			at, duration int64
+			e            HistoryEntry
+		)
+		if err := rows.Scan(&name, &at, &duration, &e.Failed, &e.Error); err != nil {
+			return nil, err
+		}
+
+		r, ok := records[name]
+		if !ok {
+			continue
+		}
+		e.Time = time.UnixMilli(at)
+		e.ResponseTime = time.Duration(duration)
+		r.History = append(r.History, e)
+		records[name] = r
+	}
+	return records, rows.Err()
+}
+
+func (s *sqliteStore) Save(records map[string]Record) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec("DELETE FROM targets"); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM history"); err != nil {
+		return err
+	}
+
+	target, err := tx.Prepare("INSERT INTO targets (name, fingerprint, state) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	history, err := tx.Prepare("INSERT INTO history (target, time, response_time, failed, error) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+
+	for _, name := range names(records) {
+		r := records[name]
+		if _, err = target.Exec(name, r.Fingerprint, r.State); err != nil {
+			return err
+		}
+		for _, e := range r.History {
+			if _, err = history.Exec(name, e.Time.UnixMilli(), int64(e.ResponseTime), e.Failed, e.Error); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
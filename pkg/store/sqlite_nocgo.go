@@ -0,0 +1,10 @@
+//go:build !cgo
+
+package store
+
+import "errors"
+
+// OpenSQLite fails in builds without cgo, SQLite driver is written in C
+func OpenSQLite(path string) (Store, error) {
+	return nil, errors.New("sqlite storage is not available, zcm was built without cgo (CGO_ENABLED=0)")
+}
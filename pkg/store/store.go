@@ -0,0 +1,119 @@
+// Package store persists state and history of monitored targets, so
+// counters, availability and error budgets survive restarts of agent.
+// Agent selects one of the implementations with storage section of its
+// configuration, embedding users can supply their own Store.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	TypeMemory = "memory"
+	TypeFile   = "file"
+	TypeSQLite = "sqlite"
+)
+
+// HistoryEntry is result of single check kept in target's history
+type HistoryEntry struct {
+	Time         time.Time
+	ResponseTime time.Duration
+	Failed       bool
+	// Error is set when check got no response
+	Error bool
+}
+
+// Record is saved state of single target
+type Record struct {
+	// Fingerprint identifies definition of target the state belongs to,
+	// state of target whose definition changed is discarded
+	Fingerprint string
+	// State is encoded by agent, stores keep it as is
+	State []byte
+	// History are last checks from the oldest to the newest
+	History []HistoryEntry
+}
+
+// Store keeps records of targets by their names. Agent loads records once
+// on start and saves records of all running targets periodically and on
+// shutdown, so Save replaces all previously saved records.
+type Store interface {
+	Load() (map[string]Record, error)
+	Save(records map[string]Record) error
+	Close() error
+}
+
+// Open opens store of given type, path is file of file and sqlite stores
+func Open(typ string, path string) (Store, error) {
+	switch typ {
+	case "", TypeMemory:
+		if path != "" {
+			return nil, errors.New("storage path is available only for file and sqlite storage")
+		}
+		return NewMemory(), nil
+	case TypeFile, TypeSQLite:
+		if path == "" {
+			return nil, errors.New(fmt.Sprintf("storage path is required for %s storage", typ))
+		}
+		if typ == TypeFile {
+			return OpenFile(path)
+		}
+		return OpenSQLite(path)
+	}
+
+	return nil, errors.New(fmt.Sprintf("unsupported storage type \"%s\", available: memory, file, sqlite", typ))
+}
+
+type memory struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewMemory returns store keeping records in memory, it's used when
+// storage isn't configured, state is then lost on restart
+func NewMemory() Store {
+	return &memory{records: map[string]Record{}}
+}
+
+func (m *memory) Load() (map[string]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return cloneRecords(m.records), nil
+}
+
+func (m *memory) Save(records map[string]Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records = cloneRecords(records)
+	return nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
+
+func cloneRecords(records map[string]Record) map[string]Record {
+	c := make(map[string]Record, len(records))
+	for name, r := range records {
+		r.State = slices.Clone(r.State)
+		r.History = slices.Clone(r.History)
+		c[name] = r
+	}
+	return c
+}
+
+// names returns sorted names of records, so stores write them in stable order
+func names(records map[string]Record) []string {
+	list := make([]string, 0, len(records))
+	for name := range records {
+		list = append(list, name)
+	}
+	slices.Sort(list)
+	return list
+}
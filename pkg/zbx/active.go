@@ -0,0 +1,394 @@
+package zbx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultActivePort = "10051"
+
+	// maximum number of values kept while server is unreachable
+	activeBufferSize = 1000
+	// maximum delay between attempts to send values server didn't accept
+	activeMaxBackoff = 5 * time.Minute
+)
+
+type ActiveOptions struct {
+	// ServerAddress is host[:port] of Zabbix server or proxy, port defaults to 10051
+	ServerAddress string
+	// Hostname must match host name configured in Zabbix
+	Hostname string
+	// RefreshInterval is how often list of active checks is requested, defaults to 60s
+	RefreshInterval time.Duration
+	// SendInterval is how often collected values are sent, defaults to 5s
+	SendInterval time.Duration
+	// MaxResponseSize is maximum size of response data of server in bytes,
+	// also after decompression, larger responses are rejected, default 1 MiB
+	MaxResponseSize int
+	// Logger receives errors of communication with server, default logger
+	// with component=zbx attribute when nil
+	Logger *slog.Logger
+}
+
+type activeChecksRequest struct {
+	Request string `json:"request"`
+	Host    string `json:"host"`
+	Version string `json:"version"`
+	Variant int    `json:"variant"`
+	Session string `json:"session"`
+}
+
+type activeChecksResponse struct {
+	Response string        `json:"response"`
+	Info     string        `json:"info"`
+	Data     []activeCheck `json:"data"`
+}
+
+type activeCheck struct {
+	Key    string `json:"key"`
+	ItemID uint64 `json:"itemid"`
+	Delay  string `json:"delay"`
+}
+
+type agentDataRequest struct {
+	Request string           `json:"request"`
+	Session string           `json:"session"`
+	Version string           `json:"version"`
+	Variant int              `json:"variant"`
+	Data    []agentDataValue `json:"data"`
+	Clock   int64            `json:"clock"`
+	Ns      int              `json:"ns"`
+}
+
+type agentDataValue struct {
+	Host   string `json:"host"`
+	Key    string `json:"key"`
+	ItemID uint64 `json:"itemid"`
+	Value  string `json:"value"`
+	State  int    `json:"state,omitempty"`
+	ID     uint64 `json:"id"`
+	Clock  int64  `json:"clock"`
+	Ns     int    `json:"ns"`
+}
+
+type agentDataResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+type scheduledCheck struct {
+	activeCheck
+	interval time.Duration
+	next     time.Time
+}
+
+type activeAgent struct {
+	opts    ActiveOptions
+	handler Handler
+	session string
+
+	checks map[uint64]*scheduledCheck
+	buffer []agentDataValue
+	lastID uint64
+
+	// backoff is delay after last failed attempt to send values,
+	// no values are sent before retryAt
+	backoff time.Duration
+	retryAt time.Time
+
+	// compress is set once server sent compressed packet
+	compress bool
+}
+
+// RunActive works as Zabbix active agent, it periodically requests list of active
+// checks from server and pushes collected values with agent data packets.
+// It returns when options are invalid or when ctx is cancelled,
+// after last attempt to send collected values.
+func RunActive(ctx context.Context, opts ActiveOptions, handler Handler) error {
+	if opts.ServerAddress == "" {
+		return errors.New("active server address not specified")
+	}
+	if opts.Hostname == "" {
+		return errors.New("active agent hostname not specified")
+	}
+
+	if _, _, err := net.SplitHostPort(opts.ServerAddress); err != nil {
+		opts.ServerAddress = net.JoinHostPort(opts.ServerAddress, defaultActivePort)
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = time.Minute
+	}
+	if opts.SendInterval <= 0 {
+		opts.SendInterval = 5 * time.Second
+	}
+	if opts.MaxResponseSize <= 0 {
+		opts.MaxResponseSize = defaultMaxRequestSize
+	}
+
+	session := make([]byte, 16)
+	if _, err := rand.Read(session); err != nil {
+		return err
+	}
+
+	a := &activeAgent{
+		opts:    opts,
+		handler: handler,
+		session: hex.EncodeToString(session),
+		checks:  map[uint64]*scheduledCheck{},
+	}
+	a.run(ctx)
+
+	return nil
+}
+
+func (a *activeAgent) run(ctx context.Context) {
+	refresh := time.NewTicker(a.opts.RefreshInterval)
+	send := time.NewTicker(a.opts.SendInterval)
+	collect := time.NewTicker(time.Second)
+
+	defer refresh.Stop()
+	defer send.Stop()
+	defer collect.Stop()
+
+	a.refresh()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// last attempt doesn't wait for backoff
+			a.retryAt = time.Time{}
+			a.send(time.Now())
+			return
+		case <-refresh.C:
+			a.refresh()
+		case now := <-collect.C:
+			a.collect(now)
+		case now := <-send.C:
+			a.send(now)
+		}
+	}
+}
+
+func (a *activeAgent) refresh() {
+	req := activeChecksRequest{
+		Request: "active checks",
+		Host:    a.opts.Hostname,
+		Version: "7.0.0",
+		Variant: 2,
+		Session: a.session,
+	}
+
+	res := activeChecksResponse{}
+	if err := a.exchange(req, &res); err != nil {
+		logger(a.opts.Logger).Error("active checks request error", "server", a.opts.ServerAddress, "err", err)
+		return
+	}
+
+	if res.Response != "success" {
+		logger(a.opts.Logger).Error("active checks request failed", "server", a.opts.ServerAddress, "info", res.Info)
+		return
+	}
+
+	checks := make(map[uint64]*scheduledCheck, len(res.Data))
+	for _, c := range res.Data {
+		interval, err := parseDelay(c.Delay)
+		if err != nil {
+			logger(a.opts.Logger).Warn("invalid active check", "key", c.Key, "err", err)
+			continue
+		}
+
+		sc, ok := a.checks[c.ItemID]
+		if !ok || sc.Key != c.Key || sc.interval != interval {
+			sc = &scheduledCheck{activeCheck: c, interval: interval, next: time.Now()}
+		}
+		checks[c.ItemID] = sc
+	}
+
+	a.checks = checks
+}
+
+func (a *activeAgent) collect(now time.Time) {
+	for _, c := range a.checks {
+		if now.Before(c.next) {
+			continue
+		}
+
+		for !now.Before(c.next) {
+			c.next = c.next.Add(c.interval)
+		}
+
+		v := agentDataValue{
+			Host:   a.opts.Hostname,
+			Key:    c.Key,
+			ItemID: c.ItemID,
+			Clock:  now.Unix(),
+			Ns:     now.Nanosecond(),
+		}
+
+		value, err := a.handler.Item(c.Key)
+		if err != nil {
+			v.State = 1
+			v.Value = err.Error()
+		} else if value == nil {
+			v.State = 1
+			v.Value = "Cannot obtain item value"
+		} else {
+			v.Value = fmt.Sprint(value)
+		}
+
+		a.lastID++
+		v.ID = a.lastID
+
+		a.buffer = append(a.buffer, v)
+	}
+
+	if over := len(a.buffer) - activeBufferSize; over > 0 {
+		logger(a.opts.Logger).Warn("active buffer full, dropping oldest values", "dropped", over)
+		a.buffer = a.buffer[over:]
+	}
+}
+
+func (a *activeAgent) send(now time.Time) {
+	if len(a.buffer) == 0 || now.Before(a.retryAt) {
+		return
+	}
+
+	req := agentDataRequest{
+		Request: "agent data",
+		Session: a.session,
+		Version: "7.0.0",
+		Variant: 2,
+		Data:    a.buffer,
+		Clock:   now.Unix(),
+		Ns:      now.Nanosecond(),
+	}
+
+	res := agentDataResponse{}
+	if err := a.exchange(req, &res); err != nil {
+		// keep values, they are sent with next attempt
+		a.retry(now)
+		logger(a.opts.Logger).Error("agent data error", "server", a.opts.ServerAddress, "err", err, "retryIn", a.backoff)
+		return
+	}
+
+	if res.Response != "success" {
+		// server didn't process the data at all, e.g. it's starting or
+		// host isn't monitored yet, so values are kept as well
+		a.retry(now)
+		logger(a.opts.Logger).Error("agent data rejected", "server", a.opts.ServerAddress, "info", res.Info, "retryIn", a.backoff)
+		return
+	}
+
+	// server processed the data, values it failed to process are rejected
+	// for good, e.g. of item which isn't active check, so they aren't resent
+	if failed := failedValues(res.Info); failed > 0 {
+		logger(a.opts.Logger).Warn("agent data partially failed", "server", a.opts.ServerAddress, "failed", failed, "info", res.Info)
+	}
+
+	a.buffer = nil
+	a.backoff = 0
+	a.retryAt = time.Time{}
+}
+
+// retry postpones next attempt to send values, delay starts at send
+// interval and doubles with every failed attempt up to activeMaxBackoff
+func (a *activeAgent) retry(now time.Time) {
+	a.backoff = min(max(2*a.backoff, a.opts.SendInterval), activeMaxBackoff)
+	a.retryAt = now.Add(a.backoff)
+}
+
+// failedValues returns number of values server failed to process from info
+// of its response, e.g. "processed: 2; failed: 1; total: 3; seconds spent: 0.000055"
+func failedValues(info string) int {
+	for _, field := range strings.Split(info, ";") {
+		name, value, ok := strings.Cut(field, ":")
+		if !ok || strings.TrimSpace(name) != "failed" {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// exchange sends request to server and decodes its response
+func (a *activeAgent) exchange(req interface{}, res interface{}) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", a.opts.ServerAddress, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if err := writePacket(conn, data, a.compress); err != nil {
+		return err
+	}
+
+	// length of data comes from server, so it's limited before data is allocated
+	b, compressed, err := readPacket(conn, uint32(a.opts.MaxResponseSize))
+	if err != nil {
+		return err
+	}
+	// server which sends compressed data accepts it too
+	if compressed {
+		a.compress = true
+	}
+
+	return json.Unmarshal(b, res)
+}
+
+// parseDelay parses update interval of item, e.g. 30, 30s or 5m,
+// flexible and scheduling intervals are ignored
+func parseDelay(delay string) (time.Duration, error) {
+	delay, _, _ = strings.Cut(delay, ";")
+	raw := delay
+
+	unit := time.Second
+	if delay != "" {
+		switch delay[len(delay)-1] {
+		case 's':
+			delay = delay[:len(delay)-1]
+		case 'm':
+			unit = time.Minute
+			delay = delay[:len(delay)-1]
+		case 'h':
+			unit = time.Hour
+			delay = delay[:len(delay)-1]
+		case 'd':
+			unit = 24 * time.Hour
+			delay = delay[:len(delay)-1]
+		case 'w':
+			unit = 7 * 24 * time.Hour
+			delay = delay[:len(delay)-1]
+		}
+	}
+
+	n, err := strconv.Atoi(delay)
+	if err != nil || n < 0 {
+		return 0, errors.New(fmt.Sprintf("invalid update interval \"%s\"", raw))
+	}
+
+	// items with only flexible intervals have zero delay
+	if n == 0 {
+		return time.Minute, nil
+	}
+
+	return time.Duration(n) * unit, nil
+}
@@ -0,0 +1,215 @@
+package zbx
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeActiveServer answers agent data requests with responses in order
+// and records values of every request
+type fakeActiveServer struct {
+	listener  net.Listener
+	responses []agentDataResponse
+
+	mu       sync.Mutex
+	requests [][]agentDataValue
+}
+
+func newFakeActiveServer(t *testing.T, responses ...agentDataResponse) *fakeActiveServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeActiveServer{listener: l, responses: responses}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeActiveServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	data, _, err := readPacket(conn, 0)
+	if err != nil {
+		return
+	}
+	req := agentDataRequest{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	res := s.responses[min(len(s.requests), len(s.responses)-1)]
+	s.requests = append(s.requests, req.Data)
+	s.mu.Unlock()
+
+	data, _ = json.Marshal(res)
+	writePacket(conn, data, false)
+}
+
+func (s *fakeActiveServer) received() [][]agentDataValue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]agentDataValue(nil), s.requests...)
+}
+
+func newTestActiveAgent(address string) *activeAgent {
+	return &activeAgent{
+		opts: ActiveOptions{
+			ServerAddress:   address,
+			Hostname:        "zcm",
+			SendInterval:    5 * time.Second,
+			MaxResponseSize: defaultMaxRequestSize,
+			Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		},
+		buffer: []agentDataValue{{Key: "a.ok", ID: 1, Value: "1"}, {Key: "b.ok", ID: 2, Value: "0"}},
+	}
+}
+
+func TestActiveSendKeepsValuesUntilAccepted(t *testing.T) {
+	server := newFakeActiveServer(t,
+		agentDataResponse{Response: "failed", Info: "host [zcm] not found"},
+		agentDataResponse{Response: "success", Info: "processed: 2; failed: 0; total: 2; seconds spent: 0.000055"},
+	)
+	a := newTestActiveAgent(server.listener.Addr().String())
+	now := time.Now()
+
+	a.send(now)
+	if len(a.buffer) != 2 {
+		t.Fatalf("values were dropped after rejected request, buffer %v", a.buffer)
+	}
+	if a.backoff != a.opts.SendInterval {
+		t.Errorf("got backoff %s, want %s", a.backoff, a.opts.SendInterval)
+	}
+
+	// attempt before backoff elapsed doesn't reach server
+	a.send(now.Add(time.Second))
+	if n := len(server.received()); n != 1 {
+		t.Fatalf("got %d requests during backoff, want 1", n)
+	}
+
+	a.send(now.Add(a.backoff))
+	requests := server.received()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if len(requests[1]) != 2 || requests[1][0].ID != 1 || requests[1][1].ID != 2 {
+		t.Errorf("retry didn't resend kept values, got %v", requests[1])
+	}
+	if len(a.buffer) != 0 || a.backoff != 0 || !a.retryAt.IsZero() {
+		t.Errorf("accepted values weren't cleared, buffer %v, backoff %s, retry at %s", a.buffer, a.backoff, a.retryAt)
+	}
+}
+
+func TestActiveSendDropsValuesServerFailed(t *testing.T) {
+	server := newFakeActiveServer(t, agentDataResponse{Response: "success", Info: "processed: 1; failed: 1; total: 2; seconds spent: 0.000055"})
+	a := newTestActiveAgent(server.listener.Addr().String())
+
+	a.send(time.Now())
+	if len(a.buffer) != 0 {
+		t.Errorf("values processed by server were kept, buffer %v", a.buffer)
+	}
+}
+
+func TestActiveSendKeepsValuesOnConnectionError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	a := newTestActiveAgent(address)
+	a.send(time.Now())
+	if len(a.buffer) != 2 {
+		t.Errorf("values were dropped after connection error, buffer %v", a.buffer)
+	}
+	if a.retryAt.IsZero() {
+		t.Error("next attempt wasn't postponed")
+	}
+}
+
+func TestActiveExchangeRejectsOversizedResponse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		readPacket(conn, 0)
+		// header announcing 4 GiB of data, which never comes
+		header := append([]byte(protocol), flag)
+		header = binary.LittleEndian.AppendUint32(header, math.MaxUint32)
+		header = binary.LittleEndian.AppendUint32(header, 0)
+		conn.Write(header)
+	}()
+
+	a := newTestActiveAgent(l.Addr().String())
+	err = a.exchange(agentDataRequest{Request: "agent data"}, &agentDataResponse{})
+	if err == nil || !strings.Contains(err.Error(), "limit is 1048576") {
+		t.Errorf("got error %v, want size limit error", err)
+	}
+}
+
+func TestActiveRetryBackoff(t *testing.T) {
+	a := &activeAgent{opts: ActiveOptions{SendInterval: 5 * time.Second}}
+	now := time.Now()
+
+	want := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 160 * time.Second, activeMaxBackoff, activeMaxBackoff}
+	for i, w := range want {
+		a.retry(now)
+		if a.backoff != w {
+			t.Fatalf("attempt %d: got backoff %s, want %s", i+1, a.backoff, w)
+		}
+		if !a.retryAt.Equal(now.Add(w)) {
+			t.Fatalf("attempt %d: got retry at %s, want %s", i+1, a.retryAt, now.Add(w))
+		}
+	}
+}
+
+func TestFailedValues(t *testing.T) {
+	tests := []struct {
+		info string
+		want int
+	}{
+		{"processed: 2; failed: 0; total: 2; seconds spent: 0.000055", 0},
+		{"processed: 1; failed: 3; total: 4; seconds spent: 0.000055", 3},
+		{"failed:7", 7},
+		{"host [zcm] not found", 0},
+		{"failed: x", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := failedValues(tt.info); got != tt.want {
+			t.Errorf("%q: got %d, want %d", tt.info, got, tt.want)
+		}
+	}
+}
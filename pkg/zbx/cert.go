@@ -0,0 +1,62 @@
+package zbx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+type CertOptions struct {
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	// ServerCertIssuer and ServerCertSubject, when set, must match issuer and subject
+	// of Zabbix server's certificate in RFC 4514 form, e.g. CN=Zabbix CA,O=Example
+	ServerCertIssuer  string
+	ServerCertSubject string
+}
+
+// LoadCertConfig returns TLS config of listener which requires Zabbix server
+// to present certificate signed by CA, as Zabbix agent's TLSAccept=cert
+func LoadCertConfig(opts CertOptions) (*tls.Config, error) {
+	if opts.CAFile == "" || opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("CA file, certificate file and key file are required for certificate encryption")
+	}
+
+	cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error while loading certificate, error: %s", err))
+	}
+
+	ca, err := os.ReadFile(opts.CAFile)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error while reading CA file, error: %s", err))
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New(fmt.Sprintf("no certificates found in CA file %s", opts.CAFile))
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			peer := cs.PeerCertificates[0]
+
+			if opts.ServerCertIssuer != "" && peer.Issuer.String() != opts.ServerCertIssuer {
+				return errors.New(fmt.Sprintf("certificate issuer \"%s\" doesn't match", peer.Issuer))
+			}
+
+			if opts.ServerCertSubject != "" && peer.Subject.String() != opts.ServerCertSubject {
+				return errors.New(fmt.Sprintf("certificate subject \"%s\" doesn't match", peer.Subject))
+			}
+
+			return nil
+		},
+	}, nil
+}
@@ -0,0 +1,68 @@
+package zbx
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// flagCompressed marks packet with zlib compressed data, its reserved
+	// bytes carry length of uncompressed data
+	flagCompressed byte = 0x02
+
+	// compressThreshold is size of data from which packets are compressed,
+	// smaller ones would hardly get shorter
+	compressThreshold = 1024
+)
+
+// inflate decompresses data of compressed packet and verifies it
+// has length given in packet's header
+func inflate(data []byte, size uint32) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error while decompressing data, error: %s", err))
+	}
+	defer zr.Close()
+
+	// size comes from peer, so preallocation is bounded, e.g. for active
+	// checks responses of server, which aren't limited
+	buf := bytes.NewBuffer(make([]byte, 0, min(size, defaultMaxRequestSize)))
+	// one byte over size tells data is longer than declared
+	if _, err := io.Copy(buf, io.LimitReader(zr, int64(size)+1)); err != nil {
+		return nil, errors.New(fmt.Sprintf("error while decompressing data, error: %s", err))
+	}
+
+	if uint32(buf.Len()) != size {
+		return nil, errors.New(fmt.Sprintf("decompressed data has %d bytes, expected %d", buf.Len(), size))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// compressPacket appends packet with compressed data of uncompressed packet to dst
+func compressPacket(dst, packet []byte) ([]byte, error) {
+	data := packet[headerSize:]
+
+	start := len(dst)
+	dst = append(dst, protocol...)
+	dst = append(dst, flag|flagCompressed)
+	dst = binary.LittleEndian.AppendUint32(dst, 0)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(data)))
+
+	buf := bytes.NewBuffer(dst)
+	zw := zlib.NewWriter(buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	dst = buf.Bytes()
+	binary.LittleEndian.PutUint32(dst[start+protocolSize+flagSize:], uint32(len(dst)-start-headerSize))
+	return dst, nil
+}
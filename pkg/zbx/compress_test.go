@@ -0,0 +1,179 @@
+package zbx
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func zlibData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// rawPacket builds packet with given flag, data and reserved bytes
+func rawPacket(flag byte, data []byte, reserved uint32) []byte {
+	packet := append([]byte(protocol), flag)
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(len(data)))
+	packet = binary.LittleEndian.AppendUint32(packet, reserved)
+	return append(packet, data...)
+}
+
+func TestWritePacketReadPacket(t *testing.T) {
+	small := []byte(`{"request":"passive checks","data":[{"key":"zcm.version","timeout":3}]}`)
+	large := []byte(strings.Repeat(`{"key":"target.ok","value":"1"},`, 100))
+
+	tests := []struct {
+		name       string
+		data       []byte
+		compress   bool
+		compressed bool
+	}{
+		{"small", small, false, false},
+		{"small with compression isn't compressed", small, true, false},
+		{"large", large, false, false},
+		{"large with compression", large, true, true},
+		{"threshold with compression", large[:compressThreshold], true, true},
+		{"below threshold with compression", large[:compressThreshold-1], true, false},
+		{"empty", []byte{}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writePacket(&buf, tt.data, tt.compress); err != nil {
+				t.Fatal(err)
+			}
+			packet := buf.Bytes()
+
+			if string(packet[:protocolSize]) != protocol {
+				t.Fatalf("got protocol %q", packet[:protocolSize])
+			}
+			dataLen := binary.LittleEndian.Uint32(packet[5:])
+			reserved := binary.LittleEndian.Uint32(packet[9:])
+			if int(dataLen) != len(packet)-headerSize {
+				t.Errorf("header has data length %d, packet carries %d bytes", dataLen, len(packet)-headerSize)
+			}
+
+			if tt.compressed {
+				if packet[4] != flag|flagCompressed {
+					t.Errorf("got flag %x, want %x", packet[4], flag|flagCompressed)
+				}
+				if int(reserved) != len(tt.data) {
+					t.Errorf("reserved bytes carry %d, want uncompressed length %d", reserved, len(tt.data))
+				}
+				if int(dataLen) >= len(tt.data) {
+					t.Errorf("compressed data has %d bytes, uncompressed %d", dataLen, len(tt.data))
+				}
+			} else {
+				if packet[4] != flag || reserved != 0 || !bytes.Equal(packet[headerSize:], tt.data) {
+					t.Errorf("got packet %q", packet)
+				}
+			}
+
+			got, compressed, err := readPacket(bytes.NewReader(packet), 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if compressed != tt.compressed {
+				t.Errorf("got compressed %v, want %v", compressed, tt.compressed)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("got %q, want %q", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestCompressPacketAppends(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 2000)
+	prefix := []byte("prefix")
+
+	out, err := compressPacket(append([]byte{}, prefix...), rawPacket(flag, data, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out, prefix) {
+		t.Fatalf("prefix was overwritten, got %q", out[:len(prefix)])
+	}
+
+	got, compressed, err := readPacket(bytes.NewReader(out[len(prefix):]), 0)
+	if err != nil || !compressed || !bytes.Equal(got, data) {
+		t.Errorf("got %d bytes, compressed %v, error %v", len(got), compressed, err)
+	}
+}
+
+// Zabbix compresses with zlib format, i.e. deflate with zlib header and checksum
+func TestReadPacketCompressed(t *testing.T) {
+	data := []byte(`{"request":"passive checks","data":[{"key":"a","timeout":3}]}`)
+
+	got, compressed, err := readPacket(bytes.NewReader(rawPacket(flag|flagCompressed, zlibData(t, data), uint32(len(data)))), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !compressed || !bytes.Equal(got, data) {
+		t.Errorf("got %q, compressed %v", got, compressed)
+	}
+
+	req, compressed, err := decode(bytes.NewReader(rawPacket(flag|flagCompressed, zlibData(t, data), uint32(len(data)))), 1024)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !compressed || len(req.Data) != 1 || req.Data[0].Key != "a" {
+		t.Errorf("got %+v, compressed %v", req, compressed)
+	}
+}
+
+func TestReadPacketCompressedErrors(t *testing.T) {
+	data := []byte(strings.Repeat("zabbix ", 100))
+	compressed := zlibData(t, data)
+
+	var deflated bytes.Buffer
+	fw, _ := flate.NewWriter(&deflated, flate.DefaultCompression)
+	fw.Write(data)
+	fw.Close()
+
+	corrupted := append([]byte{}, compressed...)
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	tests := []struct {
+		name    string
+		packet  []byte
+		maxSize uint32
+		err     string
+	}{
+		{"declared length shorter", rawPacket(flag|flagCompressed, compressed, uint32(len(data)-1)), 0, "decompressed data has 700 bytes, expected 699"},
+		{"declared length longer", rawPacket(flag|flagCompressed, compressed, uint32(len(data)+1)), 0, "decompressed data has 700 bytes, expected 701"},
+		// declared length isn't allocated upfront when there's no limit
+		{"huge declared length", rawPacket(flag|flagCompressed, compressed, 1<<32-1), 0, "expected 4294967295"},
+		{"zero declared length", rawPacket(flag|flagCompressed, compressed, 0), 0, "expected 0"},
+		{"uncompressed data with compressed flag", rawPacket(flag|flagCompressed, data, uint32(len(data))), 0, "error while decompressing data"},
+		{"raw deflate without zlib header", rawPacket(flag|flagCompressed, deflated.Bytes(), uint32(len(data))), 0, "error while decompressing data"},
+		{"checksum mismatch", rawPacket(flag|flagCompressed, corrupted, uint32(len(data))), 0, "error while decompressing data"},
+		{"truncated compressed data", rawPacket(flag|flagCompressed, compressed[:len(compressed)/2], uint32(len(data))), 0, "error while decompressing data"},
+		{"empty compressed data", rawPacket(flag|flagCompressed, nil, 10), 0, "error while decompressing data"},
+		{"uncompressed length over limit", rawPacket(flag|flagCompressed, compressed, uint32(len(data))), 500, "packet data has 700 bytes, limit is 500"},
+		{"compressed length over limit", rawPacket(flag|flagCompressed, compressed, 10), 5, "limit is 5"},
+		{"unsupported flag", rawPacket(0x04|flag, data, 0), 0, "Unsupported flag 5"},
+		{"compressed flag without protocol flag", rawPacket(flagCompressed, compressed, uint32(len(data))), 0, "Unsupported flag 2"},
+		{"packet shorter than data length", rawPacket(flag|flagCompressed, compressed, uint32(len(data)))[:headerSize+5], 0, "error while reading data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := readPacket(bytes.NewReader(tt.packet), tt.maxSize)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v (data %q), want error containing %q", err, got, tt.err)
+			}
+		})
+	}
+}
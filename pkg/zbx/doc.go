@@ -0,0 +1,38 @@
+// Package zbx implements Zabbix agent protocol, so any program can be
+// monitored by Zabbix as passive agent, active agent or both.
+//
+// Values of items are provided by Handler, ItemHandler adapts plain function:
+//
+//	handler := zbx.ItemHandler(func(key string) (interface{}, error) {
+//		switch key {
+//		case "app.queue.length":
+//			return queue.Len(), nil
+//		}
+//		return nil, errors.New("unsupported item key")
+//	})
+//
+// ServeMux routes items to handlers by key name or prefix, ParseKey splits
+// key into name and parameters.
+//
+// Server answers requests of Zabbix server or proxy (passive checks).
+// It supports unencrypted, TLS-PSK and certificate encrypted connections,
+// compressed packets and several items in single request:
+//
+//	server := &zbx.Server{
+//		Addresses:    []string{"0.0.0.0:10050"},
+//		Handler:      handler,
+//		AllowedPeers: []string{"zabbix.example.com"},
+//		ReadTimeout:  5 * time.Second,
+//	}
+//	err := server.ListenAndServe(ctx)
+//
+// RunActive requests list of items from server and sends their values
+// periodically (active checks):
+//
+//	err := zbx.RunActive(ctx, zbx.ActiveOptions{
+//		ServerAddress: "zabbix.example.com",
+//		Hostname:      "app-1",
+//	}, handler)
+//
+// Both stop when ctx is cancelled.
+package zbx
@@ -0,0 +1,151 @@
+package zbx
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// response of passive check is always the same json apart from values,
+// so the rest is pre-encoded and values are appended without reflection
+const (
+	responsePrefix = `{"version":"7.0.0","variant":2,"data":[`
+	responseSuffix = `]}`
+	valuePrefix    = `{"value":`
+	errorPrefix    = `{"error":`
+
+	headerSize = protocolSize + flagSize + datalenSize + reservedSize
+
+	// buffers grown above maxPooledBuffer aren't returned to the pool
+	maxPooledBuffer = 64 << 10
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBuffer {
+		return
+	}
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
+
+// itemResult is value or error of item requested by passive check
+type itemResult struct {
+	value interface{}
+	err   error
+}
+
+// appendResponse appends whole packet with agent response carrying results
+// of requested items, in order they were requested
+func appendResponse(b []byte, results []itemResult) ([]byte, error) {
+	start := len(b)
+	b = append(b, protocol...)
+	b = append(b, flag)
+	b = append(b, make([]byte, datalenSize+reservedSize)...)
+
+	b = append(b, responsePrefix...)
+	for i, r := range results {
+		if i > 0 {
+			b = append(b, ',')
+		}
+
+		var err error
+		if r.err != nil {
+			b = append(b, errorPrefix...)
+			b, err = appendString(b, r.err.Error())
+		} else {
+			b = append(b, valuePrefix...)
+			b, err = appendValue(b, r.value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, '}')
+	}
+	b = append(b, responseSuffix...)
+
+	binary.LittleEndian.PutUint32(b[start+protocolSize+flagSize:], uint32(len(b)-start-headerSize))
+	return b, nil
+}
+
+// appendValue appends value encoded as json, types returned by item handlers
+// are encoded directly, other ones fall back to json.Marshal
+func appendValue(b []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(b, "null"...), nil
+	case string:
+		return appendString(b, v)
+	case bool:
+		return strconv.AppendBool(b, v), nil
+	case int:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(b, v, 10), nil
+	case uint64:
+		return strconv.AppendUint(b, v, 10), nil
+	case float64:
+		return appendFloat(b, v)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, data...), nil
+}
+
+// appendString quotes strings which don't need escaping, others are
+// escaped by json.Marshal
+func appendString(b []byte, s string) ([]byte, error) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= utf8.RuneSelf || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			data, err := json.Marshal(s)
+			if err != nil {
+				return nil, err
+			}
+			return append(b, data...), nil
+		}
+	}
+
+	b = append(b, '"')
+	b = append(b, s...)
+	return append(b, '"'), nil
+}
+
+// appendFloat formats float the same way as encoding/json
+func appendFloat(b []byte, f float64) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, &json.UnsupportedValueError{Str: strconv.FormatFloat(f, 'g', -1, 64)}
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b, nil
+}
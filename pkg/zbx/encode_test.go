@@ -0,0 +1,119 @@
+package zbx
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestAppendResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []itemResult
+		want    string
+	}{
+		{"single value", []itemResult{{value: 1}}, `[{"value":1}]`},
+		{"single error", []itemResult{{err: errors.New("unsupported item key")}}, `[{"error":"unsupported item key"}]`},
+		{
+			"values and errors keep order",
+			[]itemResult{{value: "up"}, {err: errors.New("target \"x\" not found")}, {value: 0.25}, {value: nil}, {value: true}},
+			`[{"value":"up"},{"error":"target \"x\" not found"},{"value":0.25},{"value":null},{"value":true}]`,
+		},
+		{"no results", nil, `[]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := []byte("prefix")
+			b, err := appendResponse(append([]byte{}, prefix...), tt.results)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if string(b[:len(prefix)]) != string(prefix) {
+				t.Fatalf("prefix was overwritten, got %q", b[:len(prefix)])
+			}
+			packet := b[len(prefix):]
+
+			if string(packet[:protocolSize]) != protocol || packet[4] != flag {
+				t.Fatalf("got header %q", packet[:headerSize])
+			}
+			if n := binary.LittleEndian.Uint32(packet[5:]); int(n) != len(packet)-headerSize {
+				t.Errorf("header has data length %d, packet carries %d bytes", n, len(packet)-headerSize)
+			}
+
+			want := responsePrefix + tt.want[1:len(tt.want)-1] + responseSuffix
+			if got := string(packet[headerSize:]); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if !json.Valid(packet[headerSize:]) {
+				t.Errorf("response isn't valid json: %s", packet[headerSize:])
+			}
+		})
+	}
+}
+
+func TestAppendResponseUnsupportedValue(t *testing.T) {
+	if _, err := appendResponse(nil, []itemResult{{value: 1}, {value: math.NaN()}}); err == nil {
+		t.Error("expected error for NaN value")
+	}
+}
+
+// values are encoded the same way as by encoding/json
+func TestAppendValue(t *testing.T) {
+	values := []interface{}{
+		nil, "", "plain", "quote \" and \\", "<html>&", "new\nline", "zażółć", "\x00\x1f", "\xff invalid",
+		true, false, 0, -1, int64(math.MaxInt64), uint64(math.MaxUint64),
+		0.0, 1.5, -2.25, 1e20, 1e21, 123456789.125, 1e-6, 1e-7, -3e-9, 5e-324, math.MaxFloat64,
+		map[string]interface{}{"a": []int{1, 2}}, []string{"x"}, float32(0.5), int32(-7),
+	}
+
+	for _, v := range values {
+		want, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := appendValue(nil, v)
+		if err != nil {
+			t.Errorf("%#v: unexpected error: %s", v, err)
+			continue
+		}
+		if string(got) != string(want) {
+			t.Errorf("%#v: got %s, want %s", v, got, want)
+		}
+	}
+}
+
+func TestAppendValueErrors(t *testing.T) {
+	for _, v := range []interface{}{math.NaN(), math.Inf(1), math.Inf(-1), make(chan int)} {
+		if b, err := appendValue(nil, v); err == nil {
+			t.Errorf("%#v: expected error, got %s", v, b)
+		}
+	}
+}
+
+func BenchmarkAppendResponse(b *testing.B) {
+	results := make([]itemResult, 10)
+	for i := range results {
+		switch i % 4 {
+		case 0:
+			results[i].value = 0.125 * float64(i)
+		case 1:
+			results[i].value = int64(i)
+		case 2:
+			results[i].value = "status \"ok\""
+		case 3:
+			results[i].err = errors.New("target \"x\" not found")
+		}
+	}
+
+	var buf []byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = appendResponse(buf[:0], results); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
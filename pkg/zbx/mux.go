@@ -0,0 +1,184 @@
+package zbx
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ServeMux is Handler dispatching items to handlers registered for key
+// patterns. Pattern is either item key name, matching key with or without
+// parameters in brackets (e.g. "web.check" matches "web.check[api,status]"),
+// or name prefix ending with "*" (e.g. "app.*", "*" matches every key).
+// Exact names take precedence over prefixes, longer prefixes over shorter.
+// Handlers get whole key, ParseKey splits it into name and parameters.
+type ServeMux struct {
+	mu       sync.RWMutex
+	exact    map[string]Handler
+	prefixes []muxEntry
+}
+
+type muxEntry struct {
+	prefix  string
+	handler Handler
+}
+
+func NewServeMux() *ServeMux {
+	return &ServeMux{exact: map[string]Handler{}}
+}
+
+// Handle registers handler for pattern, it panics when pattern
+// is invalid or already registered
+func (m *ServeMux) Handle(pattern string, handler Handler) {
+	if pattern == "" || strings.ContainsAny(pattern, "[]") {
+		panic(fmt.Sprintf("zbx: invalid pattern \"%s\"", pattern))
+	}
+	if handler == nil {
+		panic("zbx: nil handler")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		for _, e := range m.prefixes {
+			if e.prefix == prefix {
+				panic(fmt.Sprintf("zbx: multiple registrations for \"%s\"", pattern))
+			}
+		}
+
+		m.prefixes = append(m.prefixes, muxEntry{prefix: prefix, handler: handler})
+		sort.SliceStable(m.prefixes, func(i, j int) bool {
+			return len(m.prefixes[i].prefix) > len(m.prefixes[j].prefix)
+		})
+		return
+	}
+
+	if _, ok := m.exact[pattern]; ok {
+		panic(fmt.Sprintf("zbx: multiple registrations for \"%s\"", pattern))
+	}
+	m.exact[pattern] = handler
+}
+
+// HandleFunc registers function as handler for pattern
+func (m *ServeMux) HandleFunc(pattern string, handler func(key string) (interface{}, error)) {
+	m.Handle(pattern, ItemHandler(handler))
+}
+
+// Item answers item with handler registered for its key
+func (m *ServeMux) Item(key string) (interface{}, error) {
+	name, _, _ := strings.Cut(key, "[")
+
+	m.mu.RLock()
+	handler, ok := m.exact[name]
+	if !ok {
+		for _, e := range m.prefixes {
+			if strings.HasPrefix(name, e.prefix) {
+				handler, ok = e.handler, true
+				break
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, errors.New("unsupported item key")
+	}
+	return handler.Item(key)
+}
+
+// ParseKey splits item key into name and parameters following Zabbix
+// key syntax: parameters are comma separated in brackets after name,
+// quoted ones may contain commas and brackets (\" escapes quote), array
+// parameters (e.g. [a,b]) are returned as they are, with brackets
+func ParseKey(key string) (string, []string, error) {
+	open := strings.Index(key, "[")
+	if open == -1 {
+		return key, nil, nil
+	}
+
+	name := key[:open]
+	if name == "" {
+		return "", nil, errors.New(fmt.Sprintf("invalid item key \"%s\", missing name", key))
+	}
+	if !strings.HasSuffix(key, "]") {
+		return "", nil, errors.New(fmt.Sprintf("invalid item key \"%s\", missing closing bracket", key))
+	}
+
+	rest := key[open+1 : len(key)-1]
+	params := []string{}
+	for {
+		rest = strings.TrimLeft(rest, " ")
+
+		var (
+			param string
+			err   error
+		)
+		switch {
+		case strings.HasPrefix(rest, "\""):
+			param, rest, err = cutQuotedParam(rest)
+		case strings.HasPrefix(rest, "["):
+			param, rest, err = cutArrayParam(rest)
+		default:
+			end := strings.Index(rest, ",")
+			if end == -1 {
+				end = len(rest)
+			}
+			param, rest = strings.TrimRight(rest[:end], " "), rest[end:]
+			if strings.ContainsAny(param, "[]\"") {
+				err = errors.New(fmt.Sprintf("unexpected character in unquoted parameter \"%s\"", param))
+			}
+		}
+		if err != nil {
+			return "", nil, errors.New(fmt.Sprintf("invalid item key \"%s\", %s", key, err))
+		}
+		params = append(params, param)
+
+		rest = strings.TrimLeft(rest, " ")
+		if rest == "" {
+			return name, params, nil
+		}
+		if rest[0] != ',' {
+			return "", nil, errors.New(fmt.Sprintf("invalid item key \"%s\", expected comma after parameter", key))
+		}
+		rest = rest[1:]
+	}
+}
+
+// cutQuotedParam returns unquoted parameter at start of s and rest after it
+func cutQuotedParam(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '"':
+			b.WriteByte('"')
+			i++
+		case s[i] == '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", errors.New("unterminated quoted parameter")
+}
+
+// cutArrayParam returns array parameter at start of s with its brackets
+// and rest after it, quoted elements may contain brackets
+func cutArrayParam(s string) (string, string, error) {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\' && i+1 < len(s) && s[i+1] == '"':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == '[':
+			return "", "", errors.New("nested arrays are not supported")
+		case !quoted && s[i] == ']':
+			return s[:i+1], s[i+1:], nil
+		}
+	}
+	return "", "", errors.New("unterminated array parameter")
+}
@@ -0,0 +1,88 @@
+package zbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// peerAllowlist matches remote addresses against IPs, CIDR ranges and host names,
+// as Zabbix agent's Server parameter. Host names are resolved on every check.
+type peerAllowlist struct {
+	prefixes []netip.Prefix
+	hosts    []string
+}
+
+func parsePeers(peers []string) (*peerAllowlist, error) {
+	a := &peerAllowlist{}
+
+	for _, peer := range peers {
+		peer = strings.TrimSpace(peer)
+		if peer == "" {
+			continue
+		}
+
+		if strings.Contains(peer, "/") {
+			prefix, err := netip.ParsePrefix(peer)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid allowed peer \"%s\", error: %s", peer, err))
+			}
+			a.prefixes = append(a.prefixes, prefix.Masked())
+			continue
+		}
+
+		if addr, err := netip.ParseAddr(peer); err == nil {
+			addr = addr.Unmap()
+			a.prefixes = append(a.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		a.hosts = append(a.hosts, peer)
+	}
+
+	if len(a.prefixes) == 0 && len(a.hosts) == 0 {
+		return nil, errors.New("allowed peers list is empty")
+	}
+
+	return a, nil
+}
+
+func (a *peerAllowlist) allows(remote net.Addr) bool {
+	tcpAddr, ok := remote.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	addr, ok := netip.AddrFromSlice(tcpAddr.IP)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range a.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	for _, host := range a.hosts {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		cancel()
+		if err != nil {
+			continue
+		}
+
+		for _, resolved := range addrs {
+			if resolved.Unmap() == addr {
+				return true
+			}
+		}
+	}
+
+	return false
+}
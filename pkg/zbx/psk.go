@@ -0,0 +1,571 @@
+package zbx
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Go's crypto/tls doesn't implement pre-shared keys, so the server side of
+// TLS 1.2 with TLS_PSK_WITH_AES_128_GCM_SHA256 (RFC 4279, RFC 5487) is
+// implemented here. It is one of the ciphersuites offered by Zabbix for PSK.
+
+type PSK struct {
+	Identity string
+	Key      []byte
+}
+
+const (
+	recordTypeChangeCipherSpec byte = 20
+	recordTypeAlert            byte = 21
+	recordTypeHandshake        byte = 22
+	recordTypeApplicationData  byte = 23
+
+	handshakeTypeClientHello       byte = 1
+	handshakeTypeServerHello       byte = 2
+	handshakeTypeServerHelloDone   byte = 14
+	handshakeTypeClientKeyExchange byte = 16
+	handshakeTypeFinished          byte = 20
+
+	alertCloseNotify        byte = 0
+	alertHandshakeFailure   byte = 40
+	alertDecodeError        byte = 50
+	alertDecryptError       byte = 51
+	alertProtocolVersion    byte = 70
+	alertUnknownPSKIdentity byte = 115
+
+	versionTLS12 uint16 = 0x0303
+
+	suitePSKWithAES128GCMSHA256 uint16 = 0x00a8
+	suiteEmptyRenegotiationInfo uint16 = 0x00ff
+	extensionRenegotiationInfo  uint16 = 0xff01
+
+	recordHeaderSize = 5
+	maxPlaintext     = 16384
+	maxRecord        = maxPlaintext + 2048
+	// maxHandshakeMessage limits messages of client, PSK ClientHello and
+	// ClientKeyExchange have a few hundred bytes even with many
+	// suites and extensions
+	maxHandshakeMessage = 8192
+
+	gcmExplicitNonceSize = 8
+	gcmTagSize           = 16
+	verifyDataSize       = 12
+)
+
+var errRecordAuthentication = errors.New("tls; record authentication failed")
+
+type halfConn struct {
+	aead cipher.AEAD
+	salt []byte
+	seq  uint64
+}
+
+func newHalfConn(key, salt []byte) (*halfConn, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &halfConn{aead: aead, salt: salt}, nil
+}
+
+func (h *halfConn) additionalData(typ byte, size int) []byte {
+	ad := binary.BigEndian.AppendUint64(nil, h.seq)
+	ad = append(ad, typ)
+	ad = binary.BigEndian.AppendUint16(ad, versionTLS12)
+	return binary.BigEndian.AppendUint16(ad, uint16(size))
+}
+
+func (h *halfConn) seal(typ byte, plaintext []byte) []byte {
+	explicit := binary.BigEndian.AppendUint64(nil, h.seq)
+	nonce := append(append([]byte{}, h.salt...), explicit...)
+
+	out := h.aead.Seal(explicit, nonce, plaintext, h.additionalData(typ, len(plaintext)))
+	h.seq++
+
+	return out
+}
+
+func (h *halfConn) open(typ byte, payload []byte) ([]byte, error) {
+	if len(payload) < gcmExplicitNonceSize+gcmTagSize {
+		return nil, errors.New("tls; encrypted record too short")
+	}
+
+	nonce := append(append([]byte{}, h.salt...), payload[:gcmExplicitNonceSize]...)
+	ciphertext := payload[gcmExplicitNonceSize:]
+
+	plaintext, err := h.aead.Open(nil, nonce, ciphertext, h.additionalData(typ, len(ciphertext)-gcmTagSize))
+	if err != nil {
+		return nil, errRecordAuthentication
+	}
+	h.seq++
+
+	return plaintext, nil
+}
+
+// pskConn is server side of TLS-PSK connection
+type pskConn struct {
+	net.Conn
+	psk *PSK
+
+	in  *halfConn
+	out *halfConn
+
+	transcript hash.Hash
+	handshake  []byte // buffered handshake bytes
+	input      []byte // buffered application data
+
+	writeMu sync.Mutex
+}
+
+// pskServer performs TLS-PSK handshake on conn
+func pskServer(conn net.Conn, psk *PSK) (net.Conn, error) {
+	c := &pskConn{Conn: conn, psk: psk, transcript: sha256.New()}
+	if err := c.serverHandshake(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *pskConn) serverHandshake() error {
+	hello, err := c.readHandshake(handshakeTypeClientHello)
+	if err != nil {
+		return err
+	}
+
+	ch, err := parseClientHello(hello)
+	if err != nil {
+		return err
+	}
+
+	if ch.version < versionTLS12 {
+		c.sendAlert(alertProtocolVersion)
+		return errors.New("tls; client doesn't support TLS 1.2")
+	}
+
+	if !ch.offersPSK {
+		c.sendAlert(alertHandshakeFailure)
+		return errors.New("tls; client doesn't offer TLS_PSK_WITH_AES_128_GCM_SHA256")
+	}
+	clientRandom := ch.random
+
+	serverRandom := make([]byte, 32)
+	if _, err := rand.Read(serverRandom); err != nil {
+		return err
+	}
+
+	body := binary.BigEndian.AppendUint16(nil, versionTLS12)
+	body = append(body, serverRandom...)
+	body = append(body, 0) // empty session id, resumption isn't supported
+	body = binary.BigEndian.AppendUint16(body, suitePSKWithAES128GCMSHA256)
+	body = append(body, 0) // no compression
+	if ch.renegotiation {
+		// RFC 5746, initial handshake has empty renegotiated_connection
+		body = binary.BigEndian.AppendUint16(body, 5)
+		body = binary.BigEndian.AppendUint16(body, extensionRenegotiationInfo)
+		body = binary.BigEndian.AppendUint16(body, 1)
+		body = append(body, 0)
+	}
+
+	flight := c.handshakeMessage(handshakeTypeServerHello, body)
+	flight = append(flight, c.handshakeMessage(handshakeTypeServerHelloDone, nil)...)
+	if err := c.writeRecord(recordTypeHandshake, flight); err != nil {
+		return err
+	}
+
+	keyExchange, err := c.readHandshake(handshakeTypeClientKeyExchange)
+	if err != nil {
+		return err
+	}
+
+	if len(keyExchange) < 2 || int(binary.BigEndian.Uint16(keyExchange))+2 != len(keyExchange) {
+		c.sendAlert(alertHandshakeFailure)
+		return errors.New("tls; malformed client key exchange")
+	}
+
+	identity := string(keyExchange[2:])
+	if identity != c.psk.Identity {
+		c.sendAlert(alertUnknownPSKIdentity)
+		return errors.New(fmt.Sprintf("tls; unknown PSK identity \"%s\"", identity))
+	}
+
+	master := masterSecret(c.psk.Key, clientRandom, serverRandom)
+	clientKey, serverKey, clientSalt, serverSalt := keyExpansion(master, clientRandom, serverRandom)
+
+	if err := c.readChangeCipherSpec(); err != nil {
+		return err
+	}
+
+	if c.in, err = newHalfConn(clientKey, clientSalt); err != nil {
+		return err
+	}
+
+	expected := prf(master, "client finished", c.transcript.Sum(nil), verifyDataSize)
+	finished, err := c.readHandshake(handshakeTypeFinished)
+	if err != nil && err != errRecordAuthentication {
+		return err
+	}
+
+	// different key makes decryption of finished fail as well
+	if err != nil || !hmac.Equal(finished, expected) {
+		c.sendAlert(alertDecryptError)
+		return errors.New("tls; client finished verification failed, PSK doesn't match")
+	}
+
+	if err := c.writeRecord(recordTypeChangeCipherSpec, []byte{1}); err != nil {
+		return err
+	}
+
+	if c.out, err = newHalfConn(serverKey, serverSalt); err != nil {
+		return err
+	}
+
+	verify := prf(master, "server finished", c.transcript.Sum(nil), verifyDataSize)
+	return c.writeRecord(recordTypeHandshake, c.handshakeMessage(handshakeTypeFinished, verify))
+}
+
+type clientHello struct {
+	version       uint16
+	random        []byte
+	offersPSK     bool
+	renegotiation bool
+}
+
+// parseClientHello parses body of client hello handshake message
+func parseClientHello(hello []byte) (*clientHello, error) {
+	malformed := errors.New("tls; malformed client hello")
+
+	if len(hello) < 2+32+1 {
+		return nil, malformed
+	}
+
+	ch := &clientHello{version: binary.BigEndian.Uint16(hello), random: hello[2:34]}
+	rest := hello[34:]
+
+	sessionLen := int(rest[0])
+	if len(rest) < 1+sessionLen+2 {
+		return nil, malformed
+	}
+	rest = rest[1+sessionLen:]
+
+	suitesLen := int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2+suitesLen+1 || suitesLen%2 != 0 {
+		return nil, malformed
+	}
+	suites := rest[2 : 2+suitesLen]
+	rest = rest[2+suitesLen:]
+
+	for i := 0; i < len(suites); i += 2 {
+		switch binary.BigEndian.Uint16(suites[i:]) {
+		case suitePSKWithAES128GCMSHA256:
+			ch.offersPSK = true
+		case suiteEmptyRenegotiationInfo:
+			ch.renegotiation = true
+		}
+	}
+
+	compressionLen := int(rest[0])
+	if len(rest) < 1+compressionLen {
+		return nil, malformed
+	}
+	rest = rest[1+compressionLen:]
+
+	if len(rest) >= 2 {
+		extensions := rest[2:]
+		for len(extensions) >= 4 {
+			typ := binary.BigEndian.Uint16(extensions)
+			size := int(binary.BigEndian.Uint16(extensions[2:]))
+			if len(extensions) < 4+size {
+				return nil, malformed
+			}
+			if typ == extensionRenegotiationInfo {
+				ch.renegotiation = true
+			}
+			extensions = extensions[4+size:]
+		}
+	}
+
+	return ch, nil
+}
+
+// peekClientHello parses client hello from the first record without consuming it
+func peekClientHello(br *bufio.Reader) (*clientHello, error) {
+	header, err := br.Peek(recordHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int(binary.BigEndian.Uint16(header[3:]))
+	record, err := br.Peek(recordHeaderSize + size)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := record[recordHeaderSize:]
+	if header[0] != recordTypeHandshake || len(msg) < 4 || msg[0] != handshakeTypeClientHello {
+		return nil, errors.New("tls; expected client hello")
+	}
+
+	msgSize := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+	if len(msg) < 4+msgSize {
+		return nil, errors.New("tls; client hello split across records")
+	}
+
+	return parseClientHello(msg[4 : 4+msgSize])
+}
+
+func (c *pskConn) handshakeMessage(typ byte, body []byte) []byte {
+	msg := []byte{typ, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	msg = append(msg, body...)
+	c.transcript.Write(msg)
+	return msg
+}
+
+// readHandshake returns body of next handshake message, which has to be of type typ
+func (c *pskConn) readHandshake(typ byte) ([]byte, error) {
+	for {
+		if len(c.handshake) >= 4 {
+			size := int(c.handshake[1])<<16 | int(c.handshake[2])<<8 | int(c.handshake[3])
+			// message isn't buffered until its end, announced size is enough to refuse it
+			if size > maxHandshakeMessage {
+				c.sendAlert(alertDecodeError)
+				return nil, errors.New(fmt.Sprintf("tls; handshake message has %d bytes, limit is %d", size, maxHandshakeMessage))
+			}
+			if len(c.handshake) >= 4+size {
+				msg := c.handshake[:4+size]
+				c.handshake = c.handshake[4+size:]
+
+				if msg[0] != typ {
+					c.sendAlert(alertHandshakeFailure)
+					return nil, errors.New(fmt.Sprintf("tls; unexpected handshake message %d, expected %d", msg[0], typ))
+				}
+
+				// client finished is verified against transcript without itself
+				if typ == handshakeTypeFinished {
+					defer c.transcript.Write(msg)
+				} else {
+					c.transcript.Write(msg)
+				}
+				return msg[4:], nil
+			}
+		}
+
+		recordType, payload, err := c.readRecord()
+		if err != nil {
+			return nil, err
+		}
+
+		if recordType != recordTypeHandshake {
+			c.sendAlert(alertHandshakeFailure)
+			return nil, errors.New(fmt.Sprintf("tls; unexpected record %d during handshake", recordType))
+		}
+		c.handshake = append(c.handshake, payload...)
+	}
+}
+
+func (c *pskConn) readChangeCipherSpec() error {
+	recordType, payload, err := c.readRecord()
+	if err != nil {
+		return err
+	}
+
+	if recordType != recordTypeChangeCipherSpec || !bytes.Equal(payload, []byte{1}) || len(c.handshake) != 0 {
+		c.sendAlert(alertHandshakeFailure)
+		return errors.New("tls; expected change cipher spec")
+	}
+
+	return nil
+}
+
+// readRecord reads and decrypts next record, alerts are returned as errors
+func (c *pskConn) readRecord() (byte, []byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(c.Conn, header); err != nil {
+		return 0, nil, err
+	}
+
+	size := int(binary.BigEndian.Uint16(header[3:]))
+	if size > maxRecord {
+		return 0, nil, errors.New("tls; record too large")
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.Conn, payload); err != nil {
+		return 0, nil, err
+	}
+
+	typ := header[0]
+	if c.in != nil {
+		var err error
+		if payload, err = c.in.open(typ, payload); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if typ == recordTypeAlert {
+		if len(payload) == 2 && payload[1] == alertCloseNotify {
+			return 0, nil, io.EOF
+		}
+		if len(payload) == 2 {
+			return 0, nil, errors.New(fmt.Sprintf("tls; received alert %d", payload[1]))
+		}
+		return 0, nil, errors.New("tls; malformed alert")
+	}
+
+	return typ, payload, nil
+}
+
+func (c *pskConn) writeRecord(typ byte, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	for {
+		chunk := data[:min(len(data), maxPlaintext)]
+		data = data[len(chunk):]
+
+		payload := chunk
+		if c.out != nil {
+			payload = c.out.seal(typ, chunk)
+		}
+
+		record := []byte{typ}
+		record = binary.BigEndian.AppendUint16(record, versionTLS12)
+		record = binary.BigEndian.AppendUint16(record, uint16(len(payload)))
+		record = append(record, payload...)
+
+		if _, err := c.Conn.Write(record); err != nil {
+			return err
+		}
+
+		if len(data) == 0 {
+			return nil
+		}
+	}
+}
+
+func (c *pskConn) sendAlert(desc byte) {
+	level := byte(2) // fatal
+	if desc == alertCloseNotify {
+		level = 1
+	}
+	_ = c.writeRecord(recordTypeAlert, []byte{level, desc})
+}
+
+func (c *pskConn) Read(b []byte) (int, error) {
+	for len(c.input) == 0 {
+		typ, payload, err := c.readRecord()
+		if err != nil {
+			return 0, err
+		}
+
+		switch typ {
+		case recordTypeApplicationData:
+			c.input = payload
+		case recordTypeHandshake:
+			// renegotiation isn't supported, warning no_renegotiation
+			_ = c.writeRecord(recordTypeAlert, []byte{1, 100})
+		default:
+			return 0, errors.New(fmt.Sprintf("tls; unexpected record %d", typ))
+		}
+	}
+
+	n := copy(b, c.input)
+	c.input = c.input[n:]
+	return n, nil
+}
+
+func (c *pskConn) Write(b []byte) (int, error) {
+	if err := c.writeRecord(recordTypeApplicationData, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *pskConn) Close() error {
+	c.sendAlert(alertCloseNotify)
+	return c.Conn.Close()
+}
+
+// prf is TLS 1.2 pseudorandom function with SHA-256
+func prf(secret []byte, label string, seed []byte, size int) []byte {
+	seed = append([]byte(label), seed...)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(seed)
+	a := mac.Sum(nil)
+
+	out := make([]byte, 0, size+sha256.Size)
+	for len(out) < size {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		out = mac.Sum(out)
+
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+	}
+
+	return out[:size]
+}
+
+// masterSecret derives master secret from pre-shared key, RFC 4279 premaster
+// secret of plain PSK is zeros of key's length followed by the key
+func masterSecret(key, clientRandom, serverRandom []byte) []byte {
+	n := len(key)
+	premaster := binary.BigEndian.AppendUint16(nil, uint16(n))
+	premaster = append(premaster, make([]byte, n)...)
+	premaster = binary.BigEndian.AppendUint16(premaster, uint16(n))
+	premaster = append(premaster, key...)
+
+	return prf(premaster, "master secret", append(append([]byte{}, clientRandom...), serverRandom...), 48)
+}
+
+// keyExpansion derives write keys and implicit nonces of AES-128-GCM (RFC 5288)
+func keyExpansion(master, clientRandom, serverRandom []byte) (clientKey, serverKey, clientSalt, serverSalt []byte) {
+	keys := prf(master, "key expansion", append(append([]byte{}, serverRandom...), clientRandom...), 40)
+	return keys[0:16], keys[16:32], keys[32:36], keys[36:40]
+}
+
+// LoadPSK reads pre-shared key stored as hex string in keyFile, as Zabbix TLSPSKFile
+func LoadPSK(identity string, keyFile string) (*PSK, error) {
+	if identity == "" {
+		return nil, errors.New("PSK identity not specified")
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error while reading PSK file, error: %s", err))
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("PSK file doesn't contain hex string, error: %s", err))
+	}
+
+	if len(key) < 16 || len(key) > 256 {
+		return nil, errors.New("PSK must be between 32 and 512 hex digits")
+	}
+
+	return &PSK{Identity: identity, Key: key}, nil
+}
@@ -0,0 +1,674 @@
+package zbx
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TLS 1.2 PRF with SHA-256 vector published on the IETF TLS list
+// and used by other implementations, e.g. Go's crypto/tls
+func TestPRF(t *testing.T) {
+	secret := mustHex(t, "9bbe436ba940f017b17652849a71db35")
+	seed := mustHex(t, "a0ba9f936cda311827a6f796ffd5198c")
+	want := "e3f229ba727be17b8d122620557cd453c2aab21d07c3d495329b52d4e61edb5a" +
+		"6b301791e90d35c9c9a46b4e14baf9af0fa022f7077def17abfd3797c0564bab" +
+		"4fbc91666e9def9b97fce34f796789baa48082d122ee42c5a72e5a5110fff701" +
+		"87347b66"
+
+	if got := hex.EncodeToString(prf(secret, "test label", seed, 100)); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	// shorter output is prefix of longer one
+	if got := hex.EncodeToString(prf(secret, "test label", seed, 12)); got != want[:24] {
+		t.Errorf("got %s, want %s", got, want[:24])
+	}
+}
+
+// expected values are computed with OpenSSL's TLS1-PRF from RFC 4279 premaster
+// secret 0010 || 16 zero bytes || 0010 || key
+func TestMasterSecretAndKeyExpansion(t *testing.T) {
+	key := mustHex(t, "000102030405060708090a0b0c0d0e0f")
+	clientRandom := make([]byte, 32)
+	serverRandom := make([]byte, 32)
+	for i := range clientRandom {
+		clientRandom[i] = byte(i)
+		serverRandom[i] = byte(32 + i)
+	}
+
+	master := masterSecret(key, clientRandom, serverRandom)
+	want := "deb5ea0aabb5a89d2dbe02561ada3ced3ff6626813425bddaed85718423f4edd0b9ea64c8942ddd47e38d4f3c4ca710c"
+	if got := hex.EncodeToString(master); got != want {
+		t.Fatalf("got master secret %s, want %s", got, want)
+	}
+
+	clientKey, serverKey, clientSalt, serverSalt := keyExpansion(master, clientRandom, serverRandom)
+	for _, tt := range []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"client write key", clientKey, "565d09eb8509c48e14775b9a26c2b947"},
+		{"server write key", serverKey, "33f5e05b5838c0eae8f19fd69fe61bb9"},
+		{"client salt", clientSalt, "2a55285b"},
+		{"server salt", serverSalt, "889028de"},
+	} {
+		if got := hex.EncodeToString(tt.got); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHalfConnSealOpen(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 16)
+	salt := []byte{1, 2, 3, 4}
+	writer, _ := newHalfConn(key, salt)
+	reader, _ := newHalfConn(key, salt)
+
+	for _, msg := range []string{"first", "", "third"} {
+		got, err := reader.open(recordTypeApplicationData, writer.seal(recordTypeApplicationData, []byte(msg)))
+		if err != nil {
+			t.Fatalf("%q: %s", msg, err)
+		}
+		if string(got) != msg {
+			t.Errorf("got %q, want %q", got, msg)
+		}
+	}
+
+	record := writer.seal(recordTypeApplicationData, []byte("data"))
+
+	// record type is authenticated
+	if _, err := reader.open(recordTypeHandshake, record); err != errRecordAuthentication {
+		t.Errorf("record of other type: got %v, want %v", err, errRecordAuthentication)
+	}
+
+	tampered := append([]byte{}, record...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := reader.open(recordTypeApplicationData, tampered); err != errRecordAuthentication {
+		t.Errorf("tampered record: got %v, want %v", err, errRecordAuthentication)
+	}
+
+	// failed records don't advance sequence number, so the original still opens
+	if _, err := reader.open(recordTypeApplicationData, record); err != nil {
+		t.Errorf("original record: %s", err)
+	}
+
+	// replayed record has sequence number which was already used
+	if _, err := reader.open(recordTypeApplicationData, record); err != errRecordAuthentication {
+		t.Errorf("replayed record: got %v, want %v", err, errRecordAuthentication)
+	}
+
+	if _, err := reader.open(recordTypeApplicationData, record[:gcmExplicitNonceSize+gcmTagSize-1]); err == nil {
+		t.Error("expected error for record shorter than nonce and tag")
+	}
+}
+
+// clientHelloBody builds body of client hello message offering suites
+func clientHelloBody(version uint16, suites []uint16, extensions []byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, version)
+	body = append(body, make([]byte, 32)...)
+	body = append(body, 0)
+	body = binary.BigEndian.AppendUint16(body, uint16(2*len(suites)))
+	for _, s := range suites {
+		body = binary.BigEndian.AppendUint16(body, s)
+	}
+	body = append(body, 1, 0)
+	if extensions != nil {
+		body = binary.BigEndian.AppendUint16(body, uint16(len(extensions)))
+		body = append(body, extensions...)
+	}
+	return body
+}
+
+func TestParseClientHello(t *testing.T) {
+	renegotiation := []byte{0xff, 0x01, 0, 1, 0}
+	grease := []byte{0x0a, 0x0a, 0, 0}
+
+	tests := []struct {
+		name          string
+		hello         []byte
+		offersPSK     bool
+		renegotiation bool
+	}{
+		{"psk suite", clientHelloBody(versionTLS12, []uint16{0x00a8}, nil), true, false},
+		{"other suites", clientHelloBody(versionTLS12, []uint16{0xc02f, 0x009c}, nil), false, false},
+		{"scsv", clientHelloBody(versionTLS12, []uint16{0x00a8, 0x00ff}, nil), true, true},
+		{"renegotiation extension", clientHelloBody(versionTLS12, []uint16{0x00a8}, append(grease, renegotiation...)), true, true},
+		{"empty extensions", clientHelloBody(versionTLS12, []uint16{0x00a8}, []byte{}), true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, err := parseClientHello(tt.hello)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if ch.version != versionTLS12 || len(ch.random) != 32 {
+				t.Errorf("got version %x, random %x", ch.version, ch.random)
+			}
+			if ch.offersPSK != tt.offersPSK || ch.renegotiation != tt.renegotiation {
+				t.Errorf("got offersPSK %v, renegotiation %v, want %v, %v", ch.offersPSK, ch.renegotiation, tt.offersPSK, tt.renegotiation)
+			}
+		})
+	}
+}
+
+func TestParseClientHelloMalformed(t *testing.T) {
+	valid := clientHelloBody(versionTLS12, []uint16{0x00a8}, []byte{0xff, 0x01, 0, 1, 0})
+
+	// offsets in valid: version 0, random 2, session id length 34,
+	// suites length 35, suites 37, compression 39, extensions 41
+	oddSuites := append([]byte{}, valid...)
+	oddSuites[36] = 3
+	longSession := append([]byte{}, valid...)
+	longSession[34] = 200
+	longCompression := append([]byte{}, valid...)
+	longCompression[39] = 10
+	longExtension := append([]byte{}, valid...)
+	longExtension[len(longExtension)-2] = 9
+
+	tests := map[string][]byte{
+		"empty":                      {},
+		"version only":               valid[:2],
+		"truncated random":           valid[:30],
+		"missing session id":         valid[:34],
+		"missing suites":             valid[:35],
+		"truncated suites":           valid[:38],
+		"missing compression":        valid[:39],
+		"odd suites length":          oddSuites,
+		"session id beyond hello":    longSession,
+		"compression beyond hello":   longCompression,
+		"extension beyond extension": longExtension,
+	}
+
+	for name, hello := range tests {
+		t.Run(name, func(t *testing.T) {
+			if ch, err := parseClientHello(hello); err == nil {
+				t.Errorf("expected error, got %+v", ch)
+			}
+		})
+	}
+}
+
+// pskTestClient is minimal client side of TLS_PSK_WITH_AES_128_GCM_SHA256
+type pskTestClient struct {
+	conn       net.Conn
+	transcript hash.Hash
+	in         *halfConn
+	out        *halfConn
+}
+
+func newPSKTestClient(conn net.Conn) *pskTestClient {
+	return &pskTestClient{conn: conn, transcript: sha256.New()}
+}
+
+func (c *pskTestClient) writeRecord(typ byte, data []byte) error {
+	if c.out != nil {
+		data = c.out.seal(typ, data)
+	}
+	record := []byte{typ}
+	record = binary.BigEndian.AppendUint16(record, versionTLS12)
+	record = binary.BigEndian.AppendUint16(record, uint16(len(data)))
+	_, err := c.conn.Write(append(record, data...))
+	return err
+}
+
+// readRecord returns next record, alerts are returned as errors with their description
+func (c *pskTestClient) readRecord() (byte, []byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[3:]))
+	if _, err := io.ReadFull(c.conn, payload); err != nil {
+		return 0, nil, err
+	}
+
+	if c.in != nil {
+		var err error
+		if payload, err = c.in.open(header[0], payload); err != nil {
+			return 0, nil, err
+		}
+	}
+	if header[0] == recordTypeAlert {
+		return 0, nil, alertError(payload[1])
+	}
+	return header[0], payload, nil
+}
+
+type alertError byte
+
+func (e alertError) Error() string {
+	return fmt.Sprintf("alert %d", byte(e))
+}
+
+func (c *pskTestClient) handshakeMessage(typ byte, body []byte) []byte {
+	msg := append([]byte{typ, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+	c.transcript.Write(msg)
+	return msg
+}
+
+func (c *pskTestClient) handshake(identity string, key []byte) error {
+	hello := clientHelloBody(versionTLS12, []uint16{0xc02f, suitePSKWithAES128GCMSHA256, suiteEmptyRenegotiationInfo}, nil)
+	clientRandom := hello[2:34]
+	rand.Read(clientRandom)
+
+	if err := c.writeRecord(recordTypeHandshake, c.handshakeMessage(handshakeTypeClientHello, hello)); err != nil {
+		return err
+	}
+
+	typ, flight, err := c.readRecord()
+	if err != nil {
+		return err
+	}
+	if typ != recordTypeHandshake || len(flight) < 4 || flight[0] != handshakeTypeServerHello {
+		return errors.New("expected server hello")
+	}
+	size := int(flight[1])<<16 | int(flight[2])<<8 | int(flight[3])
+	serverHello, done := flight[:4+size], flight[4+size:]
+	if !bytes.Equal(done, []byte{handshakeTypeServerHelloDone, 0, 0, 0}) {
+		return errors.New("expected server hello done")
+	}
+	if binary.BigEndian.Uint16(serverHello[4+2+32+1:]) != suitePSKWithAES128GCMSHA256 {
+		return errors.New("server selected other ciphersuite")
+	}
+	c.transcript.Write(flight)
+	serverRandom := serverHello[6:38]
+
+	keyExchange := binary.BigEndian.AppendUint16(nil, uint16(len(identity)))
+	keyExchange = append(keyExchange, identity...)
+	if err := c.writeRecord(recordTypeHandshake, c.handshakeMessage(handshakeTypeClientKeyExchange, keyExchange)); err != nil {
+		return err
+	}
+
+	master := masterSecret(key, clientRandom, serverRandom)
+	clientKey, serverKey, clientSalt, serverSalt := keyExpansion(master, clientRandom, serverRandom)
+
+	if err := c.writeRecord(recordTypeChangeCipherSpec, []byte{1}); err != nil {
+		return err
+	}
+	c.out, _ = newHalfConn(clientKey, clientSalt)
+
+	verify := prf(master, "client finished", c.transcript.Sum(nil), verifyDataSize)
+	if err := c.writeRecord(recordTypeHandshake, c.handshakeMessage(handshakeTypeFinished, verify)); err != nil {
+		return err
+	}
+
+	if typ, _, err := c.readRecord(); err != nil {
+		return err
+	} else if typ != recordTypeChangeCipherSpec {
+		return errors.New(fmt.Sprintf("expected change cipher spec, got record %d", typ))
+	}
+	c.in, _ = newHalfConn(serverKey, serverSalt)
+
+	expected := prf(master, "server finished", c.transcript.Sum(nil), verifyDataSize)
+	typ, finished, err := c.readRecord()
+	if err != nil {
+		return err
+	}
+	if typ != recordTypeHandshake || !bytes.Equal(finished, append([]byte{handshakeTypeFinished, 0, 0, verifyDataSize}, expected...)) {
+		return errors.New("server finished verification failed")
+	}
+
+	return nil
+}
+
+var testPSK = &PSK{Identity: "zcm", Key: bytes.Repeat([]byte{0xab}, 32)}
+
+// startPSKServer accepts single connection, performs handshake on it
+// and passes it to serve, handshake error is sent to returned channel
+func startPSKServer(t *testing.T, serve func(net.Conn)) (net.Conn, <-chan error) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		c, err := pskServer(conn, testPSK)
+		errs <- err
+		if err == nil && serve != nil {
+			serve(c)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, errs
+}
+
+func TestPSKHandshakeRoundTrip(t *testing.T) {
+	received := make(chan []byte, 1)
+	conn, errs := startPSKServer(t, func(c net.Conn) {
+		defer c.Close()
+
+		// echo messages until client closes with close_notify
+		var all []byte
+		buf := make([]byte, 4096)
+		for {
+			n, err := c.Read(buf)
+			if err != nil {
+				received <- all
+				return
+			}
+			all = append(all, buf[:n]...)
+			if _, err := c.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+	})
+
+	client := newPSKTestClient(conn)
+	if err := client.handshake(testPSK.Identity, testPSK.Key); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("server handshake failed: %s", err)
+	}
+
+	// larger message than maximum plaintext is split across records
+	message := bytes.Repeat([]byte("ZBXD zcm.version "), 2000)
+	for off := 0; off < len(message); off += maxPlaintext {
+		if err := client.writeRecord(recordTypeApplicationData, message[off:min(off+maxPlaintext, len(message))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var echoed []byte
+	for len(echoed) < len(message) {
+		typ, data, err := client.readRecord()
+		if err != nil {
+			t.Fatalf("reading echo: %s", err)
+		}
+		if typ != recordTypeApplicationData || len(data) > maxPlaintext {
+			t.Fatalf("got record %d of %d bytes", typ, len(data))
+		}
+		echoed = append(echoed, data...)
+	}
+	if !bytes.Equal(echoed, message) {
+		t.Error("echoed data differs")
+	}
+
+	if err := client.writeRecord(recordTypeAlert, []byte{1, alertCloseNotify}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; !bytes.Equal(got, message) {
+		t.Errorf("server received %d bytes, want %d", len(got), len(message))
+	}
+	if _, _, err := client.readRecord(); err != alertError(alertCloseNotify) {
+		t.Errorf("expected close_notify from server, got %v", err)
+	}
+}
+
+func TestPSKHandshakeRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity string
+		key      []byte
+		alert    alertError
+		err      string
+	}{
+		{"wrong key", testPSK.Identity, bytes.Repeat([]byte{0xac}, 32), alertError(alertDecryptError), "PSK doesn't match"},
+		{"shorter key", testPSK.Identity, testPSK.Key[:16], alertError(alertDecryptError), "PSK doesn't match"},
+		{"unknown identity", "other", testPSK.Key, alertError(alertUnknownPSKIdentity), "unknown PSK identity \"other\""},
+		{"empty identity", "", testPSK.Key, alertError(alertUnknownPSKIdentity), "unknown PSK identity"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, errs := startPSKServer(t, nil)
+
+			err := newPSKTestClient(conn).handshake(tt.identity, tt.key)
+			if err != tt.alert {
+				t.Errorf("client got %v, want %v", err, tt.alert)
+			}
+			if err := <-errs; err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("server got %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPSKHandshakeInvalidClientHello(t *testing.T) {
+	message := func(body []byte) []byte {
+		return append([]byte{handshakeTypeClientHello, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	}
+
+	tests := []struct {
+		name   string
+		record []byte
+		alert  alertError
+	}{
+		{"truncated body", message(clientHelloBody(versionTLS12, []uint16{0x00a8}, nil)[:20]), 0},
+		{"malformed suites", message(clientHelloBody(versionTLS12, []uint16{0x00a8}, nil)[:36]), 0},
+		{"without psk suite", message(clientHelloBody(versionTLS12, []uint16{0xc02f}, nil)), alertError(alertHandshakeFailure)},
+		{"tls 1.0", message(clientHelloBody(0x0301, []uint16{0x00a8}, nil)), alertError(alertProtocolVersion)},
+		{"other message", append([]byte{handshakeTypeClientKeyExchange, 0, 0, 2}, 0, 0), alertError(alertHandshakeFailure)},
+		// message length claims more than is sent before connection is closed
+		{"truncated message", message(clientHelloBody(versionTLS12, []uint16{0x00a8}, nil))[:30], 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, errs := startPSKServer(t, nil)
+			client := newPSKTestClient(conn)
+
+			if err := client.writeRecord(recordTypeHandshake, tt.record); err != nil {
+				t.Fatal(err)
+			}
+			if tt.alert == 0 {
+				conn.(*net.TCPConn).CloseWrite()
+			}
+
+			if err := <-errs; err == nil {
+				t.Error("expected handshake error")
+			}
+			if _, _, err := client.readRecord(); tt.alert != 0 && err != tt.alert {
+				t.Errorf("got %v, want %v", err, tt.alert)
+			}
+		})
+	}
+}
+
+func TestPSKBadRecordLength(t *testing.T) {
+	t.Run("record larger than maximum", func(t *testing.T) {
+		conn, errs := startPSKServer(t, nil)
+
+		conn.Write(binary.BigEndian.AppendUint16([]byte{recordTypeHandshake, 3, 3}, maxRecord+1))
+		if err := <-errs; err == nil || !strings.Contains(err.Error(), "record too large") {
+			t.Errorf("got %v, want record too large", err)
+		}
+	})
+
+	t.Run("handshake message larger than maximum", func(t *testing.T) {
+		conn, errs := startPSKServer(t, nil)
+
+		// ClientHello announcing 16 MiB, only its header is sent
+		header := []byte{handshakeTypeClientHello, 0xff, 0xff, 0xff}
+		conn.Write(append([]byte{recordTypeHandshake, 3, 3, 0, byte(len(header))}, header...))
+		if err := <-errs; err == nil || !strings.Contains(err.Error(), "limit is 8192") {
+			t.Errorf("got %v, want handshake message limit", err)
+		}
+		alert := make([]byte, 7)
+		if _, err := io.ReadFull(conn, alert); err != nil || alert[0] != recordTypeAlert || alert[6] != alertDecodeError {
+			t.Errorf("got %v %x, want decode error alert", err, alert)
+		}
+	})
+
+	t.Run("record shorter than its length", func(t *testing.T) {
+		conn, errs := startPSKServer(t, nil)
+
+		conn.Write([]byte{recordTypeHandshake, 3, 3, 0, 100, 1, 0})
+		conn.(*net.TCPConn).CloseWrite()
+		if err := <-errs; err != io.ErrUnexpectedEOF {
+			t.Errorf("got %v, want %v", err, io.ErrUnexpectedEOF)
+		}
+	})
+
+	for _, tt := range []struct {
+		name   string
+		record func(c *pskTestClient) []byte
+	}{
+		{"encrypted record shorter than nonce and tag", func(c *pskTestClient) []byte {
+			return make([]byte, gcmExplicitNonceSize+gcmTagSize-1)
+		}},
+		{"encrypted record with wrong length", func(c *pskTestClient) []byte {
+			return c.out.seal(recordTypeApplicationData, []byte("data"))[:20]
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			readErr := make(chan error, 1)
+			conn, errs := startPSKServer(t, func(c net.Conn) {
+				_, err := c.Read(make([]byte, 16))
+				readErr <- err
+			})
+
+			client := newPSKTestClient(conn)
+			if err := client.handshake(testPSK.Identity, testPSK.Key); err != nil {
+				t.Fatalf("handshake failed: %s", err)
+			}
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+
+			payload := tt.record(client)
+			record := []byte{recordTypeApplicationData, 3, 3, 0, byte(len(payload))}
+			conn.Write(append(record, payload...))
+
+			if err := <-readErr; err == nil {
+				t.Error("expected error of invalid record")
+			}
+		})
+	}
+}
+
+// TestPSKOpenSSLInterop runs passive check through openssl s_client, with
+// the right key and with wrong one which has to fail the handshake,
+// it's skipped when openssl isn't installed
+func TestPSKOpenSSLInterop(t *testing.T) {
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl not found")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	server := &Server{
+		Addresses: []string{address},
+		Handler:   ItemHandler(func(key string) (interface{}, error) { return "value of " + key, nil }),
+		PSK:       testPSK,
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.ListenAndServe(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("server isn't listening")
+		}
+	}
+
+	var request bytes.Buffer
+	writePacket(&request, []byte(`{"request":"passive checks","data":[{"key":"zcm.version","timeout":3}]}`), false)
+	input := filepath.Join(t.TempDir(), "request")
+	if err := os.WriteFile(input, request.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := os.Open(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+
+	runClient := func(key []byte) ([]byte, error) {
+		if _, err := stdin.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, openssl, "s_client", "-connect", address, "-tls1_2",
+			"-cipher", "PSK-AES128-GCM-SHA256", "-psk_identity", testPSK.Identity, "-psk", hex.EncodeToString(key),
+			"-quiet", "-ign_eof")
+		cmd.Stdin = stdin
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return out, errors.New(fmt.Sprintf("%s: %s", err, stderr.String()))
+		}
+		return out, nil
+	}
+
+	out, err := runClient(testPSK.Key)
+	if err != nil {
+		t.Fatalf("openssl failed: %s", err)
+	}
+	data, _, err := readPacket(bytes.NewReader(out), 0)
+	if err != nil {
+		t.Fatalf("invalid response %q: %s", out, err)
+	}
+	if !strings.Contains(string(data), `"value":"value of zcm.version"`) {
+		t.Errorf("unexpected response %s", data)
+	}
+
+	wrongKey := bytes.Clone(testPSK.Key)
+	wrongKey[0] ^= 1
+	if out, err := runClient(wrongKey); err == nil || len(out) != 0 {
+		t.Errorf("handshake with wrong key succeeded, got %q", out)
+	}
+}
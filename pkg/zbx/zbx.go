@@ -0,0 +1,455 @@
+package zbx
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	protocol      = "ZBXD"
+	flag     byte = 0x01
+
+	protocolSize = 4
+	flagSize     = 1
+	datalenSize  = 4
+	reservedSize = 4
+
+	handshakeTimeout = 10 * time.Second
+
+	// defaults of limits of passive connections
+	defaultReadTimeout    = 10 * time.Second
+	defaultWriteTimeout   = 10 * time.Second
+	defaultMaxRequestSize = 1 << 20
+
+	// shutdownTimeout bounds waiting for open connections on shutdown
+	shutdownTimeout = 5 * time.Second
+)
+
+type serverRequest struct {
+	Request string              `json:"request"`
+	Data    []serverRequestData `json:"data"`
+}
+
+type serverRequestData struct {
+	Key     string `json:"key"`
+	Timeout int    `json:"timeout"`
+}
+
+// Handler answers items requested by Zabbix in passive and active checks
+type Handler interface {
+	// Item returns value of item with given key, error is reported
+	// to Zabbix as reason why item is not supported
+	Item(key string) (interface{}, error)
+}
+
+// ItemHandler is function used as Handler
+type ItemHandler func(itemKey string) (interface{}, error)
+
+func (f ItemHandler) Item(key string) (interface{}, error) {
+	return f(key)
+}
+
+// Server is passive Zabbix agent, it answers item requests of Zabbix
+// server or proxy. Zero values of optional fields use defaults.
+type Server struct {
+	// Addresses are host:port pairs listened at, IPv6 hosts in brackets
+	Addresses []string
+	Handler   Handler
+
+	// PSK enables connections encrypted with TLS-PSK
+	PSK *PSK
+	// TLS enables connections encrypted with certificates
+	TLS *tls.Config
+	// RequireEncryption rejects unencrypted connections
+	RequireEncryption bool
+	// AllowedPeers limits incoming connections to given IPs, CIDR ranges
+	// and host names, all peers are allowed when empty
+	AllowedPeers []string
+
+	// ReadTimeout bounds reading request after connection is established,
+	// so idle or stalled peer doesn't hold connection, default 10s
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing response, default 10s
+	WriteTimeout time.Duration
+	// MaxRequestSize is maximum size of request data in bytes, also after
+	// decompression, larger requests are rejected, default 1 MiB
+	MaxRequestSize int
+
+	// Logger receives connection errors and debug messages of passive checks,
+	// default logger with component=zbx attribute when nil
+	Logger *slog.Logger
+
+	peers *peerAllowlist
+	conns sync.WaitGroup
+}
+
+// logger returns l or default logger of package when l is nil, default
+// logger is looked up on every call, so it follows slog.SetDefault
+func logger(l *slog.Logger) *slog.Logger {
+	if l != nil {
+		return l
+	}
+	return slog.Default().With("component", "zbx")
+}
+
+// ListenAndServe runs passive agent with default options on address
+func ListenAndServe(ctx context.Context, address string, handler Handler) error {
+	s := &Server{Addresses: []string{address}, Handler: handler}
+	return s.ListenAndServe(ctx)
+}
+
+// ListenAndServe accepts connections until ctx is cancelled, then it stops
+// listening and waits up to shutdownTimeout for open connections to finish
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if s.RequireEncryption && s.PSK == nil && s.TLS == nil {
+		return errors.New("encryption required but neither PSK nor certificate is configured")
+	}
+
+	if s.ReadTimeout <= 0 {
+		s.ReadTimeout = defaultReadTimeout
+	}
+	if s.WriteTimeout <= 0 {
+		s.WriteTimeout = defaultWriteTimeout
+	}
+	if s.MaxRequestSize <= 0 {
+		s.MaxRequestSize = defaultMaxRequestSize
+	}
+
+	if len(s.AllowedPeers) > 0 {
+		peers, err := parsePeers(s.AllowedPeers)
+		if err != nil {
+			return err
+		}
+		s.peers = peers
+	}
+
+	listeners := make([]net.Listener, 0, len(s.Addresses))
+	closeListeners := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+	defer closeListeners()
+
+	for _, address := range s.Addresses {
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+
+	stop := context.AfterFunc(ctx, closeListeners)
+	defer stop()
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func() { errs <- s.serve(ctx, l) }()
+	}
+
+	// listener which fails stops the others too
+	var err error
+	for range listeners {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+			closeListeners()
+		}
+	}
+
+	if ctx.Err() != nil {
+		s.waitConns()
+	}
+	return err
+}
+
+// serve accepts connections of listener until it's closed,
+// it returns nil when it was closed because ctx is cancelled
+func (s *Server) serve(ctx context.Context, l net.Listener) error {
+	var tempDelay time.Duration // how long to sleep on accept failure
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+
+			if tempDelay == 0 {
+				tempDelay = 5 * time.Millisecond
+			} else {
+				tempDelay *= 2
+			}
+			if max := 1 * time.Second; tempDelay > max {
+				tempDelay = max
+			}
+			logger(s.Logger).Error("accept error", "err", err, "retry", tempDelay)
+			time.Sleep(tempDelay)
+			continue
+		}
+
+		s.conns.Add(1)
+		go func() {
+			defer s.conns.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+func (s *Server) waitConns() {
+	done := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		logger(s.Logger).Warn("connections still open, leaving them", "timeout", shutdownTimeout)
+	}
+}
+
+// serveConn detects whether connection is encrypted by its first byte,
+// plain connections start with protocol header, TLS ones with handshake record
+func (s *Server) serveConn(conn net.Conn) {
+	if s.peers != nil && !s.peers.allows(conn.RemoteAddr()) {
+		logger(s.Logger).Warn("connection rejected, peer not allowed", "remote", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
+	// buffer fits whole TLS record to peek at client hello
+	br := bufio.NewReaderSize(conn, recordHeaderSize+maxRecord)
+	c := net.Conn(&bufferedConn{Conn: conn, r: br})
+
+	// idle peer which doesn't send anything is closed after read timeout
+	conn.SetDeadline(time.Now().Add(s.ReadTimeout))
+	first, err := br.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	if first[0] == recordTypeHandshake && (s.PSK != nil || s.TLS != nil) {
+		conn.SetDeadline(time.Now().Add(handshakeTimeout))
+		usePSK := s.TLS == nil
+		if s.PSK != nil && s.TLS != nil {
+			// Zabbix offers only PSK ciphersuites when connecting with PSK
+			ch, err := peekClientHello(br)
+			if err != nil {
+				logger(s.Logger).Warn("invalid client hello", "remote", conn.RemoteAddr(), "err", err)
+				conn.Close()
+				return
+			}
+			usePSK = ch.offersPSK
+		}
+
+		if usePSK {
+			c, err = pskServer(c, s.PSK)
+		} else {
+			tc := tls.Server(c, s.TLS)
+			c, err = tc, tc.Handshake()
+		}
+
+		if err != nil {
+			logger(s.Logger).Warn("tls handshake error", "remote", conn.RemoteAddr(), "err", err)
+			conn.Close()
+			return
+		}
+	} else if s.RequireEncryption {
+		logger(s.Logger).Warn("unencrypted connection rejected", "remote", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
+	s.handleConn(c)
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// handleConn answers every item of passive check request, results
+// are returned in the same order as items were requested. Reading request
+// and writing response are bounded by server's timeouts, items are not.
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(s.ReadTimeout))
+	req, compressed, err := decode(conn, uint32(s.MaxRequestSize))
+	if err != nil {
+		logger(s.Logger).Warn("decoding error", "remote", conn.RemoteAddr(), "err", err)
+		return
+	}
+	if len(req.Data) == 0 {
+		logger(s.Logger).Warn("decoding error", "remote", conn.RemoteAddr(), "err", "request doesn't contain any item")
+		return
+	}
+
+	// single item, the usual case, doesn't allocate results
+	var single [1]itemResult
+	results := single[:0]
+	if len(req.Data) > 1 {
+		results = make([]itemResult, 0, len(req.Data))
+	}
+
+	// items may take longer than peer takes to send request
+	conn.SetDeadline(time.Time{})
+
+	for _, d := range req.Data {
+		logger(s.Logger).Debug("passive check", "remote", conn.RemoteAddr(), "key", d.Key)
+		value, err := s.Handler.Item(d.Key)
+		results = append(results, itemResult{value: value, err: err})
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	encoded, err := appendResponse(*buf, results)
+	if err != nil {
+		logger(s.Logger).Error("encoding error", "remote", conn.RemoteAddr(), "items", len(req.Data), "err", err)
+		return
+	}
+	*buf = encoded
+
+	// peer which sent compressed request accepts compressed response
+	if compressed && len(encoded)-headerSize >= compressThreshold {
+		encoded, err = compressPacket(nil, encoded)
+		if err != nil {
+			logger(s.Logger).Error("encoding error", "remote", conn.RemoteAddr(), "items", len(req.Data), "err", err)
+			return
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(s.WriteTimeout))
+	if _, err := conn.Write(encoded); err != nil {
+		logger(s.Logger).Warn("response error", "remote", conn.RemoteAddr(), "items", len(req.Data), "err", err)
+	}
+}
+
+func readHeader(r io.Reader, what string, size uint32) ([]byte, error) {
+	buf := make([]byte, size)
+
+	if n, err := io.ReadFull(r, buf); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, errors.New(fmt.Sprintf("error while reading %s; error: %s", what, err))
+	} else if uint32(n) < size {
+		return nil, errors.New(
+			fmt.Sprintf(
+				"error while reading %s, error: %s",
+				what, io.ErrUnexpectedEOF.Error(),
+			),
+		)
+	}
+
+	return buf, nil
+}
+
+// decode reads request of passive check and reports whether it was compressed
+func decode(r io.Reader, maxSize uint32) (*serverRequest, bool, error) {
+	b, compressed, err := readPacket(r, maxSize)
+	if err != nil {
+		return nil, false, err
+	}
+
+	req := &serverRequest{}
+	err = json.Unmarshal(b, req)
+
+	return req, compressed, err
+}
+
+// readPacket reads single packet and returns its data, decompressed
+// when packet is compressed. Packets with data larger than maxSize are
+// rejected before reading data, 0 means no limit.
+func readPacket(r io.Reader, maxSize uint32) ([]byte, bool, error) {
+	b, err := readHeader(r, "protocol", protocolSize)
+	if err != nil {
+		return nil, false, err
+	}
+
+	headerProtocol := string(b[:])
+	if headerProtocol != protocol {
+		return nil, false, errors.New(fmt.Sprintf("Unsupported protocol '%s'", headerProtocol))
+	}
+
+	b, err = readHeader(r, "flag", flagSize)
+	if err != nil {
+		return nil, false, err
+	}
+
+	headerFlag := b[0]
+	if headerFlag != flag && headerFlag != flag|flagCompressed {
+		return nil, false, errors.New(fmt.Sprintf("Unsupported flag %x", headerFlag))
+	}
+	compressed := headerFlag&flagCompressed != 0
+
+	b, err = readHeader(r, "data length", datalenSize)
+	if err != nil {
+		return nil, false, err
+	}
+
+	dataLen := binary.LittleEndian.Uint32(b)
+
+	b, err = readHeader(r, "reserved bytes", reservedSize)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// reserved bytes of compressed packet carry length of uncompressed data
+	uncompressedLen := binary.LittleEndian.Uint32(b)
+
+	if maxSize > 0 && (dataLen > maxSize || (compressed && uncompressedLen > maxSize)) {
+		size := dataLen
+		if compressed && uncompressedLen > size {
+			size = uncompressedLen
+		}
+		return nil, false, errors.New(fmt.Sprintf("packet data has %d bytes, limit is %d", size, maxSize))
+	}
+
+	data, err := readHeader(r, "data", dataLen)
+	if err != nil || !compressed {
+		return data, false, err
+	}
+
+	data, err = inflate(data, uncompressedLen)
+	return data, true, err
+}
+
+// writePacket wraps data with protocol header and writes it,
+// data is compressed when compress is set and data isn't small
+func writePacket(w io.Writer, data []byte, compress bool) error {
+	packet := make([]byte, 0, headerSize+len(data))
+	packet = append(packet, protocol...)
+	packet = append(packet, flag)
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(len(data)))
+	packet = binary.LittleEndian.AppendUint32(packet, 0)
+	packet = append(packet, data...)
+
+	if compress && len(data) >= compressThreshold {
+		var err error
+		if packet, err = compressPacket(nil, packet); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(packet)
+	return err
+}
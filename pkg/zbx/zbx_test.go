@@ -0,0 +1,218 @@
+package zbx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type passiveResponse struct {
+	Version string `json:"version"`
+	Variant int    `json:"variant"`
+	Data    []struct {
+		Value interface{} `json:"value"`
+		Error *string     `json:"error"`
+	} `json:"data"`
+}
+
+// passiveCheck passes request to handleConn of server over pipe
+// and returns raw response
+func passiveCheck(t testing.TB, s *Server, request []byte, compress bool) []byte {
+	t.Helper()
+
+	if s.Logger == nil {
+		s.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	s.ReadTimeout, s.WriteTimeout, s.MaxRequestSize = time.Second, time.Second, defaultMaxRequestSize
+
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.handleConn(server)
+		close(done)
+	}()
+	defer func() {
+		client.Close()
+		<-done
+	}()
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := writePacket(client, request, compress); err != nil {
+		t.Fatal(err)
+	}
+	response, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func testItemHandler(key string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(key, "fail"):
+		return nil, errors.New("cannot evaluate " + key)
+	case strings.HasPrefix(key, "num"):
+		return 1.5, nil
+	case key == "nil":
+		return nil, nil
+	}
+	return "value of " + key, nil
+}
+
+func TestPassiveRequestWithMultipleKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []string
+		values []interface{}
+		errors []string
+	}{
+		{"single key", []string{"a"}, []interface{}{"value of a"}, []string{""}},
+		{
+			"keys answered in order",
+			[]string{"c", "a", "num.b", "a"},
+			[]interface{}{"value of c", "value of a", 1.5, "value of a"},
+			[]string{"", "", "", ""},
+		},
+		{
+			"errors of single items",
+			[]string{"a", "fail.x", "num", "fail[\"y,z\"]"},
+			[]interface{}{"value of a", nil, 1.5, nil},
+			[]string{"", "cannot evaluate fail.x", "", "cannot evaluate fail[\"y,z\"]"},
+		},
+		{"nil value", []string{"nil", "a"}, []interface{}{nil, "value of a"}, []string{"", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, compress := range []bool{false, true} {
+				items := make([]serverRequestData, len(tt.keys))
+				for i, key := range tt.keys {
+					items[i] = serverRequestData{Key: key, Timeout: 3}
+				}
+				request, _ := json.Marshal(serverRequest{Request: "passive checks", Data: items})
+				// compressed request is compressed only when it's long enough
+				if compress {
+					request = append(request[:len(request)-1], []byte(`,"padding":"`+strings.Repeat("x", compressThreshold)+`"}`)...)
+				}
+
+				s := &Server{Handler: ItemHandler(testItemHandler)}
+				data, _, err := readPacket(bytes.NewReader(passiveCheck(t, s, request, compress)), 0)
+				if err != nil {
+					t.Fatalf("invalid response: %s", err)
+				}
+
+				res := passiveResponse{}
+				if err := json.Unmarshal(data, &res); err != nil {
+					t.Fatalf("invalid response %s: %s", data, err)
+				}
+				if res.Version == "" || len(res.Data) != len(tt.keys) {
+					t.Fatalf("got response %s", data)
+				}
+
+				var values []interface{}
+				var errs []string
+				for _, d := range res.Data {
+					values = append(values, d.Value)
+					if d.Error != nil {
+						errs = append(errs, *d.Error)
+					} else {
+						errs = append(errs, "")
+					}
+				}
+				if !reflect.DeepEqual(values, tt.values) {
+					t.Errorf("got values %v, want %v", values, tt.values)
+				}
+				if !reflect.DeepEqual(errs, tt.errors) {
+					t.Errorf("got errors %q, want %q", errs, tt.errors)
+				}
+			}
+		})
+	}
+}
+
+func TestPassiveRequestInvalid(t *testing.T) {
+	var keys []string
+	s := &Server{Handler: ItemHandler(func(key string) (interface{}, error) {
+		keys = append(keys, key)
+		return 1, nil
+	})}
+
+	for _, request := range []string{
+		`{"request":"passive checks","data":[]}`,
+		`{"request":"passive checks"}`,
+		`{"request":"passive checks","data":[{"key":"a"}`,
+		`zcm.version`,
+	} {
+		if response := passiveCheck(t, s, []byte(request), false); len(response) != 0 {
+			t.Errorf("%s: expected no response, got %q", request, response)
+		}
+	}
+	if len(keys) != 0 {
+		t.Errorf("handler was called for %q", keys)
+	}
+}
+
+// benchmarkRequest returns request of passive check with 10 items
+func benchmarkRequest(b *testing.B) []byte {
+	items := make([]serverRequestData, 10)
+	for i := range items {
+		items[i] = serverRequestData{Key: fmt.Sprintf("num.target-%d.responseTime", i), Timeout: 3}
+	}
+	request, err := json.Marshal(serverRequest{Request: "passive checks", Data: items})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return request
+}
+
+func BenchmarkDecode(b *testing.B) {
+	request := benchmarkRequest(b)
+
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := writePacket(&buf, request, false); err != nil {
+			b.Fatal(err)
+		}
+		packet := buf.Bytes()
+		// request is below threshold of writePacket, so it's compressed here
+		if compress {
+			var err error
+			if packet, err = compressPacket(nil, packet); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.Run(fmt.Sprintf("compressed=%t", compress), func(b *testing.B) {
+			b.SetBytes(int64(len(packet)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := decode(bytes.NewReader(packet), defaultMaxRequestSize); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkPassiveRequest measures whole passive check, decoding request,
+// dispatching its items and encoding response
+func BenchmarkPassiveRequest(b *testing.B) {
+	request := benchmarkRequest(b)
+	s := &Server{Handler: ItemHandler(testItemHandler)}
+
+	b.SetBytes(int64(headerSize + len(request)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if response := passiveCheck(b, s, request, false); !bytes.Contains(response, []byte(`"value":1.5`)) {
+			b.Fatalf("unexpected response: %q", response)
+		}
+	}
+}